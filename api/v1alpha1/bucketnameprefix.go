@@ -0,0 +1,25 @@
+package v1alpha1
+
+import "regexp"
+
+// AnnotationBucketNamePrefix on a Namespace requires the bucket names of the
+// claims in it to start with its value, e.g. team-a-
+const AnnotationBucketNamePrefix = "quobject.io/bucket-name-prefix"
+
+// bucketNamePrefixPattern leaves the prefix enough room for a name and the
+// random suffix within the 63 characters of a bucket name
+var bucketNamePrefixPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{0,39}$`)
+
+// BucketNamePrefix returns the bucket name prefix required by a namespace
+// with the given annotations, if any. ok is false for a malformed prefix,
+// which is not enforced.
+func BucketNamePrefix(annotations map[string]string) (prefix string, ok bool) {
+	prefix = annotations[AnnotationBucketNamePrefix]
+	if prefix == "" {
+		return "", true
+	}
+	if !bucketNamePrefixPattern.MatchString(prefix) {
+		return "", false
+	}
+	return prefix, true
+}
@@ -0,0 +1,79 @@
+package v1alpha1
+
+// AnnotationClaimClassApplied records the QuObjectBucketClaimClass whose
+// settings were copied into a claim. Classes are applied once, so changing
+// a class only affects the claims created afterwards.
+const AnnotationClaimClassApplied = "quobject.io/claim-class-applied"
+
+// ApplyClaimClass copies the settings of class into the fields the claim
+// leaves unset, and the class labels into the labels it does not carry.
+// It reports whether the claim changed.
+func ApplyClaimClass(claim *QuObjectBucketClaim, class *QuObjectBucketClaimClass) bool {
+	spec := &claim.Spec
+	defaults := class.Spec
+	changed := false
+	if spec.StorageClassName == "" && defaults.StorageClassName != "" {
+		spec.StorageClassName = defaults.StorageClassName
+		changed = true
+	}
+	if spec.Region == "" && defaults.Region != "" {
+		spec.Region = defaults.Region
+		changed = true
+	}
+	if spec.RetainPolicy == "" && defaults.RetainPolicy != "" {
+		spec.RetainPolicy = defaults.RetainPolicy
+		changed = true
+	}
+	if spec.Credentials == nil && defaults.Credentials != nil {
+		spec.Credentials = defaults.Credentials.DeepCopy()
+		changed = true
+	}
+	if spec.Resources == nil && defaults.Resources != nil {
+		spec.Resources = defaults.Resources.DeepCopy()
+		changed = true
+	}
+	if spec.Quota == nil && defaults.Quota != nil {
+		spec.Quota = defaults.Quota.DeepCopy()
+		changed = true
+	}
+	if !spec.ImmutableOutputs && defaults.ImmutableOutputs {
+		spec.ImmutableOutputs = true
+		changed = true
+	}
+	if spec.ConfigMapHistoryLimit == nil && defaults.ConfigMapHistoryLimit != nil {
+		limit := *defaults.ConfigMapHistoryLimit
+		spec.ConfigMapHistoryLimit = &limit
+		changed = true
+	}
+	if spec.SecretHistoryLimit == nil && defaults.SecretHistoryLimit != nil {
+		limit := *defaults.SecretHistoryLimit
+		spec.SecretHistoryLimit = &limit
+		changed = true
+	}
+	if spec.UsagePollInterval == nil && defaults.UsagePollInterval != nil {
+		interval := *defaults.UsagePollInterval
+		spec.UsagePollInterval = &interval
+		changed = true
+	}
+	if spec.VerifyInterval == nil && defaults.VerifyInterval != nil {
+		interval := *defaults.VerifyInterval
+		spec.VerifyInterval = &interval
+		changed = true
+	}
+	if spec.OperationTimeout == nil && defaults.OperationTimeout != nil {
+		timeout := *defaults.OperationTimeout
+		spec.OperationTimeout = &timeout
+		changed = true
+	}
+	for key, value := range defaults.Labels {
+		if _, ok := claim.Labels[key]; ok {
+			continue
+		}
+		if claim.Labels == nil {
+			claim.Labels = map[string]string{}
+		}
+		claim.Labels[key] = value
+		changed = true
+	}
+	return changed
+}
@@ -0,0 +1,21 @@
+package v1alpha1
+
+import "strings"
+
+// AnnotationAcceptOutputsFrom is set on a namespace to accept the outputs of
+// claims with spec.outputNamespace from a comma-separated list of
+// namespaces, or from all namespaces with "*". Only cluster administrators
+// can annotate namespaces, so claims cannot write their Secrets into
+// namespaces that did not opt in.
+const AnnotationAcceptOutputsFrom = "quobject.io/accept-outputs-from"
+
+// AcceptsOutputsFrom reports whether a namespace with the given annotations
+// accepts the outputs of claims in namespace
+func AcceptsOutputsFrom(annotations map[string]string, namespace string) bool {
+	for _, ns := range strings.Split(annotations[AnnotationAcceptOutputsFrom], ",") {
+		if ns = strings.TrimSpace(ns); ns == "*" || ns == namespace {
+			return true
+		}
+	}
+	return false
+}
@@ -4,6 +4,8 @@
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -12,16 +14,162 @@ import (
 type RetainPolicy string
 
 const (
-	// RetainPolicyRetain keeps the bucket when the claim is deleted (default)
+	// RetainPolicyRetain keeps the bucket when the claim is deleted
 	RetainPolicyRetain RetainPolicy = "Retain"
 	// RetainPolicyDelete deletes the bucket when the claim is deleted
 	RetainPolicyDelete RetainPolicy = "Delete"
 )
 
+// ClaimPhase is the lifecycle state of a QuObjectBucketClaim
+// +kubebuilder:validation:Enum=Pending;Provisioning;Bound;Error;Failed;Lost;Deleting;Hibernated
+type ClaimPhase string
+
+const (
+	// ClaimPhasePending means the claim has been seen but not yet worked on
+	ClaimPhasePending ClaimPhase = "Pending"
+	// ClaimPhaseProvisioning means the bucket and its resources are being created
+	ClaimPhaseProvisioning ClaimPhase = "Provisioning"
+	// ClaimPhaseBound means the bucket is ready and its Secret is published
+	ClaimPhaseBound ClaimPhase = "Bound"
+	// ClaimPhaseError means the last reconcile failed and is being retried
+	ClaimPhaseError ClaimPhase = "Error"
+	// ClaimPhaseFailed means the claim did not bind within the provisioning
+	// timeout and is not retried until its spec changes
+	ClaimPhaseFailed ClaimPhase = "Failed"
+	// ClaimPhaseLost means the backend or the bucket of a provisioned claim
+	// no longer exists
+	ClaimPhaseLost ClaimPhase = "Lost"
+	// ClaimPhaseDeleting means the claim is being deleted
+	ClaimPhaseDeleting ClaimPhase = "Deleting"
+	// ClaimPhaseHibernated means access is revoked while the bucket is kept
+	ClaimPhaseHibernated ClaimPhase = "Hibernated"
+)
+
+// BucketType selects the kind of bucket that is provisioned
+// +kubebuilder:validation:Enum=General;Directory
+type BucketType string
+
+const (
+	// BucketTypeGeneral is a regular general purpose bucket (default)
+	BucketTypeGeneral BucketType = "General"
+	// BucketTypeDirectory is an AWS S3 Express One Zone directory bucket
+	BucketTypeDirectory BucketType = "Directory"
+)
+
+// OutputMode selects which resources publish the bucket connection details
+// +kubebuilder:validation:Enum=Default;Connection;CSI
+type OutputMode string
+
+const (
+	// OutputModeDefault writes a Secret with credentials and a ConfigMap with
+	// bucket settings (default)
+	OutputModeDefault OutputMode = "Default"
+	// OutputModeConnection writes a single Secret with the well-known
+	// connection schema
+	OutputModeConnection OutputMode = "Connection"
+	// OutputModeCSI writes only the ConfigMap. Pods mount the credentials
+	// through the Secrets Store CSI driver and the quobject provider, so no
+	// Secret with credentials exists in the namespace.
+	OutputModeCSI OutputMode = "CSI"
+)
+
+// CredentialsMode selects how the credentials published for a claim are issued
+// +kubebuilder:validation:Enum=Static;Temporary;Dedicated
+type CredentialsMode string
+
+const (
+	// CredentialsModeStatic publishes the backend's access keys (default)
+	CredentialsModeStatic CredentialsMode = "Static"
+	// CredentialsModeTemporary publishes short-lived STS credentials scoped
+	// to the claim's bucket and refreshes them before they expire
+	CredentialsModeTemporary CredentialsMode = "Temporary"
+	// CredentialsModeDedicated publishes the access key of a backend user
+	// created for the claim, which may access the claim's bucket only
+	CredentialsModeDedicated CredentialsMode = "Dedicated"
+)
+
+// EncryptionMode selects the default server-side encryption of a bucket
+// +kubebuilder:validation:Enum=SSE-S3;SSE-KMS
+type EncryptionMode string
+
+const (
+	// EncryptionModeSSES3 encrypts objects with keys managed by the backend
+	EncryptionModeSSES3 EncryptionMode = "SSE-S3"
+	// EncryptionModeSSEKMS encrypts objects with a key of the backend's key
+	// management service
+	EncryptionModeSSEKMS EncryptionMode = "SSE-KMS"
+)
+
+// AccessMode is the access the claim's credentials grant to its bucket
+type AccessMode string
+
+const (
+	// AccessModeReadWrite allows reading and writing objects
+	AccessModeReadWrite AccessMode = "ReadWrite"
+	// AccessModeReadOnly denies writes after the write window elapsed
+	AccessModeReadOnly AccessMode = "ReadOnly"
+)
+
+const (
+	// ConditionQuotaExceeded is True while the bucket's usage exceeds
+	// spec.resources.requests.storage and writes are denied
+	ConditionQuotaExceeded = "QuotaExceeded"
+	// ConditionNameConflict is True while a generated Secret or ConfigMap
+	// name is taken by an object the claim does not own
+	ConditionNameConflict = "NameConflict"
+	// ConditionOwnerConflict is True while the ownership marker in the
+	// claim's bucket names another claim that still exists. The marker is
+	// left unchanged.
+	ConditionOwnerConflict = "OwnerConflict"
+	// ConditionInsufficientPermissions is True while the controller is
+	// forbidden to write the claim's Secret or ConfigMap. Its message names
+	// the denied verb and resource.
+	ConditionInsufficientPermissions = "InsufficientPermissions"
+	// ConditionHibernated is True while the claim's credentials are revoked
+	// and its bucket is kept
+	ConditionHibernated = "Hibernated"
+	// ConditionDataSourceCloned is True once the objects of
+	// spec.dataSource have been copied into the bucket
+	ConditionDataSourceCloned = "DataSourceCloned"
+	// ConditionFailed is True once a claim has not bound within the
+	// provisioning timeout. It is not retried until its spec changes.
+	ConditionFailed = "Failed"
+	// ConditionProvisioningError is True while the last provisioning attempt
+	// failed. Its reason classifies the failure, e.g. AccessDenied or
+	// Throttled.
+	ConditionProvisioningError = "ProvisioningError"
+	// ConditionThrottled is True while the backend throttles the claim's
+	// requests and its retries are backed off. Its message names the delay.
+	ConditionThrottled = "Throttled"
+	// ConditionCredentialsSecretInvalid is True while the backend secret
+	// lacks a required key or has a malformed one. Its message names the key.
+	ConditionCredentialsSecretInvalid = "CredentialsSecretInvalid"
+	// ConditionBucketRetained is set just before a deleted claim goes away
+	// and names the bucket kept on the backend per its retain policy
+	ConditionBucketRetained = "BucketRetained"
+	// ConditionReady is True while the claim is Bound and its Secret and
+	// ConfigMap are ready to be mounted
+	ConditionReady = "Ready"
+	// ConditionBucketReady is True while the claim's bucket exists on the
+	// backend
+	ConditionBucketReady = "BucketReady"
+	// ConditionCredentialsReady is True while the claim's credentials are
+	// published, in its Secret or through the CSI provider
+	ConditionCredentialsReady = "CredentialsReady"
+	// ConditionConfigMapReady is True while the bucket settings are
+	// published, in the claim's ConfigMap or in its connection Secret
+	ConditionConfigMapReady = "ConfigMapReady"
+	// ConditionQuobyteConfigApplied is True once the Quobyte keys of
+	// spec.additionalConfig are applied to the bucket's volume, and False
+	// while they are invalid or cannot be applied
+	ConditionQuobyteConfigApplied = "QuobyteConfigApplied"
+)
+
 // QuObjectBucketClaimSpec defines the desired state of QuObjectBucketClaim
 type QuObjectBucketClaimSpec struct {
 	// BucketName is the explicit name for the bucket.
-	// If specified, this exact name will be used.
+	// If specified, this exact name will be used. Changing it on a bound
+	// claim migrates the objects to a bucket with the new name.
 	// +optional
 	BucketName string `json:"bucketName,omitempty"`
 
@@ -30,31 +178,340 @@ type QuObjectBucketClaimSpec struct {
 	// +optional
 	GenerateBucketName string `json:"generateBucketName,omitempty"`
 
+	// BucketType selects a general purpose bucket or, on AWS, an S3 Express
+	// One Zone directory bucket. Directory bucket names get the required
+	// "--<availabilityZoneId>--x-s3" suffix appended automatically.
+	// +kubebuilder:default=General
+	// +optional
+	BucketType BucketType `json:"bucketType,omitempty"`
+
+	// AvailabilityZoneID is the AWS availability zone ID (e.g. "use1-az4")
+	// a directory bucket is created in. Required when BucketType is Directory.
+	// +optional
+	AvailabilityZoneID string `json:"availabilityZoneId,omitempty"`
+
+	// LocationHint names the zone or datacenter the bucket should be placed
+	// in, on backends whose apiProfile supports placement, such as the
+	// zonegroup of a Ceph RGW multisite. It only applies when the bucket is
+	// created; status.placement reports where it was placed.
+	// +kubebuilder:validation:MaxLength=63
+	// +optional
+	LocationHint string `json:"locationHint,omitempty"`
+
+	// PlacementTarget selects the Ceph RGW placement target of the bucket,
+	// e.g. to land it on an SSD or HDD pool. It requires apiProfile rgw and
+	// only applies when the bucket is created.
+	// +kubebuilder:validation:MaxLength=63
+	// +optional
+	PlacementTarget string `json:"placementTarget,omitempty"`
+
+	// StoragePolicy selects the storage class of the placement target that
+	// objects are written to unless a request names another. It requires
+	// PlacementTarget.
+	// +kubebuilder:validation:MaxLength=63
+	// +optional
+	StoragePolicy string `json:"storagePolicy,omitempty"`
+
+	// Region overrides the backend's default region for this bucket. If the
+	// backend endpoint contains a {region} placeholder it is resolved with
+	// this region.
+	// +optional
+	Region string `json:"region,omitempty"`
+
+	// ClaimClassName names a QuObjectBucketClaimClass whose settings are
+	// copied into the fields the claim leaves unset
+	// +optional
+	ClaimClassName string `json:"claimClassName,omitempty"`
+
 	// StorageClassName specifies the storage class to use
 	// +optional
 	StorageClassName string `json:"storageClassName,omitempty"`
 
 	// RetainPolicy determines if the bucket should be retained or deleted
-	// when the claim is deleted. Default is "Retain".
-	// +kubebuilder:default=Retain
+	// when the claim is deleted. Defaults to the defaultRetainPolicy of the
+	// backend, or "Retain".
 	// +optional
 	RetainPolicy RetainPolicy `json:"retainPolicy,omitempty"`
 
-	// AdditionalConfig contains additional configuration for the bucket
+	// OutputMode selects between the default Secret and ConfigMap pair, a
+	// single connection Secret with keys endpoint, region, bucket,
+	// accessKeyId, secretAccessKey, caBundle and usePathStyle, and a
+	// ConfigMap only, with credentials mounted through the Secrets Store CSI
+	// driver.
+	// +kubebuilder:default=Default
+	// +optional
+	OutputMode OutputMode `json:"outputMode,omitempty"`
+
+	// Credentials selects how the published credentials are issued
+	// +optional
+	Credentials *BucketCredentials `json:"credentials,omitempty"`
+
+	// ServiceAccounts names ServiceAccounts in the claim's namespace whose
+	// projected tokens may access the bucket through the backend's STS
+	// AssumeRoleWithWebIdentity API. Requires a backend with the minio
+	// apiProfile.
+	// +optional
+	ServiceAccounts []string `json:"serviceAccounts,omitempty"`
+
+	// Hibernate revokes access to the bucket while keeping it and its data:
+	// the generated Secret is deleted and ServiceAccount access is removed.
+	// Access is restored when Hibernate is set back to false.
+	// +optional
+	Hibernate bool `json:"hibernate,omitempty"`
+
+	// SecretName overrides the name of the generated Secret. When it
+	// changes, the Secret under the previous name is deleted.
+	// +kubebuilder:validation:MaxLength=253
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+
+	// ConfigMapName overrides the name of the generated ConfigMap. When it
+	// changes, the ConfigMap under the previous name is deleted.
+	// +kubebuilder:validation:MaxLength=253
+	// +optional
+	ConfigMapName string `json:"configMapName,omitempty"`
+
+	// OutputNamespace delivers the generated Secret and ConfigMap into
+	// another namespace, e.g. a central namespace read by shared gateways.
+	// The target namespace must accept the claim's namespace with the
+	// quobject.io/accept-outputs-from annotation.
+	// +kubebuilder:validation:MaxLength=63
+	// +optional
+	OutputNamespace string `json:"outputNamespace,omitempty"`
+
+	// ImmutableOutputs creates the generated Secret and ConfigMap as
+	// immutable. Instead of being updated, e.g. when credentials rotate, they
+	// are replaced by a new version with a new name, published in
+	// status.secretRef and status.configMapRef.
+	// +optional
+	ImmutableOutputs bool `json:"immutableOutputs,omitempty"`
+
+	// ConfigMapHistoryLimit versions the generated ConfigMap: its name gets
+	// a hash of its content appended, so every configuration change creates
+	// a new ConfigMap published in status.configMapRef, and rolls out
+	// Deployments that reference it. This many previous versions are kept for
+	// pods still using them. Unset updates a single ConfigMap in place,
+	// unless ImmutableOutputs is set.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	ConfigMapHistoryLimit *int32 `json:"configMapHistoryLimit,omitempty"`
+
+	// SecretHistoryLimit is the number of previous versions of the Secret
+	// kept with ImmutableOutputs, for pods still mounting them until they
+	// are rolled out. Defaults to 1.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	SecretHistoryLimit *int32 `json:"secretHistoryLimit,omitempty"`
+
+	// DataSource seeds a new bucket with a copy of another claim's objects
+	// or of a snapshot. The copy is made once, before the claim becomes
+	// Bound.
+	// +optional
+	DataSource *BucketDataSource `json:"dataSource,omitempty"`
+
+	// AdditionalConfig contains additional configuration for the bucket.
+	// On backends with the Quobyte management API, the quobyte.io/quota,
+	// quobyte.io/file-quota and quobyte.io/policy-preset keys are applied
+	// to the bucket's volume. Deprecated for other keys: the controller does
+	// not interpret them; use the structured fields instead.
 	// +optional
 	AdditionalConfig map[string]string `json:"additionalConfig,omitempty"`
+
+	// UsagePollInterval overrides the controller-wide interval at which the
+	// bucket's object count and size are measured. Zero disables polling
+	// for this claim.
+	// +optional
+	UsagePollInterval *metav1.Duration `json:"usagePollInterval,omitempty"`
+
+	// VerifyInterval overrides the controller-wide interval at which the
+	// bucket and the generated Secret and ConfigMap are verified and
+	// repaired. Zero disables periodic verification for this claim.
+	// +optional
+	VerifyInterval *metav1.Duration `json:"verifyInterval,omitempty"`
+
+	// OperationTimeout overrides the controller-wide deadline of each S3
+	// request made for the claim, e.g. for tape-backed or remote backends
+	// that need longer. Zero disables the deadline for this claim.
+	// +optional
+	OperationTimeout *metav1.Duration `json:"operationTimeout,omitempty"`
+
+	// Resources requests capacity for the bucket, like the resources of a
+	// PersistentVolumeClaim. requests.storage is enforced like
+	// quota.maxSize and, on backends that support it, set as the bucket's
+	// quota on the backend.
+	// +optional
+	Resources *BucketResources `json:"resources,omitempty"`
+
+	// Quota limits the space the bucket may consume.
+	// Deprecated: use resources.requests.storage instead.
+	// +optional
+	Quota *BucketQuota `json:"quota,omitempty"`
+
+	// WriteWindow is how long the bucket accepts writes after it was first
+	// bound. Once it elapses, writes are denied by bucket policy and
+	// temporary credentials are issued read-only.
+	// +optional
+	WriteWindow *metav1.Duration `json:"writeWindow,omitempty"`
+
+	// Encryption sets the default server-side encryption of the bucket's
+	// objects. It is verified on every reconcile and restored if changed on
+	// the backend.
+	// +optional
+	Encryption *BucketEncryption `json:"encryption,omitempty"`
+
+	// LifecycleRules are applied as the bucket's lifecycle configuration,
+	// e.g. to expire old objects or abort stale multipart uploads. Rules
+	// added to the bucket by others are kept.
+	// +kubebuilder:validation:MaxItems=100
+	// +optional
+	LifecycleRules []LifecycleRule `json:"lifecycleRules,omitempty"`
+}
+
+// BucketEncryption is the default server-side encryption of a bucket
+type BucketEncryption struct {
+	// Mode selects keys managed by the backend (SSE-S3) or by its key
+	// management service (SSE-KMS)
+	Mode EncryptionMode `json:"mode"`
+
+	// KMSKeyID is the ID, alias or ARN of the key used with SSE-KMS. Empty
+	// selects the backend's default key.
+	// +optional
+	KMSKeyID string `json:"kmsKeyId,omitempty"`
+}
+
+// LifecycleRule expires the objects under a key prefix. At least one of its
+// actions must be set.
+type LifecycleRule struct {
+	// ID names the rule within the claim. Defaults to its position in the
+	// list.
+	// +kubebuilder:validation:MaxLength=200
+	// +optional
+	ID string `json:"id,omitempty"`
+
+	// Prefix limits the rule to objects whose keys start with it. Empty
+	// applies the rule to the whole bucket.
+	// +optional
+	Prefix string `json:"prefix,omitempty"`
+
+	// ExpirationDays is the age in days at which objects are deleted
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	ExpirationDays *int32 `json:"expirationDays,omitempty"`
+
+	// NoncurrentVersionExpirationDays is the number of days after which
+	// versions that are no longer current are deleted
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	NoncurrentVersionExpirationDays *int32 `json:"noncurrentVersionExpirationDays,omitempty"`
+
+	// AbortIncompleteMultipartUploadDays is the number of days after which
+	// multipart uploads that were never completed are aborted and their
+	// parts deleted
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	AbortIncompleteMultipartUploadDays *int32 `json:"abortIncompleteMultipartUploadDays,omitempty"`
+}
+
+// BucketDataSource selects the objects a new bucket is seeded with. Exactly
+// one of ClaimRef and SnapshotRef must be set.
+type BucketDataSource struct {
+	// ClaimRef is the bound claim in the same namespace to copy from
+	// +optional
+	ClaimRef *ClaimReference `json:"claimRef,omitempty"`
+
+	// SnapshotRef is the ready QuObjectBucketSnapshot in the same namespace
+	// to restore from
+	// +optional
+	SnapshotRef *SnapshotReference `json:"snapshotRef,omitempty"`
+
+	// Prefix limits the copy to objects whose keys start with it
+	// +optional
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// ClaimReference names a QuObjectBucketClaim in the same namespace
+type ClaimReference struct {
+	// Name is the name of the claim
+	Name string `json:"name"`
+}
+
+// SnapshotReference names a QuObjectBucketSnapshot in the same namespace
+type SnapshotReference struct {
+	// Name is the name of the snapshot
+	Name string `json:"name"`
+}
+
+// BucketResources describes the capacity requested for a bucket
+type BucketResources struct {
+	// Requests holds the requested capacity. Only storage is supported.
+	// +optional
+	Requests corev1.ResourceList `json:"requests,omitempty"`
+}
+
+// BucketQuota limits the space a bucket may consume
+type BucketQuota struct {
+	// MaxSize is the maximum total size of the objects in the bucket.
+	// When the measured usage exceeds it, the controller denies further
+	// writes with a bucket policy until usage drops below it again.
+	// +optional
+	MaxSize *resource.Quantity `json:"maxSize,omitempty"`
+}
+
+// BucketCredentials configures the credentials published for a claim
+type BucketCredentials struct {
+	// Mode selects static backend keys, temporary STS credentials or the
+	// keys of a user dedicated to the claim
+	// +kubebuilder:default=Static
+	// +optional
+	Mode CredentialsMode `json:"mode,omitempty"`
+
+	// Duration is the lifetime of temporary credentials. They are refreshed
+	// when a third of it remains. Defaults to one hour.
+	// +optional
+	Duration *metav1.Duration `json:"duration,omitempty"`
 }
 
 // QuObjectBucketClaimStatus defines the observed state of QuObjectBucketClaim
 type QuObjectBucketClaimStatus struct {
 	// Phase represents the current phase of the bucket claim
 	// +optional
-	Phase string `json:"phase,omitempty"`
+	Phase ClaimPhase `json:"phase,omitempty"`
 
 	// BucketName is the actual name of the created bucket
 	// +optional
 	BucketName string `json:"bucketName,omitempty"`
 
+	// GeneratedBucketName is the generated bucket name chosen for the claim.
+	// It is recorded before the bucket is created so a retry reuses it.
+	// +optional
+	GeneratedBucketName string `json:"generatedBucketName,omitempty"`
+
+	// RetainPolicy is the effective retain policy, recorded when the
+	// backend default applies so that changing the default never affects
+	// existing buckets
+	// +optional
+	RetainPolicy RetainPolicy `json:"retainPolicy,omitempty"`
+
+	// StorageClassName is the storage class the bucket's backend was
+	// resolved from when it was bound. Later changes to spec.storageClassName
+	// or to the storage class mapping do not move the bucket.
+	// +optional
+	StorageClassName string `json:"storageClassName,omitempty"`
+
+	// Backend is the backend the bucket lives on: a backend secret in the
+	// controller's namespace, or class/<name> for a QuObjectBucketClass
+	// +optional
+	Backend string `json:"backend,omitempty"`
+
+	// UntruncatedBucketName is the generated bucket name before it was
+	// truncated to the 63 character limit of bucket names
+	// +optional
+	UntruncatedBucketName string `json:"untruncatedBucketName,omitempty"`
+
+	// Placement is the location of the bucket as reported by the backend
+	// +optional
+	Placement string `json:"placement,omitempty"`
+
 	// SecretRef is the name of the secret containing bucket credentials
 	// +optional
 	SecretRef string `json:"secretRef,omitempty"`
@@ -62,13 +519,209 @@ type QuObjectBucketClaimStatus struct {
 	// ConfigMapRef is the name of the configmap containing bucket configuration
 	// +optional
 	ConfigMapRef string `json:"configMapRef,omitempty"`
+
+	// OutputNamespace is the namespace of SecretRef and ConfigMapRef if it
+	// is not the claim's namespace
+	// +optional
+	OutputNamespace string `json:"outputNamespace,omitempty"`
+
+	// CredentialsExpiration is the time the temporary credentials in the
+	// Secret expire
+	// +optional
+	CredentialsExpiration *metav1.Time `json:"credentialsExpiration,omitempty"`
+
+	// CredentialsUser is the backend user whose access keys the Secret
+	// holds. The keys are only reused while the claim is served by the same
+	// backend and user.
+	// +optional
+	CredentialsUser *CredentialsUserStatus `json:"credentialsUser,omitempty"`
+
+	// ServiceAccounts are the ServiceAccounts currently granted access to
+	// the bucket on the backend
+	// +optional
+	ServiceAccounts []string `json:"serviceAccounts,omitempty"`
+
+	// Migration reports the progress of moving the bucket to a new name
+	// +optional
+	Migration *BucketMigrationStatus `json:"migration,omitempty"`
+
+	// Capacity is the storage granted to the bucket, its spec.quota.maxSize,
+	// like the capacity of a PersistentVolumeClaim. Unset without a quota.
+	// +optional
+	Capacity corev1.ResourceList `json:"capacity,omitempty"`
+
+	// Used is the storage occupied by the bucket's objects at the last usage
+	// poll
+	// +optional
+	Used corev1.ResourceList `json:"used,omitempty"`
+
+	// Usage is the most recent estimate of the bucket's object count and size
+	// +optional
+	Usage *BucketUsage `json:"usage,omitempty"`
+
+	// Snapshots is the storage consumed by the claim's snapshots
+	// +optional
+	Snapshots *SnapshotUsage `json:"snapshots,omitempty"`
+
+	// Share is the presigned URL issued for the quobject.io/share
+	// annotation
+	// +optional
+	Share *ShareStatus `json:"share,omitempty"`
+
+	// Access reports the write window of the bucket
+	// +optional
+	Access *BucketAccessStatus `json:"access,omitempty"`
+
+	// Encryption is the default server-side encryption applied to the
+	// bucket from spec.encryption
+	// +optional
+	Encryption *BucketEncryption `json:"encryption,omitempty"`
+
+	// Quobyte reports the Quobyte volume configuration applied from
+	// spec.additionalConfig
+	// +optional
+	Quobyte *QuobyteVolumeStatus `json:"quobyte,omitempty"`
+
+	// Conditions describe the current state of the claim
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// QuobyteVolumeStatus is the configuration applied to the Quobyte volume
+// backing a bucket
+type QuobyteVolumeStatus struct {
+	// VolumeUUID is the volume the bucket is stored in
+	VolumeUUID string `json:"volumeUUID"`
+
+	// Quota is the logical disk space limit of the volume
+	// +optional
+	Quota *resource.Quantity `json:"quota,omitempty"`
+
+	// FileQuota is the file count limit of the volume
+	// +optional
+	FileQuota int64 `json:"fileQuota,omitempty"`
+
+	// PolicyPreset is the policy preset applied to the volume
+	// +optional
+	PolicyPreset string `json:"policyPreset,omitempty"`
+
+	// PolicyRule is the name of the policy rule applying the preset
+	// +optional
+	PolicyRule string `json:"policyRule,omitempty"`
+}
+
+// CredentialsUserStatus identifies the user that was issued a claim's
+// published access keys
+type CredentialsUserStatus struct {
+	// Backend is the backend the user was created on
+	Backend string `json:"backend"`
+
+	// Name is the user's name on the backend
+	Name string `json:"name"`
+
+	// Buckets are the buckets the user's policy allows
+	// +optional
+	Buckets []string `json:"buckets,omitempty"`
+}
+
+// BucketMigrationStatus is the progress of moving a claim's objects to a
+// bucket with a new name
+type BucketMigrationStatus struct {
+	// SourceBucket is the bucket the objects are copied from
+	SourceBucket string `json:"sourceBucket"`
+
+	// TargetBucket is the bucket the objects are copied to
+	TargetBucket string `json:"targetBucket"`
+
+	// ObjectsCopied is the number of objects copied so far
+	ObjectsCopied int64 `json:"objectsCopied"`
+
+	// BytesCopied is the total size of the objects copied so far
+	BytesCopied int64 `json:"bytesCopied"`
+
+	// StartTime is when the migration started
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// CleanupPending is set once the claim is bound to the target bucket,
+	// while the source bucket remains to be deleted
+	// +optional
+	CleanupPending bool `json:"cleanupPending,omitempty"`
+}
+
+// BucketUsage is an estimate of the space consumed by a bucket
+type BucketUsage struct {
+	// Objects is the number of objects stored in the bucket
+	Objects int64 `json:"objects"`
+
+	// Bytes is the total size of the objects stored in the bucket
+	Bytes int64 `json:"bytes"`
+
+	// LastUpdated is the time the usage was last measured
+	// +optional
+	LastUpdated *metav1.Time `json:"lastUpdated,omitempty"`
+}
+
+// SnapshotUsage is the space consumed by the snapshots of a claim
+type SnapshotUsage struct {
+	// Count is the number of snapshots of the claim
+	Count int32 `json:"count"`
+
+	// Bytes is the total size of the claim's ready snapshots
+	Bytes int64 `json:"bytes"`
+}
+
+// BucketAccessStatus is the state of a claim's write window
+type BucketAccessStatus struct {
+	// Mode is the access currently granted to the bucket
+	Mode AccessMode `json:"mode"`
+
+	// WindowStart is when the bucket was first bound and the write window
+	// started
+	WindowStart metav1.Time `json:"windowStart"`
+
+	// WritableUntil is when the write window elapses
+	// +optional
+	WritableUntil *metav1.Time `json:"writableUntil,omitempty"`
+
+	// ReadOnlySince is when the bucket was made read-only
+	// +optional
+	ReadOnlySince *metav1.Time `json:"readOnlySince,omitempty"`
+}
+
+// ShareStatus is a temporary public link to one object of the bucket
+type ShareStatus struct {
+	// Request is the annotation value the URL was issued for
+	Request string `json:"request"`
+
+	// Key is the shared object
+	Key string `json:"key"`
+
+	// URL is the presigned GET URL of the object
+	URL string `json:"url"`
+
+	// Expiration is the time the URL stops working
+	Expiration metav1.Time `json:"expiration"`
 }
 
 // +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=qbc
 // +kubebuilder:subresource:status
 // +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
 // +kubebuilder:printcolumn:name="BucketName",type=string,JSONPath=`.status.bucketName`
-// +kubebuilder:printcolumn:name="RetainPolicy",type=string,JSONPath=`.spec.retainPolicy`
+// +kubebuilder:printcolumn:name="Secret",type=string,JSONPath=`.status.secretRef`,priority=1
+// +kubebuilder:printcolumn:name="ConfigMap",type=string,JSONPath=`.status.configMapRef`,priority=1
+// +kubebuilder:printcolumn:name="RetainPolicy",type=string,JSONPath=`.status.retainPolicy`
+// +kubebuilder:printcolumn:name="Backend",type=string,JSONPath=`.status.backend`,priority=1
+// +kubebuilder:printcolumn:name="Capacity",type=string,JSONPath=`.status.capacity.storage`
+// +kubebuilder:printcolumn:name="Used",type=string,JSONPath=`.status.used.storage`,priority=1
+// +kubebuilder:printcolumn:name="Objects",type=integer,JSONPath=`.status.usage.objects`
+// +kubebuilder:printcolumn:name="Bytes",type=integer,JSONPath=`.status.usage.bytes`
+// +kubebuilder:printcolumn:name="Access",type=string,JSONPath=`.status.access.mode`,priority=1
+// +kubebuilder:printcolumn:name="Encryption",type=string,JSONPath=`.status.encryption.mode`,priority=1
 // +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // QuObjectBucketClaim is the Schema for the quobjectbucketclaims API
@@ -0,0 +1,97 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// QuObjectBucketClaimClassSpec defines the defaults a class gives its claims.
+// Each setting only applies to claims that leave it unset.
+type QuObjectBucketClaimClassSpec struct {
+	// StorageClassName is the storage class selecting the backend
+	// +optional
+	StorageClassName string `json:"storageClassName,omitempty"`
+
+	// Region overrides the backend's default region
+	// +optional
+	Region string `json:"region,omitempty"`
+
+	// RetainPolicy determines if buckets are retained or deleted with their
+	// claims
+	// +optional
+	RetainPolicy RetainPolicy `json:"retainPolicy,omitempty"`
+
+	// Credentials selects how the published credentials are issued
+	// +optional
+	Credentials *BucketCredentials `json:"credentials,omitempty"`
+
+	// Resources requests capacity for the buckets, enforced as their quota
+	// +optional
+	Resources *BucketResources `json:"resources,omitempty"`
+
+	// Quota limits the space the buckets may consume
+	// +optional
+	Quota *BucketQuota `json:"quota,omitempty"`
+
+	// ImmutableOutputs creates the generated Secrets and ConfigMaps as
+	// immutable, versioned objects
+	// +optional
+	ImmutableOutputs bool `json:"immutableOutputs,omitempty"`
+
+	// ConfigMapHistoryLimit versions the generated ConfigMaps and keeps this
+	// many previous versions
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	ConfigMapHistoryLimit *int32 `json:"configMapHistoryLimit,omitempty"`
+
+	// SecretHistoryLimit is the number of previous versions of immutable
+	// Secrets kept
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	SecretHistoryLimit *int32 `json:"secretHistoryLimit,omitempty"`
+
+	// UsagePollInterval overrides the controller-wide usage polling interval
+	// +optional
+	UsagePollInterval *metav1.Duration `json:"usagePollInterval,omitempty"`
+
+	// VerifyInterval overrides the controller-wide verification interval
+	// +optional
+	VerifyInterval *metav1.Duration `json:"verifyInterval,omitempty"`
+
+	// OperationTimeout overrides the controller-wide deadline of S3 requests
+	// +optional
+	OperationTimeout *metav1.Duration `json:"operationTimeout,omitempty"`
+
+	// Labels are added to claims that do not carry them, and so become
+	// bucket tags through the controller's --label-tags mapping
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster,shortName=qbcc
+// +kubebuilder:printcolumn:name="StorageClass",type=string,JSONPath=`.spec.storageClassName`
+// +kubebuilder:printcolumn:name="RetainPolicy",type=string,JSONPath=`.spec.retainPolicy`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// QuObjectBucketClaimClass captures common claim settings owned by platform
+// teams. Claims reference it with spec.claimClassName and get its settings
+// copied into the fields they leave unset when they are first reconciled.
+type QuObjectBucketClaimClass struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec QuObjectBucketClaimClassSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// QuObjectBucketClaimClassList contains a list of QuObjectBucketClaimClass
+type QuObjectBucketClaimClassList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []QuObjectBucketClaimClass `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&QuObjectBucketClaimClass{}, &QuObjectBucketClaimClassList{})
+}
@@ -0,0 +1,70 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// QuObjectBucketClassSpec defines the object store a bucket class
+// provisions against
+type QuObjectBucketClassSpec struct {
+	// Endpoint is the S3 endpoint as host[:port] or URL. It may contain a
+	// {region} placeholder.
+	// +kubebuilder:validation:MinLength=1
+	Endpoint string `json:"endpoint"`
+
+	// Region is the default region of the object store
+	// +optional
+	Region string `json:"region,omitempty"`
+
+	// CredentialsSecretRef names the secret in the controller's namespace
+	// holding the accessKey and secretKey of the object store. Other keys of
+	// backend secrets, like apiProfile or caBundle, are honoured as well.
+	CredentialsSecretRef CredentialsSecretReference `json:"credentialsSecretRef"`
+
+	// ForcePathStyle selects path-style instead of virtual-hosted
+	// addressing. Defaults to true.
+	// +optional
+	ForcePathStyle *bool `json:"forcePathStyle,omitempty"`
+
+	// DefaultRetainPolicy is the retain policy of claims that set none.
+	// Defaults to Retain.
+	// +optional
+	DefaultRetainPolicy RetainPolicy `json:"defaultRetainPolicy,omitempty"`
+}
+
+// CredentialsSecretReference names a secret in the controller's namespace
+type CredentialsSecretReference struct {
+	// Name of the secret
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster,shortName=qbcls
+// +kubebuilder:printcolumn:name="Endpoint",type=string,JSONPath=`.spec.endpoint`
+// +kubebuilder:printcolumn:name="Region",type=string,JSONPath=`.spec.region`
+// +kubebuilder:printcolumn:name="Secret",type=string,JSONPath=`.spec.credentialsSecretRef.name`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// QuObjectBucketClass configures an object store for the claims whose
+// spec.storageClassName matches its name. It takes precedence over the
+// backend secrets of the storage class.
+type QuObjectBucketClass struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec QuObjectBucketClassSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// QuObjectBucketClassList contains a list of QuObjectBucketClass
+type QuObjectBucketClassList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []QuObjectBucketClass `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&QuObjectBucketClass{}, &QuObjectBucketClassList{})
+}
@@ -0,0 +1,118 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MigrationPhase is the stage a QuObjectBucketMigration has reached
+type MigrationPhase string
+
+const (
+	// MigrationPhaseCopying copies the objects to the target backend
+	MigrationPhaseCopying MigrationPhase = "Copying"
+	// MigrationPhaseVerifying compares the objects on both backends
+	MigrationPhaseVerifying MigrationPhase = "Verifying"
+	// MigrationPhaseCutover binds the claim to the target backend
+	MigrationPhaseCutover MigrationPhase = "Cutover"
+	// MigrationPhaseCleanup deletes the source bucket if requested
+	MigrationPhaseCleanup MigrationPhase = "Cleanup"
+	// MigrationPhaseCompleted means the claim is served by the target backend
+	MigrationPhaseCompleted MigrationPhase = "Completed"
+	// MigrationPhaseFailed means the migration stopped and needs attention
+	MigrationPhaseFailed MigrationPhase = "Failed"
+)
+
+// QuObjectBucketMigrationSpec defines the desired state of QuObjectBucketMigration
+type QuObjectBucketMigrationSpec struct {
+	// ClaimName is the QuObjectBucketClaim in the same namespace to migrate
+	ClaimName string `json:"claimName"`
+
+	// TargetStorageClassName is the storage class whose backend the claim
+	// is moved to
+	TargetStorageClassName string `json:"targetStorageClassName"`
+
+	// DeleteSource deletes the bucket on the source backend after cutover
+	// +optional
+	DeleteSource bool `json:"deleteSource,omitempty"`
+}
+
+// QuObjectBucketMigrationStatus defines the observed state of QuObjectBucketMigration
+type QuObjectBucketMigrationStatus struct {
+	// Phase is the stage the migration has reached
+	// +optional
+	Phase MigrationPhase `json:"phase,omitempty"`
+
+	// SourceBackend is the backend the claim was served by
+	// +optional
+	SourceBackend string `json:"sourceBackend,omitempty"`
+
+	// TargetBackend is the backend the claim is moved to
+	// +optional
+	TargetBackend string `json:"targetBackend,omitempty"`
+
+	// BucketName is the bucket being migrated, which keeps its name
+	// +optional
+	BucketName string `json:"bucketName,omitempty"`
+
+	// ObjectsCopied is the number of objects copied so far
+	// +optional
+	ObjectsCopied int64 `json:"objectsCopied,omitempty"`
+
+	// BytesCopied is the total size of the objects copied so far
+	// +optional
+	BytesCopied int64 `json:"bytesCopied,omitempty"`
+
+	// ObjectsVerified is the number of objects found identical on both
+	// backends
+	// +optional
+	ObjectsVerified int64 `json:"objectsVerified,omitempty"`
+
+	// SyncPasses is the number of times the objects were copied again
+	// because the source bucket changed during the copy
+	// +optional
+	SyncPasses int32 `json:"syncPasses,omitempty"`
+
+	// Message describes the current phase or the failure
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// StartTime is when the migration started
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// CompletionTime is when the migration completed
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=qbm
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Claim",type=string,JSONPath=`.spec.claimName`
+// +kubebuilder:printcolumn:name="Target",type=string,JSONPath=`.spec.targetStorageClassName`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Copied",type=integer,JSONPath=`.status.objectsCopied`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// QuObjectBucketMigration moves a claim's bucket and binding to the backend
+// of another storage class
+type QuObjectBucketMigration struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   QuObjectBucketMigrationSpec   `json:"spec,omitempty"`
+	Status QuObjectBucketMigrationStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// QuObjectBucketMigrationList contains a list of QuObjectBucketMigration
+type QuObjectBucketMigrationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []QuObjectBucketMigration `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&QuObjectBucketMigration{}, &QuObjectBucketMigrationList{})
+}
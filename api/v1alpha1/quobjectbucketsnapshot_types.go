@@ -0,0 +1,83 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// QuObjectBucketSnapshotSpec defines the desired state of QuObjectBucketSnapshot
+type QuObjectBucketSnapshotSpec struct {
+	// ClaimName is the QuObjectBucketClaim in the same namespace whose
+	// bucket is captured
+	ClaimName string `json:"claimName"`
+}
+
+// QuObjectBucketSnapshotStatus defines the observed state of QuObjectBucketSnapshot
+type QuObjectBucketSnapshotStatus struct {
+	// ReadyToUse is true once the snapshot is complete and can be restored
+	// +optional
+	ReadyToUse bool `json:"readyToUse,omitempty"`
+
+	// Backend is the backend holding the snapshot
+	// +optional
+	Backend string `json:"backend,omitempty"`
+
+	// BucketName is the bucket holding the snapshot's objects
+	// +optional
+	BucketName string `json:"bucketName,omitempty"`
+
+	// Region is the region of the snapshot bucket
+	// +optional
+	Region string `json:"region,omitempty"`
+
+	// SourceBucket is the claim's bucket the snapshot was taken of
+	// +optional
+	SourceBucket string `json:"sourceBucket,omitempty"`
+
+	// Objects is the number of objects in the snapshot
+	// +optional
+	Objects int64 `json:"objects,omitempty"`
+
+	// Bytes is the total size of the objects in the snapshot
+	// +optional
+	Bytes int64 `json:"bytes,omitempty"`
+
+	// CreationTime is when the snapshot became ready
+	// +optional
+	CreationTime *metav1.Time `json:"creationTime,omitempty"`
+
+	// Message describes why the snapshot is not ready yet
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=qbs
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Claim",type=string,JSONPath=`.spec.claimName`
+// +kubebuilder:printcolumn:name="Ready",type=boolean,JSONPath=`.status.readyToUse`
+// +kubebuilder:printcolumn:name="Objects",type=integer,JSONPath=`.status.objects`
+// +kubebuilder:printcolumn:name="Bytes",type=integer,JSONPath=`.status.bytes`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// QuObjectBucketSnapshot is a point-in-time copy of a claim's bucket, taken
+// with server-side copies into a dedicated bucket on the same backend
+type QuObjectBucketSnapshot struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   QuObjectBucketSnapshotSpec   `json:"spec,omitempty"`
+	Status QuObjectBucketSnapshotStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// QuObjectBucketSnapshotList contains a list of QuObjectBucketSnapshot
+type QuObjectBucketSnapshotList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []QuObjectBucketSnapshot `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&QuObjectBucketSnapshot{}, &QuObjectBucketSnapshotList{})
+}
@@ -0,0 +1,84 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// QuObjectBucketSnapshotScheduleSpec defines the desired state of QuObjectBucketSnapshotSchedule
+type QuObjectBucketSnapshotScheduleSpec struct {
+	// ClaimName is the QuObjectBucketClaim in the same namespace that is
+	// snapshotted
+	ClaimName string `json:"claimName"`
+
+	// Interval is the time between two snapshots
+	Interval metav1.Duration `json:"interval"`
+
+	// Retention limits how many snapshots of this schedule are kept
+	// +optional
+	Retention *SnapshotRetention `json:"retention,omitempty"`
+}
+
+// SnapshotRetention selects the snapshots of a schedule that are pruned.
+// Only ready snapshots are pruned; a snapshot is pruned if either limit
+// is exceeded.
+type SnapshotRetention struct {
+	// Count is the maximum number of ready snapshots kept
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Count *int32 `json:"count,omitempty"`
+
+	// MaxAge is the maximum age of a ready snapshot
+	// +optional
+	MaxAge *metav1.Duration `json:"maxAge,omitempty"`
+}
+
+// QuObjectBucketSnapshotScheduleStatus defines the observed state of QuObjectBucketSnapshotSchedule
+type QuObjectBucketSnapshotScheduleStatus struct {
+	// LastSnapshotName is the most recent snapshot created by the schedule
+	// +optional
+	LastSnapshotName string `json:"lastSnapshotName,omitempty"`
+
+	// LastSnapshotTime is when the most recent snapshot was created
+	// +optional
+	LastSnapshotTime *metav1.Time `json:"lastSnapshotTime,omitempty"`
+
+	// Snapshots is the number of snapshots of the schedule currently kept
+	// +optional
+	Snapshots int32 `json:"snapshots,omitempty"`
+
+	// Bytes is the total size of the ready snapshots currently kept
+	// +optional
+	Bytes int64 `json:"bytes,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=qbss
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Claim",type=string,JSONPath=`.spec.claimName`
+// +kubebuilder:printcolumn:name="Interval",type=string,JSONPath=`.spec.interval`
+// +kubebuilder:printcolumn:name="Snapshots",type=integer,JSONPath=`.status.snapshots`
+// +kubebuilder:printcolumn:name="Last",type=date,JSONPath=`.status.lastSnapshotTime`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// QuObjectBucketSnapshotSchedule periodically snapshots a claim's bucket and
+// prunes old snapshots
+type QuObjectBucketSnapshotSchedule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   QuObjectBucketSnapshotScheduleSpec   `json:"spec,omitempty"`
+	Status QuObjectBucketSnapshotScheduleStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// QuObjectBucketSnapshotScheduleList contains a list of QuObjectBucketSnapshotSchedule
+type QuObjectBucketSnapshotScheduleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []QuObjectBucketSnapshotSchedule `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&QuObjectBucketSnapshotSchedule{}, &QuObjectBucketSnapshotScheduleList{})
+}
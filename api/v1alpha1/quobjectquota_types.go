@@ -0,0 +1,59 @@
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ResourceClaims is the number of QuObjectBucketClaims in a namespace, as
+// limited by a QuObjectQuota
+const ResourceClaims corev1.ResourceName = "quobjectbucketclaims"
+
+// QuObjectQuotaSpec defines the limits of the claims in a namespace
+type QuObjectQuotaSpec struct {
+	// Hard limits the claims in the namespace: requests.storage caps the
+	// total capacity they request with resources.requests.storage or
+	// quota.maxSize, and quobjectbucketclaims their number
+	// +optional
+	Hard corev1.ResourceList `json:"hard,omitempty"`
+}
+
+// QuObjectQuotaStatus defines the observed state of QuObjectQuota
+type QuObjectQuotaStatus struct {
+	// Hard is the enforced limits, copied from the spec
+	// +optional
+	Hard corev1.ResourceList `json:"hard,omitempty"`
+
+	// Used is what the claims in the namespace count against the limits
+	// +optional
+	Used corev1.ResourceList `json:"used,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=qoq
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// QuObjectQuota limits the capacity the claims in its namespace may request
+// in total, like a ResourceQuota does for PersistentVolumeClaims. Claims
+// beyond it are denied at admission and are not provisioned.
+type QuObjectQuota struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   QuObjectQuotaSpec   `json:"spec,omitempty"`
+	Status QuObjectQuotaStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// QuObjectQuotaList contains a list of QuObjectQuota
+type QuObjectQuotaList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []QuObjectQuota `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&QuObjectQuota{}, &QuObjectQuotaList{})
+}
@@ -0,0 +1,70 @@
+package v1alpha1
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// StorageRequest returns the capacity requested for the claim:
+// resources.requests.storage, or the legacy quota.maxSize. Nil means
+// unlimited.
+func StorageRequest(claim *QuObjectBucketClaim) *resource.Quantity {
+	if res := claim.Spec.Resources; res != nil {
+		if storage, ok := res.Requests[corev1.ResourceStorage]; ok {
+			return &storage
+		}
+	}
+	if quota := claim.Spec.Quota; quota != nil {
+		return quota.MaxSize
+	}
+	return nil
+}
+
+// QuotaUsage returns what the claims count against a QuObjectQuota in
+// their namespace: their number and the total capacity they request
+func QuotaUsage(claims []QuObjectBucketClaim) corev1.ResourceList {
+	storage := resource.NewQuantity(0, resource.BinarySI)
+	for i := range claims {
+		if size := StorageRequest(&claims[i]); size != nil {
+			storage.Add(*size)
+		}
+	}
+	return corev1.ResourceList{
+		ResourceClaims:                 *resource.NewQuantity(int64(len(claims)), resource.DecimalSI),
+		corev1.ResourceRequestsStorage: *storage,
+	}
+}
+
+// CheckQuota verifies that the quota admits claim next to the other claims
+// of its namespace. old is the claim's previous version, nil for a new
+// claim. Like a ResourceQuota, the quota only rejects claims that add to a
+// resource that is over its limit, so lowering a limit never blocks claims
+// that keep their requests, and a quota on requests.storage requires claims
+// to request storage.
+func CheckQuota(quota *QuObjectQuota, others []QuObjectBucketClaim, old, claim *QuObjectBucketClaim) error {
+	hard := quota.Spec.Hard
+	if _, ok := hard[corev1.ResourceRequestsStorage]; ok && StorageRequest(claim) == nil &&
+		(old == nil || StorageRequest(old) != nil) {
+		return fmt.Errorf("quota %s limits %s, so the claim must set resources.requests.storage",
+			quota.Name, corev1.ResourceRequestsStorage)
+	}
+	before := QuotaUsage(others)
+	if old != nil {
+		before = QuotaUsage(append(others[:len(others):len(others)], *old))
+	}
+	after := QuotaUsage(append(others[:len(others):len(others)], *claim))
+	for _, name := range []corev1.ResourceName{corev1.ResourceRequestsStorage, ResourceClaims} {
+		limit, ok := hard[name]
+		if !ok {
+			continue
+		}
+		used, prev := after[name], before[name]
+		if used.Cmp(prev) > 0 && used.Cmp(limit) > 0 {
+			return fmt.Errorf("exceeded quota %s: %s would use %s, limited to %s",
+				quota.Name, name, used.String(), limit.String())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package v1alpha1
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AnnotationShare requests a presigned URL for one object of the claim's
+// bucket, e.g. "key=reports/q3.pdf,ttl=1h". The URL is published in
+// status.share and an Event.
+const AnnotationShare = "quobject.io/share"
+
+// DefaultShareTTL is the lifetime of a share without a ttl
+const DefaultShareTTL = time.Hour
+
+// MaxShareTTL is the longest lifetime of a presigned URL signed with
+// Signature Version 4
+const MaxShareTTL = 7 * 24 * time.Hour
+
+// ParseShare parses the value of the quobject.io/share annotation into the
+// object key and the lifetime of the URL
+func ParseShare(value string) (string, time.Duration, error) {
+	var key string
+	ttl := DefaultShareTTL
+	for _, field := range strings.Split(value, ",") {
+		name, v, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			return "", 0, fmt.Errorf("%q is not a name=value pair", field)
+		}
+		switch name {
+		case "key":
+			key = strings.TrimPrefix(v, "/")
+		case "ttl":
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid ttl: %w", err)
+			}
+			if d <= 0 || d > MaxShareTTL {
+				return "", 0, fmt.Errorf("ttl %s must be positive and at most %s", v, MaxShareTTL)
+			}
+			ttl = d
+		default:
+			return "", 0, fmt.Errorf("unknown field %q: must be key or ttl", name)
+		}
+	}
+	if key == "" {
+		return "", 0, fmt.Errorf("key is required")
+	}
+	return key, ttl, nil
+}
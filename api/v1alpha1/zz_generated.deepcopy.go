@@ -21,16 +21,262 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BucketAccessStatus) DeepCopyInto(out *BucketAccessStatus) {
+	*out = *in
+	in.WindowStart.DeepCopyInto(&out.WindowStart)
+	if in.WritableUntil != nil {
+		in, out := &in.WritableUntil, &out.WritableUntil
+		*out = (*in).DeepCopy()
+	}
+	if in.ReadOnlySince != nil {
+		in, out := &in.ReadOnlySince, &out.ReadOnlySince
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BucketAccessStatus.
+func (in *BucketAccessStatus) DeepCopy() *BucketAccessStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(BucketAccessStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BucketCredentials) DeepCopyInto(out *BucketCredentials) {
+	*out = *in
+	if in.Duration != nil {
+		in, out := &in.Duration, &out.Duration
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BucketCredentials.
+func (in *BucketCredentials) DeepCopy() *BucketCredentials {
+	if in == nil {
+		return nil
+	}
+	out := new(BucketCredentials)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BucketDataSource) DeepCopyInto(out *BucketDataSource) {
+	*out = *in
+	if in.ClaimRef != nil {
+		in, out := &in.ClaimRef, &out.ClaimRef
+		*out = new(ClaimReference)
+		**out = **in
+	}
+	if in.SnapshotRef != nil {
+		in, out := &in.SnapshotRef, &out.SnapshotRef
+		*out = new(SnapshotReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BucketDataSource.
+func (in *BucketDataSource) DeepCopy() *BucketDataSource {
+	if in == nil {
+		return nil
+	}
+	out := new(BucketDataSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BucketEncryption) DeepCopyInto(out *BucketEncryption) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BucketEncryption.
+func (in *BucketEncryption) DeepCopy() *BucketEncryption {
+	if in == nil {
+		return nil
+	}
+	out := new(BucketEncryption)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BucketMigrationStatus) DeepCopyInto(out *BucketMigrationStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BucketMigrationStatus.
+func (in *BucketMigrationStatus) DeepCopy() *BucketMigrationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(BucketMigrationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BucketQuota) DeepCopyInto(out *BucketQuota) {
+	*out = *in
+	if in.MaxSize != nil {
+		in, out := &in.MaxSize, &out.MaxSize
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BucketQuota.
+func (in *BucketQuota) DeepCopy() *BucketQuota {
+	if in == nil {
+		return nil
+	}
+	out := new(BucketQuota)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BucketResources) DeepCopyInto(out *BucketResources) {
+	*out = *in
+	if in.Requests != nil {
+		in, out := &in.Requests, &out.Requests
+		*out = make(corev1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BucketResources.
+func (in *BucketResources) DeepCopy() *BucketResources {
+	if in == nil {
+		return nil
+	}
+	out := new(BucketResources)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BucketUsage) DeepCopyInto(out *BucketUsage) {
+	*out = *in
+	if in.LastUpdated != nil {
+		in, out := &in.LastUpdated, &out.LastUpdated
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BucketUsage.
+func (in *BucketUsage) DeepCopy() *BucketUsage {
+	if in == nil {
+		return nil
+	}
+	out := new(BucketUsage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClaimReference) DeepCopyInto(out *ClaimReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClaimReference.
+func (in *ClaimReference) DeepCopy() *ClaimReference {
+	if in == nil {
+		return nil
+	}
+	out := new(ClaimReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CredentialsSecretReference) DeepCopyInto(out *CredentialsSecretReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CredentialsSecretReference.
+func (in *CredentialsSecretReference) DeepCopy() *CredentialsSecretReference {
+	if in == nil {
+		return nil
+	}
+	out := new(CredentialsSecretReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CredentialsUserStatus) DeepCopyInto(out *CredentialsUserStatus) {
+	*out = *in
+	if in.Buckets != nil {
+		in, out := &in.Buckets, &out.Buckets
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CredentialsUserStatus.
+func (in *CredentialsUserStatus) DeepCopy() *CredentialsUserStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CredentialsUserStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LifecycleRule) DeepCopyInto(out *LifecycleRule) {
+	*out = *in
+	if in.ExpirationDays != nil {
+		in, out := &in.ExpirationDays, &out.ExpirationDays
+		*out = new(int32)
+		**out = **in
+	}
+	if in.NoncurrentVersionExpirationDays != nil {
+		in, out := &in.NoncurrentVersionExpirationDays, &out.NoncurrentVersionExpirationDays
+		*out = new(int32)
+		**out = **in
+	}
+	if in.AbortIncompleteMultipartUploadDays != nil {
+		in, out := &in.AbortIncompleteMultipartUploadDays, &out.AbortIncompleteMultipartUploadDays
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LifecycleRule.
+func (in *LifecycleRule) DeepCopy() *LifecycleRule {
+	if in == nil {
+		return nil
+	}
+	out := new(LifecycleRule)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *QuObjectBucketClaim) DeepCopyInto(out *QuObjectBucketClaim) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuObjectBucketClaim.
@@ -51,6 +297,126 @@ func (in *QuObjectBucketClaim) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QuObjectBucketClaimClass) DeepCopyInto(out *QuObjectBucketClaimClass) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuObjectBucketClaimClass.
+func (in *QuObjectBucketClaimClass) DeepCopy() *QuObjectBucketClaimClass {
+	if in == nil {
+		return nil
+	}
+	out := new(QuObjectBucketClaimClass)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *QuObjectBucketClaimClass) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QuObjectBucketClaimClassList) DeepCopyInto(out *QuObjectBucketClaimClassList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]QuObjectBucketClaimClass, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuObjectBucketClaimClassList.
+func (in *QuObjectBucketClaimClassList) DeepCopy() *QuObjectBucketClaimClassList {
+	if in == nil {
+		return nil
+	}
+	out := new(QuObjectBucketClaimClassList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *QuObjectBucketClaimClassList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QuObjectBucketClaimClassSpec) DeepCopyInto(out *QuObjectBucketClaimClassSpec) {
+	*out = *in
+	if in.Credentials != nil {
+		in, out := &in.Credentials, &out.Credentials
+		*out = new(BucketCredentials)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(BucketResources)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Quota != nil {
+		in, out := &in.Quota, &out.Quota
+		*out = new(BucketQuota)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ConfigMapHistoryLimit != nil {
+		in, out := &in.ConfigMapHistoryLimit, &out.ConfigMapHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.SecretHistoryLimit != nil {
+		in, out := &in.SecretHistoryLimit, &out.SecretHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.UsagePollInterval != nil {
+		in, out := &in.UsagePollInterval, &out.UsagePollInterval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.VerifyInterval != nil {
+		in, out := &in.VerifyInterval, &out.VerifyInterval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.OperationTimeout != nil {
+		in, out := &in.OperationTimeout, &out.OperationTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuObjectBucketClaimClassSpec.
+func (in *QuObjectBucketClaimClassSpec) DeepCopy() *QuObjectBucketClaimClassSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(QuObjectBucketClaimClassSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *QuObjectBucketClaimList) DeepCopyInto(out *QuObjectBucketClaimList) {
 	*out = *in
@@ -86,6 +452,31 @@ func (in *QuObjectBucketClaimList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *QuObjectBucketClaimSpec) DeepCopyInto(out *QuObjectBucketClaimSpec) {
 	*out = *in
+	if in.Credentials != nil {
+		in, out := &in.Credentials, &out.Credentials
+		*out = new(BucketCredentials)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ServiceAccounts != nil {
+		in, out := &in.ServiceAccounts, &out.ServiceAccounts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ConfigMapHistoryLimit != nil {
+		in, out := &in.ConfigMapHistoryLimit, &out.ConfigMapHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.SecretHistoryLimit != nil {
+		in, out := &in.SecretHistoryLimit, &out.SecretHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.DataSource != nil {
+		in, out := &in.DataSource, &out.DataSource
+		*out = new(BucketDataSource)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.AdditionalConfig != nil {
 		in, out := &in.AdditionalConfig, &out.AdditionalConfig
 		*out = make(map[string]string, len(*in))
@@ -93,6 +484,48 @@ func (in *QuObjectBucketClaimSpec) DeepCopyInto(out *QuObjectBucketClaimSpec) {
 			(*out)[key] = val
 		}
 	}
+	if in.UsagePollInterval != nil {
+		in, out := &in.UsagePollInterval, &out.UsagePollInterval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.VerifyInterval != nil {
+		in, out := &in.VerifyInterval, &out.VerifyInterval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.OperationTimeout != nil {
+		in, out := &in.OperationTimeout, &out.OperationTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(BucketResources)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Quota != nil {
+		in, out := &in.Quota, &out.Quota
+		*out = new(BucketQuota)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.WriteWindow != nil {
+		in, out := &in.WriteWindow, &out.WriteWindow
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Encryption != nil {
+		in, out := &in.Encryption, &out.Encryption
+		*out = new(BucketEncryption)
+		**out = **in
+	}
+	if in.LifecycleRules != nil {
+		in, out := &in.LifecycleRules, &out.LifecycleRules
+		*out = make([]LifecycleRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuObjectBucketClaimSpec.
@@ -108,6 +541,76 @@ func (in *QuObjectBucketClaimSpec) DeepCopy() *QuObjectBucketClaimSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *QuObjectBucketClaimStatus) DeepCopyInto(out *QuObjectBucketClaimStatus) {
 	*out = *in
+	if in.CredentialsExpiration != nil {
+		in, out := &in.CredentialsExpiration, &out.CredentialsExpiration
+		*out = (*in).DeepCopy()
+	}
+	if in.CredentialsUser != nil {
+		in, out := &in.CredentialsUser, &out.CredentialsUser
+		*out = new(CredentialsUserStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ServiceAccounts != nil {
+		in, out := &in.ServiceAccounts, &out.ServiceAccounts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Migration != nil {
+		in, out := &in.Migration, &out.Migration
+		*out = new(BucketMigrationStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Capacity != nil {
+		in, out := &in.Capacity, &out.Capacity
+		*out = make(corev1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+	if in.Used != nil {
+		in, out := &in.Used, &out.Used
+		*out = make(corev1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+	if in.Usage != nil {
+		in, out := &in.Usage, &out.Usage
+		*out = new(BucketUsage)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Snapshots != nil {
+		in, out := &in.Snapshots, &out.Snapshots
+		*out = new(SnapshotUsage)
+		**out = **in
+	}
+	if in.Share != nil {
+		in, out := &in.Share, &out.Share
+		*out = new(ShareStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Access != nil {
+		in, out := &in.Access, &out.Access
+		*out = new(BucketAccessStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Encryption != nil {
+		in, out := &in.Encryption, &out.Encryption
+		*out = new(BucketEncryption)
+		**out = **in
+	}
+	if in.Quobyte != nil {
+		in, out := &in.Quobyte, &out.Quobyte
+		*out = new(QuobyteVolumeStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuObjectBucketClaimStatus.
@@ -119,3 +622,572 @@ func (in *QuObjectBucketClaimStatus) DeepCopy() *QuObjectBucketClaimStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QuObjectBucketClass) DeepCopyInto(out *QuObjectBucketClass) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuObjectBucketClass.
+func (in *QuObjectBucketClass) DeepCopy() *QuObjectBucketClass {
+	if in == nil {
+		return nil
+	}
+	out := new(QuObjectBucketClass)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *QuObjectBucketClass) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QuObjectBucketClassList) DeepCopyInto(out *QuObjectBucketClassList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]QuObjectBucketClass, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuObjectBucketClassList.
+func (in *QuObjectBucketClassList) DeepCopy() *QuObjectBucketClassList {
+	if in == nil {
+		return nil
+	}
+	out := new(QuObjectBucketClassList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *QuObjectBucketClassList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QuObjectBucketClassSpec) DeepCopyInto(out *QuObjectBucketClassSpec) {
+	*out = *in
+	out.CredentialsSecretRef = in.CredentialsSecretRef
+	if in.ForcePathStyle != nil {
+		in, out := &in.ForcePathStyle, &out.ForcePathStyle
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuObjectBucketClassSpec.
+func (in *QuObjectBucketClassSpec) DeepCopy() *QuObjectBucketClassSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(QuObjectBucketClassSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QuObjectBucketMigration) DeepCopyInto(out *QuObjectBucketMigration) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuObjectBucketMigration.
+func (in *QuObjectBucketMigration) DeepCopy() *QuObjectBucketMigration {
+	if in == nil {
+		return nil
+	}
+	out := new(QuObjectBucketMigration)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *QuObjectBucketMigration) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QuObjectBucketMigrationList) DeepCopyInto(out *QuObjectBucketMigrationList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]QuObjectBucketMigration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuObjectBucketMigrationList.
+func (in *QuObjectBucketMigrationList) DeepCopy() *QuObjectBucketMigrationList {
+	if in == nil {
+		return nil
+	}
+	out := new(QuObjectBucketMigrationList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *QuObjectBucketMigrationList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QuObjectBucketMigrationSpec) DeepCopyInto(out *QuObjectBucketMigrationSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuObjectBucketMigrationSpec.
+func (in *QuObjectBucketMigrationSpec) DeepCopy() *QuObjectBucketMigrationSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(QuObjectBucketMigrationSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QuObjectBucketMigrationStatus) DeepCopyInto(out *QuObjectBucketMigrationStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuObjectBucketMigrationStatus.
+func (in *QuObjectBucketMigrationStatus) DeepCopy() *QuObjectBucketMigrationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(QuObjectBucketMigrationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QuObjectBucketSnapshot) DeepCopyInto(out *QuObjectBucketSnapshot) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuObjectBucketSnapshot.
+func (in *QuObjectBucketSnapshot) DeepCopy() *QuObjectBucketSnapshot {
+	if in == nil {
+		return nil
+	}
+	out := new(QuObjectBucketSnapshot)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *QuObjectBucketSnapshot) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QuObjectBucketSnapshotList) DeepCopyInto(out *QuObjectBucketSnapshotList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]QuObjectBucketSnapshot, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuObjectBucketSnapshotList.
+func (in *QuObjectBucketSnapshotList) DeepCopy() *QuObjectBucketSnapshotList {
+	if in == nil {
+		return nil
+	}
+	out := new(QuObjectBucketSnapshotList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *QuObjectBucketSnapshotList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QuObjectBucketSnapshotSchedule) DeepCopyInto(out *QuObjectBucketSnapshotSchedule) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuObjectBucketSnapshotSchedule.
+func (in *QuObjectBucketSnapshotSchedule) DeepCopy() *QuObjectBucketSnapshotSchedule {
+	if in == nil {
+		return nil
+	}
+	out := new(QuObjectBucketSnapshotSchedule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *QuObjectBucketSnapshotSchedule) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QuObjectBucketSnapshotScheduleList) DeepCopyInto(out *QuObjectBucketSnapshotScheduleList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]QuObjectBucketSnapshotSchedule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuObjectBucketSnapshotScheduleList.
+func (in *QuObjectBucketSnapshotScheduleList) DeepCopy() *QuObjectBucketSnapshotScheduleList {
+	if in == nil {
+		return nil
+	}
+	out := new(QuObjectBucketSnapshotScheduleList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *QuObjectBucketSnapshotScheduleList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QuObjectBucketSnapshotScheduleSpec) DeepCopyInto(out *QuObjectBucketSnapshotScheduleSpec) {
+	*out = *in
+	out.Interval = in.Interval
+	if in.Retention != nil {
+		in, out := &in.Retention, &out.Retention
+		*out = new(SnapshotRetention)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuObjectBucketSnapshotScheduleSpec.
+func (in *QuObjectBucketSnapshotScheduleSpec) DeepCopy() *QuObjectBucketSnapshotScheduleSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(QuObjectBucketSnapshotScheduleSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QuObjectBucketSnapshotScheduleStatus) DeepCopyInto(out *QuObjectBucketSnapshotScheduleStatus) {
+	*out = *in
+	if in.LastSnapshotTime != nil {
+		in, out := &in.LastSnapshotTime, &out.LastSnapshotTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuObjectBucketSnapshotScheduleStatus.
+func (in *QuObjectBucketSnapshotScheduleStatus) DeepCopy() *QuObjectBucketSnapshotScheduleStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(QuObjectBucketSnapshotScheduleStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QuObjectBucketSnapshotSpec) DeepCopyInto(out *QuObjectBucketSnapshotSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuObjectBucketSnapshotSpec.
+func (in *QuObjectBucketSnapshotSpec) DeepCopy() *QuObjectBucketSnapshotSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(QuObjectBucketSnapshotSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QuObjectBucketSnapshotStatus) DeepCopyInto(out *QuObjectBucketSnapshotStatus) {
+	*out = *in
+	if in.CreationTime != nil {
+		in, out := &in.CreationTime, &out.CreationTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuObjectBucketSnapshotStatus.
+func (in *QuObjectBucketSnapshotStatus) DeepCopy() *QuObjectBucketSnapshotStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(QuObjectBucketSnapshotStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QuObjectQuota) DeepCopyInto(out *QuObjectQuota) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuObjectQuota.
+func (in *QuObjectQuota) DeepCopy() *QuObjectQuota {
+	if in == nil {
+		return nil
+	}
+	out := new(QuObjectQuota)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *QuObjectQuota) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QuObjectQuotaList) DeepCopyInto(out *QuObjectQuotaList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]QuObjectQuota, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuObjectQuotaList.
+func (in *QuObjectQuotaList) DeepCopy() *QuObjectQuotaList {
+	if in == nil {
+		return nil
+	}
+	out := new(QuObjectQuotaList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *QuObjectQuotaList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QuObjectQuotaSpec) DeepCopyInto(out *QuObjectQuotaSpec) {
+	*out = *in
+	if in.Hard != nil {
+		in, out := &in.Hard, &out.Hard
+		*out = make(corev1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuObjectQuotaSpec.
+func (in *QuObjectQuotaSpec) DeepCopy() *QuObjectQuotaSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(QuObjectQuotaSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QuObjectQuotaStatus) DeepCopyInto(out *QuObjectQuotaStatus) {
+	*out = *in
+	if in.Hard != nil {
+		in, out := &in.Hard, &out.Hard
+		*out = make(corev1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+	if in.Used != nil {
+		in, out := &in.Used, &out.Used
+		*out = make(corev1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuObjectQuotaStatus.
+func (in *QuObjectQuotaStatus) DeepCopy() *QuObjectQuotaStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(QuObjectQuotaStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QuobyteVolumeStatus) DeepCopyInto(out *QuobyteVolumeStatus) {
+	*out = *in
+	if in.Quota != nil {
+		in, out := &in.Quota, &out.Quota
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuobyteVolumeStatus.
+func (in *QuobyteVolumeStatus) DeepCopy() *QuobyteVolumeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(QuobyteVolumeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ShareStatus) DeepCopyInto(out *ShareStatus) {
+	*out = *in
+	in.Expiration.DeepCopyInto(&out.Expiration)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ShareStatus.
+func (in *ShareStatus) DeepCopy() *ShareStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ShareStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SnapshotReference) DeepCopyInto(out *SnapshotReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SnapshotReference.
+func (in *SnapshotReference) DeepCopy() *SnapshotReference {
+	if in == nil {
+		return nil
+	}
+	out := new(SnapshotReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SnapshotRetention) DeepCopyInto(out *SnapshotRetention) {
+	*out = *in
+	if in.Count != nil {
+		in, out := &in.Count, &out.Count
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxAge != nil {
+		in, out := &in.MaxAge, &out.MaxAge
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SnapshotRetention.
+func (in *SnapshotRetention) DeepCopy() *SnapshotRetention {
+	if in == nil {
+		return nil
+	}
+	out := new(SnapshotRetention)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SnapshotUsage) DeepCopyInto(out *SnapshotUsage) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SnapshotUsage.
+func (in *SnapshotUsage) DeepCopy() *SnapshotUsage {
+	if in == nil {
+		return nil
+	}
+	out := new(SnapshotUsage)
+	in.DeepCopyInto(out)
+	return out
+}
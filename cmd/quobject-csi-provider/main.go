@@ -0,0 +1,97 @@
+// Command quobject-csi-provider is a Secrets Store CSI driver provider that
+// mounts the credentials of QuObjectBucketClaims into pods. It runs as a
+// DaemonSet next to the driver on every node.
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/controllers"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+	"github.com/pamvdam71/quobject-controller/internal/csiprovider"
+	"github.com/pamvdam71/quobject-controller/internal/logging"
+)
+
+// providerName is the provider name SecretProviderClasses select
+const providerName = "quobject"
+
+var (
+	scheme   = runtime.NewScheme()
+	setupLog = ctrl.Log.WithName("setup")
+)
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(quv1.AddToScheme(scheme))
+}
+
+func main() {
+	var providerDir string
+	var s3QPS float64
+	var s3Burst int
+	flag.StringVar(
+		&providerDir,
+		"provider-dir",
+		"/etc/kubernetes/secrets-store-csi-providers",
+		"Directory the Secrets Store CSI driver looks for provider sockets in.",
+	)
+	flag.Float64Var(
+		&s3QPS,
+		"s3-qps",
+		0,
+		"Maximum STS requests per second across all backends (0 disables rate limiting).",
+	)
+	flag.IntVar(
+		&s3Burst,
+		"s3-burst",
+		10,
+		"Maximum burst of STS requests allowed above s3-qps.",
+	)
+	opts := zap.Options{}
+	opts.BindFlags(flag.CommandLine)
+	flag.Parse()
+	// Credentials registered by the backends are scrubbed from every log line
+	ctrl.SetLogger(logging.NewRedactingLogger(zap.New(zap.UseFlagOptions(&opts))))
+
+	// Claims and backend secrets are read uncached on every mount
+	c, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+	if err != nil {
+		setupLog.Error(err, "unable to create client")
+		os.Exit(1)
+	}
+	server := &csiprovider.Server{
+		Provider: &controllers.CSIProvider{
+			Client:        c,
+			S3RateLimiter: backend.NewRateLimiter(s3QPS, s3Burst),
+		},
+		Name:    providerName,
+		Version: version(),
+	}
+
+	socket := filepath.Join(providerDir, providerName+".sock")
+	setupLog.Info("serving provider", "socket", socket)
+	ctx := ctrl.LoggerInto(ctrl.SetupSignalHandler(), ctrl.Log.WithName("csi-provider"))
+	if err := server.Serve(ctx, socket); err != nil {
+		setupLog.Error(err, "problem serving provider")
+		os.Exit(1)
+	}
+}
+
+// version returns the module version the binary was built from
+func version() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "devel"
+}
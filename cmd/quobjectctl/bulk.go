@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+)
+
+// Claim annotations set by bulk operations
+const (
+	// annotationVerifyRequested changes the claim, which makes the controller
+	// reconcile and thereby verify it
+	annotationVerifyRequested = "quobject.io/verify-requested-at"
+	// annotationRotateCredentials asks the controller to publish new
+	// credentials for the claim
+	annotationRotateCredentials = "quobject.io/rotate-credentials"
+)
+
+// bulkAction changes one claim in place. It returns a description of the
+// change, or an empty one if the claim is left as it is, with the reason in
+// skip.
+type bulkAction func(ctx context.Context, c client.Client, claim *quv1.QuObjectBucketClaim) (change, skip string, err error)
+
+// bulkResult is the outcome of a bulk operation on one claim
+type bulkResult struct {
+	claim  client.ObjectKey
+	result string
+	detail string
+}
+
+var bulkActions = map[string]string{
+	"relabel":            "Set or remove labels of the claims",
+	"verify":             "Have the controller verify and repair the claims now",
+	"rotate-credentials": "Publish new credentials for temporary, dedicated and Quobyte claims",
+	"retain-policy":      "Change spec.retainPolicy of the claims",
+}
+
+func runBulk(args []string) int {
+	if len(args) == 0 || bulkActions[args[0]] == "" {
+		bulkUsage()
+		return 2
+	}
+	name := args[0]
+	fs := flag.NewFlagSet("bulk "+name, flag.ExitOnError)
+	namespace := fs.String("namespace", "", "Only change claims in this namespace.")
+	selector := fs.String("selector", "", "Only change claims matching this label selector, e.g. team=a,tier!=critical.")
+	kubeconfig := fs.String("kubeconfig", "", "Path to the kubeconfig (defaults to $KUBECONFIG, ~/.kube/config or in-cluster).")
+	dryRun := fs.Bool("dry-run", false, "Only report the changes that would be made.")
+	timeout := fs.Duration("timeout", 5*time.Minute, "Timeout for the whole operation.")
+	set := fs.String("set", "", "relabel: labels to set, as key=value pairs separated by commas.")
+	remove := fs.String("remove", "", "relabel: label keys to remove, separated by commas.")
+	policy := fs.String("policy", "", "retain-policy: the new retain policy, Retain or Delete.")
+	fs.Parse(args[1:])
+
+	var action bulkAction
+	switch name {
+	case "relabel":
+		toSet, err := parseLabelPairs(*set)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --set: %v\n", err)
+			return 2
+		}
+		var toRemove []string
+		for _, key := range strings.Split(*remove, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				toRemove = append(toRemove, key)
+			}
+		}
+		if len(toSet) == 0 && len(toRemove) == 0 {
+			fmt.Fprintln(os.Stderr, "relabel requires --set or --remove")
+			return 2
+		}
+		action = relabel(toSet, toRemove)
+	case "verify":
+		action = requestVerify(time.Now())
+	case "rotate-credentials":
+		action = requestRotation
+	case "retain-policy":
+		p := quv1.RetainPolicy(*policy)
+		if p != quv1.RetainPolicyRetain && p != quv1.RetainPolicyDelete {
+			fmt.Fprintf(os.Stderr, "invalid --policy %q: must be Retain or Delete\n", *policy)
+			return 2
+		}
+		action = setRetainPolicy(p)
+	}
+
+	sel, err := labels.Parse(*selector)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid --selector: %v\n", err)
+		return 2
+	}
+	c, err := newClient(*kubeconfig)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	var list quv1.QuObjectBucketClaimList
+	if err := c.List(ctx, &list, client.InNamespace(*namespace), client.MatchingLabelsSelector{Selector: sel}); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to list claims: %v\n", err)
+		return 1
+	}
+	sort.Slice(list.Items, func(i, j int) bool {
+		a, b := list.Items[i], list.Items[j]
+		return a.Namespace < b.Namespace || (a.Namespace == b.Namespace && a.Name < b.Name)
+	})
+
+	results := make([]bulkResult, 0, len(list.Items))
+	for i := range list.Items {
+		results = append(results, applyBulk(ctx, c, &list.Items[i], action, *dryRun))
+	}
+	writeBulkResults(os.Stdout, results)
+	for _, r := range results {
+		if r.result == resultFail {
+			return 1
+		}
+	}
+	return 0
+}
+
+func bulkUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: quobjectctl bulk <action> [--namespace ns] [--selector labels] [--dry-run] [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Actions:")
+	names := make([]string, 0, len(bulkActions))
+	for name := range bulkActions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-20s %s\n", name, bulkActions[name])
+	}
+}
+
+// applyBulk runs the action on a copy of the claim and patches the claim
+// with the result, unless dryRun is set
+func applyBulk(ctx context.Context, c client.Client, claim *quv1.QuObjectBucketClaim, action bulkAction, dryRun bool) bulkResult {
+	res := bulkResult{claim: client.ObjectKeyFromObject(claim)}
+	if !claim.DeletionTimestamp.IsZero() {
+		res.result, res.detail = resultSkip, "claim is being deleted"
+		return res
+	}
+	patch := client.MergeFrom(claim.DeepCopy())
+	change, skip, err := action(ctx, c, claim)
+	switch {
+	case err != nil:
+		res.result, res.detail = resultFail, err.Error()
+	case change == "":
+		res.result, res.detail = resultSkip, skip
+	case dryRun:
+		res.result, res.detail = resultPass, "would "+change
+	default:
+		if err := c.Patch(ctx, claim, patch); err != nil {
+			res.result, res.detail = resultFail, fmt.Sprintf("failed to %s: %v", change, err)
+			break
+		}
+		res.result, res.detail = resultPass, change
+	}
+	return res
+}
+
+// parseLabelPairs parses "key=value,key=value"
+func parseLabelPairs(s string) (map[string]string, error) {
+	pairs := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%q is not a key=value pair", pair)
+		}
+		pairs[key] = value
+	}
+	return pairs, nil
+}
+
+// relabel sets and removes labels. Labels mapped to bucket tags with the
+// controller's --label-tags are retagged on the next reconcile.
+func relabel(toSet map[string]string, toRemove []string) bulkAction {
+	return func(_ context.Context, _ client.Client, claim *quv1.QuObjectBucketClaim) (string, string, error) {
+		var changes []string
+		for _, key := range toRemove {
+			if _, ok := claim.Labels[key]; ok {
+				delete(claim.Labels, key)
+				changes = append(changes, "-"+key)
+			}
+		}
+		keys := make([]string, 0, len(toSet))
+		for key := range toSet {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if current, ok := claim.Labels[key]; ok && current == toSet[key] {
+				continue
+			}
+			if claim.Labels == nil {
+				claim.Labels = map[string]string{}
+			}
+			claim.Labels[key] = toSet[key]
+			changes = append(changes, "+"+key+"="+toSet[key])
+		}
+		if len(changes) == 0 {
+			return "", "labels already match", nil
+		}
+		return "relabel " + strings.Join(changes, " "), "", nil
+	}
+}
+
+// requestVerify annotates the claims with the request time, which triggers
+// a reconcile that verifies the bucket and repairs the generated objects
+func requestVerify(now time.Time) bulkAction {
+	return func(_ context.Context, _ client.Client, claim *quv1.QuObjectBucketClaim) (string, string, error) {
+		if claim.Spec.Hibernate {
+			return "", "claim is hibernated", nil
+		}
+		if claim.Annotations == nil {
+			claim.Annotations = map[string]string{}
+		}
+		claim.Annotations[annotationVerifyRequested] = now.UTC().Format(time.RFC3339)
+		return "request verification", "", nil
+	}
+}
+
+// requestRotation asks the controller for new credentials. Static claims
+// publish the backend's keys, which are rotated with the backend instead.
+func requestRotation(ctx context.Context, c client.Client, claim *quv1.QuObjectBucketClaim) (string, string, error) {
+	if claim.Spec.Hibernate {
+		return "", "claim is hibernated", nil
+	}
+	if claim.Annotations[annotationRotateCredentials] == "true" {
+		return "", "rotation already requested", nil
+	}
+	mode := quv1.CredentialsModeStatic
+	if claim.Spec.Credentials != nil && claim.Spec.Credentials.Mode != "" {
+		mode = claim.Spec.Credentials.Mode
+	}
+	if mode == quv1.CredentialsModeStatic {
+		name := claim.Annotations[annotationBackend]
+		if name == "" {
+			return "", "claim is not provisioned yet", nil
+		}
+		cfg, err := backend.Load(ctx, c, name)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to load backend %s: %w", name, err)
+		}
+		if !cfg.Quobyte.Enabled() {
+			return "", "static credentials are the backend's keys; set rotationInterval in the backend secret", nil
+		}
+	}
+	if claim.Annotations == nil {
+		claim.Annotations = map[string]string{}
+	}
+	claim.Annotations[annotationRotateCredentials] = "true"
+	return fmt.Sprintf("request new %s credentials", mode), "", nil
+}
+
+// setRetainPolicy changes the retain policy, which the controller records
+// on the claim on its next reconcile
+func setRetainPolicy(policy quv1.RetainPolicy) bulkAction {
+	return func(_ context.Context, _ client.Client, claim *quv1.QuObjectBucketClaim) (string, string, error) {
+		if claim.Spec.RetainPolicy == policy {
+			return "", "retain policy is already " + string(policy), nil
+		}
+		from := claim.Spec.RetainPolicy
+		if from == "" {
+			from = claim.Status.RetainPolicy
+		}
+		if from == "" {
+			from = "the backend default"
+		}
+		claim.Spec.RetainPolicy = policy
+		return fmt.Sprintf("change retain policy from %s to %s", from, policy), "", nil
+	}
+}
+
+func writeBulkResults(w io.Writer, results []bulkResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CLAIM\tRESULT\tDETAIL")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", r.claim, r.result, r.detail)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+)
+
+// Check results
+const (
+	resultPass = "PASS"
+	resultWarn = "WARN"
+	resultFail = "FAIL"
+	resultSkip = "SKIP"
+)
+
+const canaryKey = "quobject-conformance/canary.txt"
+
+// checkResult is one line of the compatibility report
+type checkResult struct {
+	name   string
+	result string
+	detail string
+}
+
+// conformanceSuite runs the S3 operations the controller performs while
+// provisioning and deleting claims, and records how the backend responds
+type conformanceSuite struct {
+	cfg     backend.Config
+	s3c     *s3.Client
+	prefix  string
+	results []checkResult
+}
+
+func runConformance(args []string) int {
+	fs := flag.NewFlagSet("conformance", flag.ExitOnError)
+	endpoint := fs.String("endpoint", "", "S3 endpoint of the backend under test (required).")
+	region := fs.String("region", "us-east-1", "Region of the backend.")
+	accessKey := fs.String("access-key", os.Getenv("AWS_ACCESS_KEY_ID"),
+		"Access key (defaults to $AWS_ACCESS_KEY_ID).")
+	secretKey := fs.String("secret-key", os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		"Secret key (defaults to $AWS_SECRET_ACCESS_KEY).")
+	useSSL := fs.Bool("use-ssl", true, "Use HTTPS for endpoints without a scheme.")
+	insecureSkipVerify := fs.Bool("insecure-skip-verify", false, "Skip TLS certificate verification.")
+	apiProfile := fs.String("api-profile", "", "Compatibility profile of the backend (generic, minio, aws, r2, backblaze, wasabi).")
+	bucketPrefix := fs.String("bucket-prefix", "quobject-conformance", "Prefix of the buckets created by the suite.")
+	timeout := fs.Duration("timeout", 5*time.Minute, "Timeout for the whole suite.")
+	fs.Parse(args)
+
+	if *endpoint == "" {
+		fmt.Fprintln(os.Stderr, "--endpoint is required")
+		fs.Usage()
+		return 2
+	}
+
+	// Build the configuration the same way the controller reads a backend
+	// credentials secret
+	cfg, err := backend.ConfigFromSecret(&corev1.Secret{Data: map[string][]byte{
+		"endpoint":           []byte(*endpoint),
+		"region":             []byte(*region),
+		"accessKey":          []byte(*accessKey),
+		"secretKey":          []byte(*secretKey),
+		"useSSL":             []byte(strconv.FormatBool(*useSSL)),
+		"insecureSkipVerify": []byte(strconv.FormatBool(*insecureSkipVerify)),
+		"apiProfile":         []byte(*apiProfile),
+	}})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	s3c, err := backend.NewS3Client(cfg, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create S3 client: %v\n", err)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	suite := &conformanceSuite{
+		cfg:    cfg,
+		s3c:    s3c,
+		prefix: fmt.Sprintf("%s-%d", *bucketPrefix, time.Now().Unix()),
+	}
+	suite.run(ctx)
+	suite.report(os.Stdout)
+	if suite.failed() {
+		return 1
+	}
+	return 0
+}
+
+func (s *conformanceSuite) record(name, result, detail string) {
+	s.results = append(s.results, checkResult{name: name, result: result, detail: detail})
+}
+
+// check runs fn and records it as passed or failed. It returns whether the
+// check passed.
+func (s *conformanceSuite) check(name string, fn func() error) bool {
+	if err := fn(); err != nil {
+		s.record(name, resultFail, err.Error())
+		return false
+	}
+	s.record(name, resultPass, "")
+	return true
+}
+
+func (s *conformanceSuite) failed() bool {
+	for _, r := range s.results {
+		if r.result == resultFail {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *conformanceSuite) run(ctx context.Context) {
+	deleteBucket := s.prefix + "-delete"
+	retainBucket := s.prefix + "-retain"
+
+	// Claim with retainPolicy Delete
+	if !s.provision(ctx, deleteBucket) {
+		s.record("delete policy removes bucket", resultSkip, "provisioning failed")
+	} else {
+		s.checkPolicy(ctx, deleteBucket)
+		s.check("delete policy removes bucket", func() error {
+			if err := s.removeBucket(ctx, deleteBucket); err != nil {
+				return err
+			}
+			if _, err := s.s3c.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(deleteBucket)}); err == nil {
+				return errors.New("bucket still exists after deletion")
+			}
+			return nil
+		})
+	}
+
+	// Claim with retainPolicy Retain: releasing the claim leaves the data
+	if !s.provision(ctx, retainBucket) {
+		s.record("retain policy keeps bucket", resultSkip, "provisioning failed")
+		return
+	}
+	s.check("retain policy keeps bucket", func() error {
+		_, err := s.s3c.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(retainBucket),
+			Key:    aws.String(canaryKey),
+		})
+		return err
+	})
+	if err := s.removeBucket(ctx, retainBucket); err != nil {
+		s.record("cleanup", resultWarn, fmt.Sprintf("bucket %s was left behind: %v", retainBucket, err))
+	}
+}
+
+// provision runs the checks for creating a claim's bucket, verifying its
+// credentials and writing a canary object. It returns whether the bucket
+// is usable.
+func (s *conformanceSuite) provision(ctx context.Context, bucket string) bool {
+	createCfg := &s3types.CreateBucketConfiguration{
+		LocationConstraint: s3types.BucketLocationConstraint(s.cfg.Region),
+	}
+	if s.cfg.Profile.SkipLocationConstraint {
+		createCfg = nil
+	}
+
+	ok := s.check("create bucket "+bucket, func() error {
+		_, err := s.s3c.CreateBucket(ctx, &s3.CreateBucketInput{
+			Bucket:                    aws.String(bucket),
+			CreateBucketConfiguration: createCfg,
+		})
+		return err
+	})
+	if !ok {
+		return false
+	}
+
+	// Reconciles create buckets idempotently
+	_, err := s.s3c.CreateBucket(ctx, &s3.CreateBucketInput{
+		Bucket:                    aws.String(bucket),
+		CreateBucketConfiguration: createCfg,
+	})
+	switch {
+	case err == nil:
+		s.record("recreate existing bucket", resultPass, "accepted")
+	case s.cfg.Profile.IsBucketExists(err):
+		s.record("recreate existing bucket", resultPass, "recognized as already existing")
+	default:
+		s.record("recreate existing bucket", resultFail,
+			fmt.Sprintf("error not recognized as already existing, try another --api-profile: %v", err))
+	}
+
+	// The generated secret carries the backend credentials, so a client
+	// built from them must reach the bucket
+	ok = s.check("secret credentials reach bucket", func() error {
+		_, err := s.s3c.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucket)})
+		return err
+	})
+	if !ok {
+		return false
+	}
+
+	canary := []byte("quobject conformance canary " + bucket)
+	ok = s.check("write canary object", func() error {
+		_, err := s.s3c.PutObject(ctx, &s3.PutObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(canaryKey),
+			Body:   bytes.NewReader(canary),
+		})
+		return err
+	})
+	if !ok {
+		return false
+	}
+	s.check("read canary object", func() error {
+		out, err := s.s3c.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(canaryKey),
+		})
+		if err != nil {
+			return err
+		}
+		defer out.Body.Close()
+		data, err := io.ReadAll(out.Body)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(data, canary) {
+			return errors.New("canary content differs from what was written")
+		}
+		return nil
+	})
+	s.check("list objects (usage)", func() error {
+		out, err := s.s3c.ListObjectsV2(ctx, &s3.ListObjectsV2Input{Bucket: aws.String(bucket)})
+		if err != nil {
+			return err
+		}
+		for _, obj := range out.Contents {
+			if aws.ToString(obj.Key) == canaryKey {
+				if aws.ToInt64(obj.Size) != int64(len(canary)) {
+					return fmt.Errorf("canary size is %d, want %d", aws.ToInt64(obj.Size), len(canary))
+				}
+				return nil
+			}
+		}
+		return errors.New("canary not listed")
+	})
+	return true
+}
+
+// checkPolicy verifies bucket policy support, which quotas rely on. Missing
+// support is a warning since buckets still work without it.
+func (s *conformanceSuite) checkPolicy(ctx context.Context, bucket string) {
+	policy := fmt.Sprintf(`{"Version":"2012-10-17","Statement":[{"Sid":"QuObjectConformance",`+
+		`"Effect":"Deny","Principal":"*","Action":"s3:PutObject","Resource":"arn:aws:s3:::%s/deny/*"}]}`, bucket)
+	_, err := s.s3c.PutBucketPolicy(ctx, &s3.PutBucketPolicyInput{
+		Bucket: aws.String(bucket),
+		Policy: aws.String(policy),
+	})
+	if err != nil {
+		s.record("bucket policy (quota)", resultWarn, fmt.Sprintf("quotas cannot deny writes: %v", err))
+		return
+	}
+	out, err := s.s3c.GetBucketPolicy(ctx, &s3.GetBucketPolicyInput{Bucket: aws.String(bucket)})
+	if err != nil || !strings.Contains(aws.ToString(out.Policy), "QuObjectConformance") {
+		s.record("bucket policy (quota)", resultWarn, "policy was accepted but not returned")
+	} else {
+		s.record("bucket policy (quota)", resultPass, "")
+	}
+	s.s3c.DeleteBucketPolicy(ctx, &s3.DeleteBucketPolicyInput{Bucket: aws.String(bucket)})
+}
+
+// removeBucket empties and deletes a bucket like the controller does for the
+// Delete retain policy
+func (s *conformanceSuite) removeBucket(ctx context.Context, bucket string) error {
+	paginator := s3.NewListObjectsV2Paginator(s.s3c, &s3.ListObjectsV2Input{Bucket: aws.String(bucket)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list objects: %w", err)
+		}
+		for _, obj := range page.Contents {
+			if _, err := s.s3c.DeleteObject(ctx, &s3.DeleteObjectInput{
+				Bucket: aws.String(bucket),
+				Key:    obj.Key,
+			}); err != nil {
+				return fmt.Errorf("failed to delete object %s: %w", aws.ToString(obj.Key), err)
+			}
+		}
+	}
+	if _, err := s.s3c.DeleteBucket(ctx, &s3.DeleteBucketInput{Bucket: aws.String(bucket)}); err != nil {
+		return fmt.Errorf("failed to delete bucket: %w", err)
+	}
+	return nil
+}
+
+// report prints the compatibility report
+func (s *conformanceSuite) report(out io.Writer) {
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RESULT\tCHECK\tDETAIL")
+	counts := map[string]int{}
+	for _, r := range s.results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", r.result, r.name, r.detail)
+		counts[r.result]++
+	}
+	tw.Flush()
+	fmt.Fprintf(out, "\n%d passed, %d warnings, %d failed, %d skipped\n",
+		counts[resultPass], counts[resultWarn], counts[resultFail], counts[resultSkip])
+	if s.failed() {
+		fmt.Fprintln(out, "Backend is NOT compatible with the controller")
+	} else {
+		fmt.Fprintln(out, "Backend is compatible with the controller")
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+)
+
+// annotationBackend is the claim annotation the controller records the
+// backend secret of a provisioned bucket in
+const annotationBackend = "quobject.io/backend"
+
+// newClient returns a client of the cluster selected by kubeconfig, or of the
+// default kubeconfig if it is empty
+func newClient(kubeconfig string) (client.Client, error) {
+	restCfg, err := config.GetConfig()
+	if kubeconfig != "" {
+		restCfg, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(quv1.AddToScheme(scheme))
+	c, err := client.New(restCfg, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+	return c, nil
+}
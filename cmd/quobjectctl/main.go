@@ -0,0 +1,62 @@
+// Command quobjectctl is the command-line companion of the QuObject
+// controller.
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// command is a quobjectctl subcommand
+type command struct {
+	summary string
+	run     func(args []string) int
+}
+
+var commands = map[string]command{
+	"bulk": {
+		summary: "Relabel, verify, rotate credentials of or change the retain policy of many claims",
+		run:     runBulk,
+	},
+	"conformance": {
+		summary: "Run the provisioning conformance suite against a live S3 backend",
+		run:     runConformance,
+	},
+	"migrate-obc": {
+		summary: "Replace bound Rook/NooBaa ObjectBucketClaims with claims adopting their buckets",
+		run:     runMigrateOBC,
+	},
+	"report": {
+		summary: "Summarize claims, buckets, usage and phases by namespace or storage class",
+		run:     runReport,
+	},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+	os.Exit(cmd.run(os.Args[2:]))
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: quobjectctl <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", name, commands[name].summary)
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+	"github.com/pamvdam71/quobject-controller/webhooks"
+)
+
+// annotationMigratedFrom is set on a migrated claim to the namespace/name of
+// the ObjectBucketClaim it replaces
+const annotationMigratedFrom = "quobject.io/migrated-from-obc"
+
+var obcListGVK = schema.GroupVersionKind{
+	Group:   "objectbucket.io",
+	Version: "v1alpha1",
+	Kind:    "ObjectBucketClaimList",
+}
+
+// parityKeys are the connection settings an OBC ConfigMap and the ConfigMap
+// of the migrated claim must agree on
+var parityKeys = []string{"BUCKET_NAME", "BUCKET_HOST", "BUCKET_PORT", "BUCKET_REGION"}
+
+// migration is the outcome of migrating one ObjectBucketClaim
+type migration struct {
+	obc    client.ObjectKey
+	bucket string
+	result string
+	detail string
+}
+
+// obcMigrator creates QuObjectBucketClaims adopting the buckets of bound
+// ObjectBucketClaims
+type obcMigrator struct {
+	client       client.Client
+	storageClass string
+	dryRun       bool
+	wait         time.Duration
+}
+
+func runMigrateOBC(args []string) int {
+	fs := flag.NewFlagSet("migrate-obc", flag.ExitOnError)
+	namespace := fs.String("namespace", "", "Only migrate ObjectBucketClaims in this namespace.")
+	storageClass := fs.String("storage-class", "",
+		"Storage class of the created claims (defaults to the storage class of each ObjectBucketClaim).")
+	kubeconfig := fs.String("kubeconfig", "", "Path to the kubeconfig (defaults to $KUBECONFIG, ~/.kube/config or in-cluster).")
+	dryRun := fs.Bool("dry-run", false, "Only report what would be migrated.")
+	waitTimeout := fs.Duration("wait", 2*time.Minute, "How long to wait for each created claim to become Bound.")
+	timeout := fs.Duration("timeout", 30*time.Minute, "Timeout for the whole migration.")
+	fs.Parse(args)
+
+	c, err := newClient(*kubeconfig)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(obcListGVK)
+	if err := c.List(ctx, list, client.InNamespace(*namespace)); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to list ObjectBucketClaims: %v\n", err)
+		return 1
+	}
+
+	m := &obcMigrator{client: c, storageClass: *storageClass, dryRun: *dryRun, wait: *waitTimeout}
+	var results []migration
+	for i := range list.Items {
+		results = append(results, m.migrate(ctx, &list.Items[i]))
+	}
+	writeMigrations(os.Stdout, results)
+	for _, r := range results {
+		if r.result == resultFail {
+			return 1
+		}
+	}
+	return 0
+}
+
+// migrate creates the claim replacing obc and verifies that it publishes the
+// same connection settings
+func (m *obcMigrator) migrate(ctx context.Context, obc *unstructured.Unstructured) migration {
+	res := migration{obc: client.ObjectKeyFromObject(obc)}
+	fail := func(format string, args ...any) migration {
+		res.result, res.detail = resultFail, fmt.Sprintf(format, args...)
+		return res
+	}
+
+	if phase, _, _ := unstructured.NestedString(obc.Object, "status", "phase"); phase != "Bound" {
+		res.result, res.detail = resultSkip, fmt.Sprintf("phase is %q, not Bound", phase)
+		return res
+	}
+	old := &corev1.ConfigMap{}
+	if err := m.client.Get(ctx, res.obc, old); err != nil {
+		return fail("failed to get ConfigMap of the ObjectBucketClaim: %v", err)
+	}
+	res.bucket = old.Data["BUCKET_NAME"]
+	if res.bucket == "" {
+		return fail("ConfigMap of the ObjectBucketClaim has no BUCKET_NAME")
+	}
+
+	storageClass := m.storageClass
+	if storageClass == "" {
+		storageClass, _, _ = unstructured.NestedString(obc.Object, "spec", "storageClassName")
+	}
+	backendName, cfg, err := backend.Resolve(ctx, m.client, storageClass)
+	if err != nil {
+		return fail("no backend for storage class %q: %v", storageClass, err)
+	}
+	cfg = cfg.ForRegion(old.Data["BUCKET_REGION"])
+
+	claim := &quv1.QuObjectBucketClaim{}
+	err = m.client.Get(ctx, res.obc, claim)
+	switch {
+	case err == nil:
+		if claim.Annotations[annotationMigratedFrom] != res.obc.String() {
+			return fail("a QuObjectBucketClaim %s that was not migrated from it exists", res.obc)
+		}
+	case !apierrors.IsNotFound(err):
+		return fail("failed to get QuObjectBucketClaim: %v", err)
+	case m.dryRun:
+		res.result, res.detail = resultPass, fmt.Sprintf("would create a claim on backend %s", backendName)
+		return res
+	default:
+		// Tag the bucket so the admission webhook lets the claim adopt it
+		if err := tagAdoptable(ctx, cfg, res.bucket); err != nil {
+			return fail("failed to tag the bucket for adoption: %v", err)
+		}
+		claim = &quv1.QuObjectBucketClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        res.obc.Name,
+				Namespace:   res.obc.Namespace,
+				Labels:      obc.GetLabels(),
+				Annotations: map[string]string{annotationMigratedFrom: res.obc.String()},
+			},
+			Spec: quv1.QuObjectBucketClaimSpec{
+				BucketName:       res.bucket,
+				Region:           old.Data["BUCKET_REGION"],
+				StorageClassName: storageClass,
+				// Deleting the new claim must not delete the migrated data
+				RetainPolicy: quv1.RetainPolicyRetain,
+			},
+		}
+		if err := m.client.Create(ctx, claim); err != nil {
+			return fail("failed to create QuObjectBucketClaim: %v", err)
+		}
+	}
+	if m.dryRun {
+		res.result, res.detail = resultPass, "already migrated"
+		return res
+	}
+
+	if err := m.waitBound(ctx, claim); err != nil {
+		return fail("%v", err)
+	}
+	if err := m.verifyParity(ctx, claim, old, cfg); err != nil {
+		return fail("%v", err)
+	}
+	res.result, res.detail = resultPass, fmt.Sprintf("connection settings match; remove ObjectBucketClaim %s once its consumers use Secret %s and ConfigMap %s",
+		res.obc, claim.Status.SecretRef, claim.Status.ConfigMapRef)
+	return res
+}
+
+// waitBound polls the claim until it is Bound
+func (m *obcMigrator) waitBound(ctx context.Context, claim *quv1.QuObjectBucketClaim) error {
+	err := wait.PollUntilContextTimeout(ctx, 2*time.Second, m.wait, true, func(ctx context.Context) (bool, error) {
+		if err := m.client.Get(ctx, client.ObjectKeyFromObject(claim), claim); err != nil {
+			return false, err
+		}
+		return claim.Status.Phase == quv1.ClaimPhaseBound, nil
+	})
+	if err != nil {
+		return fmt.Errorf("claim did not become Bound (phase %q): %w", claim.Status.Phase, err)
+	}
+	return nil
+}
+
+// verifyParity compares the connection settings published for the claim with
+// those of the ObjectBucketClaim, and checks that the claim's credentials
+// reach the bucket
+func (m *obcMigrator) verifyParity(
+	ctx context.Context,
+	claim *quv1.QuObjectBucketClaim,
+	old *corev1.ConfigMap,
+	cfg backend.Config,
+) error {
+	key := client.ObjectKey{Namespace: claim.Namespace}
+	cm := &corev1.ConfigMap{}
+	key.Name = claim.Status.ConfigMapRef
+	if err := m.client.Get(ctx, key, cm); err != nil {
+		return fmt.Errorf("failed to get ConfigMap of the claim: %w", err)
+	}
+	var mismatches []string
+	for _, k := range parityKeys {
+		if cm.Data[k] != old.Data[k] {
+			mismatches = append(mismatches, fmt.Sprintf("%s is %q instead of %q", k, cm.Data[k], old.Data[k]))
+		}
+	}
+	if len(mismatches) > 0 {
+		return errors.New(strings.Join(mismatches, ", "))
+	}
+
+	secret := &corev1.Secret{}
+	key.Name = claim.Status.SecretRef
+	if err := m.client.Get(ctx, key, secret); err != nil {
+		return fmt.Errorf("failed to get Secret of the claim: %w", err)
+	}
+	cfg.AccessKey = string(secret.Data["AWS_ACCESS_KEY_ID"])
+	cfg.SecretKey = string(secret.Data["AWS_SECRET_ACCESS_KEY"])
+	s3c, err := backend.NewS3Client(cfg, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := s3c.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(cm.Data["BUCKET_NAME"])}); err != nil {
+		return fmt.Errorf("credentials of the claim cannot access the bucket: %w", err)
+	}
+	return nil
+}
+
+// tagAdoptable adds the adoption tag to the bucket's tags
+func tagAdoptable(ctx context.Context, cfg backend.Config, bucket string) error {
+	s3c, err := backend.NewS3Client(cfg, nil)
+	if err != nil {
+		return err
+	}
+	var tags []s3types.Tag
+	// Buckets without tags report NoSuchTagSet
+	if out, err := s3c.GetBucketTagging(ctx, &s3.GetBucketTaggingInput{Bucket: aws.String(bucket)}); err == nil {
+		for _, tag := range out.TagSet {
+			if aws.ToString(tag.Key) != webhooks.AdoptTag {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	tags = append(tags, s3types.Tag{Key: aws.String(webhooks.AdoptTag), Value: aws.String("true")})
+	_, err = s3c.PutBucketTagging(ctx, &s3.PutBucketTaggingInput{
+		Bucket:  aws.String(bucket),
+		Tagging: &s3types.Tagging{TagSet: tags},
+	})
+	return err
+}
+
+func writeMigrations(w io.Writer, results []migration) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "OBJECTBUCKETCLAIM\tBUCKET\tRESULT\tDETAIL")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.obc, r.bucket, r.result, r.detail)
+	}
+	tw.Flush()
+}
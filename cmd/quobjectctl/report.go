@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+)
+
+// reportRow summarizes the claims of one namespace or storage class
+type reportRow struct {
+	Name    string         `json:"name"`
+	Claims  int            `json:"claims"`
+	Buckets int            `json:"buckets"`
+	Objects int64          `json:"objects"`
+	Bytes   int64          `json:"bytes"`
+	Phases  map[string]int `json:"phases"`
+}
+
+func runReport(args []string) int {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	by := fs.String("by", "namespace", "Group claims by namespace or storageclass.")
+	output := fs.String("output", "table", "Output format: table, json or csv.")
+	namespace := fs.String("namespace", "", "Only report claims in this namespace.")
+	kubeconfig := fs.String("kubeconfig", "", "Path to the kubeconfig (defaults to $KUBECONFIG, ~/.kube/config or in-cluster).")
+	fromBackend := fs.Bool("from-backend", false,
+		"Measure bucket usage on the backends instead of using the claims' last usage poll (lists every object).")
+	timeout := fs.Duration("timeout", 5*time.Minute, "Timeout for the whole report.")
+	fs.Parse(args)
+
+	if *by != "namespace" && *by != "storageclass" {
+		fmt.Fprintf(os.Stderr, "invalid --by %q: must be namespace or storageclass\n", *by)
+		return 2
+	}
+	if *output != "table" && *output != "json" && *output != "csv" {
+		fmt.Fprintf(os.Stderr, "invalid --output %q: must be table, json or csv\n", *output)
+		return 2
+	}
+
+	c, err := newClient(*kubeconfig)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	var list quv1.QuObjectBucketClaimList
+	if err := c.List(ctx, &list, client.InNamespace(*namespace)); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to list claims: %v\n", err)
+		return 1
+	}
+
+	m := &usageMeter{client: c, s3: map[string]*s3.Client{}}
+	rows := map[string]*reportRow{}
+	for i := range list.Items {
+		claim := &list.Items[i]
+		key := claim.Namespace
+		if *by == "storageclass" {
+			key = claim.Spec.StorageClassName
+		}
+		row, ok := rows[key]
+		if !ok {
+			row = &reportRow{Name: key, Phases: map[string]int{}}
+			rows[key] = row
+		}
+		row.Claims++
+		row.Phases[string(claim.Status.Phase)]++
+		if claim.Status.BucketName == "" {
+			continue
+		}
+		row.Buckets++
+		if *fromBackend {
+			objects, bytes, err := m.measure(ctx, claim)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to measure bucket %s of claim %s/%s: %v\n",
+					claim.Status.BucketName, claim.Namespace, claim.Name, err)
+				continue
+			}
+			row.Objects += objects
+			row.Bytes += bytes
+		} else if usage := claim.Status.Usage; usage != nil {
+			row.Objects += usage.Objects
+			row.Bytes += usage.Bytes
+		}
+	}
+
+	sorted := make([]reportRow, 0, len(rows))
+	for _, row := range rows {
+		sorted = append(sorted, *row)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	switch *output {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(sorted); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	case "csv":
+		writeReportCSV(os.Stdout, *by, sorted)
+	default:
+		writeReportTable(os.Stdout, *by, sorted)
+	}
+	return 0
+}
+
+// phaseSummary renders phase counts as "Bound=3,Error=1"
+func phaseSummary(phases map[string]int) string {
+	names := make([]string, 0, len(phases))
+	for name := range phases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		label := name
+		if label == "" {
+			label = "Unknown"
+		}
+		parts = append(parts, fmt.Sprintf("%s=%d", label, phases[name]))
+	}
+	return strings.Join(parts, ",")
+}
+
+func writeReportTable(w io.Writer, by string, rows []reportRow) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\tCLAIMS\tBUCKETS\tOBJECTS\tBYTES\tPHASES\n", strings.ToUpper(by))
+	for _, r := range rows {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%s\n", r.Name, r.Claims, r.Buckets, r.Objects, r.Bytes, phaseSummary(r.Phases))
+	}
+	tw.Flush()
+}
+
+func writeReportCSV(w io.Writer, by string, rows []reportRow) {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{by, "claims", "buckets", "objects", "bytes", "phases"})
+	for _, r := range rows {
+		cw.Write([]string{
+			r.Name,
+			strconv.Itoa(r.Claims),
+			strconv.Itoa(r.Buckets),
+			strconv.FormatInt(r.Objects, 10),
+			strconv.FormatInt(r.Bytes, 10),
+			phaseSummary(r.Phases),
+		})
+	}
+	cw.Flush()
+}
+
+// usageMeter measures bucket usage on the backends, reusing one S3 client
+// per backend and region
+type usageMeter struct {
+	client client.Reader
+	s3     map[string]*s3.Client
+}
+
+func (m *usageMeter) measure(ctx context.Context, claim *quv1.QuObjectBucketClaim) (int64, int64, error) {
+	name := claim.Annotations[annotationBackend]
+	key := name + "/" + claim.Spec.Region
+	s3c, ok := m.s3[key]
+	if !ok {
+		var cfg backend.Config
+		var err error
+		if name != "" {
+			cfg, err = backend.Load(ctx, m.client, name)
+		} else {
+			_, cfg, err = backend.Resolve(ctx, m.client, claim.Spec.StorageClassName)
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		if s3c, err = backend.NewS3Client(cfg.ForRegion(claim.Spec.Region), nil); err != nil {
+			return 0, 0, err
+		}
+		m.s3[key] = s3c
+	}
+
+	var objects, bytes int64
+	paginator := s3.NewListObjectsV2Paginator(s3c, &s3.ListObjectsV2Input{
+		Bucket: aws.String(claim.Status.BucketName),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, obj := range page.Contents {
+			objects++
+			bytes += aws.ToInt64(obj.Size)
+		}
+	}
+	return objects, bytes, nil
+}
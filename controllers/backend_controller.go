@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+	"github.com/pamvdam71/quobject-controller/internal/logging"
+)
+
+// annotationOIDCApplied records the fingerprint of the OpenID provider
+// settings last applied to a backend
+const annotationOIDCApplied = "quobject.io/oidc-applied"
+
+// Backend Event reasons
+const (
+	reasonOIDCConfigured  = "OIDCConfigured"
+	reasonOIDCFailed      = "OIDCConfigurationFailed"
+	reasonOIDCUnsupported = "OIDCUnsupported"
+)
+
+// BackendReconciler checks the credentials of backend secrets, rotates them
+// when configured and applies their OIDC trust settings to the backends'
+// identity configuration
+type BackendReconciler struct {
+	client.Client
+
+	// S3RateLimiter throttles the admin requests to the backends.
+	// A nil limiter disables rate limiting.
+	S3RateLimiter *rate.Limiter
+	// Recorder emits Events on backend secrets
+	Recorder record.EventRecorder
+}
+
+// Reconcile checks the credentials and configures the OpenID provider of one
+// backend
+func (r *BackendReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx).WithValues("backend", req.Name)
+
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, req.NamespacedName, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			backendCredentialsValid.DeleteLabelValues(req.Name)
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	cfg, err := backend.ConfigFromSecret(secret)
+	if err == nil {
+		cfg, err = backend.LoadClientCertificate(ctx, r.Client, cfg)
+	}
+	if checkErr := r.checkCredentials(ctx, secret, cfg, err); checkErr != nil && err == nil {
+		log.Error(checkErr, "Failed to check backend credentials")
+		return ctrl.Result{}, checkErr
+	}
+	if err != nil {
+		log.Error(err, "Invalid backend secret")
+		return ctrl.Result{}, nil
+	}
+	requeue, err := r.rotateCredentials(ctx, secret, cfg)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	result := ctrl.Result{RequeueAfter: requeue}
+	if !cfg.OIDC.Enabled() {
+		return result, nil
+	}
+	fingerprint := cfg.OIDC.Fingerprint()
+	if secret.Annotations[annotationOIDCApplied] == fingerprint {
+		return result, nil
+	}
+	if !cfg.Profile.MinIOAdmin {
+		// Other backends are configured out of band
+		r.Recorder.Event(secret, corev1.EventTypeWarning, reasonOIDCUnsupported,
+			"The backend's apiProfile cannot configure OIDC trust; configure the issuer on the backend directly")
+		return result, nil
+	}
+
+	restart, err := backend.ConfigureOpenID(ctx, cfg, r.S3RateLimiter)
+	if err != nil {
+		log.Error(err, "Failed to configure OpenID provider")
+		r.Recorder.Event(secret, corev1.EventTypeWarning, reasonOIDCFailed, logging.Redact(err.Error()))
+		return ctrl.Result{}, err
+	}
+	msg := fmt.Sprintf("Configured OpenID provider %s for issuer %s", backend.OpenIDProviderName, cfg.OIDC.Issuer)
+	if restart {
+		msg += "; the backend must be restarted to apply it"
+	}
+	log.Info(msg)
+	r.Recorder.Event(secret, corev1.EventTypeNormal, reasonOIDCConfigured, msg)
+
+	patch := client.MergeFrom(secret.DeepCopy())
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[annotationOIDCApplied] = fingerprint
+	return result, r.Patch(ctx, secret, patch)
+}
+
+// SetupWithManager sets up the controller with the Manager
+func (r *BackendReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	isBackend := predicate.NewPredicateFuncs(func(o client.Object) bool {
+		return o.GetNamespace() == backend.Namespace && backend.IsSecretName(o.GetName())
+	})
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("backend").
+		For(&corev1.Secret{}, builder.WithPredicates(isBackend)).
+		WithOptions(controller.Options{NewQueue: newInstrumentedQueue}).
+		Complete(r)
+}
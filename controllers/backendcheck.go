@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+	"github.com/pamvdam71/quobject-controller/internal/logging"
+)
+
+// annotationCredentialsCondition holds the CredentialsValid condition of a
+// backend secret as JSON, since Secrets have no status
+const annotationCredentialsCondition = "quobject.io/credentials-condition"
+
+// conditionCredentialsValid is True once the backend accepted the
+// credentials of its secret
+const conditionCredentialsValid = "CredentialsValid"
+
+// Backend Event reasons of the credentials check
+const (
+	reasonCredentialsVerified = "CredentialsVerified"
+	reasonCredentialsInvalid  = "CredentialsInvalid"
+)
+
+// checkCredentials verifies a backend's credentials with a ListBuckets call
+// and publishes the result in the CredentialsValid condition and the
+// quobject_backend_credentials_valid metric. Rejected credentials are final
+// until the secret changes; other failures are returned to be retried.
+func (r *BackendReconciler) checkCredentials(
+	ctx context.Context,
+	secret *corev1.Secret,
+	cfg backend.Config,
+	cfgErr error,
+) error {
+	err := cfgErr
+	if err == nil {
+		var s3c *s3.Client
+		if s3c, err = backend.NewS3Client(cfg, r.S3RateLimiter); err == nil {
+			_, err = s3c.ListBuckets(ctx, &s3.ListBucketsInput{})
+		}
+	}
+
+	cond := metav1.Condition{
+		Type:    conditionCredentialsValid,
+		Status:  metav1.ConditionTrue,
+		Reason:  reasonCredentialsVerified,
+		Message: "The backend accepted the credentials",
+	}
+	var retry error
+	if err != nil {
+		class := classifyError(err)
+		var invalid *backend.InvalidSecretError
+		cond.Status, cond.Reason, cond.Message = metav1.ConditionFalse, class.reason, logging.Redact(err.Error())
+		if !class.terminal && !errors.As(err, &invalid) {
+			// The credentials could not be checked at all
+			cond.Status = metav1.ConditionUnknown
+			retry = err
+		}
+	}
+	valid := 0.0
+	if cond.Status == metav1.ConditionTrue {
+		valid = 1
+	}
+	backendCredentialsValid.WithLabelValues(secret.Name).Set(valid)
+
+	var conditions []metav1.Condition
+	if previous, ok := secret.Annotations[annotationCredentialsCondition]; ok {
+		var old metav1.Condition
+		if json.Unmarshal([]byte(previous), &old) == nil {
+			conditions = append(conditions, old)
+		}
+	}
+	changed := meta.SetStatusCondition(&conditions, cond)
+	if !changed {
+		return retry
+	}
+	switch cond.Status {
+	case metav1.ConditionTrue:
+		r.Recorder.Event(secret, corev1.EventTypeNormal, reasonCredentialsVerified, cond.Message)
+	case metav1.ConditionFalse:
+		r.Recorder.Event(secret, corev1.EventTypeWarning, reasonCredentialsInvalid, cond.Message)
+	}
+
+	encoded, err := json.Marshal(conditions[0])
+	if err != nil {
+		return err
+	}
+	patch := client.MergeFrom(secret.DeepCopy())
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[annotationCredentialsCondition] = string(encoded)
+	if err := r.Patch(ctx, secret, patch); err != nil {
+		return err
+	}
+	return retry
+}
@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+)
+
+// claimBackend returns the name and configuration of the backend serving the
+// claim. Once a bucket has been provisioned, the recorded backend is used so
+// that remapping a storage class never strands an existing bucket.
+func (r *QuObjectBucketClaimReconciler) claimBackend(
+	ctx context.Context,
+	claim *quv1.QuObjectBucketClaim,
+) (string, backend.Config, error) {
+	if name := claim.Annotations[annotationBackend]; name != "" {
+		cfg, err := backend.Load(ctx, r.Client, name)
+		return name, cfg, err
+	}
+	return backend.Resolve(ctx, r.Client, claim.Spec.StorageClassName)
+}
+
+// bucketClassClaims enqueues the claims provisioned on a QuObjectBucketClass
+// that changed, and the claims of its storage class waiting for a backend
+func (r *QuObjectBucketClaimReconciler) bucketClassClaims(ctx context.Context, obj client.Object) []reconcile.Request {
+	var list quv1.QuObjectBucketClaimList
+	if err := r.List(ctx, &list); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list claims of bucket class", "class", obj.GetName())
+		return nil
+	}
+	name := backend.BackendNameForClass(obj.GetName())
+	var reqs []reconcile.Request
+	for i := range list.Items {
+		claim := &list.Items[i]
+		recorded := claim.Annotations[annotationBackend]
+		if (recorded == name || recorded == "" && claim.Spec.StorageClassName == obj.GetName()) && r.Shard.Owns(claim) {
+			reqs = append(reqs, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(claim)})
+		}
+	}
+	return reqs
+}
+
+// retainPolicy returns the effective retain policy of the claim: its own, the
+// one recorded when the bucket was provisioned, the backend default, or
+// Retain, in that order
+func retainPolicy(claim *quv1.QuObjectBucketClaim, cfg backend.Config) quv1.RetainPolicy {
+	switch {
+	case claim.Spec.RetainPolicy != "":
+		return claim.Spec.RetainPolicy
+	case claim.Status.RetainPolicy != "":
+		return claim.Status.RetainPolicy
+	case claim.Annotations[annotationRetainPolicy] != "":
+		return quv1.RetainPolicy(claim.Annotations[annotationRetainPolicy])
+	case cfg.DefaultRetainPolicy != "":
+		return quv1.RetainPolicy(cfg.DefaultRetainPolicy)
+	}
+	return quv1.RetainPolicyRetain
+}
+
+// setCredentialsSecretCondition reports a missing or malformed key of the
+// claim's backend secret in the CredentialsSecretInvalid condition, and
+// removes the condition once the secret could be read
+func setCredentialsSecretCondition(claim *quv1.QuObjectBucketClaim, err error) {
+	var invalid *backend.InvalidSecretError
+	if !errors.As(err, &invalid) {
+		if err == nil {
+			meta.RemoveStatusCondition(&claim.Status.Conditions, quv1.ConditionCredentialsSecretInvalid)
+		}
+		return
+	}
+	reason := "InvalidKey"
+	if invalid.Missing {
+		reason = "MissingKey"
+	}
+	meta.SetStatusCondition(&claim.Status.Conditions, metav1.Condition{
+		Type:               quv1.ConditionCredentialsSecretInvalid,
+		Status:             metav1.ConditionTrue,
+		Reason:             reason,
+		Message:            invalid.Error(),
+		ObservedGeneration: claim.Generation,
+	})
+}
@@ -0,0 +1,194 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+)
+
+// bucketLockRetry is how long a claim waits before retrying a bucket whose
+// lock is held by another replica
+const bucketLockRetry = 5 * time.Second
+
+// errBucketLocked is returned when another replica holds a bucket's Lease
+var errBucketLocked = errors.New("bucket is locked by another replica")
+
+// BucketLocks serializes the creation of buckets with the same name. Within
+// the process a lock per bucket name is held; with Leases set, a
+// coordination Lease per bucket name also excludes other replicas. A nil
+// BucketLocks does not lock.
+type BucketLocks struct {
+	// Leases reads and writes the Leases. It should not be cached. Nil
+	// restricts locking to this process.
+	Leases client.Client
+	// Namespace holds the Leases
+	Namespace string
+	// Identity names this replica as the holder of its Leases
+	Identity string
+	// LeaseDuration is how long a Lease of a crashed holder blocks others
+	LeaseDuration time.Duration
+
+	mu    sync.Mutex
+	locks map[string]*bucketLock
+}
+
+// bucketLock is a lock on one bucket name, shared by all waiters
+type bucketLock struct {
+	sem     chan struct{}
+	waiters int
+}
+
+// Lock acquires the lock on a bucket name. It returns errBucketLocked if the
+// bucket's Lease is held by another replica. The returned function releases
+// the lock.
+func (l *BucketLocks) Lock(ctx context.Context, bucket string) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	lock := l.acquire(bucket)
+	select {
+	case lock.sem <- struct{}{}:
+	case <-ctx.Done():
+		l.release(bucket, lock, false)
+		return nil, ctx.Err()
+	}
+	if l.Leases == nil {
+		return func() { l.release(bucket, lock, true) }, nil
+	}
+
+	lease, err := l.acquireLease(ctx, bucket)
+	if err != nil {
+		l.release(bucket, lock, true)
+		return nil, err
+	}
+	return func() {
+		// An undeleted Lease expires on its own
+		l.Leases.Delete(context.Background(), lease, client.Preconditions{
+			UID:             &lease.UID,
+			ResourceVersion: &lease.ResourceVersion,
+		})
+		l.release(bucket, lock, true)
+	}, nil
+}
+
+func (l *BucketLocks) acquire(bucket string) *bucketLock {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.locks == nil {
+		l.locks = make(map[string]*bucketLock)
+	}
+	lock, ok := l.locks[bucket]
+	if !ok {
+		lock = &bucketLock{sem: make(chan struct{}, 1)}
+		l.locks[bucket] = lock
+	}
+	lock.waiters++
+	return lock
+}
+
+func (l *BucketLocks) release(bucket string, lock *bucketLock, held bool) {
+	if held {
+		<-lock.sem
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lock.waiters--
+	if lock.waiters == 0 {
+		delete(l.locks, bucket)
+	}
+}
+
+// acquireLease creates the bucket's Lease, or takes it over once expired
+func (l *BucketLocks) acquireLease(ctx context.Context, bucket string) (*coordinationv1.Lease, error) {
+	now := metav1.NewMicroTime(time.Now())
+	seconds := int32(l.LeaseDuration.Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	lease := &coordinationv1.Lease{}
+	key := types.NamespacedName{Name: bucketLeaseName(bucket), Namespace: l.Namespace}
+	err := l.Leases.Get(ctx, key, lease)
+	if apierrors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &l.Identity,
+				LeaseDurationSeconds: &seconds,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		if err := l.Leases.Create(ctx, lease); err != nil {
+			if apierrors.IsAlreadyExists(err) {
+				return nil, errBucketLocked
+			}
+			return nil, err
+		}
+		return lease, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !leaseExpired(lease, now.Time) {
+		return nil, errBucketLocked
+	}
+	lease.Spec.HolderIdentity = &l.Identity
+	lease.Spec.LeaseDurationSeconds = &seconds
+	lease.Spec.AcquireTime = &now
+	lease.Spec.RenewTime = &now
+	if err := l.Leases.Update(ctx, lease); err != nil {
+		if apierrors.IsConflict(err) {
+			return nil, errBucketLocked
+		}
+		return nil, err
+	}
+	return lease, nil
+}
+
+// leaseExpired reports whether the holder of a Lease has stopped renewing it
+func leaseExpired(lease *coordinationv1.Lease, now time.Time) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	expiry := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+	return now.After(expiry)
+}
+
+// bucketLeaseName derives a valid Lease name from a bucket name
+func bucketLeaseName(bucket string) string {
+	sum := sha256.Sum256([]byte(bucket))
+	return "quobject-bucket-" + hex.EncodeToString(sum[:10])
+}
+
+// ensureBucket creates the bucket unless it exists, holding the bucket's lock
+func (l *BucketLocks) ensureBucket(
+	ctx context.Context,
+	s3c *s3.Client,
+	bucket string,
+	createCfg *s3types.CreateBucketConfiguration,
+	profile backend.Profile,
+	optFns ...func(*s3.Options),
+) (bool, error) {
+	unlock, err := l.Lock(ctx, bucket)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	return ensureBucket(ctx, s3c, bucket, createCfg, profile, optFns...)
+}
@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+)
+
+const reasonBucketNamePrefixRequired = "BucketNamePrefixRequired"
+
+// bucketNamePrefixError is returned when a claim's bucket name does not
+// start with the prefix its namespace requires
+type bucketNamePrefixError struct {
+	namespace string
+	prefix    string
+	bucket    string
+}
+
+func (e *bucketNamePrefixError) Error() string {
+	return fmt.Sprintf("bucket names in namespace %s must start with %q, but the bucket name is %q",
+		e.namespace, e.prefix, e.bucket)
+}
+
+// checkBucketNamePrefix verifies that a bucket the claim is not bound to
+// yet starts with the bucket name prefix of the claim's namespace. The
+// admission webhooks check this too, but a claim admitted while they were
+// down or before the namespace was annotated must not get a bucket outside
+// the prefix. Bound buckets keep their names, like in the webhooks.
+func (r *QuObjectBucketClaimReconciler) checkBucketNamePrefix(
+	ctx context.Context,
+	claim *quv1.QuObjectBucketClaim,
+	bucketName string,
+) error {
+	if claim.Status.BucketName == bucketName {
+		return nil
+	}
+	ns := &corev1.Namespace{}
+	if err := r.Get(ctx, types.NamespacedName{Name: claim.Namespace}, ns); err != nil {
+		return fmt.Errorf("failed to get namespace %s: %w", claim.Namespace, err)
+	}
+	prefix, _ := quv1.BucketNamePrefix(ns.Annotations)
+	if prefix == "" {
+		return nil
+	}
+	// The prefix applies to the name within an RGW tenant
+	if _, name := backend.SplitTenantBucket(bucketName); !strings.HasPrefix(name, prefix) {
+		return &bucketNamePrefixError{namespace: claim.Namespace, prefix: prefix, bucket: bucketName}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/testutil"
+)
+
+// TestBucketNamePrefixEnforcedWithoutWebhook provisions claims that never
+// passed the admission webhooks in a namespace requiring a prefix
+func TestBucketNamePrefixEnforcedWithoutWebhook(t *testing.T) {
+	srv := testutil.NewS3Server()
+	defer srv.Close()
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "team-a",
+		Annotations: map[string]string{quv1.AnnotationBucketNamePrefix: "team-a-"},
+	}}
+	outside := &quv1.QuObjectBucketClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "outside", Namespace: ns.Name},
+		Spec:       quv1.QuObjectBucketClaimSpec{BucketName: "shared-data"},
+	}
+	inside := &quv1.QuObjectBucketClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "inside", Namespace: ns.Name},
+		Spec:       quv1.QuObjectBucketClaimSpec{BucketName: "team-a-data"},
+	}
+	r := newTestReconciler(t, srv, ns, outside, inside)
+
+	got := reconcileUntil(t, r, client.ObjectKeyFromObject(outside), func(c *quv1.QuObjectBucketClaim) bool {
+		return c != nil && c.Status.Phase == quv1.ClaimPhaseError
+	})
+	cond := meta.FindStatusCondition(got.Status.Conditions, quv1.ConditionProvisioningError)
+	if cond == nil || cond.Reason != reasonBucketNamePrefixRequired {
+		t.Fatalf("ProvisioningError condition %+v, want reason %s", cond, reasonBucketNamePrefixRequired)
+	}
+	if srv.BucketExists("shared-data") {
+		t.Error("bucket outside the namespace's prefix was created")
+	}
+
+	reconcileUntil(t, r, client.ObjectKeyFromObject(inside), func(c *quv1.QuObjectBucketClaim) bool {
+		return c != nil && c.Status.Phase == quv1.ClaimPhaseBound
+	})
+	if !srv.BucketExists("team-a-data") {
+		t.Error("bucket within the namespace's prefix was not created")
+	}
+}
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+)
+
+const (
+	reasonClaimClassNotFound = "ClaimClassNotFound"
+	reasonClaimClassApplied  = "ClaimClassApplied"
+)
+
+// claimClassNotFoundError is returned while the claim's class does not exist
+type claimClassNotFoundError struct {
+	name string
+}
+
+func (e *claimClassNotFoundError) Error() string {
+	return fmt.Sprintf("QuObjectBucketClaimClass %s not found", e.name)
+}
+
+// applyClaimClass copies the settings of the claim's class into the claim
+// once. It returns true if the claim was updated, which triggers another
+// reconcile of the completed claim.
+func (r *QuObjectBucketClaimReconciler) applyClaimClass(ctx context.Context, claim *quv1.QuObjectBucketClaim) (bool, error) {
+	name := claim.Spec.ClaimClassName
+	if name == "" || claim.Annotations[quv1.AnnotationClaimClassApplied] == name {
+		return false, nil
+	}
+	class := &quv1.QuObjectBucketClaimClass{}
+	if err := r.Get(ctx, types.NamespacedName{Name: name}, class); apierrors.IsNotFound(err) {
+		return false, &claimClassNotFoundError{name: name}
+	} else if err != nil {
+		return false, fmt.Errorf("failed to get QuObjectBucketClaimClass %s: %w", name, err)
+	}
+	quv1.ApplyClaimClass(claim, class)
+	if claim.Annotations == nil {
+		claim.Annotations = map[string]string{}
+	}
+	claim.Annotations[quv1.AnnotationClaimClassApplied] = name
+	if err := r.Update(ctx, claim); err != nil {
+		return false, err
+	}
+	log.FromContext(ctx).Info("Applied claim class", "class", name)
+	r.event(ctx, claim, corev1.EventTypeNormal, reasonClaimClassApplied,
+		"Applied the settings of QuObjectBucketClaimClass %s", name)
+	return true, nil
+}
+
+// classClaims enqueues the claims waiting for a class that was created
+func (r *QuObjectBucketClaimReconciler) classClaims(ctx context.Context, obj client.Object) []reconcile.Request {
+	var list quv1.QuObjectBucketClaimList
+	if err := r.List(ctx, &list); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list claims of claim class", "class", obj.GetName())
+		return nil
+	}
+	var reqs []reconcile.Request
+	for i := range list.Items {
+		claim := &list.Items[i]
+		if claim.Spec.ClaimClassName == obj.GetName() &&
+			claim.Annotations[quv1.AnnotationClaimClassApplied] != obj.GetName() && r.Shard.Owns(claim) {
+			reqs = append(reqs, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(claim)})
+		}
+	}
+	return reqs
+}
@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+	"github.com/pamvdam71/quobject-controller/internal/logging"
+)
+
+// annotationCredentialsUser records the backend user created for a claim
+// with dedicated credentials, so that it is deleted even after the claim
+// switched to another credentials mode
+const annotationCredentialsUser = "quobject.io/credentials-user"
+
+const claimUserSid = managedSidPrefix + "ClaimUser"
+
+// claimUserName returns the backend user of the claim. The UID keeps the
+// name unique when a claim is recreated with the same name.
+func claimUserName(claim *quv1.QuObjectBucketClaim) string {
+	return "quobject-" + string(claim.UID)
+}
+
+// usesDedicatedUser reports whether the claim publishes the keys of a
+// backend user of its own. On backends with the Quobyte management API,
+// the claim's Quobyte user serves that purpose.
+func usesDedicatedUser(claim *quv1.QuObjectBucketClaim, cfg backend.Config) bool {
+	return claim.Spec.Credentials != nil && claim.Spec.Credentials.Mode == quv1.CredentialsModeDedicated &&
+		!usesQuobyteUser(claim, cfg)
+}
+
+// dedicatedCredentials returns the access key of the claim's user. The keys
+// in the claim's Secret are reused if they were issued to that user on the
+// same backend, after updating the user's policy to the current buckets;
+// otherwise the user is created, or given new keys. The user on a backend
+// the claim moved away from is deleted.
+func (r *QuObjectBucketClaimReconciler) dedicatedCredentials(
+	ctx context.Context,
+	claim *quv1.QuObjectBucketClaim,
+	backendName string,
+	cfg backend.Config,
+	bucketName string,
+) (claimCredentials, error) {
+	if !cfg.CanProvisionUsers() {
+		return claimCredentials{}, backend.ErrUserProvisioningUnsupported
+	}
+	user := claim.Annotations[annotationCredentialsUser]
+
+	// A bucket being renamed stays accessible until clients switched over
+	buckets := []string{bucketName}
+	if current := claim.Status.BucketName; current != "" && current != bucketName {
+		buckets = append(buckets, current)
+	}
+	issued := &quv1.CredentialsUserStatus{Backend: backendName, Name: user, Buckets: buckets}
+	// The Secret of a claim that used other credentials before holds the
+	// backend's keys or STS credentials, and one of a migrated claim the
+	// keys of another backend, which are all replaced
+	if creds, ok := r.publishedCredentials(ctx, claim); ok && issuedTo(claim, creds, cfg, backendName, user) &&
+		!rotationRequested(claim) {
+		// The policy follows a rename, and drops the old bucket once done.
+		// Users recorded without their buckets get it rewritten once.
+		if recorded := claim.Status.CredentialsUser; recorded == nil || !slices.Equal(recorded.Buckets, buckets) {
+			if err := backend.PutClaimUserPolicy(ctx, cfg, r.S3RateLimiter, user, buckets...); err != nil {
+				return claimCredentials{}, fmt.Errorf("failed to grant user %s the claim's buckets: %w", user, err)
+			}
+		}
+		return claimCredentials{AccessKey: creds.AccessKey, SecretKey: creds.SecretKey, User: issued}, nil
+	}
+	if err := r.revokeMovedUser(ctx, claim, backendName); err != nil {
+		return claimCredentials{}, err
+	}
+
+	owner := backend.UserOwner{Namespace: claim.Namespace, Name: claim.Name, UID: string(claim.UID)}
+	key, err := backend.CreateClaimUser(ctx, cfg, r.S3RateLimiter, user, owner, buckets...)
+	if err != nil {
+		return claimCredentials{}, fmt.Errorf("failed to create user %s: %w", user, err)
+	}
+	logging.SetSecrets(claimSecretsOwner(claim), time.Time{}, key.AccessKeyID, key.SecretAccessKey)
+	return claimCredentials{AccessKey: key.AccessKeyID, SecretKey: key.SecretAccessKey, User: issued}, nil
+}
+
+// claimUserStatements returns the bucket policy statements granting the
+// claim's user access to the bucket on backends without user policies
+func claimUserStatements(claim *quv1.QuObjectBucketClaim, cfg backend.Config, bucket string) []policyStatement {
+	if !usesDedicatedUser(claim, cfg) || cfg.UserPolicyGrantsAccess() {
+		return nil
+	}
+	return []policyStatement{{
+		Sid:       claimUserSid,
+		Effect:    "Allow",
+		Principal: map[string][]string{"AWS": {cfg.UserARN(claimUserName(claim))}},
+		Action:    []string{"s3:*"},
+		Resource:  []string{bucketARN(bucket), bucketARN(bucket, "*")},
+	}}
+}
+
+// deleteClaimUser revokes the dedicated credentials of the claim by
+// deleting its user, if it has one. The claim is patched, so changes to its
+// status must be written before.
+func (r *QuObjectBucketClaimReconciler) deleteClaimUser(
+	ctx context.Context,
+	claim *quv1.QuObjectBucketClaim,
+	cfg backend.Config,
+) error {
+	user := claim.Annotations[annotationCredentialsUser]
+	if user == "" {
+		return nil
+	}
+	if err := backend.DeleteClaimUser(ctx, cfg, r.S3RateLimiter, user); err != nil {
+		return fmt.Errorf("failed to delete user %s: %w", user, err)
+	}
+	patch := client.MergeFrom(claim.DeepCopy())
+	delete(claim.Annotations, annotationCredentialsUser)
+	return r.Patch(ctx, claim, patch)
+}
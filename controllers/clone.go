@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+)
+
+// Event reason for a bucket seeded from a data source
+const reasonCloned = "Cloned"
+
+// dataSourceBucket locates the objects of a data source on a backend
+type dataSourceBucket struct {
+	backend string
+	bucket  string
+	region  string
+	// desc names the data source in messages
+	desc string
+}
+
+// cloneDataSource copies the objects of the claim's data source into its
+// bucket once. Copies within one backend are server-side; across backends
+// the objects are streamed through the controller.
+func (r *QuObjectBucketClaimReconciler) cloneDataSource(
+	ctx context.Context,
+	claim *quv1.QuObjectBucketClaim,
+	dst *s3.Client,
+	backendName, bucketName string,
+) error {
+	ds := claim.Spec.DataSource
+	if ds == nil || meta.IsStatusConditionTrue(claim.Status.Conditions, quv1.ConditionDataSourceCloned) {
+		return nil
+	}
+	from, err := r.resolveDataSource(ctx, claim)
+	if err != nil {
+		return err
+	}
+	srcBucket := from.bucket
+
+	src := dst
+	if from.backend != backendName {
+		cfg, err := backend.Load(ctx, r.Client, from.backend)
+		if err != nil {
+			return err
+		}
+		if src, err = backend.NewS3Client(cfg.ForRegion(from.region), r.S3RateLimiter); err != nil {
+			return err
+		}
+	}
+
+	var objects, bytes int64
+	paginator := s3.NewListObjectsV2Paginator(src, &s3.ListObjectsV2Input{
+		Bucket: aws.String(srcBucket),
+		Prefix: aws.String(ds.Prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list objects of %s: %w", srcBucket, err)
+		}
+		for _, obj := range page.Contents {
+			objKey := aws.ToString(obj.Key)
+			if isOwnerMarker(objKey) {
+				continue
+			}
+			if src == dst {
+				err = copyObjectInBackend(ctx, dst, srcBucket, bucketName, objKey, aws.ToInt64(obj.Size))
+			} else {
+				err = copyObject(ctx, src, dst, srcBucket, bucketName, objKey, aws.ToInt64(obj.Size))
+			}
+			if err != nil {
+				return fmt.Errorf("failed to copy object %s: %w", objKey, err)
+			}
+			objects++
+			bytes += aws.ToInt64(obj.Size)
+		}
+	}
+
+	msg := fmt.Sprintf("Copied %d objects (%d bytes) from %s", objects, bytes, from.desc)
+	meta.SetStatusCondition(&claim.Status.Conditions, metav1.Condition{
+		Type:    quv1.ConditionDataSourceCloned,
+		Status:  metav1.ConditionTrue,
+		Reason:  reasonCloned,
+		Message: msg,
+	})
+	r.event(ctx, claim, corev1.EventTypeNormal, reasonCloned, "%s", msg)
+	return nil
+}
+
+// resolveDataSource returns where the objects of the claim's data source are
+// stored. Exactly one of a bound claim or a ready snapshot must be named.
+func (r *QuObjectBucketClaimReconciler) resolveDataSource(
+	ctx context.Context,
+	claim *quv1.QuObjectBucketClaim,
+) (dataSourceBucket, error) {
+	ds := claim.Spec.DataSource
+	switch {
+	case ds.ClaimRef != nil && ds.SnapshotRef != nil:
+		return dataSourceBucket{}, fmt.Errorf("spec.dataSource must set only one of claimRef and snapshotRef")
+	case ds.ClaimRef != nil:
+		source := &quv1.QuObjectBucketClaim{}
+		key := types.NamespacedName{Name: ds.ClaimRef.Name, Namespace: claim.Namespace}
+		if err := r.Get(ctx, key, source); err != nil {
+			return dataSourceBucket{}, fmt.Errorf("failed to get data source claim %s: %w", key.Name, err)
+		}
+		if source.UID == claim.UID {
+			return dataSourceBucket{}, fmt.Errorf("a claim cannot be its own data source")
+		}
+		if source.Status.Phase != quv1.ClaimPhaseBound || source.Status.BucketName == "" {
+			return dataSourceBucket{}, fmt.Errorf("data source claim %s is not bound", key.Name)
+		}
+		return dataSourceBucket{
+			backend: source.Annotations[annotationBackend],
+			bucket:  source.Status.BucketName,
+			region:  source.Spec.Region,
+			desc:    "claim " + key.Name,
+		}, nil
+	case ds.SnapshotRef != nil:
+		snap := &quv1.QuObjectBucketSnapshot{}
+		key := types.NamespacedName{Name: ds.SnapshotRef.Name, Namespace: claim.Namespace}
+		if err := r.Get(ctx, key, snap); err != nil {
+			return dataSourceBucket{}, fmt.Errorf("failed to get data source snapshot %s: %w", key.Name, err)
+		}
+		if !snap.Status.ReadyToUse {
+			return dataSourceBucket{}, fmt.Errorf("data source snapshot %s is not ready", key.Name)
+		}
+		return dataSourceBucket{
+			backend: snap.Status.Backend,
+			bucket:  snap.Status.BucketName,
+			region:  snap.Status.Region,
+			desc:    "snapshot " + key.Name,
+		}, nil
+	}
+	return dataSourceBucket{}, fmt.Errorf("spec.dataSource must set claimRef or snapshotRef")
+}
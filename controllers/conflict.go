@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+)
+
+const reasonNameConflict = "NameConflict"
+
+// nameConflictRetryInterval is how often a claim blocked by a name conflict
+// checks whether the conflicting object is gone
+const nameConflictRetryInterval = time.Minute
+
+// nameConflictError is returned when a generated resource name is taken by
+// an object the claim does not control
+type nameConflictError struct {
+	kind string
+	name string
+	// otherClaim is set if the object belongs to another claim
+	otherClaim bool
+}
+
+func (e *nameConflictError) Error() string {
+	return fmt.Sprintf("%s %s already exists and is not owned by this claim", e.kind, e.name)
+}
+
+// checkOwnership returns a nameConflictError unless existing was generated
+// for owner
+func checkOwnership(owner, existing metav1.Object, kind string) error {
+	if ownsOutput(owner, existing) {
+		return nil
+	}
+	ref := metav1.GetControllerOf(existing)
+	return &nameConflictError{
+		kind: kind,
+		name: existing.GetName(),
+		otherClaim: (ref != nil && ref.Kind == "QuObjectBucketClaim") ||
+			existing.GetLabels()[labelClaimUID] != "",
+	}
+}
+
+// handleNameConflict marks the claim as blocked by a foreign object using one
+// of its generated names. The claim is retried periodically in case the
+// object is removed.
+func (r *QuObjectBucketClaimReconciler) handleNameConflict(
+	ctx context.Context,
+	claim *quv1.QuObjectBucketClaim,
+	conflict *nameConflictError,
+) (ctrl.Result, error) {
+	log.FromContext(ctx).Error(conflict, "Refusing to overwrite a resource not owned by the claim")
+	r.warn(ctx, claim, reasonNameConflict, conflict)
+
+	meta.SetStatusCondition(&claim.Status.Conditions, metav1.Condition{
+		Type:   quv1.ConditionNameConflict,
+		Status: metav1.ConditionTrue,
+		Reason: reasonNameConflict,
+		Message: fmt.Sprintf("%s; rename the claim or remove the existing %s",
+			conflict.Error(), conflict.kind),
+		ObservedGeneration: claim.Generation,
+	})
+	claim.Status.Phase = quv1.ClaimPhaseError
+	setReadyCondition(claim, reasonNameConflict, conflict.Error())
+	if err := r.Status().Update(ctx, claim); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: nameConflictRetryInterval}, nil
+}
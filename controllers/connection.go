@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"context"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+)
+
+// Keys of the combined connection Secret. The schema is stable so generic
+// tooling can consume any claim uniformly.
+const (
+	connectionKeyEndpoint        = "endpoint"
+	connectionKeyRegion          = "region"
+	connectionKeyBucket          = "bucket"
+	connectionKeyAccessKeyID     = "accessKeyId"
+	connectionKeySecretAccessKey = "secretAccessKey"
+	connectionKeyCABundle        = "caBundle"
+	connectionKeyUsePathStyle    = "usePathStyle"
+	// connectionKeySessionToken is only present for temporary credentials
+	connectionKeySessionToken = "sessionToken"
+	// connectionKeyTenant is only present for tenant-qualified RGW buckets,
+	// whose bucket key is tenant:bucket
+	connectionKeyTenant = "tenant"
+)
+
+// isConnectionOutput reports whether the claim publishes a single connection
+// Secret instead of the Secret and ConfigMap pair
+func isConnectionOutput(claim *quv1.QuObjectBucketClaim) bool {
+	return claim.Spec.OutputMode == quv1.OutputModeConnection
+}
+
+// isCSIOutput reports whether the claim's credentials are only mounted
+// through the Secrets Store CSI provider
+func isCSIOutput(claim *quv1.QuObjectBucketClaim) bool {
+	return claim.Spec.OutputMode == quv1.OutputModeCSI
+}
+
+// bucketPathStyle reports whether clients must use path-style addressing.
+// Directory buckets are always addressed virtual-hosted style.
+func bucketPathStyle(claim *quv1.QuObjectBucketClaim, cfg backend.Config) bool {
+	return cfg.UsePathStyle && !isDirectoryBucket(claim)
+}
+
+// connectionSecretData returns the data of the combined connection Secret
+func connectionSecretData(
+	claim *quv1.QuObjectBucketClaim,
+	cfg backend.Config,
+	creds claimCredentials,
+	bucketName, endpointURL string,
+) map[string]string {
+	data := map[string]string{
+		connectionKeyEndpoint:        endpointURL,
+		connectionKeyRegion:          cfg.Region,
+		connectionKeyBucket:          bucketName,
+		connectionKeyAccessKeyID:     creds.AccessKey,
+		connectionKeySecretAccessKey: creds.SecretKey,
+		connectionKeyUsePathStyle:    strconv.FormatBool(bucketPathStyle(claim, cfg)),
+	}
+	if creds.SessionToken != "" {
+		data[connectionKeySessionToken] = creds.SessionToken
+	}
+	if tenant, _ := backend.SplitTenantBucket(bucketName); tenant != "" {
+		data[connectionKeyTenant] = tenant
+	}
+	if len(cfg.CABundle) > 0 {
+		data[connectionKeyCABundle] = string(cfg.CABundle)
+	}
+	return data
+}
+
+// deleteGeneratedConfigMap removes the claim's ConfigMap after switching to
+// the connection output mode. ConfigMaps the claim does not own are left
+// alone.
+func (r *QuObjectBucketClaimReconciler) deleteGeneratedConfigMap(
+	ctx context.Context,
+	claim *quv1.QuObjectBucketClaim,
+) error {
+	return r.deleteOwned(ctx, claim, &corev1.ConfigMap{}, claim.Status.ConfigMapRef)
+}
+
+// deleteOwned deletes the named object in the namespace of the claim's
+// recorded outputs if the claim owns it. A missing object or empty name is not an error.
+func (r *QuObjectBucketClaimReconciler) deleteOwned(
+	ctx context.Context,
+	claim *quv1.QuObjectBucketClaim,
+	obj client.Object,
+	name string,
+) error {
+	if name == "" {
+		return nil
+	}
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: recordedOutputNamespace(claim)}, obj)
+	if apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !ownsOutput(claim, obj) {
+		return nil
+	}
+	if err := r.Delete(ctx, obj); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
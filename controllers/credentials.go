@@ -0,0 +1,254 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+	"github.com/pamvdam71/quobject-controller/internal/logging"
+)
+
+// defaultCredentialsDuration is the lifetime of temporary credentials when
+// the claim does not set one
+const defaultCredentialsDuration = time.Hour
+
+// maxSessionNameLength is the longest role session name STS accepts
+const maxSessionNameLength = 64
+
+// annotationRotateCredentials requests new credentials for the claim's
+// Secret. It is removed once they are published.
+const annotationRotateCredentials = "quobject.io/rotate-credentials"
+
+// Event reasons of rotation requests
+const (
+	reasonClaimCredentialsRotated = "CredentialsRotated"
+	reasonCredentialsNotRotated   = "CredentialsNotRotated"
+)
+
+// claimCredentials are the credentials published in the claim's Secret
+type claimCredentials struct {
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	// Expiration is set for temporary credentials only
+	Expiration *metav1.Time
+	// User is set for the keys of a user created for the claim
+	User *quv1.CredentialsUserStatus
+}
+
+// isTemporaryCredentials reports whether the claim publishes short-lived
+// STS credentials instead of the backend's keys
+func isTemporaryCredentials(claim *quv1.QuObjectBucketClaim) bool {
+	return claim.Spec.Credentials != nil && claim.Spec.Credentials.Mode == quv1.CredentialsModeTemporary
+}
+
+// credentialsDuration returns the lifetime of the claim's temporary credentials
+func credentialsDuration(claim *quv1.QuObjectBucketClaim) time.Duration {
+	if c := claim.Spec.Credentials; c != nil && c.Duration != nil && c.Duration.Duration > 0 {
+		return c.Duration.Duration
+	}
+	return defaultCredentialsDuration
+}
+
+// credentialsRefreshIn returns how long the published temporary credentials
+// remain usable before they are refreshed, which happens when a third of
+// their lifetime remains. It is not positive when a refresh is due.
+func credentialsRefreshIn(claim *quv1.QuObjectBucketClaim) time.Duration {
+	exp := claim.Status.CredentialsExpiration
+	if exp == nil {
+		return 0
+	}
+	return time.Until(exp.Time) - credentialsDuration(claim)/3
+}
+
+// claimCredentials returns the credentials to publish for the claim. Static
+// claims get the backend's keys, or the keys of their own user on backends
+// with the Quobyte management API, and dedicated claims those of their own
+// user. Temporary credentials are reused from
+// the claim's Secret until their refresh is due and then issued anew.
+func (r *QuObjectBucketClaimReconciler) claimCredentials(
+	ctx context.Context,
+	claim *quv1.QuObjectBucketClaim,
+	backendName string,
+	cfg backend.Config,
+	bucketName string,
+) (claimCredentials, error) {
+	if usesQuobyteUser(claim, cfg) {
+		return r.quobyteCredentials(ctx, claim, backendName, cfg)
+	}
+	if usesDedicatedUser(claim, cfg) {
+		return r.dedicatedCredentials(ctx, claim, backendName, cfg, bucketName)
+	}
+	if !isTemporaryCredentials(claim) {
+		return claimCredentials{AccessKey: cfg.AccessKey, SecretKey: cfg.SecretKey}, nil
+	}
+	if credentialsRefreshIn(claim) > 0 && !issuedBeforeReadOnly(claim, claim.Status.CredentialsExpiration) &&
+		!rotationRequested(claim) {
+		if creds, ok := r.publishedCredentials(ctx, claim); ok && creds.SessionToken != "" {
+			return creds, nil
+		}
+	}
+
+	tc, err := backend.AssumeRoleForBucket(ctx, cfg, r.S3RateLimiter, bucketName,
+		sessionName(claim), credentialsDuration(claim), isReadOnly(claim))
+	if err != nil {
+		return claimCredentials{}, fmt.Errorf("failed to issue temporary credentials: %w", err)
+	}
+	logging.SetSecrets(claimSecretsOwner(claim), tc.Expiration, tc.AccessKeyID, tc.SecretAccessKey, tc.SessionToken)
+	exp := metav1.NewTime(tc.Expiration)
+	return claimCredentials{
+		AccessKey:    tc.AccessKeyID,
+		SecretKey:    tc.SecretAccessKey,
+		SessionToken: tc.SessionToken,
+		Expiration:   &exp,
+	}, nil
+}
+
+// issuedTo reports whether the published credentials are the keys of the
+// user on the backend. Claims published before the user was recorded are
+// matched by the backend of their outputs and by holding other keys than
+// the backend's own.
+func issuedTo(
+	claim *quv1.QuObjectBucketClaim,
+	creds claimCredentials,
+	cfg backend.Config,
+	backendName, user string,
+) bool {
+	if issued := claim.Status.CredentialsUser; issued != nil {
+		return issued.Backend == backendName && issued.Name == user
+	}
+	return claim.Status.Backend == backendName && creds.AccessKey != cfg.AccessKey && creds.SessionToken == ""
+}
+
+// revokeMovedUser deletes the user whose keys were published while the
+// claim was served by another backend. The user of a backend that no longer
+// exists cannot be reached and is left behind.
+func (r *QuObjectBucketClaimReconciler) revokeMovedUser(
+	ctx context.Context,
+	claim *quv1.QuObjectBucketClaim,
+	backendName string,
+) error {
+	issued := claim.Status.CredentialsUser
+	if issued == nil || issued.Backend == backendName {
+		return nil
+	}
+	cfg, err := backend.Load(ctx, r.Client, issued.Backend)
+	if apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	switch {
+	case cfg.Quobyte.Enabled():
+		err = backend.DeleteQuobyteUser(ctx, cfg, r.S3RateLimiter, issued.Name)
+	case cfg.CanProvisionUsers():
+		err = backend.DeleteClaimUser(ctx, cfg, r.S3RateLimiter, issued.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete user %s on backend %s: %w", issued.Name, issued.Backend, err)
+	}
+	return nil
+}
+
+// rotationRequested reports whether the claim asks for new credentials
+// instead of reusing the published ones
+func rotationRequested(claim *quv1.QuObjectBucketClaim) bool {
+	return claim.Annotations[annotationRotateCredentials] == "true"
+}
+
+// finishCredentialsRotation removes the rotation request once the new
+// credentials are published. The claim is patched, so changes to its status
+// must be written before.
+func (r *QuObjectBucketClaimReconciler) finishCredentialsRotation(
+	ctx context.Context,
+	claim *quv1.QuObjectBucketClaim,
+	cfg backend.Config,
+) error {
+	if _, ok := claim.Annotations[annotationRotateCredentials]; !ok {
+		return nil
+	}
+	patch := client.MergeFrom(claim.DeepCopy())
+	delete(claim.Annotations, annotationRotateCredentials)
+	if err := r.Patch(ctx, claim, patch); err != nil {
+		return err
+	}
+	if !isTemporaryCredentials(claim) && !usesQuobyteUser(claim, cfg) && !usesDedicatedUser(claim, cfg) {
+		r.event(ctx, claim, corev1.EventTypeWarning, reasonCredentialsNotRotated,
+			"Static credentials are the backend's keys, which are rotated with the rotationInterval of the backend secret")
+		return nil
+	}
+	r.event(ctx, claim, corev1.EventTypeNormal, reasonClaimCredentialsRotated,
+		"Published new credentials as requested by %s", annotationRotateCredentials)
+	return nil
+}
+
+// publishedCredentials reads the credentials from the claim's Secret. It
+// reports false if the Secret holds no access key pair in the claim's
+// output mode.
+func (r *QuObjectBucketClaimReconciler) publishedCredentials(
+	ctx context.Context,
+	claim *quv1.QuObjectBucketClaim,
+) (claimCredentials, bool) {
+	if claim.Status.SecretRef == "" {
+		return claimCredentials{}, false
+	}
+	var secret corev1.Secret
+	key := types.NamespacedName{Name: claim.Status.SecretRef, Namespace: recordedOutputNamespace(claim)}
+	if err := r.Get(ctx, key, &secret); err != nil {
+		return claimCredentials{}, false
+	}
+	keyID, secretKey, token := "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN"
+	if isConnectionOutput(claim) {
+		keyID, secretKey, token = connectionKeyAccessKeyID, connectionKeySecretAccessKey, connectionKeySessionToken
+	}
+	creds := claimCredentials{
+		AccessKey:    string(secret.Data[keyID]),
+		SecretKey:    string(secret.Data[secretKey]),
+		SessionToken: string(secret.Data[token]),
+		Expiration:   claim.Status.CredentialsExpiration,
+	}
+	if creds.AccessKey == "" || creds.SecretKey == "" {
+		return claimCredentials{}, false
+	}
+	var expires time.Time
+	if creds.Expiration != nil {
+		expires = creds.Expiration.Time
+	}
+	logging.SetSecrets(claimSecretsOwner(claim), expires, creds.AccessKey, creds.SecretKey, creds.SessionToken)
+	return creds, true
+}
+
+// claimSecretsOwner names the published credentials of a claim for log
+// redaction
+func claimSecretsOwner(claim *quv1.QuObjectBucketClaim) string {
+	return "claim/" + string(claim.UID)
+}
+
+// csiSecretsOwner names the credentials issued to CSI mounts of a claim for
+// log redaction
+func csiSecretsOwner(claim *quv1.QuObjectBucketClaim) string {
+	return claimSecretsOwner(claim) + "/csi"
+}
+
+// forgetClaimSecrets stops redacting the credentials of a deleted claim
+func forgetClaimSecrets(claim *quv1.QuObjectBucketClaim) {
+	logging.ForgetSecrets(claimSecretsOwner(claim), csiSecretsOwner(claim))
+}
+
+// sessionName returns the role session name identifying the claim in the
+// backend's audit logs
+func sessionName(claim *quv1.QuObjectBucketClaim) string {
+	name := "quobject-" + claim.Namespace + "-" + claim.Name
+	if len(name) > maxSessionNameLength {
+		name = name[:maxSessionNameLength]
+	}
+	return name
+}
@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"testing"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+)
+
+func TestIssuedTo(t *testing.T) {
+	cfg := backend.Config{AccessKey: "backend-key"}
+	userKeys := claimCredentials{AccessKey: "user-key", SecretKey: "secret"}
+	recorded := func(backendName, user string) *quv1.QuObjectBucketClaim {
+		claim := &quv1.QuObjectBucketClaim{}
+		claim.Status.Backend = backendName
+		claim.Status.CredentialsUser = &quv1.CredentialsUserStatus{Backend: backendName, Name: user}
+		return claim
+	}
+	unrecorded := func(backendName string) *quv1.QuObjectBucketClaim {
+		claim := &quv1.QuObjectBucketClaim{}
+		claim.Status.Backend = backendName
+		return claim
+	}
+
+	for _, tc := range []struct {
+		name  string
+		claim *quv1.QuObjectBucketClaim
+		creds claimCredentials
+		want  bool
+	}{
+		{"same backend and user", recorded("target", "quobject-1"), userKeys, true},
+		{"other backend", recorded("source", "quobject-1"), userKeys, false},
+		{"other user", recorded("target", "quobject-2"), userKeys, false},
+		{"unrecorded user on the backend", unrecorded("target"), userKeys, true},
+		{"unrecorded user on another backend", unrecorded("source"), userKeys, false},
+		{"backend keys", unrecorded("target"), claimCredentials{AccessKey: "backend-key"}, false},
+		{"STS credentials", unrecorded("target"), claimCredentials{AccessKey: "sts", SessionToken: "token"}, false},
+	} {
+		if got := issuedTo(tc.claim, tc.creds, cfg, "target", "quobject-1"); got != tc.want {
+			t.Errorf("%s: issuedTo = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
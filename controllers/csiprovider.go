@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+	"github.com/pamvdam71/quobject-controller/internal/csiprovider"
+	"github.com/pamvdam71/quobject-controller/internal/logging"
+)
+
+// csiParameterClaimName is the SecretProviderClass parameter naming the
+// claim whose credentials are mounted
+const csiParameterClaimName = "claimName"
+
+// CSIProvider mounts the credentials and settings of a claim into pods
+// through the Secrets Store CSI driver. Pods may only mount the claims of
+// their own namespace, like the claim's Secret.
+type CSIProvider struct {
+	Client client.Reader
+	// S3RateLimiter throttles the requests to the backends' STS APIs.
+	// A nil limiter disables rate limiting.
+	S3RateLimiter *rate.Limiter
+
+	mu sync.Mutex
+	// issued caches temporary credentials per claim, so that the driver's
+	// periodic rotation polls reuse them until their refresh is due. Expired
+	// credentials are dropped, so claims no longer mounted do not pile up.
+	issued map[types.UID]claimCredentials
+}
+
+var _ csiprovider.Provider = &CSIProvider{}
+
+// Mount returns one file per key of the claim's default Secret
+func (p *CSIProvider) Mount(
+	ctx context.Context,
+	attributes map[string]string,
+	mode int32,
+	_ []csiprovider.ObjectVersion,
+) ([]csiprovider.File, []csiprovider.ObjectVersion, error) {
+	name := attributes[csiParameterClaimName]
+	if name == "" {
+		return nil, nil, fmt.Errorf("the SecretProviderClass must set the %s parameter", csiParameterClaimName)
+	}
+	namespace := attributes[csiprovider.AttributePodNamespace]
+	if namespace == "" {
+		return nil, nil, errors.New("the driver did not pass the pod namespace")
+	}
+
+	claim := &quv1.QuObjectBucketClaim{}
+	if err := p.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, claim); err != nil {
+		return nil, nil, fmt.Errorf("failed to get claim %s/%s: %w", namespace, name, err)
+	}
+	if claim.Status.Phase != quv1.ClaimPhaseBound {
+		return nil, nil, fmt.Errorf("claim %s/%s is %s, not Bound", namespace, name, claim.Status.Phase)
+	}
+
+	var cfg backend.Config
+	var err error
+	if backendName := claim.Annotations[annotationBackend]; backendName != "" {
+		cfg, err = backend.Load(ctx, p.Client, backendName)
+	} else {
+		_, cfg, err = backend.Resolve(ctx, p.Client, claim.Spec.StorageClassName)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg = cfg.ForRegion(claim.Spec.Region)
+
+	creds, err := p.credentials(ctx, claim, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bucketHost := cfg.Endpoint
+	if isDirectoryBucket(claim) {
+		bucketHost = directoryBucketEndpoint(cfg.Region, claim.Spec.AvailabilityZoneID)
+	}
+	data := map[string]string{
+		"AWS_ACCESS_KEY_ID":     creds.AccessKey,
+		"AWS_SECRET_ACCESS_KEY": creds.SecretKey,
+		"BUCKET_NAME":           claim.Status.BucketName,
+		"BUCKET_HOST":           bucketHost,
+		"BUCKET_REGION":         cfg.Region,
+	}
+	if creds.SessionToken != "" {
+		data["AWS_SESSION_TOKEN"] = creds.SessionToken
+		data["AWS_CREDENTIALS_EXPIRATION"] = creds.Expiration.UTC().Format(time.RFC3339)
+	}
+
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	files := make([]csiprovider.File, 0, len(keys))
+	versions := make([]csiprovider.ObjectVersion, 0, len(keys))
+	for _, k := range keys {
+		sum := sha256.Sum256([]byte(data[k]))
+		files = append(files, csiprovider.File{Path: k, Mode: mode, Contents: []byte(data[k])})
+		versions = append(versions, csiprovider.ObjectVersion{ID: k, Version: hex.EncodeToString(sum[:])[:16]})
+	}
+	return files, versions, nil
+}
+
+// checkCSICredentials returns an error if the claim's credentials cannot be
+// mounted through CSI, because they are the keys of a user created for the
+// claim, which are only kept in its Secret
+func checkCSICredentials(claim *quv1.QuObjectBucketClaim, cfg backend.Config) error {
+	if usesQuobyteUser(claim, cfg) {
+		return fmt.Errorf("claims on backends with the Quobyte management API must use %s credentials to be mounted through CSI",
+			quv1.CredentialsModeTemporary)
+	}
+	if usesDedicatedUser(claim, cfg) {
+		return fmt.Errorf("%s credentials are only published in the claim's Secret and cannot be mounted through CSI",
+			quv1.CredentialsModeDedicated)
+	}
+	return nil
+}
+
+// credentials returns the backend's keys for static claims, and temporary
+// credentials scoped to the bucket otherwise
+func (p *CSIProvider) credentials(
+	ctx context.Context,
+	claim *quv1.QuObjectBucketClaim,
+	cfg backend.Config,
+) (claimCredentials, error) {
+	if err := checkCSICredentials(claim, cfg); err != nil {
+		return claimCredentials{}, err
+	}
+	if !isTemporaryCredentials(claim) {
+		return claimCredentials{AccessKey: cfg.AccessKey, SecretKey: cfg.SecretKey}, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	for uid, creds := range p.issued {
+		if !creds.Expiration.After(now) {
+			delete(p.issued, uid)
+		}
+	}
+	if creds, ok := p.issued[claim.UID]; ok &&
+		time.Until(creds.Expiration.Time) > credentialsDuration(claim)/3 &&
+		!issuedBeforeReadOnly(claim, creds.Expiration) {
+		return creds, nil
+	}
+	tc, err := backend.AssumeRoleForBucket(ctx, cfg, p.S3RateLimiter, claim.Status.BucketName,
+		sessionName(claim), credentialsDuration(claim), isReadOnly(claim))
+	if err != nil {
+		return claimCredentials{}, fmt.Errorf("failed to issue temporary credentials: %w", err)
+	}
+	logging.SetSecrets(csiSecretsOwner(claim), tc.Expiration, tc.AccessKeyID, tc.SecretAccessKey, tc.SessionToken)
+	exp := metav1.NewTime(tc.Expiration)
+	creds := claimCredentials{
+		AccessKey:    tc.AccessKeyID,
+		SecretKey:    tc.SecretAccessKey,
+		SessionToken: tc.SessionToken,
+		Expiration:   &exp,
+	}
+	if p.issued == nil {
+		p.issued = map[types.UID]claimCredentials{}
+	}
+	p.issued[claim.UID] = creds
+	return creds, nil
+}
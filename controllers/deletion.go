@@ -0,0 +1,243 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// deleteBucket empties an S3 bucket using the given number of parallel
+// workers and then deletes it, reporting drain progress to progress
+func deleteBucket(
+	ctx context.Context,
+	s3c *s3.Client,
+	bucket string,
+	workers int,
+	progress *deletionProgress,
+) error {
+	// Managed statements such as the read-only Deny apply to the bucket
+	// owner too, and would fail the drain with AccessDenied
+	if err := syncBucketPolicy(ctx, s3c, bucket, nil); isNoSuchBucket(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// First, delete all objects in the bucket
+	if err := emptyBucket(ctx, s3c, bucket, workers, progress); err != nil {
+		return err
+	}
+
+	// Now delete the bucket
+	_, err := s3c.DeleteBucket(ctx, &s3.DeleteBucketInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		// Check if bucket doesn't exist (already deleted)
+		if isNoSuchBucket(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to delete bucket: %w", err)
+	}
+
+	return nil
+}
+
+// isNoSuchBucket reports whether err says the bucket does not exist. The
+// bucket policy error NoSuchBucketPolicy does not count.
+func isNoSuchBucket(err error) bool {
+	if err == nil {
+		return false
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode() == "NoSuchBucket"
+	}
+	return strings.Contains(strings.ToLower(err.Error()), "nosuchbucket") &&
+		!strings.Contains(strings.ToLower(err.Error()), "nosuchbucketpolicy")
+}
+
+// deleteBatchSize is the most keys a DeleteObjects call may delete
+const deleteBatchSize = 1000
+
+// deleteBatch is a set of objects, or object versions, deleted with one
+// DeleteObjects call
+type deleteBatch struct {
+	objects []s3types.ObjectIdentifier
+	bytes   int64
+}
+
+// batcher collects listed objects into batches of deleteBatchSize for the
+// deletion workers
+type batcher struct {
+	batch deleteBatch
+	// send hands a batch to the workers and returns false once they stopped
+	send func(deleteBatch) bool
+}
+
+// add adds an object to the current batch, sending it when full. It returns
+// false once the workers stopped.
+func (b *batcher) add(key, versionID *string, size int64) bool {
+	b.batch.objects = append(b.batch.objects, s3types.ObjectIdentifier{Key: key, VersionId: versionID})
+	b.batch.bytes += size
+	if len(b.batch.objects) < deleteBatchSize {
+		return true
+	}
+	return b.flush()
+}
+
+// flush sends the current batch, if any. It returns false once the workers
+// stopped.
+func (b *batcher) flush() bool {
+	if len(b.batch.objects) == 0 {
+		return true
+	}
+	batch := b.batch
+	b.batch = deleteBatch{}
+	return b.send(batch)
+}
+
+// emptyBucket lists all objects in the bucket page by page, including all
+// versions and delete markers if the bucket has or had versioning enabled,
+// and hands them in batches to a pool of workers that delete them with
+// DeleteObjects. The first failure stops the pool.
+func emptyBucket(
+	ctx context.Context,
+	s3c *s3.Client,
+	bucket string,
+	workers int,
+	progress *deletionProgress,
+) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	batches := make(chan deleteBatch)
+	// Each worker reports at most one error before exiting
+	errs := make(chan error, workers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				if err := deleteObjects(ctx, s3c, bucket, batch); err != nil {
+					errs <- err
+					cancel()
+					return
+				}
+				progress.add(int64(len(batch.objects)), batch.bytes)
+			}
+		}()
+	}
+
+	b := &batcher{send: func(batch deleteBatch) bool {
+		select {
+		case batches <- batch:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}}
+	var listErr error
+	if bucketVersioned(ctx, s3c, bucket) {
+		listErr = listObjectVersions(ctx, s3c, bucket, b)
+	} else {
+		listErr = listObjects(ctx, s3c, bucket, b)
+	}
+	close(batches)
+	wg.Wait()
+	close(errs)
+
+	// A worker failure is the root cause of any listing cancellation
+	if err := <-errs; err != nil {
+		return err
+	}
+	return listErr
+}
+
+// bucketVersioned reports whether versioning is or was enabled on the
+// bucket, so that it may hold noncurrent versions and delete markers.
+// Backends without versioning support report false.
+func bucketVersioned(ctx context.Context, s3c *s3.Client, bucket string) bool {
+	out, err := s3c.GetBucketVersioning(ctx, &s3.GetBucketVersioningInput{Bucket: aws.String(bucket)})
+	return err == nil && out.Status != ""
+}
+
+// listObjects hands the objects of an unversioned bucket to b
+func listObjects(ctx context.Context, s3c *s3.Client, bucket string, b *batcher) error {
+	paginator := s3.NewListObjectsV2Paginator(s3c, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list objects: %w", err)
+		}
+		for _, obj := range page.Contents {
+			if !b.add(obj.Key, nil, aws.ToInt64(obj.Size)) {
+				return nil
+			}
+		}
+	}
+	b.flush()
+	return nil
+}
+
+// listObjectVersions hands all object versions and delete markers of a
+// versioned bucket to b
+func listObjectVersions(ctx context.Context, s3c *s3.Client, bucket string, b *batcher) error {
+	paginator := s3.NewListObjectVersionsPaginator(s3c, &s3.ListObjectVersionsInput{
+		Bucket: aws.String(bucket),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list object versions: %w", err)
+		}
+		for _, v := range page.Versions {
+			if !b.add(v.Key, v.VersionId, aws.ToInt64(v.Size)) {
+				return nil
+			}
+		}
+		for _, m := range page.DeleteMarkers {
+			if !b.add(m.Key, m.VersionId, 0) {
+				return nil
+			}
+		}
+	}
+	b.flush()
+	return nil
+}
+
+// deleteObjects deletes a batch of objects, failing if any of them could not
+// be deleted
+func deleteObjects(ctx context.Context, s3c *s3.Client, bucket string, batch deleteBatch) error {
+	out, err := s3c.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(bucket),
+		Delete: &s3types.Delete{
+			Objects: batch.objects,
+			Quiet:   aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete %d objects: %w", len(batch.objects), err)
+	}
+	if len(out.Errors) > 0 {
+		e := out.Errors[0]
+		return fmt.Errorf("failed to delete %d of %d objects, e.g. %s: %s: %s", len(out.Errors), len(batch.objects),
+			aws.ToString(e.Key), aws.ToString(e.Code), aws.ToString(e.Message))
+	}
+	return nil
+}
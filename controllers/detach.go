@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+)
+
+// reasonDetached is the Event reason of a claim or snapshot released by a
+// controller in detach-only mode
+const reasonDetached = "Detached"
+
+// detach removes the finalizer of the claim without touching its bucket,
+// user or outputs, so the claim can be deleted once the controller is
+// uninstalled. Deleting it then keeps the bucket whatever its retain policy.
+func (r *QuObjectBucketClaimReconciler) detach(ctx context.Context, claim *quv1.QuObjectBucketClaim) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(claim, finalizerName) {
+		return ctrl.Result{}, nil
+	}
+	patch := client.MergeFrom(claim.DeepCopy())
+	controllerutil.RemoveFinalizer(claim, finalizerName)
+	if err := r.Patch(ctx, claim, patch); err != nil {
+		return ctrl.Result{}, err
+	}
+	log.FromContext(ctx).Info("Detached QuObjectBucketClaim", "bucket", claim.Status.BucketName)
+	r.event(ctx, claim, corev1.EventTypeNormal, reasonDetached,
+		"Released by the controller in detach-only mode; bucket %s is kept on deletion", claim.Status.BucketName)
+	return ctrl.Result{}, nil
+}
+
+// detach removes the finalizer of the snapshot without deleting its
+// snapshot bucket
+func (r *QuObjectBucketSnapshotReconciler) detach(ctx context.Context, snap *quv1.QuObjectBucketSnapshot) error {
+	if !controllerutil.ContainsFinalizer(snap, finalizerName) {
+		return nil
+	}
+	patch := client.MergeFrom(snap.DeepCopy())
+	controllerutil.RemoveFinalizer(snap, finalizerName)
+	if err := r.Patch(ctx, snap, patch); err != nil {
+		return err
+	}
+	log.FromContext(ctx).Info("Detached QuObjectBucketSnapshot", "bucket", snap.Status.BucketName)
+	r.Recorder.Eventf(snap, corev1.EventTypeNormal, reasonDetached,
+		"Released by the controller in detach-only mode; bucket %s is kept on deletion", snap.Status.BucketName)
+	return nil
+}
@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+)
+
+const directoryBucketSuffix = "--x-s3"
+
+// isDirectoryBucket reports whether the claim requests an S3 Express One
+// Zone directory bucket
+func isDirectoryBucket(claim *quv1.QuObjectBucketClaim) bool {
+	return claim.Spec.BucketType == quv1.BucketTypeDirectory
+}
+
+// directoryBucketName appends the zone suffix required in directory bucket
+// names unless the name already carries it
+func directoryBucketName(base, azID string) string {
+	if strings.HasSuffix(base, directoryBucketSuffix) {
+		return base
+	}
+	return fmt.Sprintf("%s--%s%s", base, azID, directoryBucketSuffix)
+}
+
+// directoryBucketEndpoint returns the zonal endpoint serving directory
+// buckets in the given availability zone
+func directoryBucketEndpoint(region, azID string) string {
+	return fmt.Sprintf("s3express-%s.%s.amazonaws.com", azID, region)
+}
+
+// useAWSEndpoints makes the client resolve AWS endpoints itself. Directory
+// buckets need this for their zonal endpoints and session authentication,
+// neither of which work with a fixed path-style base endpoint.
+func useAWSEndpoints(o *s3.Options) {
+	o.BaseEndpoint = nil
+	o.UsePathStyle = false
+}
+
+// bucketClientOptions returns the client options needed to reach the claim's
+// bucket
+func bucketClientOptions(claim *quv1.QuObjectBucketClaim) []func(*s3.Options) {
+	if isDirectoryBucket(claim) {
+		return []func(*s3.Options){useAWSEndpoints}
+	}
+	return nil
+}
+
+// createBucketConfiguration returns the CreateBucket configuration for the
+// claim's bucket type, or nil if the backend takes none
+func createBucketConfiguration(
+	claim *quv1.QuObjectBucketClaim,
+	cfg backend.Config,
+) *s3types.CreateBucketConfiguration {
+	if isDirectoryBucket(claim) {
+		return &s3types.CreateBucketConfiguration{
+			Location: &s3types.LocationInfo{
+				Name: aws.String(claim.Spec.AvailabilityZoneID),
+				Type: s3types.LocationTypeAvailabilityZone,
+			},
+			Bucket: &s3types.BucketInfo{
+				DataRedundancy: s3types.DataRedundancySingleAvailabilityZone,
+				Type:           s3types.BucketTypeDirectory,
+			},
+		}
+	}
+	if cfg.Profile.SkipLocationConstraint {
+		return nil
+	}
+	location := cfg.Region
+	if claim.Spec.LocationHint != "" && cfg.Profile.LocationHints {
+		location = claim.Spec.LocationHint
+	}
+	if claim.Spec.PlacementTarget != "" && cfg.Profile.PlacementTargets {
+		location += ":" + claim.Spec.PlacementTarget
+	}
+	return &s3types.CreateBucketConfiguration{
+		LocationConstraint: s3types.BucketLocationConstraint(location),
+	}
+}
+
+// createBucketOptions returns the request options of CreateBucket for the
+// claim. RGW takes the default storage class of the placement target from
+// the storage class header.
+func createBucketOptions(claim *quv1.QuObjectBucketClaim, cfg backend.Config) []func(*s3.Options) {
+	if claim.Spec.StoragePolicy == "" || claim.Spec.PlacementTarget == "" || !cfg.Profile.PlacementTargets {
+		return nil
+	}
+	return []func(*s3.Options){func(o *s3.Options) {
+		o.APIOptions = append(o.APIOptions, smithyhttp.SetHeaderValue("X-Amz-Storage-Class", claim.Spec.StoragePolicy))
+	}}
+}
+
+// recordPlacement records where the backend placed the claim's bucket. It
+// is looked up once, as the placement of a bucket never changes.
+func recordPlacement(
+	ctx context.Context,
+	s3c *s3.Client,
+	claim *quv1.QuObjectBucketClaim,
+	cfg backend.Config,
+	bucket string,
+) error {
+	if claim.Status.Placement != "" {
+		return nil
+	}
+	if isDirectoryBucket(claim) {
+		claim.Status.Placement = claim.Spec.AvailabilityZoneID
+		return nil
+	}
+	out, err := s3c.GetBucketLocation(ctx, &s3.GetBucketLocationInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		return fmt.Errorf("failed to get bucket location: %w", err)
+	}
+	claim.Status.Placement = string(out.LocationConstraint)
+	if claim.Status.Placement == "" {
+		// An empty constraint is the backend's default location
+		claim.Status.Placement = cfg.Region
+	}
+	return nil
+}
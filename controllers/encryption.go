@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+)
+
+// sseAlgorithms maps encryption modes to their S3 algorithm
+var sseAlgorithms = map[quv1.EncryptionMode]s3types.ServerSideEncryption{
+	quv1.EncryptionModeSSES3:  s3types.ServerSideEncryptionAes256,
+	quv1.EncryptionModeSSEKMS: s3types.ServerSideEncryptionAwsKms,
+}
+
+// syncBucketEncryption makes the default encryption of the bucket match
+// spec.encryption and records it in status.encryption. Claims without
+// spec.encryption leave the bucket's encryption alone.
+func syncBucketEncryption(ctx context.Context, s3c *s3.Client, claim *quv1.QuObjectBucketClaim, bucket string) error {
+	desired := claim.Spec.Encryption
+	if desired == nil {
+		claim.Status.Encryption = nil
+		return nil
+	}
+	algorithm := sseAlgorithms[desired.Mode]
+
+	out, err := s3c.GetBucketEncryption(ctx, &s3.GetBucketEncryptionInput{Bucket: aws.String(bucket)})
+	var apiErr smithy.APIError
+	if err != nil && !(errors.As(err, &apiErr) && apiErr.ErrorCode() == "ServerSideEncryptionConfigurationNotFoundError") {
+		return fmt.Errorf("failed to get bucket encryption: %w", err)
+	}
+	if err == nil && out.ServerSideEncryptionConfiguration != nil {
+		for _, rule := range out.ServerSideEncryptionConfiguration.Rules {
+			def := rule.ApplyServerSideEncryptionByDefault
+			if def != nil && def.SSEAlgorithm == algorithm && aws.ToString(def.KMSMasterKeyID) == desired.KMSKeyID {
+				claim.Status.Encryption = desired.DeepCopy()
+				return nil
+			}
+		}
+	}
+
+	def := &s3types.ServerSideEncryptionByDefault{SSEAlgorithm: algorithm}
+	if desired.KMSKeyID != "" {
+		def.KMSMasterKeyID = aws.String(desired.KMSKeyID)
+	}
+	_, err = s3c.PutBucketEncryption(ctx, &s3.PutBucketEncryptionInput{
+		Bucket: aws.String(bucket),
+		ServerSideEncryptionConfiguration: &s3types.ServerSideEncryptionConfiguration{
+			Rules: []s3types.ServerSideEncryptionRule{{ApplyServerSideEncryptionByDefault: def}},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put bucket encryption: %w", err)
+	}
+	claim.Status.Encryption = desired.DeepCopy()
+	return nil
+}
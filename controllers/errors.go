@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+)
+
+// ProvisioningError condition reasons
+const (
+	reasonAccessDenied       = "AccessDenied"
+	reasonInvalidBucketName  = "InvalidBucketName"
+	reasonBucketNameTaken    = "BucketNameTaken"
+	reasonThrottled          = "Throttled"
+	reasonBackendUnavailable = "BackendUnavailable"
+	reasonBackendUnreachable = "BackendUnreachable"
+	reasonBackendError       = "BackendError"
+	reasonSecretInvalid      = "CredentialsSecretInvalid"
+	reasonUsersUnsupported   = "UserProvisioningUnsupported"
+)
+
+// errorClass is the condition reason of a failure and whether retrying it
+// can succeed without someone changing the claim or its backend
+type errorClass struct {
+	reason   string
+	terminal bool
+}
+
+// s3ErrorClasses maps S3 error codes to their class
+var s3ErrorClasses = map[string]errorClass{
+	"AccessDenied":          {reasonAccessDenied, true},
+	"InvalidAccessKeyId":    {reasonAccessDenied, true},
+	"SignatureDoesNotMatch": {reasonAccessDenied, true},
+	"AllAccessDisabled":     {reasonAccessDenied, true},
+	"InvalidBucketName":     {reasonInvalidBucketName, true},
+	"BucketAlreadyExists":   {reasonBucketNameTaken, true},
+	"SlowDown":              {reasonThrottled, false},
+	"Throttling":            {reasonThrottled, false},
+	"TooManyRequests":       {reasonThrottled, false},
+	"ServiceUnavailable":    {reasonBackendUnavailable, false},
+	"InternalError":         {reasonBackendUnavailable, false},
+	"RequestTimeout":        {reasonBackendUnavailable, false},
+}
+
+// classifyError returns the class of a provisioning failure. Unknown
+// failures are retried.
+func classifyError(err error) errorClass {
+	// Backend secrets are not watched by claims, so a fix is picked up by
+	// the next retry
+	var invalid *backend.InvalidSecretError
+	if errors.As(err, &invalid) {
+		return errorClass{reasonSecretInvalid, false}
+	}
+	// Namespace annotations are not watched either
+	var nsErr *outputNamespaceError
+	if errors.As(err, &nsErr) {
+		return errorClass{reasonOutputNamespaceDenied, false}
+	}
+	var prefixErr *bucketNamePrefixError
+	if errors.As(err, &prefixErr) {
+		return errorClass{reasonBucketNamePrefixRequired, false}
+	}
+	// Neither are quotas, and other claims may free capacity
+	var quotaErr *namespaceQuotaError
+	if errors.As(err, &quotaErr) {
+		return errorClass{reasonNamespaceQuotaExceeded, false}
+	}
+	if errors.Is(err, backend.ErrUserProvisioningUnsupported) {
+		return errorClass{reasonUsersUnsupported, true}
+	}
+	var classErr *claimClassNotFoundError
+	if errors.As(err, &classErr) {
+		return errorClass{reasonClaimClassNotFound, false}
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		if class, ok := s3ErrorClasses[apiErr.ErrorCode()]; ok {
+			return class
+		}
+	}
+	var netErr net.Error
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.As(err, &netErr) ||
+		strings.Contains(strings.ToLower(err.Error()), "connection refused") {
+		return errorClass{reasonBackendUnreachable, false}
+	}
+	return errorClass{reasonBackendError, false}
+}
+
+// isThrottled reports whether the backend rejected a request because it is
+// overloaded: a throttling error code, or a 429 or 503 response
+func isThrottled(err error) bool {
+	if classifyError(err).reason == reasonThrottled {
+		return true
+	}
+	var respErr *smithyhttp.ResponseError
+	return errors.As(err, &respErr) &&
+		(respErr.HTTPStatusCode() == http.StatusTooManyRequests || respErr.HTTPStatusCode() == http.StatusServiceUnavailable)
+}
+
+// provisioningError records a failed provisioning step in the claim's phase,
+// Events and ProvisioningError condition. Terminal failures are not requeued;
+// throttled claims are retried after the throttle backoff, and any other
+// failure is retried with the workqueue's backoff.
+func (r *QuObjectBucketClaimReconciler) provisioningError(
+	ctx context.Context,
+	claim *quv1.QuObjectBucketClaim,
+	err error,
+) (ctrl.Result, error) {
+	class := classifyError(err)
+	r.warn(ctx, claim, reasonProvisioningFailed, err)
+
+	message := err.Error()
+	if class.terminal {
+		message += "; not retried until the claim changes"
+	}
+	meta.SetStatusCondition(&claim.Status.Conditions, metav1.Condition{
+		Type:               quv1.ConditionProvisioningError,
+		Status:             metav1.ConditionTrue,
+		Reason:             class.reason,
+		Message:            message,
+		ObservedGeneration: claim.Generation,
+	})
+	claim.Status.Phase = quv1.ClaimPhaseError
+	setReadyCondition(claim, class.reason, message)
+	var delay time.Duration
+	if r.Throttle != nil && isThrottled(err) {
+		delay = r.Throttle.Throttled(claim)
+		meta.SetStatusCondition(&claim.Status.Conditions, metav1.Condition{
+			Type:               quv1.ConditionThrottled,
+			Status:             metav1.ConditionTrue,
+			Reason:             reasonThrottled,
+			Message:            fmt.Sprintf("The backend is throttling requests; retrying in %s", delay.Round(time.Second)),
+			ObservedGeneration: claim.Generation,
+		})
+	}
+	r.Status().Update(ctx, claim)
+
+	if class.terminal {
+		return ctrl.Result{}, reconcile.TerminalError(err)
+	}
+	if delay > 0 {
+		// Requeues with an error would ignore the delay
+		return ctrl.Result{RequeueAfter: delay}, nil
+	}
+	return ctrl.Result{}, err
+}
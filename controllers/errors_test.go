@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+	"github.com/pamvdam71/quobject-controller/internal/testutil"
+)
+
+func TestEnsureBucketNameTaken(t *testing.T) {
+	srv := testutil.NewS3Server()
+	defer srv.Close()
+	srv.SetForeignBucket("taken")
+	claim := &quv1.QuObjectBucketClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec:       quv1.QuObjectBucketClaimSpec{BucketName: "taken"},
+	}
+	r := newTestReconciler(t, srv, claim)
+
+	for _, name := range []string{"generic", "minio", "aws", "rgw", "quobyte"} {
+		profile, err := backend.LookupProfile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		created, err := ensureBucket(context.Background(), newTestS3Client(t, r), "taken", nil, profile)
+		if err == nil {
+			t.Fatalf("%s: ensureBucket adopted a bucket of another account (created %v)", name, created)
+		}
+		class := classifyError(fmt.Errorf("failed to ensure bucket taken: %w", err))
+		if class.reason != reasonBucketNameTaken || !class.terminal {
+			t.Errorf("%s: classified %v as %+v, want terminal %s", name, err, class, reasonBucketNameTaken)
+		}
+	}
+
+	got := reconcileUntil(t, r, client.ObjectKeyFromObject(claim), func(c *quv1.QuObjectBucketClaim) bool {
+		return c != nil && c.Status.Phase == quv1.ClaimPhaseError
+	})
+	cond := meta.FindStatusCondition(got.Status.Conditions, quv1.ConditionProvisioningError)
+	if cond == nil || cond.Reason != reasonBucketNameTaken {
+		t.Fatalf("ProvisioningError condition %+v, want reason %s", cond, reasonBucketNameTaken)
+	}
+}
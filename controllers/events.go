@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+	"github.com/pamvdam71/quobject-controller/internal/logging"
+)
+
+// annotationReconcileID is set on Events to the reconcile that emitted them
+const annotationReconcileID = "quobject.io/reconcile-id"
+
+// Event reasons
+const (
+	reasonBound                = "Bound"
+	reasonProvisioningFailed   = "ProvisioningFailed"
+	reasonBucketCreated        = "BucketCreated"
+	reasonBucketAdopted        = "BucketAdopted"
+	reasonSecretCreated        = "SecretCreated"
+	reasonConfigMapCreated     = "ConfigMapCreated"
+	reasonDeletionStarted      = "DeletionStarted"
+	reasonBucketDeleted        = "BucketDeleted"
+	reasonBucketDeletionFailed = "BucketDeletionFailed"
+	reasonBucketRetained       = "BucketRetained"
+)
+
+// event records an Event on the claim, annotated with the reconcile ID so it
+// can be matched with the log lines and S3 requests of the same reconcile.
+// The ID stays out of the message, so that repeated Events are aggregated.
+func (r *QuObjectBucketClaimReconciler) event(
+	ctx context.Context,
+	claim *quv1.QuObjectBucketClaim,
+	eventType, reason, messageFmt string,
+	args ...interface{},
+) {
+	if r.Recorder == nil {
+		return
+	}
+	// Events are as public as logs, so the same credentials are scrubbed
+	message := logging.Redact(fmt.Sprintf(messageFmt, args...))
+	id := string(controller.ReconcileIDFromContext(ctx))
+	if id == "" {
+		r.Recorder.Event(claim, eventType, reason, message)
+		return
+	}
+	r.Recorder.AnnotatedEventf(claim, map[string]string{annotationReconcileID: id},
+		eventType, reason, "%s", message)
+}
+
+// warn records a Warning Event for a failed step
+func (r *QuObjectBucketClaimReconciler) warn(
+	ctx context.Context,
+	claim *quv1.QuObjectBucketClaim,
+	reason string,
+	err error,
+) {
+	r.event(ctx, claim, corev1.EventTypeWarning, reason, "%v", err)
+}
+
+// s3ClientOptions returns the client options for the claim's S3 requests,
+// including the reconcile ID user-agent suffix if enabled and the claim's
+// operation timeout
+func (r *QuObjectBucketClaimReconciler) s3ClientOptions(
+	ctx context.Context,
+	claim *quv1.QuObjectBucketClaim,
+) []func(*s3.Options) {
+	opts := bucketClientOptions(claim)
+	storageClass := claim.Status.StorageClassName
+	if storageClass == "" {
+		storageClass = claim.Spec.StorageClassName
+	}
+	opts = append(opts, withS3Metrics(storageClass))
+	if id := controller.ReconcileIDFromContext(ctx); r.UserAgentReconcileID && id != "" {
+		opts = append(opts, s3.WithAPIOptions(awsmiddleware.AddUserAgentKeyValue("reconcile", string(id))))
+	}
+	if timeout := r.operationTimeout(claim); timeout > 0 {
+		opts = append(opts, backend.WithOperationTimeout(timeout))
+	}
+	return opts
+}
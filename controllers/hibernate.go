@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+)
+
+// Event reason for a claim whose access was revoked
+const reasonHibernated = "Hibernated"
+
+// hibernate revokes all access to the claim's bucket while keeping the
+// bucket: the generated Secret and the claim's Quobyte user are deleted and
+// the ServiceAccount policies no longer grant the bucket. Reconciling the claim after hibernate is
+// unset issues the credentials again.
+func (r *QuObjectBucketClaimReconciler) hibernate(
+	ctx context.Context,
+	s3c *s3.Client,
+	claim *quv1.QuObjectBucketClaim,
+	backendName string,
+	cfg backend.Config,
+	bucketName string,
+) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	if err := r.deleteOwned(ctx, claim, &corev1.Secret{}, claim.Status.SecretRef); err != nil {
+		log.Error(err, "Failed to delete secret")
+		return ctrl.Result{}, err
+	}
+	if err := r.deleteQuobyteUser(ctx, claim, cfg); err != nil {
+		log.Error(err, "Failed to revoke Quobyte user")
+		r.warn(ctx, claim, reasonProvisioningFailed, err)
+		return ctrl.Result{}, err
+	}
+	if err := r.deleteClaimUser(ctx, claim, cfg); err != nil {
+		log.Error(err, "Failed to revoke user")
+		r.warn(ctx, claim, reasonProvisioningFailed, err)
+		return ctrl.Result{}, err
+	}
+	// Without clients, a migrated bucket has nothing left to switch over
+	if err := r.finishMigration(ctx, s3c, claim); err != nil {
+		log.Error(err, "Failed to finish bucket migration")
+		r.warn(ctx, claim, reasonMigrationFailed, err)
+		return ctrl.Result{}, err
+	}
+	if err := r.syncServiceAccountAccess(ctx, claim, backendName, cfg); err != nil {
+		log.Error(err, "Failed to revoke ServiceAccount access")
+		r.warn(ctx, claim, reasonProvisioningFailed, err)
+		return ctrl.Result{}, err
+	}
+
+	if claim.Status.Phase != quv1.ClaimPhaseHibernated {
+		r.event(ctx, claim, corev1.EventTypeNormal, reasonHibernated,
+			"Revoked access to bucket %s, which is kept", bucketName)
+	}
+	claim.Status.Phase = quv1.ClaimPhaseHibernated
+	setReadyCondition(claim, "HibernateRequested", fmt.Sprintf("Access to bucket %s is revoked", bucketName))
+	meta.RemoveStatusCondition(&claim.Status.Conditions, quv1.ConditionFailed)
+	meta.RemoveStatusCondition(&claim.Status.Conditions, quv1.ConditionProvisioningError)
+	claim.Status.BucketName = bucketName
+	recordBackend(claim, backendName)
+	claim.Status.SecretRef = ""
+	claim.Status.CredentialsExpiration = nil
+	setStageCondition(claim, quv1.ConditionCredentialsReady, false, "HibernateRequested",
+		fmt.Sprintf("Access to bucket %s is revoked", bucketName))
+	claim.Status.Share = nil
+	meta.SetStatusCondition(&claim.Status.Conditions, metav1.Condition{
+		Type:    quv1.ConditionHibernated,
+		Status:  metav1.ConditionTrue,
+		Reason:  "HibernateRequested",
+		Message: fmt.Sprintf("Access to bucket %s is revoked until spec.hibernate is unset", bucketName),
+	})
+	if err := r.Status().Update(ctx, claim); err != nil {
+		log.Error(err, "Failed to update QuObjectBucketClaim status")
+		return ctrl.Result{}, err
+	}
+
+	log.Info("Hibernated QuObjectBucketClaim")
+	if migrationCleanupPending(claim) {
+		return ctrl.Result{RequeueAfter: time.Second}, nil
+	}
+	return ctrl.Result{RequeueAfter: r.verifyInterval(claim)}, nil
+}
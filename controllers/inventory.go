@@ -0,0 +1,214 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+)
+
+// InventoryClaim is a claim as listed by the inventory API
+type InventoryClaim struct {
+	Namespace        string              `json:"namespace"`
+	Name             string              `json:"name"`
+	Labels           map[string]string   `json:"labels,omitempty"`
+	BucketName       string              `json:"bucketName,omitempty"`
+	Phase            quv1.ClaimPhase     `json:"phase,omitempty"`
+	Backend          string              `json:"backend,omitempty"`
+	StorageClassName string              `json:"storageClassName,omitempty"`
+	Region           string              `json:"region,omitempty"`
+	SecretRef        string              `json:"secretRef,omitempty"`
+	ConfigMapRef     string              `json:"configMapRef,omitempty"`
+	OutputNamespace  string              `json:"outputNamespace,omitempty"`
+	Usage            *quv1.BucketUsage   `json:"usage,omitempty"`
+	Capacity         corev1.ResourceList `json:"capacity,omitempty"`
+	Conditions       []metav1.Condition  `json:"conditions,omitempty"`
+	CreatedAt        metav1.Time         `json:"createdAt"`
+}
+
+// InventoryServer serves a read-only JSON API listing the claims, for
+// developer portals that should not need access to the Kubernetes API.
+// Requests must present one of the bearer tokens in TokenFile.
+type InventoryServer struct {
+	Client client.Reader
+	// Addr is the address to listen on, e.g. ":8443"
+	Addr string
+	// TokenFile holds the accepted bearer tokens, one per line. It is read
+	// on every request, so tokens can be rotated without a restart.
+	TokenFile string
+	// CertDir holds tls.crt and tls.key. Empty serves plain HTTP.
+	CertDir string
+}
+
+// NeedLeaderElection makes every replica answer, as the API only reads the
+// cache
+func (s *InventoryServer) NeedLeaderElection() bool {
+	return false
+}
+
+// Start serves the API until ctx is done
+func (s *InventoryServer) Start(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("inventory-api")
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/claims", s.listClaims)
+	mux.HandleFunc("GET /api/v1/namespaces/{namespace}/claims", s.listClaims)
+	mux.HandleFunc("GET /api/v1/namespaces/{namespace}/claims/{name}", s.getClaim)
+	srv := &http.Server{
+		Addr:              s.Addr,
+		Handler:           s.authenticate(mux),
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Info("Serving inventory API", "addr", s.Addr, "tls", s.CertDir != "")
+	var err error
+	if s.CertDir != "" {
+		err = srv.ListenAndServeTLS(filepath.Join(s.CertDir, "tls.crt"), filepath.Join(s.CertDir, "tls.key"))
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// authenticate rejects requests without a valid bearer token
+func (s *InventoryServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeInventoryError(w, http.StatusUnauthorized, "a bearer token is required")
+			return
+		}
+		valid, err := s.validToken(token)
+		if err != nil {
+			log.FromContext(r.Context()).Error(err, "Failed to read inventory API tokens")
+			writeInventoryError(w, http.StatusInternalServerError, "failed to authenticate the request")
+			return
+		}
+		if !valid {
+			writeInventoryError(w, http.StatusUnauthorized, "invalid bearer token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validToken compares the token with every token of TokenFile in constant
+// time
+func (s *InventoryServer) validToken(token string) (bool, error) {
+	data, err := os.ReadFile(s.TokenFile)
+	if err != nil {
+		return false, err
+	}
+	valid := false
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 && subtle.ConstantTimeCompare(line, []byte(token)) == 1 {
+			valid = true
+		}
+	}
+	return valid, nil
+}
+
+// listClaims answers with the claims of all namespaces, or of the namespace
+// in the path. A labelSelector query parameter filters them.
+func (s *InventoryServer) listClaims(w http.ResponseWriter, r *http.Request) {
+	opts := []client.ListOption{client.InNamespace(r.PathValue("namespace"))}
+	if selector := r.URL.Query().Get("labelSelector"); selector != "" {
+		ls, err := metav1.ParseToLabelSelector(selector)
+		if err != nil {
+			writeInventoryError(w, http.StatusBadRequest, fmt.Sprintf("invalid labelSelector: %v", err))
+			return
+		}
+		sel, err := metav1.LabelSelectorAsSelector(ls)
+		if err != nil {
+			writeInventoryError(w, http.StatusBadRequest, fmt.Sprintf("invalid labelSelector: %v", err))
+			return
+		}
+		opts = append(opts, client.MatchingLabelsSelector{Selector: sel})
+	}
+
+	var list quv1.QuObjectBucketClaimList
+	if err := s.Client.List(r.Context(), &list, opts...); err != nil {
+		log.FromContext(r.Context()).Error(err, "Failed to list claims")
+		writeInventoryError(w, http.StatusInternalServerError, "failed to list claims")
+		return
+	}
+	claims := make([]InventoryClaim, 0, len(list.Items))
+	for i := range list.Items {
+		claims = append(claims, inventoryClaim(&list.Items[i]))
+	}
+	writeInventory(w, http.StatusOK, map[string]any{"claims": claims})
+}
+
+// getClaim answers with a single claim
+func (s *InventoryServer) getClaim(w http.ResponseWriter, r *http.Request) {
+	claim := &quv1.QuObjectBucketClaim{}
+	key := client.ObjectKey{Namespace: r.PathValue("namespace"), Name: r.PathValue("name")}
+	if err := s.Client.Get(r.Context(), key, claim); apierrors.IsNotFound(err) {
+		writeInventoryError(w, http.StatusNotFound, fmt.Sprintf("claim %s not found", key))
+		return
+	} else if err != nil {
+		log.FromContext(r.Context()).Error(err, "Failed to get claim", "claim", key)
+		writeInventoryError(w, http.StatusInternalServerError, "failed to get the claim")
+		return
+	}
+	writeInventory(w, http.StatusOK, inventoryClaim(claim))
+}
+
+func inventoryClaim(claim *quv1.QuObjectBucketClaim) InventoryClaim {
+	return InventoryClaim{
+		Namespace:        claim.Namespace,
+		Name:             claim.Name,
+		Labels:           claim.Labels,
+		BucketName:       claim.Status.BucketName,
+		Phase:            claim.Status.Phase,
+		Backend:          claim.Annotations[annotationBackend],
+		StorageClassName: claim.Spec.StorageClassName,
+		Region:           claim.Spec.Region,
+		SecretRef:        claim.Status.SecretRef,
+		ConfigMapRef:     claim.Status.ConfigMapRef,
+		OutputNamespace:  claim.Status.OutputNamespace,
+		Usage:            claim.Status.Usage,
+		Capacity:         claim.Status.Capacity,
+		Conditions:       claim.Status.Conditions,
+		CreatedAt:        claim.CreationTimestamp,
+	}
+}
+
+func writeInventory(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeInventoryError(w http.ResponseWriter, status int, message string) {
+	writeInventory(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+)
+
+// lifecycleRulePrefix marks the lifecycle rules owned by the controller.
+// Rules with other IDs are left untouched.
+const lifecycleRulePrefix = managedSidPrefix + "-"
+
+// lifecycleRule is the part of a lifecycle rule the controller manages,
+// comparable between the claim and the bucket
+type lifecycleRule struct {
+	id                    string
+	prefix                string
+	expirationDays        int32
+	noncurrentDays        int32
+	abortIncompleteUpload int32
+}
+
+// lifecycleRuleID returns the ID of the i-th lifecycle rule of a claim on
+// the bucket
+func lifecycleRuleID(rule quv1.LifecycleRule, i int) string {
+	if rule.ID != "" {
+		return lifecycleRulePrefix + rule.ID
+	}
+	return lifecycleRulePrefix + strconv.Itoa(i)
+}
+
+// desiredLifecycleRules returns the lifecycle rules of the claim
+func desiredLifecycleRules(claim *quv1.QuObjectBucketClaim) []lifecycleRule {
+	rules := make([]lifecycleRule, 0, len(claim.Spec.LifecycleRules))
+	for i, r := range claim.Spec.LifecycleRules {
+		rules = append(rules, lifecycleRule{
+			id:                    lifecycleRuleID(r, i),
+			prefix:                r.Prefix,
+			expirationDays:        aws.ToInt32(r.ExpirationDays),
+			noncurrentDays:        aws.ToInt32(r.NoncurrentVersionExpirationDays),
+			abortIncompleteUpload: aws.ToInt32(r.AbortIncompleteMultipartUploadDays),
+		})
+	}
+	return rules
+}
+
+// fromS3LifecycleRule returns the managed part of a rule read from the bucket
+func fromS3LifecycleRule(r s3types.LifecycleRule) lifecycleRule {
+	rule := lifecycleRule{
+		id:     aws.ToString(r.ID),
+		prefix: aws.ToString(r.Prefix),
+	}
+	if f, ok := r.Filter.(*s3types.LifecycleRuleFilterMemberPrefix); ok {
+		rule.prefix = f.Value
+	}
+	if r.Expiration != nil {
+		rule.expirationDays = aws.ToInt32(r.Expiration.Days)
+	}
+	if r.NoncurrentVersionExpiration != nil {
+		rule.noncurrentDays = aws.ToInt32(r.NoncurrentVersionExpiration.NoncurrentDays)
+	}
+	if r.AbortIncompleteMultipartUpload != nil {
+		rule.abortIncompleteUpload = aws.ToInt32(r.AbortIncompleteMultipartUpload.DaysAfterInitiation)
+	}
+	return rule
+}
+
+// toS3 returns the rule in the form of PutBucketLifecycleConfiguration
+func (r lifecycleRule) toS3() s3types.LifecycleRule {
+	rule := s3types.LifecycleRule{
+		ID:     aws.String(r.id),
+		Status: s3types.ExpirationStatusEnabled,
+		Filter: &s3types.LifecycleRuleFilterMemberPrefix{Value: r.prefix},
+	}
+	if r.expirationDays > 0 {
+		rule.Expiration = &s3types.LifecycleExpiration{Days: aws.Int32(r.expirationDays)}
+	}
+	if r.noncurrentDays > 0 {
+		rule.NoncurrentVersionExpiration = &s3types.NoncurrentVersionExpiration{NoncurrentDays: aws.Int32(r.noncurrentDays)}
+	}
+	if r.abortIncompleteUpload > 0 {
+		rule.AbortIncompleteMultipartUpload = &s3types.AbortIncompleteMultipartUpload{
+			DaysAfterInitiation: aws.Int32(r.abortIncompleteUpload),
+		}
+	}
+	return rule
+}
+
+// syncLifecycleRules makes the controller-managed rules of the bucket's
+// lifecycle configuration equal to spec.lifecycleRules, preserving any rules
+// added by others. The configuration is deleted once no rules remain.
+func syncLifecycleRules(ctx context.Context, s3c *s3.Client, claim *quv1.QuObjectBucketClaim, bucket string) error {
+	managed := desiredLifecycleRules(claim)
+	var current []s3types.LifecycleRule
+	out, err := s3c.GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{Bucket: aws.String(bucket)})
+	var apiErr smithy.APIError
+	if err != nil {
+		if !(errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchLifecycleConfiguration") {
+			if len(managed) == 0 {
+				// Nothing to apply; tolerate backends without lifecycle support
+				return nil
+			}
+			return fmt.Errorf("failed to get bucket lifecycle configuration: %w", err)
+		}
+	} else {
+		current = out.Rules
+	}
+
+	var foreign []s3types.LifecycleRule
+	var owned []lifecycleRule
+	for _, r := range current {
+		if strings.HasPrefix(aws.ToString(r.ID), lifecycleRulePrefix) {
+			owned = append(owned, fromS3LifecycleRule(r))
+		} else {
+			foreign = append(foreign, r)
+		}
+	}
+	if lifecycleRulesEqual(owned, managed) {
+		return nil
+	}
+
+	rules := foreign
+	for _, r := range managed {
+		rules = append(rules, r.toS3())
+	}
+	if len(rules) == 0 {
+		if _, err := s3c.DeleteBucketLifecycle(ctx, &s3.DeleteBucketLifecycleInput{Bucket: aws.String(bucket)}); err != nil {
+			return fmt.Errorf("failed to delete bucket lifecycle configuration: %w", err)
+		}
+		return nil
+	}
+	_, err = s3c.PutBucketLifecycleConfiguration(ctx, &s3.PutBucketLifecycleConfigurationInput{
+		Bucket:                 aws.String(bucket),
+		LifecycleConfiguration: &s3types.BucketLifecycleConfiguration{Rules: rules},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put bucket lifecycle configuration: %w", err)
+	}
+	return nil
+}
+
+func lifecycleRulesEqual(a, b []lifecycleRule) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
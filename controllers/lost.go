@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	corev1 "k8s.io/api/core/v1"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+)
+
+// annotationReprovision acknowledges the loss of a Lost claim's data and
+// requests an empty bucket with the same name
+const annotationReprovision = "quobject.io/reprovision"
+
+// Event reasons of lost buckets
+const (
+	reasonBucketLost    = "BucketLost"
+	reasonReprovisioned = "Reprovisioned"
+)
+
+// bucketLost reports whether the bucket a claim was bound to has disappeared
+// from the backend. The claim is then marked Lost instead of silently getting
+// an empty bucket, unless the reprovision annotation asks for one; the
+// annotation is removed so that a later loss is reported again.
+func (r *QuObjectBucketClaimReconciler) bucketLost(
+	ctx context.Context,
+	s3c *s3.Client,
+	claim *quv1.QuObjectBucketClaim,
+	bucketName string,
+) (bool, error) {
+	if claim.Status.BucketName == "" || claim.Status.BucketName != bucketName {
+		return false, nil
+	}
+	_, err := s3c.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucketName)})
+	var respErr *smithyhttp.ResponseError
+	if !errors.As(err, &respErr) || respErr.HTTPStatusCode() != 404 {
+		// Other failures surface when the bucket is ensured
+		return false, nil
+	}
+
+	if claim.Annotations[annotationReprovision] == "true" {
+		r.event(ctx, claim, corev1.EventTypeWarning, reasonReprovisioned,
+			"Recreating lost bucket %s empty as requested by %s; its previous objects are gone",
+			bucketName, annotationReprovision)
+		delete(claim.Annotations, annotationReprovision)
+		return false, r.Update(ctx, claim)
+	}
+
+	if claim.Status.Phase != quv1.ClaimPhaseLost {
+		r.warn(ctx, claim, reasonBucketLost, fmt.Errorf(
+			"bucket %s no longer exists on the backend; set %s=true to recreate it empty", bucketName, annotationReprovision))
+	}
+	claim.Status.Phase = quv1.ClaimPhaseLost
+	setReadyCondition(claim, reasonBucketLost, fmt.Sprintf("Bucket %s no longer exists on the backend", bucketName))
+	setStageCondition(claim, quv1.ConditionBucketReady, false, reasonBucketLost,
+		fmt.Sprintf("Bucket %s no longer exists on the backend", bucketName))
+	return true, r.Status().Update(ctx, claim)
+}
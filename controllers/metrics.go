@@ -0,0 +1,262 @@
+package controllers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+)
+
+var (
+	deletionObjectsDeleted = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "quobject_deletion_objects_deleted",
+			Help: "Number of objects deleted so far while draining the bucket of a deleted claim",
+		},
+		[]string{"namespace", "claim", "bucket"},
+	)
+	deletionBytesFreed = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "quobject_deletion_bytes_freed",
+			Help: "Number of bytes freed so far while draining the bucket of a deleted claim",
+		},
+		[]string{"namespace", "claim", "bucket"},
+	)
+	deletionElapsedSeconds = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "quobject_deletion_elapsed_seconds",
+			Help: "Seconds elapsed since draining the bucket of a deleted claim started",
+		},
+		[]string{"namespace", "claim", "bucket"},
+	)
+	backendCredentialsValid = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "quobject_backend_credentials_valid",
+			Help: "Whether the backend accepted the credentials of its secret at the last check (1) or not (0)",
+		},
+		[]string{"backend"},
+	)
+	workqueueItemRetries = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "quobject_workqueue_item_retries",
+			Help: "Number of times a failing item has been retried since it last succeeded",
+		},
+		[]string{"controller", "namespace", "name"},
+	)
+	reconcileDurationSeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "quobject_reconcile_duration_seconds",
+			Help:    "Duration of claim reconciles by result: success, requeue or error",
+			Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+		},
+		[]string{"result"},
+	)
+	s3RequestDurationSeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "quobject_s3_request_duration_seconds",
+			Help:    "Duration of S3 API operations for claims, including retries and rate limiting",
+			Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+		},
+		[]string{"operation", "storage_class"},
+	)
+	s3RequestErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "quobject_s3_request_errors_total",
+			Help: "Number of S3 API operations for claims that failed after their retries",
+		},
+		[]string{"operation", "storage_class"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		deletionObjectsDeleted,
+		deletionBytesFreed,
+		deletionElapsedSeconds,
+		backendCredentialsValid,
+		workqueueItemRetries,
+		reconcileDurationSeconds,
+		s3RequestDurationSeconds,
+		s3RequestErrors,
+	)
+}
+
+// observeReconcile records the duration and result of a claim reconcile
+func observeReconcile(start time.Time, result ctrl.Result, err error) {
+	label := "success"
+	switch {
+	case err != nil:
+		label = "error"
+	case result.Requeue || result.RequeueAfter > 0:
+		label = "requeue"
+	}
+	reconcileDurationSeconds.WithLabelValues(label).Observe(time.Since(start).Seconds())
+}
+
+// withS3Metrics times every S3 operation of the client and counts the
+// failed ones, labelled by operation and the claim's storage class. It runs
+// after the operation name is known and before the rate limiter and the
+// retries, so it sees what the reconcile waited for.
+func withS3Metrics(storageClass string) func(*s3.Options) {
+	return s3.WithAPIOptions(func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(
+			middleware.InitializeMiddlewareFunc("QuObjectMetrics", func(
+				ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler,
+			) (middleware.InitializeOutput, middleware.Metadata, error) {
+				start := time.Now()
+				out, md, err := next.HandleInitialize(ctx, in)
+				operation := awsmiddleware.GetOperationName(ctx)
+				s3RequestDurationSeconds.WithLabelValues(operation, storageClass).Observe(time.Since(start).Seconds())
+				if err != nil {
+					s3RequestErrors.WithLabelValues(operation, storageClass).Inc()
+				}
+				return out, md, err
+			}),
+			middleware.After,
+		)
+	})
+}
+
+// deletionProgress tracks the progress of draining one bucket and mirrors
+// it into the per-claim deletion gauges. A nil progress is a no-op.
+type deletionProgress struct {
+	labels prometheus.Labels
+	start  time.Time
+
+	mu      sync.Mutex
+	objects int64
+	bytes   int64
+}
+
+func newDeletionProgress(namespace, claim, bucket string) *deletionProgress {
+	p := &deletionProgress{
+		labels: prometheus.Labels{"namespace": namespace, "claim": claim, "bucket": bucket},
+		start:  time.Now(),
+	}
+	deletionObjectsDeleted.With(p.labels).Set(0)
+	deletionBytesFreed.With(p.labels).Set(0)
+	deletionElapsedSeconds.With(p.labels).Set(0)
+	return p
+}
+
+// add records deleted objects and the bytes they occupied
+func (p *deletionProgress) add(objects, bytes int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.objects += objects
+	p.bytes += bytes
+	deletionObjectsDeleted.With(p.labels).Set(float64(p.objects))
+	deletionBytesFreed.With(p.labels).Set(float64(p.bytes))
+	deletionElapsedSeconds.With(p.labels).Set(time.Since(p.start).Seconds())
+}
+
+// done removes the per-claim series once draining has finished
+func (p *deletionProgress) done() {
+	if p == nil {
+		return
+	}
+	deletionObjectsDeleted.Delete(p.labels)
+	deletionBytesFreed.Delete(p.labels)
+	deletionElapsedSeconds.Delete(p.labels)
+}
+
+var (
+	managedBucketsDesc = prometheus.NewDesc(
+		"quobject_managed_buckets",
+		"Number of buckets provisioned for claims",
+		[]string{"storage_class", "backend"}, nil,
+	)
+	claimsDesc = prometheus.NewDesc(
+		"quobject_claims",
+		"Number of claims by phase",
+		[]string{"storage_class", "backend", "phase"}, nil,
+	)
+	usageBytesDesc = prometheus.NewDesc(
+		"quobject_usage_bytes",
+		"Bytes stored in the buckets of claims at their last usage poll",
+		[]string{"storage_class", "backend"}, nil,
+	)
+	usageObjectsDesc = prometheus.NewDesc(
+		"quobject_usage_objects",
+		"Objects stored in the buckets of claims at their last usage poll",
+		[]string{"storage_class", "backend"}, nil,
+	)
+)
+
+// claimCollector counts the claims of a shard by storage class, backend and
+// phase when scraped
+type claimCollector struct {
+	reader client.Reader
+	shard  Sharding
+}
+
+// NewClaimCollector returns a collector of the claim and bucket gauges of
+// the shard, read from the given (cached) reader on every scrape
+func NewClaimCollector(reader client.Reader, shard Sharding) prometheus.Collector {
+	return &claimCollector{reader: reader, shard: shard}
+}
+
+func (c *claimCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- managedBucketsDesc
+	ch <- claimsDesc
+	ch <- usageBytesDesc
+	ch <- usageObjectsDesc
+}
+
+func (c *claimCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var list quv1.QuObjectBucketClaimList
+	if err := c.reader.List(ctx, &list); err != nil {
+		ctrllog.Log.WithName("metrics").Error(err, "Failed to list claims")
+		return
+	}
+
+	type key struct{ storageClass, backend, phase string }
+	buckets := map[key]int{}
+	claims := map[key]int{}
+	usageBytes := map[key]int64{}
+	usageObjects := map[key]int64{}
+	for i := range list.Items {
+		claim := &list.Items[i]
+		if !c.shard.Owns(claim) {
+			continue
+		}
+		k := key{storageClass: claim.Spec.StorageClassName, backend: claim.Annotations[annotationBackend]}
+		if claim.Status.BucketName != "" {
+			buckets[k]++
+		}
+		if usage := claim.Status.Usage; usage != nil {
+			usageBytes[k] += usage.Bytes
+			usageObjects[k] += usage.Objects
+		}
+		k.phase = string(claim.Status.Phase)
+		claims[k]++
+	}
+	for k, n := range buckets {
+		ch <- prometheus.MustNewConstMetric(managedBucketsDesc, prometheus.GaugeValue, float64(n), k.storageClass, k.backend)
+	}
+	for k, n := range claims {
+		ch <- prometheus.MustNewConstMetric(claimsDesc, prometheus.GaugeValue, float64(n), k.storageClass, k.backend, k.phase)
+	}
+	for k, n := range usageBytes {
+		ch <- prometheus.MustNewConstMetric(usageBytesDesc, prometheus.GaugeValue, float64(n), k.storageClass, k.backend)
+	}
+	for k, n := range usageObjects {
+		ch <- prometheus.MustNewConstMetric(usageObjectsDesc, prometheus.GaugeValue, float64(n), k.storageClass, k.backend)
+	}
+}
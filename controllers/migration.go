@@ -0,0 +1,206 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+)
+
+// Event reasons of bucket migrations
+const (
+	reasonMigrating       = "Migrating"
+	reasonMigrated        = "Migrated"
+	reasonMigrationFailed = "MigrationFailed"
+)
+
+// migrateBucket copies all objects of the claim's current bucket to the
+// bucket with its new name, recording progress in status.migration. Copies
+// are server-side and idempotent, so an interrupted migration simply
+// starts copying again.
+func (r *QuObjectBucketClaimReconciler) migrateBucket(
+	ctx context.Context,
+	s3c *s3.Client,
+	claim *quv1.QuObjectBucketClaim,
+	source, target string,
+	cfg backend.Config,
+) error {
+	if isDirectoryBucket(claim) {
+		return fmt.Errorf("directory buckets cannot be renamed")
+	}
+	m := claim.Status.Migration
+	if m == nil || m.SourceBucket != source || m.TargetBucket != target {
+		now := metav1.Now()
+		m = &quv1.BucketMigrationStatus{SourceBucket: source, TargetBucket: target, StartTime: &now}
+		r.event(ctx, claim, corev1.EventTypeNormal, reasonMigrating, "Migrating bucket %s to %s", source, target)
+	}
+	m.ObjectsCopied, m.BytesCopied = 0, 0
+	claim.Status.Migration = m
+
+	if _, err := r.BucketLocks.ensureBucket(ctx, s3c, target, createBucketConfiguration(claim, cfg), cfg.Profile,
+		createBucketOptions(claim, cfg)...); err != nil {
+		return fmt.Errorf("failed to ensure bucket %s: %w", target, err)
+	}
+
+	paginator := s3.NewListObjectsV2Paginator(s3c, &s3.ListObjectsV2Input{
+		Bucket: aws.String(source),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		// The source is only deleted after the claim was bound to the
+		// target, so a missing source was migrated already
+		if isNoSuchBucket(err) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to list objects of %s: %w", source, err)
+		}
+		for _, obj := range page.Contents {
+			err := copyObjectInBackend(ctx, s3c, source, target, aws.ToString(obj.Key), aws.ToInt64(obj.Size))
+			if err != nil {
+				return fmt.Errorf("failed to copy object %s: %w", aws.ToString(obj.Key), err)
+			}
+			m.ObjectsCopied++
+			m.BytesCopied += aws.ToInt64(obj.Size)
+		}
+		// Publish progress once per page
+		if err := r.Status().Update(ctx, claim); err != nil {
+			return err
+		}
+		claim.Status.Migration = m
+	}
+	return nil
+}
+
+// finishMigration runs once the Secret and ConfigMap point at the new
+// bucket. The first pass marks the migration for cleanup, which is
+// persisted together with the new status.bucketName. A later pass deletes
+// the old bucket if the retain policy says so, and the migration is done,
+// so a failed status update never leaves the claim without a source to
+// migrate from.
+func (r *QuObjectBucketClaimReconciler) finishMigration(
+	ctx context.Context,
+	s3c *s3.Client,
+	claim *quv1.QuObjectBucketClaim,
+) error {
+	m := claim.Status.Migration
+	if m == nil {
+		return nil
+	}
+	if !migrationCleanupPending(claim) {
+		m.CleanupPending = true
+		r.event(ctx, claim, corev1.EventTypeNormal, reasonMigrated,
+			"Migrated %d objects (%d bytes) from bucket %s to %s", m.ObjectsCopied, m.BytesCopied, m.SourceBucket, m.TargetBucket)
+		return nil
+	}
+	if retainPolicy(claim, backend.Config{}) == quv1.RetainPolicyDelete {
+		progress := newDeletionProgress(claim.Namespace, claim.Name, m.SourceBucket)
+		err := deleteBucket(ctx, s3c, m.SourceBucket, r.DeleteWorkers, progress)
+		progress.done()
+		if err != nil {
+			return fmt.Errorf("failed to delete bucket %s: %w", m.SourceBucket, err)
+		}
+	}
+	claim.Status.Migration = nil
+	return nil
+}
+
+// migrationCleanupPending reports whether the claim is bound to the target
+// of its migration and the source bucket remains to be deleted
+func migrationCleanupPending(claim *quv1.QuObjectBucketClaim) bool {
+	m := claim.Status.Migration
+	return m != nil && m.CleanupPending && claim.Status.BucketName == m.TargetBucket
+}
+
+// maxCopySize is the largest object a single CopyObject request copies
+var maxCopySize int64 = 5 << 30
+
+// copyPartSize is the size of the parts of larger objects. A copied part
+// may be at most 5 GiB, and an object at most 10000 parts.
+var copyPartSize int64 = 512 << 20
+
+// copyObjectInBackend copies an object of size bytes server-side between
+// two buckets of the same backend. Objects too large for CopyObject are
+// copied in parts with UploadPartCopy.
+func copyObjectInBackend(ctx context.Context, s3c *s3.Client, srcBucket, dstBucket, key string, size int64) error {
+	if size <= maxCopySize {
+		_, err := s3c.CopyObject(ctx, &s3.CopyObjectInput{
+			Bucket:     aws.String(dstBucket),
+			Key:        aws.String(key),
+			CopySource: aws.String(copySource(srcBucket, key)),
+		})
+		return err
+	}
+
+	// The object's metadata is not copied by UploadPartCopy
+	head, err := s3c.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(srcBucket), Key: aws.String(key)})
+	if err != nil {
+		return err
+	}
+	upload, err := s3c.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(dstBucket),
+		Key:         aws.String(key),
+		ContentType: head.ContentType,
+		Metadata:    head.Metadata,
+	})
+	if err != nil {
+		return err
+	}
+	partSize := max(copyPartSize, (size+9999)/10000)
+	var parts []s3types.CompletedPart
+	for first, number := int64(0), int32(1); first < size; first, number = first+partSize, number+1 {
+		last := min(first+partSize, size) - 1
+		part, err := s3c.UploadPartCopy(ctx, &s3.UploadPartCopyInput{
+			Bucket:          aws.String(dstBucket),
+			Key:             aws.String(key),
+			UploadId:        upload.UploadId,
+			PartNumber:      aws.Int32(number),
+			CopySource:      aws.String(copySource(srcBucket, key)),
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", first, last)),
+		})
+		if err != nil {
+			abortUpload(ctx, s3c, dstBucket, key, upload.UploadId)
+			return err
+		}
+		parts = append(parts, s3types.CompletedPart{ETag: part.CopyPartResult.ETag, PartNumber: aws.Int32(number)})
+	}
+	_, err = s3c.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(dstBucket),
+		Key:             aws.String(key),
+		UploadId:        upload.UploadId,
+		MultipartUpload: &s3types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		abortUpload(ctx, s3c, dstBucket, key, upload.UploadId)
+	}
+	return err
+}
+
+// abortUpload aborts a failed multipart upload, so its parts do not take up
+// space. Backends expire abandoned uploads themselves only with a lifecycle
+// rule.
+func abortUpload(ctx context.Context, s3c *s3.Client, bucket, key string, uploadID *string) {
+	_, err := s3c.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(key),
+		UploadId: uploadID,
+	})
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to abort multipart upload", "bucket", bucket, "key", key)
+	}
+}
+
+// copySource returns the URL-encoded CopySource of an object. Some backends
+// decode "+" as a space, so it is escaped too.
+func copySource(bucket, key string) string {
+	return strings.ReplaceAll((&url.URL{Path: bucket + "/" + key}).EscapedPath(), "+", "%2B")
+}
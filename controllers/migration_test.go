@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/testutil"
+)
+
+// renameClaim binds a claim with retainPolicy Delete to bucket old, fills
+// it and renames it to bucket renamed
+func renameClaim(t *testing.T, srv *testutil.S3Server) (*QuObjectBucketClaimReconciler, client.ObjectKey) {
+	t.Helper()
+	claim := &quv1.QuObjectBucketClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec: quv1.QuObjectBucketClaimSpec{
+			BucketName:   "old",
+			RetainPolicy: quv1.RetainPolicyDelete,
+		},
+	}
+	r := newTestReconciler(t, srv, claim)
+	key := client.ObjectKeyFromObject(claim)
+	reconcileUntil(t, r, key, func(c *quv1.QuObjectBucketClaim) bool {
+		return c != nil && c.Status.Phase == quv1.ClaimPhaseBound
+	})
+	for i := 0; i < 10; i++ {
+		srv.PutObject("old", fmt.Sprintf("data/%02d", i), []byte("payload"))
+	}
+
+	if err := r.Get(context.Background(), key, claim); err != nil {
+		t.Fatal(err)
+	}
+	claim.Spec.BucketName = "renamed"
+	if err := r.Update(context.Background(), claim); err != nil {
+		t.Fatal(err)
+	}
+	return r, key
+}
+
+func TestRenameBucket(t *testing.T) {
+	srv := testutil.NewS3Server()
+	defer srv.Close()
+	r, key := renameClaim(t, srv)
+
+	got := reconcileUntil(t, r, key, func(c *quv1.QuObjectBucketClaim) bool {
+		return c != nil && c.Status.BucketName == "renamed" && c.Status.Migration == nil
+	})
+	if got.Status.Phase != quv1.ClaimPhaseBound {
+		t.Errorf("claim is %s after the rename, want Bound", got.Status.Phase)
+	}
+	if !slices.Contains(srv.Objects("renamed"), "data/09") {
+		t.Errorf("objects were not copied to the renamed bucket: %v", srv.Objects("renamed"))
+	}
+	if srv.BucketExists("old") {
+		t.Error("old bucket was not deleted after the rename")
+	}
+}
+
+// TestRenameBucketSourceGone resumes a rename whose source bucket was
+// deleted before the new bucket name was recorded
+func TestRenameBucketSourceGone(t *testing.T) {
+	srv := testutil.NewS3Server()
+	defer srv.Close()
+	r, key := renameClaim(t, srv)
+
+	// The objects were copied and the source deleted, but the status
+	// still names the source
+	for _, name := range srv.Objects("old") {
+		srv.PutObject("renamed", name, []byte("payload"))
+	}
+	progress := newDeletionProgress(key.Namespace, key.Name, "old")
+	defer progress.done()
+	if err := deleteBucket(context.Background(), newTestS3Client(t, r), "old", 1, progress); err != nil {
+		t.Fatal(err)
+	}
+
+	got := reconcileUntil(t, r, key, func(c *quv1.QuObjectBucketClaim) bool {
+		return c != nil && c.Status.BucketName == "renamed" && c.Status.Migration == nil
+	})
+	if got.Status.Phase != quv1.ClaimPhaseBound {
+		t.Errorf("claim is %s after the rename, want Bound", got.Status.Phase)
+	}
+	if !slices.Contains(srv.Objects("renamed"), "data/09") {
+		t.Errorf("objects were not copied to the renamed bucket: %v", srv.Objects("renamed"))
+	}
+}
+
+// TestRenameBucketLargeObject renames a bucket holding an object too large
+// for a single CopyObject request
+func TestRenameBucketLargeObject(t *testing.T) {
+	srv := testutil.NewS3Server()
+	defer srv.Close()
+	srv.SetCopyLimit(1024)
+	defer func(size, part int64) { maxCopySize, copyPartSize = size, part }(maxCopySize, copyPartSize)
+	maxCopySize, copyPartSize = 1024, 300
+	r, key := renameClaim(t, srv)
+
+	large := bytes.Repeat([]byte("0123456789"), 250)
+	srv.PutObject("old", "large", large)
+	reconcileUntil(t, r, key, func(c *quv1.QuObjectBucketClaim) bool {
+		return c != nil && c.Status.BucketName == "renamed" && c.Status.Migration == nil
+	})
+
+	obj, err := newTestS3Client(t, r).GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("renamed"),
+		Key:    aws.String("large"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obj.Body.Close()
+	got, err := io.ReadAll(obj.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, large) {
+		t.Errorf("copied object has %d bytes, want the %d bytes of the source", len(got), len(large))
+	}
+	if n := srv.Uploads(); n != 0 {
+		t.Errorf("%d multipart uploads left open", n)
+	}
+}
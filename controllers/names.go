@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// maxResourceNameLength is the maximum length of Secret and ConfigMap names
+const maxResourceNameLength = 253
+
+// Suffixes of the resources generated for a claim
+const (
+	secretNameSuffix    = "-bucket-secret"
+	configMapNameSuffix = "-bucket-config"
+)
+
+// outputName returns the name of a resource generated for the claim: the
+// override from the spec, or else a name derived from the claim name. A
+// recorded fallback name is kept so the resource doesn't move back, while
+// other recorded names, such as a removed override or a previous version,
+// are replaced.
+func outputName(override, recorded, claimName, suffix string) string {
+	if override != "" {
+		return override
+	}
+	if fallback := derivedName(claimName, suffix, true); recorded == fallback {
+		return fallback
+	}
+	return derivedName(claimName, suffix, false)
+}
+
+// outputFallback returns the name used when the output name is taken by
+// another claim's resource. Overrides have no fallback, so a conflict is
+// reported instead.
+func outputFallback(override, claimName, suffix string) string {
+	if override != "" {
+		return override
+	}
+	return derivedName(claimName, suffix, true)
+}
+
+// derivedName returns claimName+suffix. If that is too long, or hashed is
+// set, a short hash of the claim name is inserted and the claim name is
+// truncated as needed, so distinct claims always get distinct names.
+func derivedName(claimName, suffix string, hashed bool) string {
+	name := claimName + suffix
+	if !hashed && len(name) <= maxResourceNameLength {
+		return name
+	}
+	sum := sha256.Sum256([]byte(claimName))
+	hash := "-" + hex.EncodeToString(sum[:])[:8]
+	base := claimName
+	if keep := maxResourceNameLength - len(hash) - len(suffix); len(base) > keep {
+		base = strings.TrimRight(base[:keep], "-.")
+	}
+	return base + hash + suffix
+}
+
+// maxBucketNameLength is the maximum length of S3 bucket names
+const maxBucketNameLength = 63
+
+// BucketNameTruncation selects how generated bucket names longer than
+// maxBucketNameLength are handled
+type BucketNameTruncation string
+
+const (
+	// BucketNameTruncationHash truncates the name and appends a short hash of
+	// the full name, so distinct claims still get distinct buckets
+	BucketNameTruncationHash BucketNameTruncation = "hash"
+	// BucketNameTruncationReject fails the claim instead
+	BucketNameTruncationReject BucketNameTruncation = "reject"
+)
+
+// ParseBucketNameTruncation validates a --bucket-name-truncation flag value
+func ParseBucketNameTruncation(s string) (BucketNameTruncation, error) {
+	switch t := BucketNameTruncation(s); t {
+	case BucketNameTruncationHash, BucketNameTruncationReject:
+		return t, nil
+	}
+	return "", fmt.Errorf("invalid bucket name truncation %q: must be hash or reject", s)
+}
+
+// truncatedBucketName shortens name to limit characters by truncating it and
+// appending a hash of the full name
+func truncatedBucketName(name string, limit int) string {
+	sum := sha256.Sum256([]byte(name))
+	hash := "-" + hex.EncodeToString(sum[:])[:8]
+	keep := max(limit-len(hash), 0)
+	return strings.TrimRight(name[:keep], "-.") + hash
+}
+
+// upsertWithFallback runs upsert for obj under its current name. If that name
+// is already used by the resource of another claim, obj is renamed to the
+// hashed fallback name and upserted again.
+func upsertWithFallback(
+	ctx context.Context,
+	obj client.Object,
+	fallback string,
+	upsert func(context.Context) error,
+) error {
+	err := upsert(ctx)
+	var conflict *nameConflictError
+	if errors.As(err, &conflict) && conflict.otherClaim && obj.GetName() != fallback {
+		obj.SetName(fallback)
+		return upsert(ctx)
+	}
+	return err
+}
@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+)
+
+// Labels tying outputs in another namespace to their claim, which owner
+// references cannot do across namespaces
+const (
+	labelClaimUID       = "quobject.io/claim-uid"
+	labelClaimNamespace = "quobject.io/claim-namespace"
+	labelClaimName      = "quobject.io/claim-name"
+)
+
+const reasonOutputNamespaceDenied = "OutputNamespaceNotAllowed"
+
+// outputNamespaceError is returned when the claim's output namespace does
+// not accept outputs from the claim's namespace
+type outputNamespaceError struct {
+	namespace string
+	source    string
+}
+
+func (e *outputNamespaceError) Error() string {
+	return fmt.Sprintf("namespace %s does not accept outputs from namespace %s; annotate it with %s",
+		e.namespace, e.source, quv1.AnnotationAcceptOutputsFrom)
+}
+
+// outputNamespace returns the namespace the claim's outputs are written to
+func outputNamespace(claim *quv1.QuObjectBucketClaim) string {
+	if claim.Spec.OutputNamespace != "" {
+		return claim.Spec.OutputNamespace
+	}
+	return claim.Namespace
+}
+
+// recordedOutputNamespace returns the namespace of the outputs named in the
+// claim's status
+func recordedOutputNamespace(claim *quv1.QuObjectBucketClaim) string {
+	if claim.Status.OutputNamespace != "" {
+		return claim.Status.OutputNamespace
+	}
+	return claim.Namespace
+}
+
+// checkOutputNamespace verifies that the output namespace accepts the
+// claim's outputs. The admission webhook checks this too, but it is
+// optional and fails open.
+func (r *QuObjectBucketClaimReconciler) checkOutputNamespace(ctx context.Context, claim *quv1.QuObjectBucketClaim) error {
+	target := outputNamespace(claim)
+	if target == claim.Namespace {
+		return nil
+	}
+	ns := &corev1.Namespace{}
+	if err := r.Get(ctx, types.NamespacedName{Name: target}, ns); err != nil {
+		return fmt.Errorf("failed to get output namespace %s: %w", target, err)
+	}
+	if !quv1.AcceptsOutputsFrom(ns.Annotations, claim.Namespace) {
+		return &outputNamespaceError{namespace: target, source: claim.Namespace}
+	}
+	return nil
+}
+
+// setOutputOwner makes the claim the owner of a generated object: through a
+// controller reference in the claim's namespace, and through labels
+// elsewhere, where the claim's finalizer deletes the object instead of the
+// garbage collector
+func (r *QuObjectBucketClaimReconciler) setOutputOwner(claim *quv1.QuObjectBucketClaim, obj client.Object) error {
+	if obj.GetNamespace() == claim.Namespace {
+		return controllerutil.SetControllerReference(claim, obj, r.Scheme)
+	}
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[labelClaimUID] = string(claim.UID)
+	labels[labelClaimNamespace] = claim.Namespace
+	labels[labelClaimName] = claim.Name
+	obj.SetLabels(labels)
+	return nil
+}
+
+// ownsOutput reports whether obj was generated for owner, in its own or in
+// another namespace
+func ownsOutput(owner, obj metav1.Object) bool {
+	if metav1.IsControlledBy(obj, owner) {
+		return true
+	}
+	return owner.GetUID() != "" && obj.GetLabels()[labelClaimUID] == string(owner.GetUID())
+}
+
+// deleteForeignOutputs deletes the claim's outputs in other namespaces,
+// which the garbage collector does not delete with the claim
+func (r *QuObjectBucketClaimReconciler) deleteForeignOutputs(ctx context.Context, claim *quv1.QuObjectBucketClaim) error {
+	selector := client.MatchingLabels{labelClaimUID: string(claim.UID)}
+	var secrets corev1.SecretList
+	if err := r.List(ctx, &secrets, selector); err != nil {
+		return err
+	}
+	for i := range secrets.Items {
+		if err := r.Delete(ctx, &secrets.Items[i]); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	var configMaps corev1.ConfigMapList
+	if err := r.List(ctx, &configMaps, selector); err != nil {
+		return err
+	}
+	for i := range configMaps.Items {
+		if err := r.Delete(ctx, &configMaps.Items[i]); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasClaimLabels passes outputs written into another namespace
+var hasClaimLabels = predicate.NewPredicateFuncs(func(o client.Object) bool {
+	return o.GetLabels()[labelClaimName] != ""
+})
+
+// outputClaim enqueues the claim of an output in another namespace, so
+// that changes to it are reverted like those of owned outputs
+func outputClaim(_ context.Context, obj client.Object) []reconcile.Request {
+	labels := obj.GetLabels()
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{
+		Namespace: labels[labelClaimNamespace],
+		Name:      labels[labelClaimName],
+	}}}
+}
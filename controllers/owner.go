@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+)
+
+// ownerMarkerUIDKey is the object metadata key holding the UID of the claim
+// in the ownership marker, so the marker can be checked with HeadObject
+const ownerMarkerUIDKey = "claim-uid"
+
+// ownerMarkerHashKey is the object metadata key holding a hash of the
+// marker's content, so a marker is rewritten when the claim's spec or
+// labels change
+const ownerMarkerHashKey = "content-hash"
+
+const reasonOwnerConflict = "OwnerConflict"
+
+// ownerConflictError is returned when the ownership marker of a bucket
+// names another claim that still exists
+type ownerConflictError struct {
+	bucket string
+	owner  types.NamespacedName
+}
+
+func (e *ownerConflictError) Error() string {
+	return fmt.Sprintf("bucket %s is owned by claim %s according to its ownership marker", e.bucket, e.owner)
+}
+
+// ownerMarker is the content of the ownership marker object
+type ownerMarker struct {
+	UID               string                       `json:"uid"`
+	Namespace         string                       `json:"namespace"`
+	Name              string                       `json:"name"`
+	CreationTimestamp time.Time                    `json:"creationTimestamp"`
+	Labels            map[string]string            `json:"labels,omitempty"`
+	Spec              quv1.QuObjectBucketClaimSpec `json:"spec"`
+
+	// synced is set when read if the marker's content matches its hash
+	synced bool
+}
+
+// isOwnerMarker reports whether key is the ownership marker, which is never
+// copied into another bucket
+func isOwnerMarker(key string) bool {
+	return key == backend.OwnerMarkerKey
+}
+
+// ensureOwnerMarker writes the ownership marker into the claim's bucket
+// unless it already names the claim with its current spec and labels. The
+// marker of another claim is only replaced once that claim is gone, or by a
+// claim recovered from it; otherwise an ownerConflictError is returned.
+func (r *QuObjectBucketClaimReconciler) ensureOwnerMarker(
+	ctx context.Context,
+	s3c *s3.Client,
+	claim *quv1.QuObjectBucketClaim,
+	bucketName string,
+) error {
+	body, err := json.Marshal(ownerMarker{
+		UID:               string(claim.UID),
+		Namespace:         claim.Namespace,
+		Name:              claim.Name,
+		CreationTimestamp: claim.CreationTimestamp.UTC(),
+		Labels:            claim.Labels,
+		Spec:              claim.Spec,
+	})
+	if err != nil {
+		return err
+	}
+	hash := ownerMarkerHash(body)
+
+	head, err := s3c.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(backend.OwnerMarkerKey),
+	})
+	var respErr *smithyhttp.ResponseError
+	if err == nil {
+		uid := head.Metadata[ownerMarkerUIDKey]
+		if uid == string(claim.UID) && head.Metadata[ownerMarkerHashKey] == hash {
+			return nil
+		}
+		if uid != string(claim.UID) {
+			if err := r.checkPreviousOwner(ctx, s3c, claim, bucketName, uid); err != nil {
+				return err
+			}
+		}
+	} else if !errors.As(err, &respErr) || respErr.HTTPStatusCode() != 404 {
+		return fmt.Errorf("failed to check ownership marker: %w", err)
+	}
+
+	_, err = s3c.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucketName),
+		Key:         aws.String(backend.OwnerMarkerKey),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/json"),
+		Metadata:    map[string]string{ownerMarkerUIDKey: string(claim.UID), ownerMarkerHashKey: hash},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write ownership marker: %w", err)
+	}
+	return nil
+}
+
+// ownerMarkerHash returns the hash of a marker's content stored in its
+// metadata
+func ownerMarkerHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// checkPreviousOwner returns an ownerConflictError unless the claim may
+// replace the bucket's marker naming the claim with the given UID: because
+// the claim was recovered from that marker, or because the claim it names
+// no longer exists
+func (r *QuObjectBucketClaimReconciler) checkPreviousOwner(
+	ctx context.Context,
+	s3c *s3.Client,
+	claim *quv1.QuObjectBucketClaim,
+	bucketName, uid string,
+) error {
+	if uid != "" && claim.Annotations[annotationRecoveredFrom] == uid {
+		return nil
+	}
+	marker, err := readOwnerMarker(ctx, s3c, bucketName)
+	if err != nil {
+		return fmt.Errorf("failed to read ownership marker: %w", err)
+	} else if marker == nil {
+		return nil
+	}
+	owner := types.NamespacedName{Namespace: marker.Namespace, Name: marker.Name}
+	previous := &quv1.QuObjectBucketClaim{}
+	if err := r.Get(ctx, owner, previous); apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	// A claim recreated under the same name is another claim
+	if string(previous.UID) != marker.UID {
+		return nil
+	}
+	return &ownerConflictError{bucket: bucketName, owner: owner}
+}
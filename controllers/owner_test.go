@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+	"github.com/pamvdam71/quobject-controller/internal/testutil"
+)
+
+func TestOwnerMarker(t *testing.T) {
+	srv := testutil.NewS3Server()
+	defer srv.Close()
+	owner := &quv1.QuObjectBucketClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", UID: "uid-app"},
+		Spec:       quv1.QuObjectBucketClaimSpec{BucketName: "shared"},
+	}
+	other := &quv1.QuObjectBucketClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default", UID: "uid-other"},
+		Spec:       quv1.QuObjectBucketClaimSpec{BucketName: "shared"},
+	}
+	r := newTestReconciler(t, srv, owner, other)
+	s3c := newTestS3Client(t, r)
+	ctx := context.Background()
+	marker := func() *ownerMarker {
+		t.Helper()
+		m, err := readOwnerMarker(ctx, s3c, "shared")
+		if err != nil || m == nil {
+			t.Fatalf("reading the ownership marker: %v", err)
+		}
+		return m
+	}
+
+	ownerKey := client.ObjectKeyFromObject(owner)
+	reconcileUntil(t, r, ownerKey, func(c *quv1.QuObjectBucketClaim) bool {
+		return c.Status.Phase == quv1.ClaimPhaseBound
+	})
+	if m := marker(); m.UID != "uid-app" || m.Spec.RetainPolicy != "" {
+		t.Fatalf("marker %+v, want one naming claim app", m)
+	}
+
+	// The marker follows changes of the spec
+	if err := r.Get(ctx, ownerKey, owner); err != nil {
+		t.Fatal(err)
+	}
+	owner.Spec.RetainPolicy = quv1.RetainPolicyRetain
+	if err := r.Update(ctx, owner); err != nil {
+		t.Fatal(err)
+	}
+	reconcileUntil(t, r, ownerKey, func(*quv1.QuObjectBucketClaim) bool {
+		return marker().Spec.RetainPolicy == quv1.RetainPolicyRetain
+	})
+
+	// Another claim of the bucket does not take the marker over while
+	// claim app exists
+	otherKey := client.ObjectKeyFromObject(other)
+	got := reconcileUntil(t, r, otherKey, func(c *quv1.QuObjectBucketClaim) bool {
+		return meta.IsStatusConditionTrue(c.Status.Conditions, quv1.ConditionOwnerConflict)
+	})
+	if m := marker(); m.UID != "uid-app" {
+		t.Errorf("claim %s replaced the marker of claim app: %+v", got.Name, m)
+	}
+
+	// A claim recovered from the marker takes it over
+	other = got
+	other.Annotations[annotationRecoveredFrom] = "uid-app"
+	if err := r.Update(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+	reconcileUntil(t, r, otherKey, func(c *quv1.QuObjectBucketClaim) bool {
+		return !meta.IsStatusConditionTrue(c.Status.Conditions, quv1.ConditionOwnerConflict)
+	})
+	if m := marker(); m.UID != "uid-other" {
+		t.Errorf("recovered claim did not take over the marker: %+v", m)
+	}
+
+	// So does any claim once the claim named by the marker is gone
+	srv.PutObject("shared", backend.OwnerMarkerKey,
+		[]byte(`{"uid":"uid-gone","namespace":"default","name":"gone","spec":{}}`))
+	reconcileUntil(t, r, ownerKey, func(*quv1.QuObjectBucketClaim) bool {
+		return marker().UID == "uid-app"
+	})
+}
@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+)
+
+const reasonInsufficientPermissions = "InsufficientPermissions"
+
+// permissionsRetryInterval is how often a claim blocked by missing
+// permissions checks whether they were granted. RBAC changes are not
+// watched.
+const permissionsRetryInterval = time.Minute
+
+// forbiddenPattern matches the verb and resource in the message of a
+// Forbidden error returned by the RBAC authorizer
+var forbiddenPattern = regexp.MustCompile(`cannot (\S+) resource "([^"]+)"`)
+
+// forbiddenAction returns the verb and resource the controller was denied.
+// Admission controllers such as OPA Gatekeeper deny without naming them, in
+// which case only the resource of the request is known.
+func forbiddenAction(err error) (verb, resource string) {
+	if m := forbiddenPattern.FindStringSubmatch(err.Error()); m != nil {
+		return m[1], m[2]
+	}
+	var status apierrors.APIStatus
+	if errors.As(err, &status) && status.Status().Details != nil {
+		resource = status.Status().Details.Kind
+	}
+	return "", resource
+}
+
+// handleInsufficientPermissions marks the claim as blocked by the
+// controller lacking permissions in the claim's namespace. The claim is
+// retried periodically in case they are granted.
+func (r *QuObjectBucketClaimReconciler) handleInsufficientPermissions(
+	ctx context.Context,
+	claim *quv1.QuObjectBucketClaim,
+	err error,
+) (ctrl.Result, error) {
+	log.FromContext(ctx).Error(err, "Insufficient permissions in the claim's namespace")
+	r.warn(ctx, claim, reasonInsufficientPermissions, err)
+
+	verb, resource := forbiddenAction(err)
+	message := fmt.Sprintf("The controller is not allowed to write %s in namespace %s", resource, claim.Namespace)
+	if verb != "" {
+		message = fmt.Sprintf("The controller cannot %s %s in namespace %s", verb, resource, claim.Namespace)
+	}
+	meta.SetStatusCondition(&claim.Status.Conditions, metav1.Condition{
+		Type:               quv1.ConditionInsufficientPermissions,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonInsufficientPermissions,
+		Message:            message + "; grant it through RBAC or exempt it from the namespace's admission policies",
+		ObservedGeneration: claim.Generation,
+	})
+	claim.Status.Phase = quv1.ClaimPhaseError
+	setReadyCondition(claim, reasonInsufficientPermissions, message)
+	if err := r.Status().Update(ctx, claim); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: permissionsRetryInterval}, nil
+}
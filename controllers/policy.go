@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+)
+
+// managedSidPrefix marks the bucket policy statements owned by the controller.
+// Statements with other Sids are left untouched.
+const managedSidPrefix = "QuObject"
+
+// policyDocument is an S3 bucket policy
+type policyDocument struct {
+	Version   string            `json:"Version"`
+	Statement []policyStatement `json:"Statement"`
+}
+
+// policyStatement is a single statement of a bucket policy
+type policyStatement struct {
+	Sid       string                            `json:"Sid,omitempty"`
+	Effect    string                            `json:"Effect"`
+	Principal interface{}                       `json:"Principal,omitempty"`
+	Action    interface{}                       `json:"Action"`
+	Resource  interface{}                       `json:"Resource"`
+	Condition map[string]map[string]interface{} `json:"Condition,omitempty"`
+}
+
+// bucketARN returns the ARN of a bucket, or of the objects matching the
+// given key pattern when one is given
+func bucketARN(bucket string, keyPattern ...string) string {
+	arn := backend.BucketARN(bucket)
+	if len(keyPattern) > 0 {
+		arn += "/" + keyPattern[0]
+	}
+	return arn
+}
+
+// syncBucketPolicy makes the controller-managed statements of the bucket
+// policy equal to managed, preserving any statements added by others. The
+// policy is deleted once no statements remain.
+func syncBucketPolicy(ctx context.Context, s3c *s3.Client, bucket string, managed []policyStatement) error {
+	current := &policyDocument{Version: "2012-10-17"}
+	resp, err := s3c.GetBucketPolicy(ctx, &s3.GetBucketPolicyInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		if !strings.Contains(strings.ToLower(err.Error()), "nosuchbucketpolicy") {
+			if len(managed) == 0 {
+				// Nothing to enforce; tolerate backends without policy support
+				return nil
+			}
+			return fmt.Errorf("failed to get bucket policy: %w", err)
+		}
+	} else if err := json.Unmarshal([]byte(aws.ToString(resp.Policy)), current); err != nil {
+		return fmt.Errorf("failed to parse bucket policy: %w", err)
+	}
+
+	var foreign, owned []policyStatement
+	for _, st := range current.Statement {
+		if strings.HasPrefix(st.Sid, managedSidPrefix) {
+			owned = append(owned, st)
+		} else {
+			foreign = append(foreign, st)
+		}
+	}
+	if statementsEqual(owned, managed) {
+		return nil
+	}
+
+	desired := &policyDocument{
+		Version:   current.Version,
+		Statement: append(foreign, managed...),
+	}
+	if len(desired.Statement) == 0 {
+		_, err := s3c.DeleteBucketPolicy(ctx, &s3.DeleteBucketPolicyInput{Bucket: aws.String(bucket)})
+		if err != nil {
+			return fmt.Errorf("failed to delete bucket policy: %w", err)
+		}
+		return nil
+	}
+
+	body, err := json.Marshal(desired)
+	if err != nil {
+		return err
+	}
+	_, err = s3c.PutBucketPolicy(ctx, &s3.PutBucketPolicyInput{
+		Bucket: aws.String(bucket),
+		Policy: aws.String(string(body)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put bucket policy: %w", err)
+	}
+	return nil
+}
+
+// statementsEqual compares statements by their JSON form, since the backend
+// may return single-element lists as plain strings and vice versa
+func statementsEqual(a, b []policyStatement) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	normalize := func(sts []policyStatement) []interface{} {
+		var out []interface{}
+		for _, st := range sts {
+			raw, _ := json.Marshal(st)
+			var v interface{}
+			_ = json.Unmarshal(raw, &v)
+			out = append(out, unwrapSingletons(v))
+		}
+		return out
+	}
+	return reflect.DeepEqual(normalize(a), normalize(b))
+}
+
+// unwrapSingletons replaces one-element lists by their element
+func unwrapSingletons(v interface{}) interface{} {
+	switch t := v.(type) {
+	case []interface{}:
+		if len(t) == 1 {
+			return unwrapSingletons(t[0])
+		}
+		for i := range t {
+			t[i] = unwrapSingletons(t[i])
+		}
+	case map[string]interface{}:
+		for k := range t {
+			t[k] = unwrapSingletons(t[k])
+		}
+	}
+	return v
+}
@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// MetricsPusher periodically pushes the controller's metrics to a Prometheus
+// Pushgateway, for clusters where /metrics is not scraped
+type MetricsPusher struct {
+	// URL is the Pushgateway URL, optionally with basic auth credentials
+	URL string
+	// Job and Instance form the grouping key. Every replica pushes to its
+	// own instance, so the replicas don't overwrite each other.
+	Job      string
+	Instance string
+	// Interval is the time between pushes
+	Interval time.Duration
+	Gatherer prometheus.Gatherer
+}
+
+// NeedLeaderElection makes every replica push its own metrics
+func (p *MetricsPusher) NeedLeaderElection() bool {
+	return false
+}
+
+// Start pushes the metrics every interval until ctx is done
+func (p *MetricsPusher) Start(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("metrics-push")
+	pusher := push.New(p.URL, p.Job).
+		Grouping("instance", p.Instance).
+		Gatherer(p.Gatherer)
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		// Push replaces the group, so series that disappeared are dropped
+		if err := pusher.PushContext(ctx); err != nil {
+			log.Error(err, "Failed to push metrics")
+		}
+	}, p.Interval)
+	return nil
+}
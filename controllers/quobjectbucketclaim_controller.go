@@ -3,47 +3,105 @@ package controllers
 import (
 	"context"
 	"crypto/rand"
-	"crypto/tls"
+	"errors"
 	"fmt"
-	"net/http"
-	"strings"
+	"maps"
+	"strconv"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"golang.org/x/time/rate"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/ratelimiter"
 
 	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
 )
 
 const (
 	finalizerName = "quobject.io/finalizer"
-	controllerNS  = "quobject-controller"
-	
 	// Annotations for storing bucket metadata
-	annotationBucketName = "quobject.io/bucket-name"
+	annotationBucketName   = "quobject.io/bucket-name"
 	annotationRetainPolicy = "quobject.io/retain-policy"
+	annotationBackend      = "quobject.io/backend"
 )
 
 // QuObjectBucketClaimReconciler reconciles a QuObjectBucketClaim object
 type QuObjectBucketClaimReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// DeleteWorkers is the number of parallel workers used to empty a
+	// bucket before it is deleted
+	DeleteWorkers int
+
+	// S3RateLimiter throttles all S3 requests made by the controller.
+	// A nil limiter disables rate limiting.
+	S3RateLimiter *rate.Limiter
+
+	// UsagePollInterval is how often the object count and size of each
+	// bucket are measured. Zero disables usage polling.
+	UsagePollInterval time.Duration
+	// VerifyInterval is how often each bound claim is reconciled to verify
+	// its bucket and generated resources. Zero relies on watch events and
+	// the manager's resync.
+	VerifyInterval time.Duration
+	// Recorder emits Events on claims
+	Recorder record.EventRecorder
+	// UserAgentReconcileID appends the reconcile ID to the user agent of S3
+	// requests so they can be found in backend audit logs
+	UserAgentReconcileID bool
+	// Shard selects the claims reconciled by this replica
+	Shard Sharding
+	// ProvisioningTimeout is how long a claim may take to bind before it is
+	// marked Failed. Zero retries forever.
+	ProvisioningTimeout time.Duration
+	// S3OperationTimeout bounds each S3 operation made for a claim,
+	// including its retries, unless the claim sets spec.operationTimeout.
+	// Zero leaves operations unbounded.
+	S3OperationTimeout time.Duration
+	// QueueRateLimiter paces requeues of the claim workqueue. Nil selects
+	// the controller-runtime default.
+	QueueRateLimiter ratelimiter.RateLimiter
+	// BucketLocks serializes bucket creation by name. Nil disables locking.
+	BucketLocks *BucketLocks
+	// LabelTags maps claim labels to the bucket tags kept in sync with them.
+	// Empty disables bucket tagging.
+	LabelTags LabelTags
+	// BucketNameTruncation selects how generated bucket names that are too
+	// long are handled. Empty selects BucketNameTruncationHash.
+	BucketNameTruncation BucketNameTruncation
+	// Throttle backs off claims whose backend throttles them. Nil retries
+	// them like any other failure.
+	Throttle *ThrottleBackoff
+	// DetachOnly only removes the finalizer of every claim, without
+	// provisioning or deleting anything, to uninstall the controller safely
+	DetachOnly bool
 }
 
 //+kubebuilder:rbac:groups=quobject.io,resources=quobjectbucketclaims,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=quobject.io,resources=quobjectbucketclaims/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=quobject.io,resources=quobjectbucketclaims/finalizers,verbs=update
+//+kubebuilder:rbac:groups=quobject.io,resources=quobjectbucketsnapshots,verbs=get;list;watch
+//+kubebuilder:rbac:groups=quobject.io,resources=quobjectbucketclaimclasses,verbs=get;list;watch
+//+kubebuilder:rbac:groups=quobject.io,resources=quobjectbucketclasses,verbs=get;list;watch
+//+kubebuilder:rbac:groups=quobject.io,resources=quobjectquotas,verbs=get;list;watch
 //+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
 
@@ -52,7 +110,19 @@ func (r *QuObjectBucketClaimReconciler) Reconcile(
 	ctx context.Context,
 	req ctrl.Request,
 ) (ctrl.Result, error) {
-	log := log.FromContext(ctx)
+	start := time.Now()
+	result, err := r.reconcile(ctx, req)
+	observeReconcile(start, result, err)
+	return result, err
+}
+
+// reconcile is Reconcile without the metrics
+func (r *QuObjectBucketClaimReconciler) reconcile(
+	ctx context.Context,
+	req ctrl.Request,
+) (ctrl.Result, error) {
+	log := log.FromContext(ctx).WithValues("claim", req.NamespacedName)
+	ctx = ctrl.LoggerInto(ctx, log)
 
 	// Fetch the QuObjectBucketClaim instance
 	claim := &quv1.QuObjectBucketClaim{}
@@ -66,6 +136,15 @@ func (r *QuObjectBucketClaimReconciler) Reconcile(
 		return ctrl.Result{}, err
 	}
 
+	// Events of owned objects are mapped to claims of every shard
+	if !r.Shard.Owns(claim) {
+		return ctrl.Result{}, nil
+	}
+
+	if r.DetachOnly {
+		return r.detach(ctx, claim)
+	}
+
 	// Handle deletion
 	if !claim.DeletionTimestamp.IsZero() {
 		return r.handleDeletion(ctx, claim)
@@ -79,158 +158,549 @@ func (r *QuObjectBucketClaimReconciler) Reconcile(
 		}
 	}
 
+	// Claims take the settings they leave unset from their class
+	if applied, err := r.applyClaimClass(ctx, claim); err != nil {
+		log.Error(err, "Failed to apply claim class")
+		return r.provisioningError(ctx, claim, err)
+	} else if applied {
+		return ctrl.Result{}, nil
+	}
+
+	// A claim seen for the first time is pending until work on it starts
+	if claim.Status.Phase == "" {
+		claim.Status.Phase = quv1.ClaimPhasePending
+		if err := r.Status().Update(ctx, claim); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// A claim that never bound stops hammering the backend after the timeout
+	if failed, err := r.provisioningFailed(ctx, claim); failed || err != nil {
+		return ctrl.Result{}, err
+	}
+
 	// Main reconciliation logic
-	log.Info("Reconciling QuObjectBucketClaim", "Name", claim.Name, "Namespace", claim.Namespace)
-
-	// Get S3 credentials from secret
-	credSecret := &corev1.Secret{}
-	err = r.Get(ctx, types.NamespacedName{
-		Name:      "s3-credentials",
-		Namespace: controllerNS,
-	}, credSecret)
-	if err != nil {
-		log.Error(err, "Failed to get S3 credentials secret")
-		claim.Status.Phase = "Error"
+	log.Info("Reconciling QuObjectBucketClaim")
+
+	if isDirectoryBucket(claim) && claim.Spec.AvailabilityZoneID == "" {
+		err := fmt.Errorf("spec.availabilityZoneId is required for directory buckets")
+		log.Error(err, "Invalid QuObjectBucketClaim")
+		r.warn(ctx, claim, reasonProvisioningFailed, err)
+		claim.Status.Phase = quv1.ClaimPhaseError
+		setReadyCondition(claim, "InvalidSpec", err.Error())
 		r.Status().Update(ctx, claim)
-		return ctrl.Result{}, err
+		return ctrl.Result{}, nil
 	}
 
-	// Extract credentials
-	endpoint := string(credSecret.Data["endpoint"])
-	region := string(credSecret.Data["region"])
-	accessKey := string(credSecret.Data["accessKey"])
-	secretKey := string(credSecret.Data["secretKey"])
-	
-	// Extract SSL configuration with defaults
-	useSSL := true // default to HTTPS
-	if sslStr := string(credSecret.Data["useSSL"]); sslStr != "" {
-		useSSL = sslStr == "true" || sslStr == "1"
+	// Resolve the backend serving the claim
+	backendName, backendCfg, err := r.claimBackend(ctx, claim)
+	setCredentialsSecretCondition(claim, err)
+	if err != nil {
+		log.Error(err, "Failed to resolve S3 backend")
+		// The recorded backend of a provisioned bucket is gone
+		if claim.Annotations[annotationBackend] != "" && apierrors.IsNotFound(err) {
+			r.warn(ctx, claim, reasonProvisioningFailed, err)
+			claim.Status.Phase = quv1.ClaimPhaseLost
+			setReadyCondition(claim, "BackendLost", err.Error())
+			r.Status().Update(ctx, claim)
+			return ctrl.Result{}, err
+		}
+		return r.provisioningError(ctx, claim, err)
 	}
-	
-	insecureSkipVerify := false // default to verify certificates
-	if skipVerifyStr := string(credSecret.Data["insecureSkipVerify"]); skipVerifyStr != "" {
-		insecureSkipVerify = skipVerifyStr == "true" || skipVerifyStr == "1"
+	backendCfg = backendCfg.ForRegion(claim.Spec.Region)
+	log = log.WithValues("backend", backendName)
+
+	// Claims hold off while their backend recovers from throttling
+	if wait := r.Throttle.Wait(claim, backendName); wait > 0 {
+		log.Info("Backend is throttling requests, waiting", "after", wait)
+		return ctrl.Result{RequeueAfter: wait}, nil
 	}
 
 	// Create S3 client
-	s3Client, err := newS3Client(endpoint, region, accessKey, secretKey, useSSL, insecureSkipVerify, true)
+	s3Client, err := backend.NewS3Client(backendCfg, r.S3RateLimiter, r.s3ClientOptions(ctx, claim)...)
 	if err != nil {
 		log.Error(err, "Failed to create S3 client")
-		claim.Status.Phase = "Error"
-		r.Status().Update(ctx, claim)
-		return ctrl.Result{}, err
+		return r.provisioningError(ctx, claim, fmt.Errorf("failed to create S3 client: %w", err))
 	}
 
 	// Determine bucket name
-	bucketName := r.determineBucketName(claim)
-	
+	bucketName, generated, fullName := r.determineBucketName(claim, backendCfg)
+	truncated := generated && fullName != bucketName
+	if err := backendCfg.CheckTenantBucket(bucketName); err != nil {
+		log.Error(err, "Invalid QuObjectBucketClaim")
+		r.warn(ctx, claim, reasonProvisioningFailed, err)
+		claim.Status.Phase = quv1.ClaimPhaseError
+		setReadyCondition(claim, "InvalidSpec", err.Error())
+		r.Status().Update(ctx, claim)
+		return ctrl.Result{}, nil
+	}
+	if truncated && r.BucketNameTruncation == BucketNameTruncationReject {
+		err := fmt.Errorf("generated bucket name %s is longer than %d characters", fullName, maxBucketNameLength)
+		log.Error(err, "Invalid QuObjectBucketClaim")
+		r.warn(ctx, claim, reasonProvisioningFailed, err)
+		claim.Status.Phase = quv1.ClaimPhaseError
+		setReadyCondition(claim, "InvalidSpec", err.Error())
+		r.Status().Update(ctx, claim)
+		return ctrl.Result{}, nil
+	}
+	if isDirectoryBucket(claim) {
+		bucketName = directoryBucketName(bucketName, claim.Spec.AvailabilityZoneID)
+	}
+	log = log.WithValues("bucket", bucketName)
+	if err := r.checkBucketNamePrefix(ctx, claim, bucketName); err != nil {
+		return r.provisioningError(ctx, claim, err)
+	}
+	if err := r.checkNamespaceQuotas(ctx, claim); err != nil {
+		return r.provisioningError(ctx, claim, err)
+	}
+
+	// Commit a newly generated name and the Provisioning phase before the
+	// bucket is created, so a crash in between cannot strand the bucket
+	// under a name that is never reused
+	if generated || claim.Status.Phase == quv1.ClaimPhasePending {
+		if generated {
+			claim.Status.GeneratedBucketName = bucketName
+			claim.Status.UntruncatedBucketName = ""
+			if truncated {
+				claim.Status.UntruncatedBucketName = fullName
+			}
+		}
+		claim.Status.Phase = quv1.ClaimPhaseProvisioning
+		setReadyCondition(claim, "Provisioning", fmt.Sprintf("Provisioning bucket %s", bucketName))
+		initStageConditions(claim)
+		if err := r.Status().Update(ctx, claim); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// A new name for a bound claim's bucket moves its objects first
+	if current := claim.Status.BucketName; current != "" && current != bucketName {
+		if err := r.migrateBucket(ctx, s3Client, claim, current, bucketName, backendCfg); err != nil {
+			log.Error(err, "Failed to migrate bucket")
+			r.warn(ctx, claim, reasonMigrationFailed, err)
+			return ctrl.Result{}, err
+		}
+	}
+
 	// Store bucket name and retain policy in annotations for deletion handling
 	if claim.Annotations == nil {
 		claim.Annotations = make(map[string]string)
 	}
 	claim.Annotations[annotationBucketName] = bucketName
-	claim.Annotations[annotationRetainPolicy] = string(claim.Spec.RetainPolicy)
+	policy := retainPolicy(claim, backendCfg)
+	claim.Annotations[annotationRetainPolicy] = string(policy)
+	claim.Annotations[annotationBackend] = backendName
+	// The user is recorded before it is created, so it is never left behind
+	if usesDedicatedUser(claim, backendCfg) {
+		claim.Annotations[annotationCredentialsUser] = claimUserName(claim)
+	}
 	if err := r.Update(ctx, claim); err != nil {
 		return ctrl.Result{}, err
 	}
 
+	// A bound bucket that vanished is only recreated on request
+	if lost, err := r.bucketLost(ctx, s3Client, claim, bucketName); err != nil {
+		return ctrl.Result{}, err
+	} else if lost {
+		return ctrl.Result{RequeueAfter: r.requeueAfter(claim)}, nil
+	}
+
 	// Ensure bucket exists
-	err = ensureBucket(ctx, s3Client, bucketName, region)
+	created, err := r.BucketLocks.ensureBucket(ctx, s3Client, bucketName, createBucketConfiguration(claim, backendCfg), backendCfg.Profile,
+		createBucketOptions(claim, backendCfg)...)
+	if errors.Is(err, errBucketLocked) {
+		log.Info("Bucket is being created by another replica, retrying")
+		return ctrl.Result{RequeueAfter: bucketLockRetry}, nil
+	}
 	if err != nil {
-		log.Error(err, "Failed to ensure bucket", "bucket", bucketName)
-		claim.Status.Phase = "Error"
-		r.Status().Update(ctx, claim)
-		return ctrl.Result{}, err
+		log.Error(err, "Failed to ensure bucket")
+		err = fmt.Errorf("failed to ensure bucket %s: %w", bucketName, err)
+		setStageCondition(claim, quv1.ConditionBucketReady, false, classifyError(err).reason, err.Error())
+		return r.provisioningError(ctx, claim, err)
 	}
+	if created {
+		r.event(ctx, claim, corev1.EventTypeNormal, reasonBucketCreated,
+			"Created bucket %s on backend %s", bucketName, backendName)
+	} else if !meta.IsStatusConditionTrue(claim.Status.Conditions, quv1.ConditionBucketReady) {
+		r.event(ctx, claim, corev1.EventTypeNormal, reasonBucketAdopted,
+			"Using existing bucket %s on backend %s", bucketName, backendName)
+	}
+	setStageCondition(claim, quv1.ConditionBucketReady, true, reasonBucketAvailable,
+		fmt.Sprintf("Bucket %s exists", bucketName))
 
-	// Create Secret for bucket access
-	secret := &corev1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      fmt.Sprintf("%s-bucket-secret", claim.Name),
-			Namespace: claim.Namespace,
-		},
-		Type: corev1.SecretTypeOpaque,
-		StringData: map[string]string{
-			"AWS_ACCESS_KEY_ID":     accessKey,
-			"AWS_SECRET_ACCESS_KEY": secretKey,
-			"BUCKET_NAME":           bucketName,
-			"BUCKET_HOST":           endpoint,
-			"BUCKET_REGION":         region,
-		},
-	}
-
-	// Set owner reference
-	if err := controllerutil.SetControllerReference(claim, secret, r.Scheme); err != nil {
-		return ctrl.Result{}, err
+	if err := recordPlacement(ctx, s3Client, claim, backendCfg, bucketName); err != nil {
+		log.Error(err, "Failed to record bucket placement")
 	}
 
-	// Create/Update Secret
-	if err := upsertSecret(ctx, r.Client, secret); err != nil {
-		log.Error(err, "Failed to create/update secret")
-		return ctrl.Result{}, err
+	// Seed a new bucket from its data source before publishing it
+	if err := r.cloneDataSource(ctx, claim, s3Client, backendName, bucketName); err != nil {
+		log.Error(err, "Failed to clone data source")
+		return r.provisioningError(ctx, claim, err)
 	}
 
-	// Create ConfigMap for bucket configuration
-	configMap := &corev1.ConfigMap{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      fmt.Sprintf("%s-bucket-config", claim.Name),
-			Namespace: claim.Namespace,
-		},
-		Data: map[string]string{
-			"BUCKET_NAME":   bucketName,
-			"BUCKET_HOST":   endpoint,
-			"BUCKET_REGION": region,
-			"BUCKET_PORT":   "443",
-		},
+	// Record the owner in the bucket itself for disaster recovery. Backends
+	// refusing the marker still get a working bucket.
+	var ownerConflict *ownerConflictError
+	if err := r.ensureOwnerMarker(ctx, s3Client, claim, bucketName); errors.As(err, &ownerConflict) {
+		if !meta.IsStatusConditionTrue(claim.Status.Conditions, quv1.ConditionOwnerConflict) {
+			r.warn(ctx, claim, reasonOwnerConflict, err)
+		}
+		meta.SetStatusCondition(&claim.Status.Conditions, metav1.Condition{
+			Type:               quv1.ConditionOwnerConflict,
+			Status:             metav1.ConditionTrue,
+			Reason:             reasonOwnerConflict,
+			Message:            err.Error(),
+			ObservedGeneration: claim.Generation,
+		})
+	} else if err != nil {
+		log.Error(err, "Failed to ensure ownership marker")
+	} else {
+		meta.RemoveStatusCondition(&claim.Status.Conditions, quv1.ConditionOwnerConflict)
 	}
 
-	// Set owner reference
-	if err := controllerutil.SetControllerReference(claim, configMap, r.Scheme); err != nil {
-		return ctrl.Result{}, err
+	// Cost-allocation tags follow the claim's labels
+	if err := r.syncBucketTags(ctx, s3Client, claim, bucketName); err != nil {
+		log.Error(err, "Failed to sync bucket tags")
+	}
+
+	// Hibernated claims keep their bucket but lose all access to it
+	if claim.Spec.Hibernate {
+		return r.hibernate(ctx, s3Client, claim, backendName, backendCfg, bucketName)
+	}
+	meta.RemoveStatusCondition(&claim.Status.Conditions, quv1.ConditionHibernated)
+
+	// Directory buckets are served from a zonal endpoint
+	bucketHost := backendCfg.Endpoint
+	bucketScheme, bucketPort := backendCfg.Scheme(), backendCfg.Port()
+	if isDirectoryBucket(claim) {
+		bucketHost = directoryBucketEndpoint(backendCfg.Region, claim.Spec.AvailabilityZoneID)
+		bucketScheme, bucketPort = "https", "443"
+	}
+
+	// Ingest buckets become read-only once their write window elapsed
+	r.syncAccess(ctx, claim)
+
+	if err := r.checkOutputNamespace(ctx, claim); err != nil {
+		log.Error(err, "Output namespace not allowed")
+		return r.provisioningError(ctx, claim, err)
+	}
+
+	secretName := ""
+	var creds claimCredentials
+	if isCSIOutput(claim) {
+		// The CSI provider issues the credentials when a pod mounts them
+		if err := r.deleteOwned(ctx, claim, &corev1.Secret{}, claim.Status.SecretRef); err != nil {
+			log.Error(err, "Failed to delete secret")
+			return ctrl.Result{}, err
+		}
+		if err := checkCSICredentials(claim, backendCfg); err != nil {
+			setStageCondition(claim, quv1.ConditionCredentialsReady, false, reasonCSIUnsupported, err.Error())
+		} else {
+			setStageCondition(claim, quv1.ConditionCredentialsReady, true, reasonCSIProvider,
+				"Credentials are issued by the Secrets Store CSI provider when a pod mounts them")
+		}
+	} else {
+		// Issue or reuse the credentials published for the bucket
+		creds, err = r.claimCredentials(ctx, claim, backendName, backendCfg, bucketName)
+		if err != nil {
+			log.Error(err, "Failed to obtain credentials")
+			setStageCondition(claim, quv1.ConditionCredentialsReady, false, classifyError(err).reason, err.Error())
+			return r.provisioningError(ctx, claim, err)
+		}
+
+		// Create Secret for bucket access
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      outputName(claim.Spec.SecretName, claim.Status.SecretRef, claim.Name, secretNameSuffix),
+				Namespace: outputNamespace(claim),
+			},
+			Type: corev1.SecretTypeOpaque,
+			StringData: map[string]string{
+				"AWS_ACCESS_KEY_ID":     creds.AccessKey,
+				"AWS_SECRET_ACCESS_KEY": creds.SecretKey,
+				"BUCKET_NAME":           bucketName,
+				"BUCKET_HOST":           bucketHost,
+				"BUCKET_REGION":         backendCfg.Region,
+			},
+		}
+		if tenant, _ := backend.SplitTenantBucket(bucketName); tenant != "" {
+			secret.StringData["BUCKET_TENANT"] = tenant
+		}
+
+		if creds.SessionToken != "" {
+			secret.StringData["AWS_SESSION_TOKEN"] = creds.SessionToken
+			secret.StringData["AWS_CREDENTIALS_EXPIRATION"] = creds.Expiration.UTC().Format(time.RFC3339)
+		}
+
+		if isConnectionOutput(claim) {
+			endpointURL := backendCfg.EndpointURL()
+			if isDirectoryBucket(claim) {
+				endpointURL = "https://" + bucketHost
+			}
+			secret.StringData = connectionSecretData(claim, backendCfg, creds, bucketName, endpointURL)
+		}
+		secretFallback := outputFallback(claim.Spec.SecretName, claim.Name, secretNameSuffix)
+		if claim.Spec.ImmutableOutputs {
+			secret.Immutable = &claim.Spec.ImmutableOutputs
+			secret.Name, secretFallback = versionedNames(claim.Spec.SecretName, claim.Name, secretNameSuffix, secret.StringData)
+		}
+
+		// Set owner reference
+		if err := r.setOutputOwner(claim, secret); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		// Create/Update Secret
+		err = upsertWithFallback(ctx, secret, secretFallback,
+			func(ctx context.Context) error { return upsertSecret(ctx, r.Client, claim, secret) })
+		if err != nil {
+			setStageCondition(claim, quv1.ConditionCredentialsReady, false, outputFailureReason(err), err.Error())
+			var conflict *nameConflictError
+			if errors.As(err, &conflict) {
+				return r.handleNameConflict(ctx, claim, conflict)
+			}
+			if apierrors.IsForbidden(err) {
+				return r.handleInsufficientPermissions(ctx, claim, err)
+			}
+			log.Error(err, "Failed to create/update secret")
+			return ctrl.Result{}, err
+		}
+		secretName = secret.Name
+		// Only a created Secret is filled in by the upsert
+		if secret.UID != "" {
+			r.event(ctx, claim, corev1.EventTypeNormal, reasonSecretCreated,
+				"Created Secret %s/%s", secret.Namespace, secret.Name)
+		}
+		setStageCondition(claim, quv1.ConditionCredentialsReady, true, reasonSecretPublished,
+			fmt.Sprintf("Credentials are published in Secret %s", secretName))
+	}
+
+	configMapName := ""
+	if isConnectionOutput(claim) {
+		// The connection Secret carries all settings
+		if err := r.deleteGeneratedConfigMap(ctx, claim); err != nil {
+			log.Error(err, "Failed to delete configmap")
+			return ctrl.Result{}, err
+		}
+		setStageCondition(claim, quv1.ConditionConfigMapReady, true, reasonConnectionSecret,
+			fmt.Sprintf("The bucket settings are published in connection Secret %s", secretName))
+	} else {
+		// Create ConfigMap for bucket configuration
+		configMap := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      outputName(claim.Spec.ConfigMapName, claim.Status.ConfigMapRef, claim.Name, configMapNameSuffix),
+				Namespace: outputNamespace(claim),
+			},
+			Data: map[string]string{
+				"BUCKET_NAME":       bucketName,
+				"BUCKET_HOST":       bucketHost,
+				"BUCKET_REGION":     backendCfg.Region,
+				"BUCKET_PORT":       bucketPort,
+				"BUCKET_SCHEME":     bucketScheme,
+				"BUCKET_PATH_STYLE": strconv.FormatBool(bucketPathStyle(claim, backendCfg)),
+			},
+		}
+		if tenant, _ := backend.SplitTenantBucket(bucketName); tenant != "" {
+			configMap.Data["BUCKET_TENANT"] = tenant
+		}
+		if isDirectoryBucket(claim) {
+			// Clients must use S3 Express session authentication and virtual-hosted
+			// addressing against the zonal endpoint
+			configMap.Data["BUCKET_TYPE"] = string(quv1.BucketTypeDirectory)
+			configMap.Data["BUCKET_AVAILABILITY_ZONE_ID"] = claim.Spec.AvailabilityZoneID
+		}
+		configMapFallback := outputFallback(claim.Spec.ConfigMapName, claim.Name, configMapNameSuffix)
+		if claim.Spec.ImmutableOutputs {
+			configMap.Immutable = &claim.Spec.ImmutableOutputs
+		}
+		if versionedConfigMap(claim) {
+			configMap.Name, configMapFallback = versionedNames(claim.Spec.ConfigMapName, claim.Name, configMapNameSuffix, configMap.Data)
+		}
+
+		// Set owner reference
+		if err := r.setOutputOwner(claim, configMap); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		// Create/Update ConfigMap
+		err = upsertWithFallback(ctx, configMap, configMapFallback,
+			func(ctx context.Context) error { return upsertConfigMap(ctx, r.Client, claim, configMap) })
+		if err != nil {
+			setStageCondition(claim, quv1.ConditionConfigMapReady, false, outputFailureReason(err), err.Error())
+			var conflict *nameConflictError
+			if errors.As(err, &conflict) {
+				return r.handleNameConflict(ctx, claim, conflict)
+			}
+			if apierrors.IsForbidden(err) {
+				return r.handleInsufficientPermissions(ctx, claim, err)
+			}
+			log.Error(err, "Failed to create/update configmap")
+			return ctrl.Result{}, err
+		}
+		configMapName = configMap.Name
+		// Only a created ConfigMap is filled in by the upsert
+		if configMap.UID != "" {
+			r.event(ctx, claim, corev1.EventTypeNormal, reasonConfigMapCreated,
+				"Created ConfigMap %s/%s", configMap.Namespace, configMap.Name)
+		}
+		setStageCondition(claim, quv1.ConditionConfigMapReady, true, reasonConfigMapPublished,
+			fmt.Sprintf("The bucket settings are published in ConfigMap %s", configMapName))
 	}
+	meta.RemoveStatusCondition(&claim.Status.Conditions, quv1.ConditionNameConflict)
+	meta.RemoveStatusCondition(&claim.Status.Conditions, quv1.ConditionInsufficientPermissions)
 
-	// Create/Update ConfigMap
-	if err := upsertConfigMap(ctx, r.Client, configMap); err != nil {
-		log.Error(err, "Failed to create/update configmap")
+	// Clients now use the new bucket, so a migration can complete
+	if err := r.finishMigration(ctx, s3Client, claim); err != nil {
+		log.Error(err, "Failed to finish bucket migration")
+		r.warn(ctx, claim, reasonMigrationFailed, err)
 		return ctrl.Result{}, err
 	}
 
+	// Refresh the usage estimate on the polling interval
+	if r.usageRefreshDue(claim) {
+		usage, err := measureBucketUsage(ctx, s3Client, bucketName)
+		if err != nil {
+			log.Error(err, "Failed to measure bucket usage")
+		} else {
+			claim.Status.Usage = usage
+		}
+	}
+	r.syncShare(ctx, s3Client, claim, bucketName)
+	snapshots, err := r.snapshotUsage(ctx, claim)
+	if err != nil {
+		log.Error(err, "Failed to measure snapshot usage")
+	} else {
+		claim.Status.Snapshots = snapshots
+	}
+
+	// Enforce the quota and the write window by denying writes, and grant
+	// the claim's Quobyte user access
+	statements := append(quotaStatements(claim, bucketName), readOnlyStatements(claim, bucketName)...)
+	statements = append(statements, quobyteStatements(claim, backendCfg, bucketName)...)
+	statements = append(statements, claimUserStatements(claim, backendCfg, bucketName)...)
+	if err := syncBucketPolicy(ctx, s3Client, bucketName, statements); err != nil {
+		log.Error(err, "Failed to sync bucket policy")
+		return r.provisioningError(ctx, claim, fmt.Errorf("failed to sync bucket policy: %w", err))
+	}
+	if err := syncLifecycleRules(ctx, s3Client, claim, bucketName); err != nil {
+		log.Error(err, "Failed to sync bucket lifecycle rules")
+		return r.provisioningError(ctx, claim, err)
+	}
+	if err := syncBucketEncryption(ctx, s3Client, claim, bucketName); err != nil {
+		log.Error(err, "Failed to sync bucket encryption")
+		return r.provisioningError(ctx, claim, err)
+	}
+	if err := r.syncBackendQuota(ctx, claim, backendCfg, bucketName); err != nil {
+		log.Error(err, "Failed to sync backend quota")
+		return r.provisioningError(ctx, claim, err)
+	}
+	if err := r.syncQuobyteVolume(ctx, claim, backendCfg, bucketName); err != nil {
+		log.Error(err, "Failed to apply Quobyte volume configuration")
+		return r.provisioningError(ctx, claim, err)
+	}
+	setQuotaCondition(claim)
+	setCapacity(claim)
+
+	// Grant the claim's ServiceAccounts web identity access to the bucket
+	if err := r.syncServiceAccountAccess(ctx, claim, backendName, backendCfg); err != nil {
+		log.Error(err, "Failed to sync ServiceAccount access")
+		return r.provisioningError(ctx, claim, err)
+	}
+
 	// Update status
-	claim.Status.Phase = "Bound"
+	if claim.Status.Phase != quv1.ClaimPhaseBound {
+		r.event(ctx, claim, corev1.EventTypeNormal, reasonBound, "Bucket %s is ready", bucketName)
+	}
+	claim.Status.Phase = quv1.ClaimPhaseBound
+	setReadyCondition(claim, reasonBound, fmt.Sprintf("Bucket %s is ready", bucketName))
+	meta.RemoveStatusCondition(&claim.Status.Conditions, quv1.ConditionFailed)
+	meta.RemoveStatusCondition(&claim.Status.Conditions, quv1.ConditionProvisioningError)
+	meta.RemoveStatusCondition(&claim.Status.Conditions, quv1.ConditionThrottled)
+	r.Throttle.Forget(claim)
 	claim.Status.BucketName = bucketName
-	claim.Status.SecretRef = secret.Name
-	claim.Status.ConfigMapRef = configMap.Name
+	claim.Status.RetainPolicy = policy
+	recordBackend(claim, backendName)
+	claim.Status.SecretRef = secretName
+	claim.Status.ConfigMapRef = configMapName
+	claim.Status.OutputNamespace = ""
+	if ns := outputNamespace(claim); ns != claim.Namespace {
+		claim.Status.OutputNamespace = ns
+	}
+	claim.Status.CredentialsExpiration = creds.Expiration
+	claim.Status.CredentialsUser = creds.User
 
 	if err := r.Status().Update(ctx, claim); err != nil {
 		log.Error(err, "Failed to update QuObjectBucketClaim status")
 		return ctrl.Result{}, err
 	}
+	if err := r.pruneStaleOutputs(ctx, claim); err != nil {
+		log.Error(err, "Failed to delete previous outputs")
+		return ctrl.Result{}, err
+	}
+	if err := r.finishCredentialsRotation(ctx, claim, backendCfg); err != nil {
+		log.Error(err, "Failed to complete credentials rotation")
+		return ctrl.Result{}, err
+	}
+	// The Secret no longer holds the keys of a user from an earlier mode
+	if !usesDedicatedUser(claim, backendCfg) {
+		if err := r.deleteClaimUser(ctx, claim, backendCfg); err != nil {
+			log.Error(err, "Failed to delete previous user")
+			return ctrl.Result{}, err
+		}
+	}
 
-	log.Info("Successfully reconciled QuObjectBucketClaim", "bucket", bucketName)
-	return ctrl.Result{}, nil
+	log.Info("Successfully reconciled QuObjectBucketClaim")
+	return ctrl.Result{RequeueAfter: r.requeueAfter(claim)}, nil
 }
 
-// determineBucketName determines the bucket name based on the spec
-func (r *QuObjectBucketClaimReconciler) determineBucketName(claim *quv1.QuObjectBucketClaim) string {
+// determineBucketName determines the bucket name based on the spec. It
+// reports whether the name was newly generated and must be recorded, and
+// returns the generated name before it was truncated to fit the length
+// limit of bucket names. Generated names are qualified with the backend's
+// RGW tenant, which does not count towards the limit.
+func (r *QuObjectBucketClaimReconciler) determineBucketName(
+	claim *quv1.QuObjectBucketClaim,
+	cfg backend.Config,
+) (string, bool, string) {
 	// If explicit bucket name is provided, use it
 	if claim.Spec.BucketName != "" {
-		return claim.Spec.BucketName
+		return claim.Spec.BucketName, false, claim.Spec.BucketName
 	}
 
 	// If already have a bucket name in status, reuse it (for idempotency)
 	if claim.Status.BucketName != "" {
-		return claim.Status.BucketName
+		return claim.Status.BucketName, false, claim.Status.BucketName
 	}
 
-	// Generate a new bucket name with random suffix
-	if claim.Spec.GenerateBucketName != "" {
-		suffix := generateRandomString(5)
-		return fmt.Sprintf("%s-%s", claim.Spec.GenerateBucketName, suffix)
+	// Reuse a name generated by an earlier, unfinished reconcile
+	if claim.Status.GeneratedBucketName != "" {
+		return claim.Status.GeneratedBucketName, false, claim.Status.GeneratedBucketName
 	}
 
-	// Fallback: use namespace-name pattern with random suffix
+	// Generate a new bucket name with random suffix, falling back to the
+	// namespace-name pattern
 	suffix := generateRandomString(5)
-	return fmt.Sprintf("%s-%s-%s", claim.Namespace, claim.Name, suffix)
+	name := backend.SanitizeBucketName(generatedBucketPrefix(claim) + "-" + suffix)
+
+	// Directory buckets get their zone suffix appended afterwards
+	limit := maxBucketNameLength
+	if isDirectoryBucket(claim) {
+		limit -= len(directoryBucketName("", claim.Spec.AvailabilityZoneID))
+	}
+	qualified := backend.QualifyBucketName(cfg.RGWTenant, name)
+	if len(name) > limit {
+		return backend.QualifyBucketName(cfg.RGWTenant, truncatedBucketName(name, limit)), true, qualified
+	}
+	return qualified, true, qualified
+}
+
+// generatedBucketPrefix returns the prefix of generated bucket names before
+// it is sanitized
+func generatedBucketPrefix(claim *quv1.QuObjectBucketClaim) string {
+	if claim.Spec.GenerateBucketName != "" {
+		return claim.Spec.GenerateBucketName
+	}
+	return claim.Namespace + "-" + claim.Name
 }
 
 // generateRandomString generates a random alphanumeric string of specified length
@@ -252,12 +722,61 @@ func (r *QuObjectBucketClaimReconciler) handleDeletion(
 	log := log.FromContext(ctx)
 
 	if controllerutil.ContainsFinalizer(claim, finalizerName) {
-		log.Info("Processing QuObjectBucketClaim deletion", 
-			"Name", claim.Name, 
-			"RetainPolicy", claim.Spec.RetainPolicy)
+		policy := retainPolicy(claim, backend.Config{})
+		log.Info("Processing QuObjectBucketClaim deletion",
+			"retainPolicy", policy)
+
+		if claim.Status.Phase != quv1.ClaimPhaseDeleting {
+			action := "retained"
+			if policy == quv1.RetainPolicyDelete {
+				action = "deleted"
+			}
+			r.event(ctx, claim, corev1.EventTypeNormal, reasonDeletionStarted,
+				"Deleting claim; its bucket is %s per retain policy %s", action, policy)
+			claim.Status.Phase = quv1.ClaimPhaseDeleting
+			if err := r.Status().Update(ctx, claim); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+
+		// Revoke ServiceAccount access whether or not the bucket is retained
+		if len(claim.Status.ServiceAccounts) > 0 {
+			backendName, backendCfg, err := r.claimBackend(ctx, claim)
+			if err == nil {
+				err = r.syncServiceAccountAccess(ctx, claim, backendName, backendCfg)
+			}
+			if err != nil {
+				log.Error(err, "Failed to revoke ServiceAccount access")
+				r.warn(ctx, claim, reasonProvisioningFailed, err)
+				// Continue with finalizer removal
+			}
+		}
+
+		// Revoke the credentials of the claim's dedicated user
+		if backendName, backendCfg, err := r.claimBackend(ctx, claim); err == nil {
+			if err := r.deleteClaimUser(ctx, claim, backendCfg); err != nil {
+				log.Error(err, "Failed to delete user", "backend", backendName)
+				r.warn(ctx, claim, reasonProvisioningFailed, err)
+				// Continue with finalizer removal
+			}
+		}
+
+		// Revoke the credentials of the claim's Quobyte user
+		if backendName, backendCfg, err := r.claimBackend(ctx, claim); err == nil && backendCfg.Quobyte.Enabled() {
+			if err := r.deleteQuobyteUser(ctx, claim, backendCfg); err != nil {
+				log.Error(err, "Failed to delete Quobyte user", "backend", backendName)
+				r.warn(ctx, claim, reasonProvisioningFailed, err)
+				// Continue with finalizer removal
+			}
+			if err := r.deleteQuobytePolicyRule(ctx, claim, backendCfg); err != nil {
+				log.Error(err, "Failed to delete Quobyte policy rule", "backend", backendName)
+				r.warn(ctx, claim, reasonProvisioningFailed, err)
+				// Continue with finalizer removal
+			}
+		}
 
 		// Check retain policy
-		if claim.Spec.RetainPolicy == quv1.RetainPolicyDelete {
+		if policy == quv1.RetainPolicyDelete {
 			// Delete the bucket if policy is Delete
 			bucketName := claim.Annotations[annotationBucketName]
 			if bucketName == "" {
@@ -265,50 +784,46 @@ func (r *QuObjectBucketClaimReconciler) handleDeletion(
 			}
 
 			if bucketName != "" {
-				log.Info("Deleting bucket per retain policy", "bucket", bucketName)
-				
-				// Get S3 credentials
-				credSecret := &corev1.Secret{}
-				err := r.Get(ctx, types.NamespacedName{
-					Name:      "s3-credentials",
-					Namespace: controllerNS,
-				}, credSecret)
+				log := log.WithValues("bucket", bucketName)
+				log.Info("Deleting bucket per retain policy")
+
+				// Create S3 client for the backend the bucket was provisioned on
+				backendName, backendCfg, err := r.claimBackend(ctx, claim)
+				var s3Client *s3.Client
+				if err == nil {
+					log = log.WithValues("backend", backendName)
+					backendCfg = backendCfg.ForRegion(claim.Spec.Region)
+					s3Client, err = backend.NewS3Client(backendCfg, r.S3RateLimiter, r.s3ClientOptions(ctx, claim)...)
+				}
 				if err != nil {
-					log.Error(err, "Failed to get S3 credentials for bucket deletion")
+					log.Error(err, "Failed to create S3 client for bucket deletion")
+					r.warn(ctx, claim, reasonBucketDeletionFailed,
+						fmt.Errorf("failed to delete bucket %s: %w", bucketName, err))
 					// Continue with finalizer removal even if we can't delete the bucket
 				} else {
-					// Create S3 client and delete bucket
-					endpoint := string(credSecret.Data["endpoint"])
-					region := string(credSecret.Data["region"])
-					accessKey := string(credSecret.Data["accessKey"])
-					secretKey := string(credSecret.Data["secretKey"])
-
-	                                // Extract SSL configuration with defaults
-	                                useSSL := true // default to HTTPS
-	                                if sslStr := string(credSecret.Data["useSSL"]); sslStr != "" {
-		                          useSSL = sslStr == "true" || sslStr == "1"
-	                                }
-	
-	                                insecureSkipVerify := false // default to verify certificates
-	                                if skipVerifyStr := string(credSecret.Data["insecureSkipVerify"]); skipVerifyStr != "" {
-		                          insecureSkipVerify = skipVerifyStr == "true" || skipVerifyStr == "1"
-	                                }
-					
-					s3Client, err := newS3Client(endpoint, region, accessKey, secretKey, useSSL, insecureSkipVerify, true)
-					if err == nil {
-						if err := deleteBucket(ctx, s3Client, bucketName); err != nil {
-							log.Error(err, "Failed to delete bucket", "bucket", bucketName)
-							// Continue with finalizer removal
-						} else {
-							log.Info("Successfully deleted bucket", "bucket", bucketName)
-						}
+					progress := newDeletionProgress(claim.Namespace, claim.Name, bucketName)
+					err := deleteBucket(ctx, s3Client, bucketName, r.DeleteWorkers, progress)
+					progress.done()
+					if err != nil {
+						log.Error(err, "Failed to delete bucket")
+						r.warn(ctx, claim, reasonBucketDeletionFailed,
+							fmt.Errorf("failed to delete bucket %s: %w", bucketName, err))
+						// Continue with finalizer removal
+					} else {
+						log.Info("Successfully deleted bucket")
+						r.event(ctx, claim, corev1.EventTypeNormal, reasonBucketDeleted,
+							"Deleted bucket %s", bucketName)
 					}
 				}
 			}
-		} else {
-			// Retain policy - keep the bucket
-			log.Info("Retaining bucket per retain policy", 
-				"bucket", claim.Status.BucketName)
+		} else if err := r.recordRetainedBucket(ctx, claim); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		// Outputs in other namespaces are not garbage-collected with the claim
+		if err := r.deleteForeignOutputs(ctx, claim); err != nil {
+			log.Error(err, "Failed to delete outputs in other namespaces")
+			return ctrl.Result{}, err
 		}
 
 		// Remove finalizer
@@ -316,122 +831,177 @@ func (r *QuObjectBucketClaimReconciler) handleDeletion(
 		if err := r.Update(ctx, claim); err != nil {
 			return ctrl.Result{}, err
 		}
+		r.Throttle.Forget(claim)
+		forgetClaimSecrets(claim)
 	}
 
 	return ctrl.Result{}, nil
 }
 
-// deleteBucket deletes an S3 bucket (must be empty)
-func deleteBucket(ctx context.Context, s3c *s3.Client, bucket string) error {
-	// First, delete all objects in the bucket
-	// List objects
-	listResp, err := s3c.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
-		Bucket: aws.String(bucket),
-	})
-	if err != nil {
-		return fmt.Errorf("failed to list objects: %w", err)
+// recordRetainedBucket names the bucket kept for a deleted claim in an Event,
+// a final BucketRetained condition and the log, so that retained buckets can
+// be found and cleaned up after the claim is gone
+func (r *QuObjectBucketClaimReconciler) recordRetainedBucket(
+	ctx context.Context,
+	claim *quv1.QuObjectBucketClaim,
+) error {
+	bucketName := claim.Annotations[annotationBucketName]
+	if bucketName == "" {
+		bucketName = claim.Status.BucketName
 	}
-
-	// Delete each object
-	for _, obj := range listResp.Contents {
-		_, err := s3c.DeleteObject(ctx, &s3.DeleteObjectInput{
-			Bucket: aws.String(bucket),
-			Key:    obj.Key,
-		})
-		if err != nil {
-			return fmt.Errorf("failed to delete object %s: %w", *obj.Key, err)
-		}
+	// Already recorded by an earlier attempt to remove the finalizer
+	if bucketName == "" || meta.IsStatusConditionTrue(claim.Status.Conditions, quv1.ConditionBucketRetained) {
+		return nil
 	}
+	backendName := claim.Annotations[annotationBackend]
+	// The log line outlives the Event and the claim
+	log.FromContext(ctx).Info("Retaining bucket per retain policy",
+		"bucket", bucketName, "backend", backendName, "claimUID", claim.UID, "retained", true)
+	r.event(ctx, claim, corev1.EventTypeNormal, reasonBucketRetained,
+		"Retained bucket %s on backend %s", bucketName, backendName)
 
-	// Now delete the bucket
-	_, err = s3c.DeleteBucket(ctx, &s3.DeleteBucketInput{
-		Bucket: aws.String(bucket),
+	meta.SetStatusCondition(&claim.Status.Conditions, metav1.Condition{
+		Type:               quv1.ConditionBucketRetained,
+		Status:             metav1.ConditionTrue,
+		Reason:             "RetainPolicy",
+		Message:            fmt.Sprintf("Bucket %s on backend %s is kept after the claim is deleted", bucketName, backendName),
+		ObservedGeneration: claim.Generation,
 	})
-	if err != nil {
-		// Check if bucket doesn't exist (already deleted)
-		if strings.Contains(strings.ToLower(err.Error()), "nosuchbucket") {
-			return nil
-		}
-		return fmt.Errorf("failed to delete bucket: %w", err)
-	}
-
-	return nil
+	return r.Status().Update(ctx, claim)
 }
 
 // SetupWithManager sets up the controller with the Manager
 func (r *QuObjectBucketClaimReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&quv1.QuObjectBucketClaim{}).
+		For(&quv1.QuObjectBucketClaim{}, builder.WithPredicates(predicate.NewPredicateFuncs(r.Shard.Owns))).
 		Owns(&corev1.Secret{}).
 		Owns(&corev1.ConfigMap{}).
+		Watches(&quv1.QuObjectBucketSnapshot{}, handler.EnqueueRequestsFromMapFunc(snapshotClaim)).
+		Watches(&quv1.QuObjectBucketClaimClass{}, handler.EnqueueRequestsFromMapFunc(r.classClaims)).
+		Watches(&quv1.QuObjectBucketClass{}, handler.EnqueueRequestsFromMapFunc(r.bucketClassClaims)).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.backendClaims),
+			builder.WithPredicates(backendKeysChanged)).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(outputClaim),
+			builder.WithPredicates(hasClaimLabels)).
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(outputClaim),
+			builder.WithPredicates(hasClaimLabels)).
+		WithOptions(controller.Options{
+			NewQueue:    newInstrumentedQueue,
+			RateLimiter: r.QueueRateLimiter,
+		}).
 		Complete(r)
 }
 
 // Helper functions
 
-// newS3Client creates a new S3 client with configurable SSL/TLS settings
-func newS3Client(
-	endpoint, region, accessKey, secretKey string,
-	useSSL, insecureSkipVerify, forcePath bool,
-) (*s3.Client, error) {
-	// Configure TLS based on settings
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: insecureSkipVerify,
-		},
-	}
-	hclient := &http.Client{Transport: tr}
-
-	// Ensure endpoint has correct protocol
-	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
-		if useSSL {
-			endpoint = "https://" + endpoint
-		} else {
-			endpoint = "http://" + endpoint
+// Reasons of the BucketReady, CredentialsReady and ConfigMapReady conditions
+const (
+	reasonBucketAvailable    = "BucketAvailable"
+	reasonSecretPublished    = "SecretPublished"
+	reasonCSIProvider        = "CSIProvider"
+	reasonCSIUnsupported     = "CSIUnsupported"
+	reasonConfigMapPublished = "ConfigMapPublished"
+	reasonConnectionSecret   = "ConnectionSecret"
+)
+
+// recordBackend records the backend of the bound bucket in the status, with
+// the storage class it was resolved from. The storage class is only updated
+// when the backend changes, as on first bind or after a migration cut over.
+func recordBackend(claim *quv1.QuObjectBucketClaim, backendName string) {
+	if claim.Status.Backend == backendName {
+		return
+	}
+	claim.Status.Backend = backendName
+	claim.Status.StorageClassName = claim.Spec.StorageClassName
+}
+
+// initStageConditions sets the BucketReady, CredentialsReady and
+// ConfigMapReady conditions a claim does not have yet to False, so that
+// they can be waited for from the start
+func initStageConditions(claim *quv1.QuObjectBucketClaim) {
+	for _, t := range []string{quv1.ConditionBucketReady, quv1.ConditionCredentialsReady, quv1.ConditionConfigMapReady} {
+		if meta.FindStatusCondition(claim.Status.Conditions, t) == nil {
+			setStageCondition(claim, t, false, "Provisioning", "Waiting for the bucket to be provisioned")
 		}
 	}
+}
 
-	cfg, err := config.LoadDefaultConfig(
-		context.TODO(),
-		config.WithRegion(region),
-		config.WithCredentialsProvider(
-			credentials.NewStaticCredentialsProvider(accessKey, secretKey, ""),
-		),
-		config.WithHTTPClient(hclient),
-	)
-	if err != nil {
-		return nil, err
+// setStageCondition sets one of the BucketReady, CredentialsReady and
+// ConfigMapReady conditions
+func setStageCondition(claim *quv1.QuObjectBucketClaim, conditionType string, ready bool, reason, message string) {
+	status := metav1.ConditionFalse
+	if ready {
+		status = metav1.ConditionTrue
 	}
+	meta.SetStatusCondition(&claim.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: claim.Generation,
+	})
+}
 
-	return s3.NewFromConfig(cfg, func(o *s3.Options) {
-		o.BaseEndpoint = aws.String(endpoint)
-		o.UsePathStyle = forcePath
-	}), nil
+// outputFailureReason returns the reason of a failure to write the claim's
+// Secret or ConfigMap
+func outputFailureReason(err error) string {
+	var conflict *nameConflictError
+	switch {
+	case errors.As(err, &conflict):
+		return reasonNameConflict
+	case apierrors.IsForbidden(err):
+		return reasonInsufficientPermissions
+	}
+	return "WriteFailed"
+}
+
+// setReadyCondition sets the Ready condition, which is True only while the
+// claim is Bound
+func setReadyCondition(claim *quv1.QuObjectBucketClaim, reason, message string) {
+	status := metav1.ConditionFalse
+	if claim.Status.Phase == quv1.ClaimPhaseBound {
+		status = metav1.ConditionTrue
+	}
+	meta.SetStatusCondition(&claim.Status.Conditions, metav1.Condition{
+		Type:               quv1.ConditionReady,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: claim.Generation,
+	})
 }
 
-func ensureBucket(ctx context.Context, s3c *s3.Client, bucket, region string) error {
+// ensureBucket creates the bucket unless it exists, and reports whether it
+// was created
+func ensureBucket(
+	ctx context.Context,
+	s3c *s3.Client,
+	bucket string,
+	createCfg *s3types.CreateBucketConfiguration,
+	profile backend.Profile,
+	optFns ...func(*s3.Options),
+) (bool, error) {
 	_, err := s3c.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucket)})
 	if err == nil {
-		return nil
+		return false, nil
 	}
 
 	_, err = s3c.CreateBucket(ctx, &s3.CreateBucketInput{
-		Bucket: aws.String(bucket),
-		CreateBucketConfiguration: &s3types.CreateBucketConfiguration{
-			LocationConstraint: s3types.BucketLocationConstraint(region),
-		},
-	})
+		Bucket:                    aws.String(bucket),
+		CreateBucketConfiguration: createCfg,
+	}, optFns...)
 	if err != nil {
-		l := strings.ToLower(err.Error())
-		if !strings.Contains(l, "bucketalreadyownedbyyou") &&
-			!strings.Contains(l, "bucketalreadyexists") {
-			return err
+		if profile.IsBucketExists(err) {
+			return false, nil
 		}
+		return false, err
 	}
-	return nil
+	return true, nil
 }
 
-func upsertSecret(ctx context.Context, c client.Client, s *corev1.Secret) error {
+// upsertSecret creates or updates a generated Secret. A Secret with the same
+// name that is not controlled by owner is never overwritten.
+func upsertSecret(ctx context.Context, c client.Client, owner metav1.Object, s *corev1.Secret) error {
 	var existing corev1.Secret
 	err := c.Get(ctx, types.NamespacedName{Name: s.Name, Namespace: s.Namespace}, &existing)
 	if apierrors.IsNotFound(err) {
@@ -439,12 +1009,30 @@ func upsertSecret(ctx context.Context, c client.Client, s *corev1.Secret) error
 	} else if err != nil {
 		return err
 	}
+	if err := checkOwnership(owner, &existing, "Secret"); err != nil {
+		return err
+	}
+	if existing.Immutable != nil && *existing.Immutable {
+		if existing.Type == s.Type && equalData(existing.Data, s.StringData) {
+			return nil
+		}
+		// The data of an immutable Secret can only change by recreating it
+		if err := c.Delete(ctx, &existing); err != nil {
+			return err
+		}
+		return c.Create(ctx, s)
+	}
+	existing.Immutable = s.Immutable
+	// Replace rather than merge so keys of a previous output mode disappear
+	existing.Data = nil
 	existing.StringData = s.StringData
 	existing.Type = s.Type
 	return c.Update(ctx, &existing)
 }
 
-func upsertConfigMap(ctx context.Context, c client.Client, m *corev1.ConfigMap) error {
+// upsertConfigMap creates or updates a generated ConfigMap. A ConfigMap with
+// the same name that is not controlled by owner is never overwritten.
+func upsertConfigMap(ctx context.Context, c client.Client, owner metav1.Object, m *corev1.ConfigMap) error {
 	var existing corev1.ConfigMap
 	err := c.Get(ctx, types.NamespacedName{Name: m.Name, Namespace: m.Namespace}, &existing)
 	if apierrors.IsNotFound(err) {
@@ -452,6 +1040,20 @@ func upsertConfigMap(ctx context.Context, c client.Client, m *corev1.ConfigMap)
 	} else if err != nil {
 		return err
 	}
+	if err := checkOwnership(owner, &existing, "ConfigMap"); err != nil {
+		return err
+	}
+	if existing.Immutable != nil && *existing.Immutable {
+		if maps.Equal(existing.Data, m.Data) {
+			return nil
+		}
+		// The data of an immutable ConfigMap can only change by recreating it
+		if err := c.Delete(ctx, &existing); err != nil {
+			return err
+		}
+		return c.Create(ctx, m)
+	}
+	existing.Immutable = m.Immutable
 	existing.Data = m.Data
 	return c.Update(ctx, &existing)
 }
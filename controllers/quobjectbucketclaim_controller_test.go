@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+	"github.com/pamvdam71/quobject-controller/internal/testutil"
+)
+
+// newTestReconciler returns a claim reconciler on a fake API server holding
+// the objects, the default namespace and a default backend secret pointing
+// at srv
+func newTestReconciler(t *testing.T, srv *testutil.S3Server, objs ...client.Object) *QuObjectBucketClaimReconciler {
+	t.Helper()
+	// A CA bundle from the environment cannot be added to the controller's
+	// own HTTP client
+	t.Setenv("AWS_CA_BUNDLE", "")
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := quv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: backend.DefaultSecretName, Namespace: backend.Namespace},
+		StringData: srv.BackendData(),
+	}
+	// The fake client does not convert StringData
+	secret.Data = map[string][]byte{}
+	for k, v := range secret.StringData {
+		secret.Data[k] = []byte(v)
+	}
+	secret.StringData = nil
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithStatusSubresource(&quv1.QuObjectBucketClaim{}, &quv1.QuObjectQuota{}).
+		WithObjects(append(objs, secret, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}})...).
+		Build()
+	return &QuObjectBucketClaimReconciler{
+		Client:        c,
+		Scheme:        scheme,
+		DeleteWorkers: 2,
+		Recorder:      record.NewFakeRecorder(100),
+	}
+}
+
+// newTestS3Client returns a client of the backend the reconciler uses
+func newTestS3Client(t *testing.T, r *QuObjectBucketClaimReconciler) *s3.Client {
+	t.Helper()
+	cfg, err := backend.Load(context.Background(), r.Client, backend.DefaultSecretName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s3c, err := backend.NewS3Client(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s3c
+}
+
+// reconcileUntil reconciles the claim until done returns true for it, and
+// fails the test after too many rounds. done gets nil once the claim is gone.
+func reconcileUntil(
+	t *testing.T,
+	r *QuObjectBucketClaimReconciler,
+	key types.NamespacedName,
+	done func(*quv1.QuObjectBucketClaim) bool,
+) *quv1.QuObjectBucketClaim {
+	t.Helper()
+	ctx := context.Background()
+	for i := 0; i < 20; i++ {
+		claim := &quv1.QuObjectBucketClaim{}
+		if err := r.Get(ctx, key, claim); err != nil {
+			claim = nil
+		}
+		if done(claim) {
+			return claim
+		}
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+			t.Logf("reconcile %d: %v", i, err)
+		}
+	}
+	t.Fatalf("claim %s did not reach the expected state", key)
+	return nil
+}
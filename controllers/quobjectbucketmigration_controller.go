@@ -0,0 +1,393 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+	"github.com/pamvdam71/quobject-controller/internal/logging"
+)
+
+// QuObjectBucketMigrationReconciler moves claims between backends
+type QuObjectBucketMigrationReconciler struct {
+	client.Client
+
+	// DeleteWorkers is the number of parallel workers used to empty the
+	// source bucket before it is deleted
+	DeleteWorkers int
+	// S3RateLimiter throttles all S3 requests made by the controller.
+	// A nil limiter disables rate limiting.
+	S3RateLimiter *rate.Limiter
+	// Recorder emits Events on migrations
+	Recorder record.EventRecorder
+	// Shard selects the migrations reconciled by this replica
+	Shard Sharding
+	// BucketLocks serializes bucket creation by name. Nil disables locking.
+	BucketLocks *BucketLocks
+}
+
+// permanentError stops a migration instead of retrying it
+type permanentError struct{ error }
+
+// errSourceChanged reports objects written or deleted in the source bucket
+// after they were copied
+var errSourceChanged = errors.New("the source bucket changed during the copy")
+
+// maxSyncPasses bounds how often the objects are copied again because the
+// source bucket changed
+const maxSyncPasses = 5
+
+// migrationPartSize is the smallest part size of uploads to the target
+// backend. Up to manager.DefaultUploadConcurrency parts are buffered at once.
+var migrationPartSize = manager.DefaultUploadPartSize
+
+//+kubebuilder:rbac:groups=quobject.io,resources=quobjectbucketmigrations,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=quobject.io,resources=quobjectbucketmigrations/status,verbs=get;update;patch
+
+// Reconcile advances a migration through copying, verification, cutover and
+// cleanup. Every phase is idempotent, so an interrupted phase is repeated.
+func (r *QuObjectBucketMigrationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx).WithValues("migration", req.NamespacedName)
+	ctx = ctrl.LoggerInto(ctx, log)
+
+	mig := &quv1.QuObjectBucketMigration{}
+	if err := r.Get(ctx, req.NamespacedName, mig); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !r.Shard.Owns(mig) {
+		return ctrl.Result{}, nil
+	}
+	if mig.Status.Phase == quv1.MigrationPhaseCompleted || mig.Status.Phase == quv1.MigrationPhaseFailed {
+		return ctrl.Result{}, nil
+	}
+
+	err := r.migrate(ctx, mig)
+	var permanent *permanentError
+	if errors.As(err, &permanent) {
+		log.Error(err, "Migration failed")
+		mig.Status.Phase = quv1.MigrationPhaseFailed
+		mig.Status.Message = logging.Redact(err.Error())
+		r.Recorder.Event(mig, corev1.EventTypeWarning, reasonMigrationFailed, mig.Status.Message)
+		return ctrl.Result{}, r.Status().Update(ctx, mig)
+	} else if err != nil {
+		log.Error(err, "Migration step failed", "phase", mig.Status.Phase)
+		mig.Status.Message = logging.Redact(err.Error())
+		r.Status().Update(ctx, mig)
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// migrate runs the remaining phases of the migration
+func (r *QuObjectBucketMigrationReconciler) migrate(ctx context.Context, mig *quv1.QuObjectBucketMigration) error {
+	claim := &quv1.QuObjectBucketClaim{}
+	key := types.NamespacedName{Name: mig.Spec.ClaimName, Namespace: mig.Namespace}
+	if err := r.Get(ctx, key, claim); err != nil {
+		if apierrors.IsNotFound(err) {
+			return &permanentError{fmt.Errorf("claim %s not found", key.Name)}
+		}
+		return err
+	}
+
+	if mig.Status.Phase == "" {
+		if err := r.start(ctx, mig, claim); err != nil {
+			return err
+		}
+	}
+
+	src, err := r.client(ctx, claim, mig.Status.SourceBackend)
+	if err != nil {
+		return err
+	}
+	dst, err := r.client(ctx, claim, mig.Status.TargetBackend)
+	if err != nil {
+		return err
+	}
+	bucket := mig.Status.BucketName
+
+	for {
+		switch mig.Status.Phase {
+		case quv1.MigrationPhaseCopying:
+			if err := r.copyObjects(ctx, mig, claim, src, dst, bucket); err != nil {
+				return err
+			}
+			r.advance(mig, quv1.MigrationPhaseVerifying, "Comparing objects on both backends")
+		case quv1.MigrationPhaseVerifying:
+			verified, err := verifyObjects(ctx, src, dst, bucket)
+			mig.Status.ObjectsVerified = verified
+			if errors.Is(err, errSourceChanged) {
+				if mig.Status.SyncPasses >= maxSyncPasses {
+					return &permanentError{fmt.Errorf("%w after %d passes, stop writes to the bucket and retry",
+						err, mig.Status.SyncPasses+1)}
+				}
+				// Another pass only copies what changed since the last one
+				mig.Status.SyncPasses++
+				r.advance(mig, quv1.MigrationPhaseCopying, fmt.Sprintf("Copying again: %v", err))
+				break
+			} else if err != nil {
+				return err
+			}
+			r.advance(mig, quv1.MigrationPhaseCutover, "Binding the claim to the target backend")
+		case quv1.MigrationPhaseCutover:
+			// The claim controller rewrites the Secret and ConfigMap for the
+			// backend recorded on the claim
+			claim.Spec.StorageClassName = mig.Spec.TargetStorageClassName
+			claim.Annotations[annotationBackend] = mig.Status.TargetBackend
+			if err := r.Update(ctx, claim); err != nil {
+				return err
+			}
+			if mig.Spec.DeleteSource {
+				r.advance(mig, quv1.MigrationPhaseCleanup, "Deleting the source bucket")
+			} else {
+				r.complete(mig)
+			}
+		case quv1.MigrationPhaseCleanup:
+			if err := deleteBucket(ctx, src, bucket, r.DeleteWorkers, nil); err != nil {
+				return fmt.Errorf("failed to delete source bucket: %w", err)
+			}
+			r.complete(mig)
+		default:
+			return nil
+		}
+		if err := r.Status().Update(ctx, mig); err != nil {
+			return err
+		}
+	}
+}
+
+// start validates the migration and records the backends and bucket
+func (r *QuObjectBucketMigrationReconciler) start(
+	ctx context.Context,
+	mig *quv1.QuObjectBucketMigration,
+	claim *quv1.QuObjectBucketClaim,
+) error {
+	if claim.Status.Phase != quv1.ClaimPhaseBound || claim.Status.BucketName == "" {
+		return fmt.Errorf("claim %s is not bound yet", claim.Name)
+	}
+	if isDirectoryBucket(claim) {
+		return &permanentError{errors.New("directory buckets cannot be migrated")}
+	}
+	source := claim.Annotations[annotationBackend]
+	target, _, err := backend.Resolve(ctx, r.Client, mig.Spec.TargetStorageClassName)
+	if errors.Is(err, backend.ErrNoBackend) {
+		return &permanentError{err}
+	} else if err != nil {
+		return err
+	}
+	if target == source {
+		return &permanentError{fmt.Errorf("claim %s is already served by backend %s", claim.Name, target)}
+	}
+
+	now := metav1.Now()
+	mig.Status.SourceBackend = source
+	mig.Status.TargetBackend = target
+	mig.Status.BucketName = claim.Status.BucketName
+	mig.Status.StartTime = &now
+	r.advance(mig, quv1.MigrationPhaseCopying, fmt.Sprintf("Copying bucket %s from %s to %s",
+		claim.Status.BucketName, source, target))
+	return r.Status().Update(ctx, mig)
+}
+
+// client returns an S3 client for the claim's bucket on the named backend
+func (r *QuObjectBucketMigrationReconciler) client(
+	ctx context.Context,
+	claim *quv1.QuObjectBucketClaim,
+	backendName string,
+) (*s3.Client, error) {
+	cfg, err := backend.Load(ctx, r.Client, backendName)
+	if err != nil {
+		return nil, err
+	}
+	return backend.NewS3Client(cfg.ForRegion(claim.Spec.Region), r.S3RateLimiter)
+}
+
+// advance moves the migration to the next phase
+func (r *QuObjectBucketMigrationReconciler) advance(
+	mig *quv1.QuObjectBucketMigration,
+	phase quv1.MigrationPhase,
+	message string,
+) {
+	mig.Status.Phase = phase
+	mig.Status.Message = message
+	r.Recorder.Event(mig, corev1.EventTypeNormal, string(phase), message)
+}
+
+// complete marks the migration as done
+func (r *QuObjectBucketMigrationReconciler) complete(mig *quv1.QuObjectBucketMigration) {
+	now := metav1.Now()
+	mig.Status.CompletionTime = &now
+	r.advance(mig, quv1.MigrationPhaseCompleted, fmt.Sprintf("Claim %s is served by backend %s",
+		mig.Spec.ClaimName, mig.Status.TargetBackend))
+}
+
+// copyObjects copies every object of the bucket from the source to the
+// target backend. Objects already present on the target with the same size
+// and ETag are skipped, so a restarted copy resumes where it stopped, and
+// objects no longer in the source are removed from the target.
+func (r *QuObjectBucketMigrationReconciler) copyObjects(
+	ctx context.Context,
+	mig *quv1.QuObjectBucketMigration,
+	claim *quv1.QuObjectBucketClaim,
+	src, dst *s3.Client,
+	bucket string,
+) error {
+	targetCfg, err := backend.Load(ctx, r.Client, mig.Status.TargetBackend)
+	if err != nil {
+		return err
+	}
+	targetCfg = targetCfg.ForRegion(claim.Spec.Region)
+	if _, err := r.BucketLocks.ensureBucket(ctx, dst, bucket, createBucketConfiguration(claim, targetCfg),
+		targetCfg.Profile, createBucketOptions(claim, targetCfg)...); err != nil {
+		return fmt.Errorf("failed to ensure target bucket: %w", err)
+	}
+
+	mig.Status.ObjectsCopied, mig.Status.BytesCopied = 0, 0
+	source := map[string]bool{}
+	paginator := s3.NewListObjectsV2Paginator(src, &s3.ListObjectsV2Input{Bucket: aws.String(bucket)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list source objects: %w", err)
+		}
+		for _, obj := range page.Contents {
+			source[aws.ToString(obj.Key)] = true
+			head, err := dst.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: obj.Key})
+			if err != nil || aws.ToInt64(head.ContentLength) != aws.ToInt64(obj.Size) ||
+				!sameETag(aws.ToString(head.ETag), aws.ToString(obj.ETag)) {
+				if err := copyObject(ctx, src, dst, bucket, bucket, aws.ToString(obj.Key), aws.ToInt64(obj.Size)); err != nil {
+					return err
+				}
+			}
+			mig.Status.ObjectsCopied++
+			mig.Status.BytesCopied += aws.ToInt64(obj.Size)
+		}
+		// Publish progress once per page
+		if err := r.Status().Update(ctx, mig); err != nil {
+			return err
+		}
+	}
+
+	paginator = s3.NewListObjectsV2Paginator(dst, &s3.ListObjectsV2Input{Bucket: aws.String(bucket)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list target objects: %w", err)
+		}
+		for _, obj := range page.Contents {
+			if source[aws.ToString(obj.Key)] {
+				continue
+			}
+			if _, err := dst.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: obj.Key}); err != nil {
+				return fmt.Errorf("failed to delete object %s from the target: %w", aws.ToString(obj.Key), err)
+			}
+		}
+	}
+	return nil
+}
+
+// copyObject streams one object of the given size between backends. Objects
+// larger than one part are sent as a multipart upload, so only a few parts
+// are held in memory at a time. The part size grows with the object to stay
+// within the part limit.
+func copyObject(ctx context.Context, src, dst *s3.Client, srcBucket, dstBucket, key string, size int64) error {
+	obj, err := src.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(srcBucket), Key: aws.String(key)})
+	if err != nil {
+		return fmt.Errorf("failed to get object %s: %w", key, err)
+	}
+	defer obj.Body.Close()
+
+	uploader := manager.NewUploader(dst, func(u *manager.Uploader) {
+		u.PartSize = max(migrationPartSize, (size+int64(manager.MaxUploadParts)-1)/int64(manager.MaxUploadParts))
+	})
+	_, err = uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(dstBucket),
+		Key:         aws.String(key),
+		Body:        obj.Body,
+		ContentType: obj.ContentType,
+		Metadata:    obj.Metadata,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put object %s: %w", key, err)
+	}
+	return nil
+}
+
+// verifyObjects checks that the target holds exactly the source's objects
+// with the same sizes and, where comparable, ETags. It returns the number
+// of objects verified.
+func verifyObjects(ctx context.Context, src, dst *s3.Client, bucket string) (int64, error) {
+	type entry struct {
+		size int64
+		etag string
+	}
+	target := map[string]entry{}
+	paginator := s3.NewListObjectsV2Paginator(dst, &s3.ListObjectsV2Input{Bucket: aws.String(bucket)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to list target objects: %w", err)
+		}
+		for _, obj := range page.Contents {
+			target[aws.ToString(obj.Key)] = entry{aws.ToInt64(obj.Size), aws.ToString(obj.ETag)}
+		}
+	}
+
+	var verified int64
+	paginator = s3.NewListObjectsV2Paginator(src, &s3.ListObjectsV2Input{Bucket: aws.String(bucket)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return verified, fmt.Errorf("failed to list source objects: %w", err)
+		}
+		for _, obj := range page.Contents {
+			key := aws.ToString(obj.Key)
+			t, ok := target[key]
+			if !ok || t.size != aws.ToInt64(obj.Size) || !sameETag(t.etag, aws.ToString(obj.ETag)) {
+				return verified, fmt.Errorf("object %s differs on the target backend: %w", key, errSourceChanged)
+			}
+			delete(target, key)
+			verified++
+		}
+	}
+	if len(target) > 0 {
+		return verified, fmt.Errorf("target bucket holds %d objects not in the source: %w", len(target), errSourceChanged)
+	}
+	return verified, nil
+}
+
+// sameETag compares ETags where they are content hashes. Multipart ETags
+// depend on the part size, which backends choose differently, so they
+// always match.
+func sameETag(a, b string) bool {
+	if strings.Contains(a, "-") || strings.Contains(b, "-") {
+		return true
+	}
+	return strings.Trim(a, `"`) == strings.Trim(b, `"`)
+}
+
+// SetupWithManager sets up the controller with the Manager
+func (r *QuObjectBucketMigrationReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&quv1.QuObjectBucketMigration{}, builder.WithPredicates(predicate.NewPredicateFuncs(r.Shard.Owns))).
+		WithOptions(controller.Options{NewQueue: newInstrumentedQueue}).
+		Complete(r)
+}
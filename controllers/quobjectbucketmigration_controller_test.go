@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/pamvdam71/quobject-controller/internal/testutil"
+)
+
+// newTestBackends returns clients for two separate backends
+func newTestBackends(t *testing.T) (src, dst *testutil.S3Server, srcClient, dstClient *s3.Client) {
+	t.Helper()
+	src, dst = testutil.NewS3Server(), testutil.NewS3Server()
+	t.Cleanup(src.Close)
+	t.Cleanup(dst.Close)
+	return src, dst, newTestS3Client(t, newTestReconciler(t, src)), newTestS3Client(t, newTestReconciler(t, dst))
+}
+
+func TestCopyObjectMultipart(t *testing.T) {
+	src, dst, srcClient, dstClient := newTestBackends(t)
+	data := bytes.Repeat([]byte("0123456789"), int(migrationPartSize)/10+1)
+	src.PutObject("bucket", "large", data)
+	dst.PutObject("bucket", "placeholder", nil)
+
+	ctx := context.Background()
+	if err := copyObject(ctx, srcClient, dstClient, "bucket", "bucket", "large", int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	obj, err := dstClient.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String("bucket"), Key: aws.String("large")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obj.Body.Close()
+	got, err := io.ReadAll(obj.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("copied %d bytes, want the %d bytes of the source", len(got), len(data))
+	}
+	if !strings.HasSuffix(aws.ToString(obj.ETag), `-2"`) {
+		t.Errorf("object was not uploaded in 2 parts, ETag %s", aws.ToString(obj.ETag))
+	}
+}
+
+// TestVerifyObjectsSourceChanged checks that objects changed after the copy
+// ask for another copy pass instead of failing the migration
+func TestVerifyObjectsSourceChanged(t *testing.T) {
+	src, dst, srcClient, dstClient := newTestBackends(t)
+	for _, srv := range []*testutil.S3Server{src, dst} {
+		srv.PutObject("bucket", "a", []byte("first"))
+		srv.PutObject("bucket", "b", []byte("first"))
+	}
+
+	ctx := context.Background()
+	if n, err := verifyObjects(ctx, srcClient, dstClient, "bucket"); err != nil || n != 2 {
+		t.Fatalf("verified %d objects, error %v, want 2 and no error", n, err)
+	}
+	src.PutObject("bucket", "b", []byte("second"))
+	_, err := verifyObjects(ctx, srcClient, dstClient, "bucket")
+	var permanent *permanentError
+	if !errors.Is(err, errSourceChanged) || errors.As(err, &permanent) {
+		t.Errorf("got %v for a changed object, want errSourceChanged", err)
+	}
+}
@@ -0,0 +1,215 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+	"github.com/pamvdam71/quobject-controller/internal/logging"
+)
+
+// Snapshot Event reasons
+const (
+	reasonSnapshotReady  = "SnapshotReady"
+	reasonSnapshotFailed = "SnapshotFailed"
+)
+
+// QuObjectBucketSnapshotReconciler takes and deletes bucket snapshots
+type QuObjectBucketSnapshotReconciler struct {
+	client.Client
+
+	// DeleteWorkers is the number of parallel workers used to empty the
+	// snapshot bucket of a deleted snapshot
+	DeleteWorkers int
+	// S3RateLimiter throttles all S3 requests made by the controller.
+	// A nil limiter disables rate limiting.
+	S3RateLimiter *rate.Limiter
+	// Recorder emits Events on snapshots
+	Recorder record.EventRecorder
+	// Shard selects the snapshots reconciled by this replica
+	Shard Sharding
+	// DetachOnly only removes the finalizer of every snapshot, keeping
+	// snapshot buckets, to uninstall the controller safely
+	DetachOnly bool
+}
+
+//+kubebuilder:rbac:groups=quobject.io,resources=quobjectbucketsnapshots,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=quobject.io,resources=quobjectbucketsnapshots/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=quobject.io,resources=quobjectbucketsnapshots/finalizers,verbs=update
+
+// Reconcile copies the claim's objects into the snapshot bucket once and
+// deletes the snapshot bucket with the snapshot
+func (r *QuObjectBucketSnapshotReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx).WithValues("snapshot", req.NamespacedName)
+	ctx = ctrl.LoggerInto(ctx, log)
+
+	snap := &quv1.QuObjectBucketSnapshot{}
+	if err := r.Get(ctx, req.NamespacedName, snap); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !r.Shard.Owns(snap) {
+		return ctrl.Result{}, nil
+	}
+	if r.DetachOnly {
+		return ctrl.Result{}, r.detach(ctx, snap)
+	}
+
+	if !snap.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, r.deleteSnapshot(ctx, snap)
+	}
+	if !controllerutil.ContainsFinalizer(snap, finalizerName) {
+		controllerutil.AddFinalizer(snap, finalizerName)
+		if err := r.Update(ctx, snap); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	if snap.Status.ReadyToUse {
+		return ctrl.Result{}, nil
+	}
+
+	if err := r.takeSnapshot(ctx, snap); err != nil {
+		log.Error(err, "Failed to take snapshot")
+		snap.Status.Message = logging.Redact(err.Error())
+		r.Recorder.Event(snap, corev1.EventTypeWarning, reasonSnapshotFailed, snap.Status.Message)
+		r.Status().Update(ctx, snap)
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// takeSnapshot copies all objects of the claim's bucket into the snapshot
+// bucket. The snapshot bucket is recorded before it is created so a retry
+// never creates a second one.
+func (r *QuObjectBucketSnapshotReconciler) takeSnapshot(ctx context.Context, snap *quv1.QuObjectBucketSnapshot) error {
+	if snap.Status.BucketName == "" {
+		claim := &quv1.QuObjectBucketClaim{}
+		key := types.NamespacedName{Name: snap.Spec.ClaimName, Namespace: snap.Namespace}
+		if err := r.Get(ctx, key, claim); err != nil {
+			return fmt.Errorf("failed to get claim %s: %w", key.Name, err)
+		}
+		if claim.Status.Phase != quv1.ClaimPhaseBound || claim.Status.BucketName == "" {
+			return fmt.Errorf("claim %s is not bound", key.Name)
+		}
+		if isDirectoryBucket(claim) {
+			return fmt.Errorf("directory buckets cannot be snapshotted")
+		}
+		snap.Status.Backend = claim.Annotations[annotationBackend]
+		snap.Status.Region = claim.Spec.Region
+		snap.Status.SourceBucket = claim.Status.BucketName
+		snap.Status.BucketName = snapshotBucketName(snap)
+		if err := r.Status().Update(ctx, snap); err != nil {
+			return err
+		}
+	}
+
+	cfg, s3c, err := r.backendClient(ctx, snap)
+	if err != nil {
+		return err
+	}
+	target := snap.Status.BucketName
+	// Snapshot buckets are always general purpose buckets
+	if _, err := ensureBucket(ctx, s3c, target, createBucketConfiguration(&quv1.QuObjectBucketClaim{}, cfg), cfg.Profile); err != nil {
+		return fmt.Errorf("failed to ensure snapshot bucket %s: %w", target, err)
+	}
+
+	var objects, bytes int64
+	paginator := s3.NewListObjectsV2Paginator(s3c, &s3.ListObjectsV2Input{
+		Bucket: aws.String(snap.Status.SourceBucket),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list objects of %s: %w", snap.Status.SourceBucket, err)
+		}
+		for _, obj := range page.Contents {
+			// A snapshot bucket must never be mistaken for the claim's bucket
+			if isOwnerMarker(aws.ToString(obj.Key)) {
+				continue
+			}
+			err := copyObjectInBackend(ctx, s3c, snap.Status.SourceBucket, target, aws.ToString(obj.Key), aws.ToInt64(obj.Size))
+			if err != nil {
+				return fmt.Errorf("failed to copy object %s: %w", aws.ToString(obj.Key), err)
+			}
+			objects++
+			bytes += aws.ToInt64(obj.Size)
+		}
+	}
+
+	now := metav1.Now()
+	snap.Status.ReadyToUse = true
+	snap.Status.Objects = objects
+	snap.Status.Bytes = bytes
+	snap.Status.CreationTime = &now
+	snap.Status.Message = ""
+	if err := r.Status().Update(ctx, snap); err != nil {
+		return err
+	}
+	r.Recorder.Eventf(snap, corev1.EventTypeNormal, reasonSnapshotReady,
+		"Copied %d objects (%d bytes) of bucket %s into %s", objects, bytes, snap.Status.SourceBucket, target)
+	return nil
+}
+
+// deleteSnapshot deletes the snapshot bucket and releases the snapshot
+func (r *QuObjectBucketSnapshotReconciler) deleteSnapshot(ctx context.Context, snap *quv1.QuObjectBucketSnapshot) error {
+	if !controllerutil.ContainsFinalizer(snap, finalizerName) {
+		return nil
+	}
+	if snap.Status.BucketName != "" {
+		_, s3c, err := r.backendClient(ctx, snap)
+		if err != nil {
+			return err
+		}
+		if err := deleteBucket(ctx, s3c, snap.Status.BucketName, r.DeleteWorkers, nil); err != nil {
+			r.Recorder.Event(snap, corev1.EventTypeWarning, reasonBucketDeletionFailed, logging.Redact(err.Error()))
+			return err
+		}
+	}
+	controllerutil.RemoveFinalizer(snap, finalizerName)
+	return r.Update(ctx, snap)
+}
+
+// backendClient returns an S3 client for the backend holding the snapshot
+func (r *QuObjectBucketSnapshotReconciler) backendClient(
+	ctx context.Context,
+	snap *quv1.QuObjectBucketSnapshot,
+) (backend.Config, *s3.Client, error) {
+	cfg, err := backend.Load(ctx, r.Client, snap.Status.Backend)
+	if err != nil {
+		return backend.Config{}, nil, err
+	}
+	cfg = cfg.ForRegion(snap.Status.Region)
+	s3c, err := backend.NewS3Client(cfg, r.S3RateLimiter)
+	return cfg, s3c, err
+}
+
+// snapshotBucketName derives a unique, valid bucket name for a snapshot
+func snapshotBucketName(snap *quv1.QuObjectBucketSnapshot) string {
+	sum := sha256.Sum256([]byte(snap.UID))
+	return "qsnap-" + hex.EncodeToString(sum[:12])
+}
+
+// SetupWithManager sets up the controller with the Manager
+func (r *QuObjectBucketSnapshotReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&quv1.QuObjectBucketSnapshot{}, builder.WithPredicates(predicate.NewPredicateFuncs(r.Shard.Owns))).
+		WithOptions(controller.Options{NewQueue: newInstrumentedQueue}).
+		Complete(r)
+}
@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+)
+
+// labelSnapshotSchedule marks the snapshots created by a schedule
+const labelSnapshotSchedule = "quobject.io/snapshot-schedule"
+
+// Snapshot schedule Event reasons
+const (
+	reasonSnapshotCreated = "SnapshotCreated"
+	reasonSnapshotPruned  = "SnapshotPruned"
+)
+
+// QuObjectBucketSnapshotScheduleReconciler creates snapshots of a claim on
+// an interval and prunes them according to the schedule's retention
+type QuObjectBucketSnapshotScheduleReconciler struct {
+	client.Client
+
+	// Recorder emits Events on snapshot schedules
+	Recorder record.EventRecorder
+	// Shard selects the schedules reconciled by this replica
+	Shard Sharding
+}
+
+//+kubebuilder:rbac:groups=quobject.io,resources=quobjectbucketsnapshotschedules,verbs=get;list;watch
+//+kubebuilder:rbac:groups=quobject.io,resources=quobjectbucketsnapshotschedules/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=quobject.io,resources=quobjectbucketsnapshots,verbs=create;delete
+
+// Reconcile creates the next snapshot when it is due and prunes snapshots
+// beyond the retention limits
+func (r *QuObjectBucketSnapshotScheduleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx).WithValues("schedule", req.NamespacedName)
+	ctx = ctrl.LoggerInto(ctx, log)
+
+	schedule := &quv1.QuObjectBucketSnapshotSchedule{}
+	if err := r.Get(ctx, req.NamespacedName, schedule); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !r.Shard.Owns(schedule) || !schedule.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+	interval := schedule.Spec.Interval.Duration
+	if interval <= 0 {
+		return ctrl.Result{}, nil
+	}
+
+	var list quv1.QuObjectBucketSnapshotList
+	if err := r.List(ctx, &list, client.InNamespace(schedule.Namespace),
+		client.MatchingLabels{labelSnapshotSchedule: schedule.Name}); err != nil {
+		return ctrl.Result{}, err
+	}
+	snapshots := list.Items
+	// Newest first
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[j].CreationTimestamp.Before(&snapshots[i].CreationTimestamp)
+	})
+
+	now := time.Now()
+	if len(snapshots) == 0 || now.Sub(snapshots[0].CreationTimestamp.Time) >= interval {
+		snap, err := r.createSnapshot(ctx, schedule, now)
+		if err != nil {
+			log.Error(err, "Failed to create snapshot")
+			return ctrl.Result{}, err
+		}
+		snapshots = append([]quv1.QuObjectBucketSnapshot{*snap}, snapshots...)
+		schedule.Status.LastSnapshotName = snap.Name
+		schedule.Status.LastSnapshotTime = &metav1.Time{Time: now}
+	}
+
+	kept, err := r.prune(ctx, schedule, snapshots, now)
+	if err != nil {
+		log.Error(err, "Failed to prune snapshots")
+		return ctrl.Result{}, err
+	}
+
+	schedule.Status.Snapshots = int32(len(kept))
+	schedule.Status.Bytes = 0
+	for _, snap := range kept {
+		if snap.Status.ReadyToUse {
+			schedule.Status.Bytes += snap.Status.Bytes
+		}
+	}
+	if err := r.Status().Update(ctx, schedule); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	next := snapshots[0].CreationTimestamp.Add(interval)
+	if snapshots[0].CreationTimestamp.IsZero() {
+		next = now.Add(interval)
+	}
+	return ctrl.Result{RequeueAfter: max(time.Until(next), time.Second)}, nil
+}
+
+// createSnapshot creates a snapshot of the schedule's claim named after the
+// schedule and the current time
+func (r *QuObjectBucketSnapshotScheduleReconciler) createSnapshot(
+	ctx context.Context,
+	schedule *quv1.QuObjectBucketSnapshotSchedule,
+	now time.Time,
+) (*quv1.QuObjectBucketSnapshot, error) {
+	snap := &quv1.QuObjectBucketSnapshot{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-%d", schedule.Name, now.Unix()),
+			Namespace: schedule.Namespace,
+			Labels:    map[string]string{labelSnapshotSchedule: schedule.Name},
+		},
+		Spec: quv1.QuObjectBucketSnapshotSpec{ClaimName: schedule.Spec.ClaimName},
+	}
+	// Keep the snapshots on the schedule's shard
+	if shard, ok := schedule.Labels[labelShard]; ok {
+		snap.Labels[labelShard] = shard
+	}
+	if err := r.Create(ctx, snap); err != nil {
+		return nil, err
+	}
+	r.Recorder.Eventf(schedule, corev1.EventTypeNormal, reasonSnapshotCreated,
+		"Created snapshot %s of claim %s", snap.Name, schedule.Spec.ClaimName)
+	return snap, nil
+}
+
+// prune deletes the ready snapshots beyond the retention count or older than
+// the maximum age and returns the remaining snapshots. Snapshots still being
+// taken are never pruned. snapshots must be sorted newest first.
+func (r *QuObjectBucketSnapshotScheduleReconciler) prune(
+	ctx context.Context,
+	schedule *quv1.QuObjectBucketSnapshotSchedule,
+	snapshots []quv1.QuObjectBucketSnapshot,
+	now time.Time,
+) ([]quv1.QuObjectBucketSnapshot, error) {
+	retention := schedule.Spec.Retention
+	if retention == nil {
+		return snapshots, nil
+	}
+
+	var kept []quv1.QuObjectBucketSnapshot
+	var ready int32
+	for i := range snapshots {
+		snap := &snapshots[i]
+		if !snap.Status.ReadyToUse || !snap.DeletionTimestamp.IsZero() {
+			kept = append(kept, *snap)
+			continue
+		}
+		ready++
+		expired := retention.MaxAge != nil && snap.Status.CreationTime != nil &&
+			now.Sub(snap.Status.CreationTime.Time) > retention.MaxAge.Duration
+		if (retention.Count == nil || ready <= *retention.Count) && !expired {
+			kept = append(kept, *snap)
+			continue
+		}
+		if err := r.Delete(ctx, snap); client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+		r.Recorder.Eventf(schedule, corev1.EventTypeNormal, reasonSnapshotPruned,
+			"Pruned snapshot %s", snap.Name)
+	}
+	return kept, nil
+}
+
+// snapshotSchedule maps a snapshot to the schedule that created it. Snapshots
+// are labelled rather than owned so they outlive a deleted schedule.
+func snapshotSchedule(_ context.Context, obj client.Object) []reconcile.Request {
+	name, ok := obj.GetLabels()[labelSnapshotSchedule]
+	if !ok {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: name, Namespace: obj.GetNamespace()}}}
+}
+
+// SetupWithManager sets up the controller with the Manager
+func (r *QuObjectBucketSnapshotScheduleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&quv1.QuObjectBucketSnapshotSchedule{}, builder.WithPredicates(predicate.NewPredicateFuncs(r.Shard.Owns))).
+		Watches(&quv1.QuObjectBucketSnapshot{}, handler.EnqueueRequestsFromMapFunc(snapshotSchedule)).
+		WithOptions(controller.Options{NewQueue: newInstrumentedQueue}).
+		Complete(r)
+}
@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+)
+
+// QuObjectQuotaReconciler accounts the claims of a namespace in the status
+// of its QuObjectQuotas. The quotas are enforced by the validating webhook
+// and by the claim reconciler before a bucket is created.
+type QuObjectQuotaReconciler struct {
+	client.Client
+
+	// Shard selects the quotas reconciled by this replica
+	Shard Sharding
+}
+
+//+kubebuilder:rbac:groups=quobject.io,resources=quobjectquotas,verbs=get;list;watch
+//+kubebuilder:rbac:groups=quobject.io,resources=quobjectquotas/status,verbs=get;update;patch
+
+// Reconcile records the limits of the quota and what the claims of its
+// namespace count against them
+func (r *QuObjectQuotaReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx).WithValues("quota", req.NamespacedName)
+
+	quota := &quv1.QuObjectQuota{}
+	if err := r.Get(ctx, req.NamespacedName, quota); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !r.Shard.Owns(quota) || !quota.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	var claims quv1.QuObjectBucketClaimList
+	if err := r.List(ctx, &claims, client.InNamespace(quota.Namespace)); err != nil {
+		return ctrl.Result{}, err
+	}
+	usage := quv1.QuotaUsage(claims.Items)
+	status := quv1.QuObjectQuotaStatus{
+		Hard: quota.Spec.Hard.DeepCopy(),
+		Used: corev1.ResourceList{},
+	}
+	// Like a ResourceQuota, only the limited resources are reported
+	for name := range quota.Spec.Hard {
+		if used, ok := usage[name]; ok {
+			status.Used[name] = used
+		}
+	}
+	if equality.Semantic.DeepEqual(quota.Status, status) {
+		return ctrl.Result{}, nil
+	}
+	quota.Status = status
+	if err := r.Status().Update(ctx, quota); err != nil {
+		return ctrl.Result{}, err
+	}
+	log.V(1).Info("Updated quota usage", "used", status.Used)
+	return ctrl.Result{}, nil
+}
+
+// namespaceQuotas maps a claim to the quotas of its namespace
+func (r *QuObjectQuotaReconciler) namespaceQuotas(ctx context.Context, obj client.Object) []reconcile.Request {
+	var quotas quv1.QuObjectQuotaList
+	if err := r.List(ctx, &quotas, client.InNamespace(obj.GetNamespace())); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list quotas", "namespace", obj.GetNamespace())
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(quotas.Items))
+	for _, quota := range quotas.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+			Namespace: quota.Namespace,
+			Name:      quota.Name,
+		}})
+	}
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager. Only spec
+// changes, creations and deletions of claims change the usage.
+func (r *QuObjectQuotaReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&quv1.QuObjectQuota{}, builder.WithPredicates(predicate.NewPredicateFuncs(r.Shard.Owns))).
+		Watches(&quv1.QuObjectBucketClaim{}, handler.EnqueueRequestsFromMapFunc(r.namespaceQuotas),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		WithOptions(controller.Options{NewQueue: newInstrumentedQueue}).
+		Complete(r)
+}
@@ -0,0 +1,213 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+	"github.com/pamvdam71/quobject-controller/internal/logging"
+)
+
+const quobyteUserSid = managedSidPrefix + "QuobyteUser"
+
+// quobyteUserName returns the Quobyte user of the claim. The UID keeps the
+// name unique when a claim is recreated with the same name.
+func quobyteUserName(claim *quv1.QuObjectBucketClaim) string {
+	return "quobject-" + string(claim.UID)
+}
+
+// usesQuobyteUser reports whether the claim publishes the keys of its own
+// Quobyte user. Temporary credentials are issued by STS as elsewhere.
+func usesQuobyteUser(claim *quv1.QuObjectBucketClaim, cfg backend.Config) bool {
+	return cfg.Quobyte.Enabled() && !isTemporaryCredentials(claim)
+}
+
+// quobyteCredentials returns the access keys of the claim's Quobyte user.
+// The keys in the claim's Secret are reused if they were issued to that
+// user on the same backend; otherwise the user is created if needed and
+// issued a new key pair. The user on a backend the claim moved away from
+// is deleted.
+func (r *QuObjectBucketClaimReconciler) quobyteCredentials(
+	ctx context.Context,
+	claim *quv1.QuObjectBucketClaim,
+	backendName string,
+	cfg backend.Config,
+) (claimCredentials, error) {
+	user := quobyteUserName(claim)
+	issued := &quv1.CredentialsUserStatus{Backend: backendName, Name: user}
+	// The Secret of a claim created before the API was configured holds the
+	// backend's keys, one of a formerly temporary claim STS credentials, and
+	// one of a migrated claim the keys of another backend, which are all
+	// replaced
+	if creds, ok := r.publishedCredentials(ctx, claim); ok && issuedTo(claim, creds, cfg, backendName, user) {
+		if !rotationRequested(claim) {
+			return claimCredentials{AccessKey: creds.AccessKey, SecretKey: creds.SecretKey, User: issued}, nil
+		}
+		// Recreating the user revokes its previous keys
+		if err := r.deleteQuobyteUser(ctx, claim, cfg); err != nil {
+			return claimCredentials{}, err
+		}
+	}
+	if err := r.revokeMovedUser(ctx, claim, backendName); err != nil {
+		return claimCredentials{}, err
+	}
+
+	if err := backend.CreateQuobyteUser(ctx, cfg, r.S3RateLimiter, user); err != nil {
+		return claimCredentials{}, fmt.Errorf("failed to create Quobyte user %s: %w", user, err)
+	}
+	key, err := backend.CreateQuobyteAccessKey(ctx, cfg, r.S3RateLimiter, user)
+	if err != nil {
+		return claimCredentials{}, fmt.Errorf("failed to create access key for Quobyte user %s: %w", user, err)
+	}
+	logging.SetSecrets(claimSecretsOwner(claim), time.Time{}, key.AccessKeyID, key.SecretAccessKey)
+	return claimCredentials{AccessKey: key.AccessKeyID, SecretKey: key.SecretAccessKey, User: issued}, nil
+}
+
+// quobyteStatements returns the bucket policy statements granting the
+// claim's Quobyte user access to the bucket
+func quobyteStatements(claim *quv1.QuObjectBucketClaim, cfg backend.Config, bucket string) []policyStatement {
+	if !usesQuobyteUser(claim, cfg) {
+		return nil
+	}
+	return []policyStatement{{
+		Sid:       quobyteUserSid,
+		Effect:    "Allow",
+		Principal: map[string][]string{"AWS": {"arn:aws:iam:::user/" + quobyteUserName(claim)}},
+		Action:    []string{"s3:*"},
+		Resource:  []string{bucketARN(bucket), bucketARN(bucket, "*")},
+	}}
+}
+
+// deleteQuobyteUser revokes the claim's credentials by deleting its Quobyte
+// user with all its access keys
+func (r *QuObjectBucketClaimReconciler) deleteQuobyteUser(
+	ctx context.Context,
+	claim *quv1.QuObjectBucketClaim,
+	cfg backend.Config,
+) error {
+	if !cfg.Quobyte.Enabled() {
+		return nil
+	}
+	user := quobyteUserName(claim)
+	if err := backend.DeleteQuobyteUser(ctx, cfg, r.S3RateLimiter, user); err != nil {
+		return fmt.Errorf("failed to delete Quobyte user %s: %w", user, err)
+	}
+	return nil
+}
+
+// quobytePolicyRuleName returns the policy rule applying the claim's
+// quobyte.io/policy-preset to its volume
+func quobytePolicyRuleName(claim *quv1.QuObjectBucketClaim) string {
+	return "quobject-" + string(claim.UID)
+}
+
+// syncQuobyteVolume applies the Quobyte keys of spec.additionalConfig to
+// the volume backing the bucket and records the result in the status. As
+// for syncBackendQuota, settings are only sent when they differ from the
+// ones recorded. Invalid keys and backends without the Quobyte management
+// API only fail the QuobyteConfigApplied condition, not the claim.
+func (r *QuObjectBucketClaimReconciler) syncQuobyteVolume(
+	ctx context.Context,
+	claim *quv1.QuObjectBucketClaim,
+	cfg backend.Config,
+	bucket string,
+) error {
+	desired, _, err := backend.ParseQuobyteConfig(claim.Spec.AdditionalConfig)
+	if err != nil {
+		setStageCondition(claim, quv1.ConditionQuobyteConfigApplied, false, "InvalidConfig",
+			strings.ReplaceAll(err.Error(), "\n", "; "))
+		return nil
+	}
+	current := claim.Status.Quobyte
+	if current == nil {
+		current = &quv1.QuobyteVolumeStatus{}
+	}
+	if desired.IsZero() && claim.Status.Quobyte == nil {
+		meta.RemoveStatusCondition(&claim.Status.Conditions, quv1.ConditionQuobyteConfigApplied)
+		return nil
+	}
+	if !cfg.Quobyte.Enabled() {
+		setStageCondition(claim, quv1.ConditionQuobyteConfigApplied, false, "QuobyteAPIUnavailable",
+			"The backend does not configure the Quobyte management API, so the quobyte.io keys are not applied")
+		return nil
+	}
+
+	applied := current.DeepCopy()
+	fail := func(err error) error {
+		setStageCondition(claim, quv1.ConditionQuobyteConfigApplied, false, "ApplyFailed", err.Error())
+		return err
+	}
+	if applied.VolumeUUID == "" {
+		volume, err := backend.ResolveQuobyteVolume(ctx, cfg, r.S3RateLimiter, bucket)
+		if err != nil {
+			return fail(fmt.Errorf("failed to resolve the Quobyte volume of bucket %s: %w", bucket, err))
+		}
+		applied.VolumeUUID = volume
+	}
+
+	var currentQuota int64
+	if current.Quota != nil {
+		currentQuota = current.Quota.Value()
+	}
+	if desired.Quota != currentQuota || desired.FileQuota != current.FileQuota {
+		if err := backend.SetQuobyteVolumeQuota(ctx, cfg, r.S3RateLimiter,
+			applied.VolumeUUID, desired.Quota, desired.FileQuota); err != nil {
+			return fail(fmt.Errorf("failed to set the Quobyte volume quota: %w", err))
+		}
+		applied.Quota = nil
+		if desired.Quota > 0 {
+			applied.Quota = resource.NewQuantity(desired.Quota, resource.BinarySI)
+		}
+		applied.FileQuota = desired.FileQuota
+	}
+
+	if desired.PolicyPreset != current.PolicyPreset {
+		rule := quobytePolicyRuleName(claim)
+		if desired.PolicyPreset != "" {
+			if _, err := backend.ApplyQuobytePolicyPreset(ctx, cfg, r.S3RateLimiter,
+				rule, applied.VolumeUUID, desired.PolicyPreset); err != nil {
+				return fail(fmt.Errorf("failed to apply Quobyte policy preset %s: %w", desired.PolicyPreset, err))
+			}
+			applied.PolicyRule = rule
+		} else {
+			if err := backend.DeleteQuobytePolicyRule(ctx, cfg, r.S3RateLimiter, rule); err != nil {
+				return fail(fmt.Errorf("failed to delete Quobyte policy rule %s: %w", rule, err))
+			}
+			applied.PolicyRule = ""
+		}
+		applied.PolicyPreset = desired.PolicyPreset
+	}
+
+	if desired.IsZero() {
+		claim.Status.Quobyte = nil
+		meta.RemoveStatusCondition(&claim.Status.Conditions, quv1.ConditionQuobyteConfigApplied)
+		return nil
+	}
+	claim.Status.Quobyte = applied
+	setStageCondition(claim, quv1.ConditionQuobyteConfigApplied, true, "Applied",
+		fmt.Sprintf("The quobyte.io keys are applied to volume %s", applied.VolumeUUID))
+	return nil
+}
+
+// deleteQuobytePolicyRule deletes the policy rule applying the claim's
+// policy preset, if it has one. The volume's quota goes with the volume.
+func (r *QuObjectBucketClaimReconciler) deleteQuobytePolicyRule(
+	ctx context.Context,
+	claim *quv1.QuObjectBucketClaim,
+	cfg backend.Config,
+) error {
+	if claim.Status.Quobyte == nil || claim.Status.Quobyte.PolicyRule == "" || !cfg.Quobyte.Enabled() {
+		return nil
+	}
+	rule := claim.Status.Quobyte.PolicyRule
+	if err := backend.DeleteQuobytePolicyRule(ctx, cfg, r.S3RateLimiter, rule); err != nil {
+		return fmt.Errorf("failed to delete Quobyte policy rule %s: %w", rule, err)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+)
+
+const quotaDenySid = managedSidPrefix + "QuotaDenyWrites"
+
+const reasonNamespaceQuotaExceeded = "NamespaceQuotaExceeded"
+
+// namespaceQuotaError is returned when a QuObjectQuota of the claim's
+// namespace does not admit the claim's bucket
+type namespaceQuotaError struct {
+	err error
+}
+
+func (e *namespaceQuotaError) Error() string {
+	return e.err.Error()
+}
+
+func (e *namespaceQuotaError) Unwrap() error {
+	return e.err
+}
+
+// checkNamespaceQuotas verifies that the QuObjectQuotas of the claim's
+// namespace admit a claim that is not bound to a bucket yet. The validating
+// webhook checks this too, but concurrent claims can each pass it, so the
+// controller counts the claim as new next to all others of the namespace.
+// Bound claims keep their buckets.
+func (r *QuObjectBucketClaimReconciler) checkNamespaceQuotas(ctx context.Context, claim *quv1.QuObjectBucketClaim) error {
+	if claim.Status.BucketName != "" {
+		return nil
+	}
+	var quotas quv1.QuObjectQuotaList
+	// Clusters without the QuObjectQuota CRD have no quotas
+	if err := r.List(ctx, &quotas, client.InNamespace(claim.Namespace)); meta.IsNoMatchError(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to list quotas: %w", err)
+	}
+	if len(quotas.Items) == 0 {
+		return nil
+	}
+	var claims quv1.QuObjectBucketClaimList
+	if err := r.List(ctx, &claims, client.InNamespace(claim.Namespace)); err != nil {
+		return fmt.Errorf("failed to list claims: %w", err)
+	}
+	others := slices.DeleteFunc(claims.Items, func(c quv1.QuObjectBucketClaim) bool {
+		return c.Name == claim.Name
+	})
+	for i := range quotas.Items {
+		if err := quv1.CheckQuota(&quotas.Items[i], others, nil, claim); err != nil {
+			return &namespaceQuotaError{err: err}
+		}
+	}
+	return nil
+}
+
+// quotaExceeded reports whether the measured usage of the claim is above
+// its requested capacity
+func quotaExceeded(claim *quv1.QuObjectBucketClaim) bool {
+	size := quv1.StorageRequest(claim)
+	if size == nil || claim.Status.Usage == nil {
+		return false
+	}
+	return claim.Status.Usage.Bytes > size.Value()
+}
+
+// quotaStatements returns the bucket policy statements enforcing the quota
+func quotaStatements(claim *quv1.QuObjectBucketClaim, bucket string) []policyStatement {
+	// Directory bucket policies use the s3express action namespace and
+	// session-based authorization, which the deny-writes policy doesn't cover
+	if !quotaExceeded(claim) || isDirectoryBucket(claim) {
+		return nil
+	}
+	return []policyStatement{{
+		Sid:       quotaDenySid,
+		Effect:    "Deny",
+		Principal: "*",
+		Action:    []string{"s3:PutObject"},
+		Resource:  []string{bucketARN(bucket, "*")},
+	}}
+}
+
+// syncBackendQuota sets the requested capacity as the bucket's quota on
+// backends with the MinIO admin API, which then rejects writes beyond it
+// itself. The quota is only sent when the capacity recorded in the status
+// differs, so it must run before setCapacity.
+func (r *QuObjectBucketClaimReconciler) syncBackendQuota(
+	ctx context.Context,
+	claim *quv1.QuObjectBucketClaim,
+	cfg backend.Config,
+	bucket string,
+) error {
+	if !cfg.Profile.MinIOAdmin || isDirectoryBucket(claim) {
+		return nil
+	}
+	var size int64
+	if q := quv1.StorageRequest(claim); q != nil {
+		size = q.Value()
+	}
+	var granted int64
+	if q, ok := claim.Status.Capacity[corev1.ResourceStorage]; ok {
+		granted = q.Value()
+	}
+	if size == granted {
+		return nil
+	}
+	if err := backend.SetBucketQuota(ctx, cfg, r.S3RateLimiter, bucket, size); err != nil {
+		return fmt.Errorf("failed to set the bucket quota: %w", err)
+	}
+	return nil
+}
+
+// setCapacity mirrors the requested capacity and the measured usage into
+// the PVC-style capacity fields of the status
+func setCapacity(claim *quv1.QuObjectBucketClaim) {
+	claim.Status.Capacity = nil
+	if size := quv1.StorageRequest(claim); size != nil {
+		claim.Status.Capacity = corev1.ResourceList{corev1.ResourceStorage: *size}
+	}
+	claim.Status.Used = nil
+	if usage := claim.Status.Usage; usage != nil {
+		claim.Status.Used = corev1.ResourceList{
+			corev1.ResourceStorage: *resource.NewQuantity(usage.Bytes, resource.BinarySI),
+		}
+	}
+}
+
+// setQuotaCondition records the quota enforcement state on the claim
+func setQuotaCondition(claim *quv1.QuObjectBucketClaim) {
+	size := quv1.StorageRequest(claim)
+	if size == nil {
+		meta.RemoveStatusCondition(&claim.Status.Conditions, quv1.ConditionQuotaExceeded)
+		return
+	}
+
+	cond := metav1.Condition{
+		Type:               quv1.ConditionQuotaExceeded,
+		Status:             metav1.ConditionFalse,
+		Reason:             "WithinQuota",
+		Message:            fmt.Sprintf("Usage is within the quota of %s", size.String()),
+		ObservedGeneration: claim.Generation,
+	}
+	if claim.Status.Usage == nil {
+		cond.Status = metav1.ConditionUnknown
+		cond.Reason = "UsageUnknown"
+		cond.Message = "Bucket usage has not been measured yet"
+	} else if quotaExceeded(claim) {
+		used := resource.NewQuantity(claim.Status.Usage.Bytes, resource.BinarySI)
+		cond.Status = metav1.ConditionTrue
+		cond.Reason = "WritesDenied"
+		cond.Message = fmt.Sprintf(
+			"Usage of %s exceeds the quota of %s; writes are denied by bucket policy",
+			used.String(), size.String(),
+		)
+	}
+	meta.SetStatusCondition(&claim.Status.Conditions, cond)
+}
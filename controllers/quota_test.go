@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/testutil"
+)
+
+func storageClaim(name, storage string) *quv1.QuObjectBucketClaim {
+	return &quv1.QuObjectBucketClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: quv1.QuObjectBucketClaimSpec{
+			BucketName: name,
+			Resources: &quv1.BucketResources{Requests: corev1.ResourceList{
+				corev1.ResourceStorage: resource.MustParse(storage),
+			}},
+		},
+	}
+}
+
+// TestNamespaceQuota provisions two claims that each passed admission but
+// together exceed the quota of their namespace
+func TestNamespaceQuota(t *testing.T) {
+	srv := testutil.NewS3Server()
+	defer srv.Close()
+	quota := &quv1.QuObjectQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "storage", Namespace: "default"},
+		Spec: quv1.QuObjectQuotaSpec{Hard: corev1.ResourceList{
+			corev1.ResourceRequestsStorage: resource.MustParse("15Gi"),
+			quv1.ResourceClaims:            resource.MustParse("5"),
+		}},
+	}
+	first, second := storageClaim("first", "10Gi"), storageClaim("second", "10Gi")
+	r := newTestReconciler(t, srv, quota, first)
+
+	reconcileUntil(t, r, client.ObjectKeyFromObject(first), func(c *quv1.QuObjectBucketClaim) bool {
+		return c != nil && c.Status.Phase == quv1.ClaimPhaseBound
+	})
+	ctx := context.Background()
+	if err := r.Create(ctx, second); err != nil {
+		t.Fatal(err)
+	}
+	got := reconcileUntil(t, r, client.ObjectKeyFromObject(second), func(c *quv1.QuObjectBucketClaim) bool {
+		return c != nil && c.Status.Phase == quv1.ClaimPhaseError
+	})
+	cond := meta.FindStatusCondition(got.Status.Conditions, quv1.ConditionProvisioningError)
+	if cond == nil || cond.Reason != reasonNamespaceQuotaExceeded {
+		t.Fatalf("ProvisioningError condition %+v, want reason %s", cond, reasonNamespaceQuotaExceeded)
+	}
+	if srv.BucketExists("second") {
+		t.Error("bucket beyond the namespace quota was created")
+	}
+
+	quotas := &QuObjectQuotaReconciler{Client: r.Client}
+	if _, err := quotas.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(quota)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(quota), quota); err != nil {
+		t.Fatal(err)
+	}
+	used := quota.Status.Used[corev1.ResourceRequestsStorage]
+	claims := quota.Status.Used[quv1.ResourceClaims]
+	if used.Cmp(resource.MustParse("20Gi")) != 0 || claims.Value() != 2 {
+		t.Errorf("quota status used %v, want 20Gi of storage and 2 claims", quota.Status.Used)
+	}
+
+	// Lowering the request of the bound claim frees capacity
+	bound := &quv1.QuObjectBucketClaim{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(first), bound); err != nil {
+		t.Fatal(err)
+	}
+	bound.Spec.Resources.Requests[corev1.ResourceStorage] = resource.MustParse("5Gi")
+	if err := r.Update(ctx, bound); err != nil {
+		t.Fatal(err)
+	}
+	reconcileUntil(t, r, client.ObjectKeyFromObject(second), func(c *quv1.QuObjectBucketClaim) bool {
+		return c != nil && c.Status.Phase == quv1.ClaimPhaseBound
+	})
+}
+
+func TestCheckQuota(t *testing.T) {
+	quota := &quv1.QuObjectQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "storage"},
+		Spec: quv1.QuObjectQuotaSpec{Hard: corev1.ResourceList{
+			corev1.ResourceRequestsStorage: resource.MustParse("15Gi"),
+			quv1.ResourceClaims:            resource.MustParse("2"),
+		}},
+	}
+	others := []quv1.QuObjectBucketClaim{*storageClaim("a", "10Gi")}
+	unlimited := storageClaim("c", "1Gi")
+	unlimited.Spec.Resources = nil
+
+	for _, tc := range []struct {
+		name   string
+		others []quv1.QuObjectBucketClaim
+		old    *quv1.QuObjectBucketClaim
+		claim  *quv1.QuObjectBucketClaim
+		denied bool
+	}{
+		{"new claim within the limits", others, nil, storageClaim("b", "5Gi"), false},
+		{"new claim beyond the storage limit", others, nil, storageClaim("b", "6Gi"), true},
+		{"new claim beyond the claim limit", append(others, *storageClaim("b", "1Gi")), nil, storageClaim("c", "1Gi"), true},
+		{"new claim without a storage request", others, nil, unlimited, true},
+		{"larger request beyond the limit", others, storageClaim("b", "5Gi"), storageClaim("b", "6Gi"), true},
+		{"unchanged request above a lowered limit", append(others, *storageClaim("b", "1Gi")),
+			storageClaim("c", "10Gi"), storageClaim("c", "10Gi"), false},
+		{"smaller request above a lowered limit", others, storageClaim("b", "10Gi"), storageClaim("b", "8Gi"), false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := quv1.CheckQuota(quota, tc.others, tc.old, tc.claim)
+			if denied := err != nil; denied != tc.denied {
+				t.Errorf("CheckQuota: got %v, want denied %v", err, tc.denied)
+			}
+		})
+	}
+}
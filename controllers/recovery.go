@@ -0,0 +1,199 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+)
+
+// annotationRecoveredFrom is set on a recreated claim to the UID of the
+// claim named by the bucket's ownership marker
+const annotationRecoveredFrom = "quobject.io/recovered-from"
+
+// ClaimRecovery rebuilds the claims of a lost cluster from the ownership
+// markers in the backends' buckets. It runs once when the manager starts and
+// creates every missing claim with an explicit bucketName, so the claim
+// reconciler adopts the bucket and regenerates its Secret and ConfigMap.
+type ClaimRecovery struct {
+	Client client.Client
+	// S3RateLimiter throttles the requests to the backends.
+	// A nil limiter disables rate limiting.
+	S3RateLimiter *rate.Limiter
+	// Shard selects the claims recreated by this replica
+	Shard Sharding
+}
+
+// NeedLeaderElection makes only the leader recreate claims
+func (c *ClaimRecovery) NeedLeaderElection() bool {
+	return true
+}
+
+// Start scans all backends once. A failing backend is logged and skipped so
+// that the others are still recovered.
+func (c *ClaimRecovery) Start(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("recovery")
+
+	var secrets corev1.SecretList
+	if err := c.Client.List(ctx, &secrets, client.InNamespace(backend.Namespace)); err != nil {
+		return fmt.Errorf("failed to list backend secrets: %w", err)
+	}
+	var classes quv1.QuObjectBucketClassList
+	if err := c.Client.List(ctx, &classes); err != nil {
+		return fmt.Errorf("failed to list bucket classes: %w", err)
+	}
+	var backends []string
+	for i := range secrets.Items {
+		if name := secrets.Items[i].Name; backend.IsSecretName(name) {
+			backends = append(backends, name)
+		}
+	}
+	for i := range classes.Items {
+		backends = append(backends, backend.BackendNameForClass(classes.Items[i].Name))
+	}
+	var recovered int
+	for _, name := range backends {
+		n, err := c.recoverBackend(ctx, name)
+		recovered += n
+		if err != nil {
+			log.Error(err, "Failed to recover claims", "backend", name)
+		}
+	}
+	log.Info("Claim recovery finished", "recovered", recovered)
+	return nil
+}
+
+// recoverBackend recreates the missing claims of one backend's buckets and
+// returns how many were created
+func (c *ClaimRecovery) recoverBackend(ctx context.Context, backendName string) (int, error) {
+	log := log.FromContext(ctx).WithName("recovery").WithValues("backend", backendName)
+
+	cfg, err := backend.Load(ctx, c.Client, backendName)
+	if err != nil {
+		return 0, err
+	}
+	s3c, err := backend.NewS3Client(cfg, c.S3RateLimiter)
+	if err != nil {
+		return 0, err
+	}
+	out, err := s3c.ListBuckets(ctx, &s3.ListBucketsInput{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list buckets: %w", err)
+	}
+
+	var recovered int
+	for _, b := range out.Buckets {
+		bucket := aws.ToString(b.Name)
+		marker, err := readOwnerMarker(ctx, s3c, bucket)
+		if err != nil {
+			log.Error(err, "Failed to read ownership marker", "bucket", bucket)
+			continue
+		}
+		if marker == nil {
+			continue
+		}
+		if !marker.synced {
+			log.Info("Ownership marker was not written by a controller keeping it in sync, its spec may be outdated",
+				"bucket", bucket, "claim", types.NamespacedName{Namespace: marker.Namespace, Name: marker.Name})
+		}
+		created, err := c.recoverClaim(ctx, backendName, bucket, marker)
+		if err != nil {
+			log.Error(err, "Failed to recover claim", "bucket", bucket,
+				"claim", types.NamespacedName{Namespace: marker.Namespace, Name: marker.Name})
+			continue
+		}
+		if created {
+			log.Info("Recovered claim", "bucket", bucket,
+				"claim", types.NamespacedName{Namespace: marker.Namespace, Name: marker.Name})
+			recovered++
+		}
+	}
+	return recovered, nil
+}
+
+// recoverClaim creates the claim named by a marker unless a claim of that
+// name exists
+func (c *ClaimRecovery) recoverClaim(
+	ctx context.Context,
+	backendName, bucket string,
+	marker *ownerMarker,
+) (bool, error) {
+	claim := &quv1.QuObjectBucketClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      marker.Name,
+			Namespace: marker.Namespace,
+			Labels:    marker.Labels,
+			Annotations: map[string]string{
+				annotationBackend:       backendName,
+				annotationRecoveredFrom: marker.UID,
+			},
+		},
+		Spec: marker.Spec,
+	}
+	// The bucket already holds the data, which must not be cloned again
+	claim.Spec.BucketName = bucket
+	claim.Spec.DataSource = nil
+	if !c.Shard.Owns(claim) {
+		return false, nil
+	}
+
+	err := c.Client.Get(ctx, client.ObjectKeyFromObject(claim), &quv1.QuObjectBucketClaim{})
+	if err == nil {
+		return false, nil
+	} else if !apierrors.IsNotFound(err) {
+		return false, err
+	}
+	if err := c.Client.Create(ctx, claim); err != nil {
+		if apierrors.IsAlreadyExists(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// readOwnerMarker returns the ownership marker of a bucket, or nil if the
+// bucket has none. The marker is marked synced if its content hash matches,
+// i.e. it was rewritten with every change of the claim's spec.
+func readOwnerMarker(ctx context.Context, s3c *s3.Client, bucket string) (*ownerMarker, error) {
+	obj, err := s3c.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(backend.OwnerMarkerKey),
+	})
+	var noSuchKey *s3types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer obj.Body.Close()
+	body, err := io.ReadAll(obj.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	marker := &ownerMarker{}
+	if err := json.Unmarshal(body, marker); err != nil {
+		return nil, fmt.Errorf("malformed ownership marker: %w", err)
+	}
+	marker.synced = obj.Metadata[ownerMarkerHashKey] == ownerMarkerHash(body)
+	if marker.Namespace == "" || marker.Name == "" {
+		return nil, errors.New("ownership marker names no claim")
+	}
+	return marker, nil
+}
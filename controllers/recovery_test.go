@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+	"github.com/pamvdam71/quobject-controller/internal/testutil"
+)
+
+// TestRecoverClaimCurrentSpec recovers a claim whose spec changed after its
+// bucket was created, and expects the recovered claim to have the new spec
+func TestRecoverClaimCurrentSpec(t *testing.T) {
+	srv := testutil.NewS3Server()
+	defer srv.Close()
+	claim := &quv1.QuObjectBucketClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", UID: "uid-app"},
+		Spec:       quv1.QuObjectBucketClaimSpec{BucketName: "data"},
+	}
+	r := newTestReconciler(t, srv, claim)
+	key := client.ObjectKeyFromObject(claim)
+	reconcileUntil(t, r, key, func(c *quv1.QuObjectBucketClaim) bool {
+		return c.Status.Phase == quv1.ClaimPhaseBound
+	})
+
+	ctx := context.Background()
+	if err := r.Get(ctx, key, claim); err != nil {
+		t.Fatal(err)
+	}
+	claim.Spec.RetainPolicy = quv1.RetainPolicyRetain
+	if err := r.Update(ctx, claim); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Lose the claim without running its finalizer
+	if err := r.Get(ctx, key, claim); err != nil {
+		t.Fatal(err)
+	}
+	claim.Finalizers = nil
+	if err := r.Update(ctx, claim); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Delete(ctx, claim); err != nil {
+		t.Fatal(err)
+	}
+
+	recovery := &ClaimRecovery{Client: r.Client}
+	if n, err := recovery.recoverBackend(ctx, backend.DefaultSecretName); err != nil || n != 1 {
+		t.Fatalf("recovered %d claims, error %v, want 1", n, err)
+	}
+	recovered := &quv1.QuObjectBucketClaim{}
+	if err := r.Get(ctx, key, recovered); err != nil {
+		t.Fatal(err)
+	}
+	if recovered.Spec.RetainPolicy != quv1.RetainPolicyRetain || recovered.Spec.BucketName != "data" {
+		t.Errorf("recovered spec %+v, want the spec at the time of the loss", recovered.Spec)
+	}
+	if recovered.Annotations[annotationRecoveredFrom] != "uid-app" {
+		t.Errorf("recovered claim annotations %v, want %s naming the lost claim", recovered.Annotations, annotationRecoveredFrom)
+	}
+}
@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+)
+
+// usageReportName is the ConfigMap the usage report is published in
+const usageReportName = "quobject-usage-report"
+
+// UsageReport is the usage of the claims of a shard, aggregated for
+// chargeback
+type UsageReport struct {
+	GeneratedAt metav1.Time `json:"generatedAt"`
+	// Label is the claim label aggregated in Labels
+	Label string `json:"label,omitempty"`
+	// Namespaces holds one entry per namespace with claims
+	Namespaces []UsageReportEntry `json:"namespaces"`
+	// Labels holds one entry per value of Label; claims without the label
+	// are reported under an empty name
+	Labels []UsageReportEntry `json:"labels,omitempty"`
+}
+
+// UsageReportEntry is the usage of a group of claims. Usage is taken from
+// the claims' last usage poll.
+type UsageReportEntry struct {
+	Name          string `json:"name"`
+	Claims        int    `json:"claims"`
+	Objects       int64  `json:"objects"`
+	Bytes         int64  `json:"bytes"`
+	SnapshotBytes int64  `json:"snapshotBytes"`
+}
+
+// UsageReporter periodically aggregates the usage of the claims of a shard
+// by namespace, and optionally by a label, into a ConfigMap in the
+// controller's namespace
+type UsageReporter struct {
+	Client client.Client
+	// Interval is the time between reports
+	Interval time.Duration
+	// Label is a claim label, e.g. team, to aggregate usage by in addition
+	// to namespaces. Empty reports namespaces only.
+	Label string
+	// Shard selects the claims reported by this replica
+	Shard Sharding
+}
+
+// NeedLeaderElection makes only the leader publish reports
+func (u *UsageReporter) NeedLeaderElection() bool {
+	return true
+}
+
+// Start publishes a report every interval until ctx is done
+func (u *UsageReporter) Start(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("usage-report")
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := u.publish(ctx); err != nil {
+			log.Error(err, "Failed to publish usage report")
+		}
+	}, u.Interval)
+	return nil
+}
+
+func (u *UsageReporter) publish(ctx context.Context) error {
+	var list quv1.QuObjectBucketClaimList
+	if err := u.Client.List(ctx, &list); err != nil {
+		return fmt.Errorf("failed to list claims: %w", err)
+	}
+	report := u.aggregate(list.Items)
+
+	encoded, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	data := map[string]string{
+		"report.json":    string(encoded),
+		"namespaces.csv": usageCSV(report.Namespaces),
+	}
+	if u.Label != "" {
+		data["labels.csv"] = usageCSV(report.Labels)
+	}
+
+	name := usageReportName
+	if u.Shard.Enabled() {
+		name = fmt.Sprintf("%s-shard-%d", usageReportName, u.Shard.Index)
+	}
+	cm := &corev1.ConfigMap{}
+	err = u.Client.Get(ctx, client.ObjectKey{Namespace: backend.Namespace, Name: name}, cm)
+	if apierrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: backend.Namespace},
+			Data:       data,
+		}
+		return u.Client.Create(ctx, cm)
+	} else if err != nil {
+		return err
+	}
+	cm.Data = data
+	return u.Client.Update(ctx, cm)
+}
+
+// aggregate sums the usage of the claims of the shard
+func (u *UsageReporter) aggregate(claims []quv1.QuObjectBucketClaim) *UsageReport {
+	namespaces := map[string]*UsageReportEntry{}
+	labels := map[string]*UsageReportEntry{}
+	add := func(groups map[string]*UsageReportEntry, name string, claim *quv1.QuObjectBucketClaim) {
+		e, ok := groups[name]
+		if !ok {
+			e = &UsageReportEntry{Name: name}
+			groups[name] = e
+		}
+		e.Claims++
+		if usage := claim.Status.Usage; usage != nil {
+			e.Objects += usage.Objects
+			e.Bytes += usage.Bytes
+		}
+		if snapshots := claim.Status.Snapshots; snapshots != nil {
+			e.SnapshotBytes += snapshots.Bytes
+		}
+	}
+	for i := range claims {
+		claim := &claims[i]
+		if !u.Shard.Owns(claim) {
+			continue
+		}
+		add(namespaces, claim.Namespace, claim)
+		if u.Label != "" {
+			add(labels, claim.Labels[u.Label], claim)
+		}
+	}
+
+	report := &UsageReport{
+		GeneratedAt: metav1.Now(),
+		Label:       u.Label,
+		Namespaces:  sortedEntries(namespaces),
+	}
+	if u.Label != "" {
+		report.Labels = sortedEntries(labels)
+	}
+	return report
+}
+
+func sortedEntries(groups map[string]*UsageReportEntry) []UsageReportEntry {
+	entries := make([]UsageReportEntry, 0, len(groups))
+	for _, e := range groups {
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries
+}
+
+// usageCSV renders report entries as CSV with a header line
+func usageCSV(entries []UsageReportEntry) string {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"name", "claims", "objects", "bytes", "snapshotBytes"})
+	for _, e := range entries {
+		w.Write([]string{
+			e.Name,
+			strconv.Itoa(e.Claims),
+			strconv.FormatInt(e.Objects, 10),
+			strconv.FormatInt(e.Bytes, 10),
+			strconv.FormatInt(e.SnapshotBytes, 10),
+		})
+	}
+	w.Flush()
+	return buf.String()
+}
@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"time"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+)
+
+// verifyInterval returns how often the claim's bucket and generated
+// resources are verified, which is the claim's own override or else the
+// controller-wide setting
+func (r *QuObjectBucketClaimReconciler) verifyInterval(claim *quv1.QuObjectBucketClaim) time.Duration {
+	if claim.Spec.VerifyInterval != nil {
+		return claim.Spec.VerifyInterval.Duration
+	}
+	return r.VerifyInterval
+}
+
+// operationTimeout returns the deadline of each of the claim's S3
+// operations. Zero leaves them unbounded.
+func (r *QuObjectBucketClaimReconciler) operationTimeout(claim *quv1.QuObjectBucketClaim) time.Duration {
+	if claim.Spec.OperationTimeout != nil {
+		return claim.Spec.OperationTimeout.Duration
+	}
+	return r.S3OperationTimeout
+}
+
+// requeueAfter returns when a bound claim must be reconciled again: at the
+// earliest of its next verification, usage poll, credentials refresh and
+// the end of its write window, or right away to clean up after a
+// migration. Zero means only on changes.
+func (r *QuObjectBucketClaimReconciler) requeueAfter(claim *quv1.QuObjectBucketClaim) time.Duration {
+	var after time.Duration
+	earliest := func(d time.Duration) {
+		if d > 0 && (after == 0 || d < after) {
+			after = d
+		}
+	}
+	earliest(r.verifyInterval(claim))
+	earliest(r.usagePollInterval(claim))
+	earliest(writableFor(claim))
+	if migrationCleanupPending(claim) {
+		// The source bucket of a finished migration is deleted next
+		earliest(time.Second)
+	}
+	if isTemporaryCredentials(claim) {
+		// Come back in time to refresh the credentials before they expire
+		earliest(max(credentialsRefreshIn(claim), time.Second))
+	}
+	return after
+}
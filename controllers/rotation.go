@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+	"github.com/pamvdam71/quobject-controller/internal/logging"
+)
+
+// Annotations recording the rotation state of a backend secret
+const (
+	// annotationRotatedAt is when the controller last rotated the key
+	annotationRotatedAt = "quobject.io/credentials-rotated-at"
+	// annotationRotatedAccessKey is the access key issued by the last
+	// rotation, which later rotations may delete
+	annotationRotatedAccessKey = "quobject.io/rotated-access-key"
+	// annotationPreviousAccessKey is the replaced key, deleted once the
+	// grace period has passed
+	annotationPreviousAccessKey = "quobject.io/previous-access-key"
+)
+
+// Backend Event reasons of credentials rotation
+const (
+	reasonCredentialsRotated  = "CredentialsRotated"
+	reasonRotationFailed      = "CredentialsRotationFailed"
+	reasonPreviousKeyDeleted  = "PreviousAccessKeyDeleted"
+	reasonPreviousKeyRetained = "PreviousAccessKeyRetained"
+	reasonStaleKeyDeleted     = "StaleAccessKeyDeleted"
+)
+
+// rotateCredentials replaces the backend's access key once it is older than
+// the rotation interval, and deletes the replaced key after the grace
+// period. It returns when the backend needs to be reconciled again.
+func (r *BackendReconciler) rotateCredentials(
+	ctx context.Context,
+	secret *corev1.Secret,
+	cfg backend.Config,
+) (time.Duration, error) {
+	if !cfg.Rotation.Enabled() {
+		return 0, nil
+	}
+	log := log.FromContext(ctx)
+	rotatedAt := secret.CreationTimestamp.Time
+	if v := secret.Annotations[annotationRotatedAt]; v != "" {
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			rotatedAt = t
+		}
+	}
+	now := time.Now()
+
+	if previous := secret.Annotations[annotationPreviousAccessKey]; previous != "" {
+		if wait := rotatedAt.Add(cfg.Rotation.GracePeriod).Sub(now); wait > 0 {
+			return wait, nil
+		}
+		if err := backend.DeleteBackendAccessKey(ctx, cfg, r.S3RateLimiter, previous); err != nil {
+			log.Error(err, "Failed to delete previous backend access key")
+			r.Recorder.Event(secret, corev1.EventTypeWarning, reasonRotationFailed,
+				logging.Redact(fmt.Sprintf("Failed to delete the previous access key: %v", err)))
+			return 0, err
+		}
+		patch := client.MergeFrom(secret.DeepCopy())
+		delete(secret.Annotations, annotationPreviousAccessKey)
+		if err := r.Patch(ctx, secret, patch); err != nil {
+			return 0, err
+		}
+		logging.ForgetSecrets(backend.SecretsOwner(secret.Name) + "/previous")
+		r.Recorder.Event(secret, corev1.EventTypeNormal, reasonPreviousKeyDeleted, "Deleted the previous access key")
+	}
+
+	if wait := rotatedAt.Add(cfg.Rotation.Interval).Sub(now); wait > 0 {
+		return wait, nil
+	}
+	// A key left behind by an earlier rotation whose Secret update failed
+	// would take the slot of the new one
+	stale, err := backend.DeleteStaleBackendAccessKeys(ctx, cfg, r.S3RateLimiter,
+		cfg.AccessKey, secret.Annotations[annotationPreviousAccessKey])
+	for _, id := range stale {
+		r.Recorder.Event(secret, corev1.EventTypeNormal, reasonStaleKeyDeleted,
+			fmt.Sprintf("Deleted access key %s, which is neither the current nor the previous key", id))
+	}
+	if err != nil {
+		log.Error(err, "Failed to delete stale backend access keys")
+		r.Recorder.Event(secret, corev1.EventTypeWarning, reasonRotationFailed, logging.Redact(err.Error()))
+		return 0, err
+	}
+	key, err := backend.CreateBackendAccessKey(ctx, cfg, r.S3RateLimiter)
+	if err != nil {
+		log.Error(err, "Failed to rotate backend credentials")
+		r.Recorder.Event(secret, corev1.EventTypeWarning, reasonRotationFailed, logging.Redact(err.Error()))
+		return 0, err
+	}
+	// The replaced key stays valid until it is deleted after the grace period
+	owner := backend.SecretsOwner(secret.Name)
+	logging.SetSecrets(owner+"/previous", time.Time{}, cfg.AccessKey, cfg.SecretKey)
+	logging.SetSecrets(owner, time.Time{}, key.AccessKeyID, key.SecretAccessKey)
+
+	// On MinIO only the service accounts of earlier rotations can be
+	// deleted; the root or user key they were created from stays
+	previous := cfg.AccessKey
+	if cfg.Profile.MinIOAdmin && secret.Annotations[annotationRotatedAccessKey] != cfg.AccessKey {
+		previous = ""
+	}
+	patch := client.MergeFrom(secret.DeepCopy())
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Data["accessKey"] = []byte(key.AccessKeyID)
+	secret.Data["secretKey"] = []byte(key.SecretAccessKey)
+	secret.Annotations[annotationRotatedAt] = now.UTC().Format(time.RFC3339)
+	secret.Annotations[annotationRotatedAccessKey] = key.AccessKeyID
+	if previous != "" {
+		secret.Annotations[annotationPreviousAccessKey] = previous
+	} else {
+		delete(secret.Annotations, annotationPreviousAccessKey)
+	}
+	if err := r.Patch(ctx, secret, patch); err != nil {
+		// The new key is unknown to anyone else, so it must not linger
+		if delErr := backend.DeleteBackendAccessKey(ctx, cfg, r.S3RateLimiter, key.AccessKeyID); delErr != nil {
+			log.Error(delErr, "Failed to delete unused backend access key")
+		}
+		return 0, err
+	}
+
+	msg := "Rotated the access key; claim Secrets are updated with the new key"
+	if previous != "" {
+		msg += fmt.Sprintf(" and the previous key is deleted in %s", cfg.Rotation.GracePeriod)
+	}
+	log.Info(msg)
+	r.Recorder.Event(secret, corev1.EventTypeNormal, reasonCredentialsRotated, msg)
+	if previous == "" {
+		r.Recorder.Event(secret, corev1.EventTypeWarning, reasonPreviousKeyRetained,
+			"The previous access key is not a service account issued by the controller and must be revoked on the backend")
+		return cfg.Rotation.Interval, nil
+	}
+	return cfg.Rotation.GracePeriod, nil
+}
+
+// backendKeysChanged passes updates of backend secrets that change their
+// access key, as made by a rotation
+var backendKeysChanged = predicate.Funcs{
+	CreateFunc:  func(event.CreateEvent) bool { return false },
+	DeleteFunc:  func(event.DeleteEvent) bool { return false },
+	GenericFunc: func(event.GenericEvent) bool { return false },
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		if e.ObjectNew.GetNamespace() != backend.Namespace || !backend.IsSecretName(e.ObjectNew.GetName()) {
+			return false
+		}
+		oldSecret, ok1 := e.ObjectOld.(*corev1.Secret)
+		newSecret, ok2 := e.ObjectNew.(*corev1.Secret)
+		return ok1 && ok2 && (!bytes.Equal(oldSecret.Data["accessKey"], newSecret.Data["accessKey"]) ||
+			!bytes.Equal(oldSecret.Data["secretKey"], newSecret.Data["secretKey"]))
+	},
+}
+
+// backendClaims enqueues the claims provisioned on a backend, so that their
+// Secrets are re-stamped with its new keys
+func (r *QuObjectBucketClaimReconciler) backendClaims(ctx context.Context, obj client.Object) []reconcile.Request {
+	var list quv1.QuObjectBucketClaimList
+	if err := r.List(ctx, &list); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list claims of rotated backend", "backend", obj.GetName())
+		return nil
+	}
+	var reqs []reconcile.Request
+	for i := range list.Items {
+		claim := &list.Items[i]
+		if claim.Annotations[annotationBackend] == obj.GetName() && r.Shard.Owns(claim) {
+			reqs = append(reqs, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(claim)})
+		}
+	}
+	return reqs
+}
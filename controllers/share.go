@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+)
+
+// Event reasons of shares
+const (
+	reasonShareIssued = "ShareIssued"
+	reasonShareFailed = "ShareFailed"
+)
+
+// syncShare issues a presigned URL for the object named by the claim's
+// quobject.io/share annotation. A URL is issued once per annotation value,
+// so an expired share is renewed by changing the annotation, and removing
+// the annotation clears it.
+func (r *QuObjectBucketClaimReconciler) syncShare(
+	ctx context.Context,
+	s3c *s3.Client,
+	claim *quv1.QuObjectBucketClaim,
+	bucket string,
+) {
+	value, ok := claim.Annotations[quv1.AnnotationShare]
+	if !ok {
+		claim.Status.Share = nil
+		return
+	}
+	if claim.Status.Share != nil && claim.Status.Share.Request == value {
+		return
+	}
+	claim.Status.Share = nil
+
+	share, err := presignShare(ctx, s3c, claim, bucket, value)
+	if err != nil {
+		r.warn(ctx, claim, reasonShareFailed, fmt.Errorf("failed to share an object: %w", err))
+		return
+	}
+	claim.Status.Share = share
+	// The URL carries the access key ID, which events redact, so it is
+	// only published in the status
+	r.event(ctx, claim, corev1.EventTypeNormal, reasonShareIssued,
+		"Published a presigned URL for %s in status.share, valid until %s",
+		share.Key, share.Expiration.UTC().Format(time.RFC3339))
+}
+
+// presignShare presigns a GET of the shared object after checking that it
+// exists
+func presignShare(
+	ctx context.Context,
+	s3c *s3.Client,
+	claim *quv1.QuObjectBucketClaim,
+	bucket, value string,
+) (*quv1.ShareStatus, error) {
+	key, ttl, err := quv1.ParseShare(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %w", quv1.AnnotationShare, err)
+	}
+	// Directory buckets authorize requests with short-lived sessions
+	if isDirectoryBucket(claim) {
+		return nil, errors.New("directory buckets cannot be shared")
+	}
+	if _, err := s3c.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}); err != nil {
+		return nil, fmt.Errorf("object %s: %w", key, err)
+	}
+	req, err := s3.NewPresignClient(s3c).PresignGetObject(ctx,
+		&s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)},
+		s3.WithPresignExpires(ttl))
+	if err != nil {
+		return nil, fmt.Errorf("failed to presign %s: %w", key, err)
+	}
+	return &quv1.ShareStatus{
+		Request:    value,
+		Key:        key,
+		URL:        req.URL,
+		Expiration: metav1.NewTime(time.Now().Add(ttl)),
+	}, nil
+}
@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+)
+
+// LabelTags maps claim label keys to the bucket tag keys their values are
+// copied to, e.g. for cost allocation in cloud billing exports
+type LabelTags map[string]string
+
+// ParseLabelTags parses a --label-tags flag value: a comma-separated list of
+// label keys, each optionally followed by =<tag key> if the tag is named
+// differently, e.g. "team,cost-center=CostCenter"
+func ParseLabelTags(s string) (LabelTags, error) {
+	tags := LabelTags{}
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		label, tag, found := strings.Cut(entry, "=")
+		label, tag = strings.TrimSpace(label), strings.TrimSpace(tag)
+		if !found {
+			tag = label
+		}
+		if label == "" || tag == "" {
+			return nil, fmt.Errorf("invalid label tag %q: must be <label> or <label>=<tag key>", entry)
+		}
+		tags[label] = tag
+	}
+	return tags, nil
+}
+
+// syncBucketTags sets the mapped tags of the bucket to the values of the
+// claim's labels, removing mapped tags whose label is gone. Tags that are not
+// mapped, such as the adoption tag, are kept.
+func (r *QuObjectBucketClaimReconciler) syncBucketTags(
+	ctx context.Context,
+	s3c *s3.Client,
+	claim *quv1.QuObjectBucketClaim,
+	bucketName string,
+) error {
+	// S3 Express directory buckets have no tags
+	if len(r.LabelTags) == 0 || isDirectoryBucket(claim) {
+		return nil
+	}
+
+	current := map[string]string{}
+	out, err := s3c.GetBucketTagging(ctx, &s3.GetBucketTaggingInput{Bucket: aws.String(bucketName)})
+	var apiErr smithy.APIError
+	if err != nil && !(errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchTagSet") {
+		return fmt.Errorf("failed to get bucket tags: %w", err)
+	}
+	if out != nil {
+		for _, t := range out.TagSet {
+			current[aws.ToString(t.Key)] = aws.ToString(t.Value)
+		}
+	}
+
+	desired := make(map[string]string, len(current))
+	for k, v := range current {
+		desired[k] = v
+	}
+	for label, tag := range r.LabelTags {
+		if value, ok := claim.Labels[label]; ok {
+			desired[tag] = value
+		} else {
+			delete(desired, tag)
+		}
+	}
+	if equalTags(current, desired) {
+		return nil
+	}
+
+	if len(desired) == 0 {
+		if _, err := s3c.DeleteBucketTagging(ctx, &s3.DeleteBucketTaggingInput{Bucket: aws.String(bucketName)}); err != nil {
+			return fmt.Errorf("failed to delete bucket tags: %w", err)
+		}
+		return nil
+	}
+	keys := make([]string, 0, len(desired))
+	for k := range desired {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	tagSet := make([]s3types.Tag, 0, len(keys))
+	for _, k := range keys {
+		tagSet = append(tagSet, s3types.Tag{Key: aws.String(k), Value: aws.String(desired[k])})
+	}
+	_, err = s3c.PutBucketTagging(ctx, &s3.PutBucketTaggingInput{
+		Bucket:  aws.String(bucketName),
+		Tagging: &s3types.Tagging{TagSet: tagSet},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put bucket tags: %w", err)
+	}
+	return nil
+}
+
+func equalTags(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
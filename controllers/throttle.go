@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+)
+
+// ThrottleBackoff delays claims whose backend throttled them, with SlowDown
+// or 503 responses, for longer than generic failures. The delay of a claim
+// doubles with every throttled attempt from BaseDelay up to MaxDelay, and
+// other claims on the same backend hold off for as long, so that they do
+// not all retry at once. All delays are jittered. A nil ThrottleBackoff
+// retries throttled claims like any other failure.
+type ThrottleBackoff struct {
+	// BaseDelay is the delay after the first throttled attempt
+	BaseDelay time.Duration
+	// MaxDelay caps the delay of a claim
+	MaxDelay time.Duration
+
+	mu sync.Mutex
+	// attempts counts the consecutive throttled attempts of each claim
+	attempts map[types.UID]int
+	// backends records the backend each claim was last reconciled against
+	backends map[types.UID]string
+	// pausedUntil is when each throttled backend may be called again
+	pausedUntil map[string]time.Time
+}
+
+// Wait records the backend of the claim and returns how long the claim must
+// wait before calling it, or zero if the backend is not throttled
+func (t *ThrottleBackoff) Wait(claim *quv1.QuObjectBucketClaim, backendName string) time.Duration {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.backends == nil {
+		t.backends = map[types.UID]string{}
+	}
+	t.backends[claim.UID] = backendName
+	wait := time.Until(t.pausedUntil[backendName])
+	if wait <= 0 {
+		delete(t.pausedUntil, backendName)
+		return 0
+	}
+	// Spread the waiting claims so they do not resume together
+	return wait + jitter(t.BaseDelay)
+}
+
+// Throttled records a throttled attempt of the claim and returns the delay
+// before its next attempt. The claim's backend is paused for as long.
+func (t *ThrottleBackoff) Throttled(claim *quv1.QuObjectBucketClaim) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.attempts == nil {
+		t.attempts = map[types.UID]int{}
+		t.pausedUntil = map[string]time.Time{}
+	}
+	t.attempts[claim.UID]++
+	delay := t.BaseDelay
+	for i := 1; i < t.attempts[claim.UID] && delay < t.MaxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, t.MaxDelay)
+	// Between half and all of the delay
+	delay = delay/2 + jitter(delay/2)
+	if backendName, ok := t.backends[claim.UID]; ok {
+		if until := time.Now().Add(delay); until.After(t.pausedUntil[backendName]) {
+			t.pausedUntil[backendName] = until
+		}
+	}
+	return delay
+}
+
+// Forget resets the backoff of a claim that succeeded or was deleted
+func (t *ThrottleBackoff) Forget(claim *quv1.QuObjectBucketClaim) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.attempts, claim.UID)
+	delete(t.backends, claim.UID)
+}
+
+// jitter returns a random duration below d
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d)))
+}
@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+)
+
+// Failed condition reasons
+const (
+	reasonProvisioningTimeout = "ProvisioningTimeout"
+	reasonSpecChanged         = "SpecChanged"
+)
+
+// provisioningFailed marks a claim that has not bound within the
+// provisioning timeout as Failed and reports whether the claim is Failed.
+// A Failed claim is not retried until its spec changes, which restarts the
+// timeout.
+func (r *QuObjectBucketClaimReconciler) provisioningFailed(
+	ctx context.Context,
+	claim *quv1.QuObjectBucketClaim,
+) (bool, error) {
+	if r.ProvisioningTimeout <= 0 || claim.Status.BucketName != "" {
+		return false, nil
+	}
+
+	start := claim.CreationTimestamp.Time
+	cond := meta.FindStatusCondition(claim.Status.Conditions, quv1.ConditionFailed)
+	if cond != nil && cond.Status == metav1.ConditionTrue {
+		if cond.ObservedGeneration == claim.Generation {
+			return true, nil
+		}
+		meta.SetStatusCondition(&claim.Status.Conditions, metav1.Condition{
+			Type:               quv1.ConditionFailed,
+			Status:             metav1.ConditionFalse,
+			Reason:             reasonSpecChanged,
+			Message:            "Provisioning is retried after a spec change",
+			ObservedGeneration: claim.Generation,
+		})
+		claim.Status.Phase = quv1.ClaimPhasePending
+		return false, r.Status().Update(ctx, claim)
+	}
+	if cond != nil {
+		start = cond.LastTransitionTime.Time
+	}
+	if time.Since(start) < r.ProvisioningTimeout {
+		return false, nil
+	}
+
+	err := fmt.Errorf("claim did not bind within %s", r.ProvisioningTimeout)
+	r.warn(ctx, claim, reasonProvisioningTimeout, err)
+	meta.SetStatusCondition(&claim.Status.Conditions, metav1.Condition{
+		Type:               quv1.ConditionFailed,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonProvisioningTimeout,
+		Message:            err.Error() + "; change the spec to retry",
+		ObservedGeneration: claim.Generation,
+	})
+	claim.Status.Phase = quv1.ClaimPhaseFailed
+	setReadyCondition(claim, reasonProvisioningTimeout, err.Error())
+	return true, r.Status().Update(ctx, claim)
+}
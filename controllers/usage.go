@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+)
+
+// usagePollInterval returns the usage polling interval of the claim, which
+// is the claim's own override or else the controller-wide setting
+func (r *QuObjectBucketClaimReconciler) usagePollInterval(claim *quv1.QuObjectBucketClaim) time.Duration {
+	if claim.Spec.UsagePollInterval != nil {
+		return claim.Spec.UsagePollInterval.Duration
+	}
+	return r.UsagePollInterval
+}
+
+// usageRefreshDue reports whether the usage estimate of the claim is missing
+// or older than its usage polling interval
+func (r *QuObjectBucketClaimReconciler) usageRefreshDue(claim *quv1.QuObjectBucketClaim) bool {
+	interval := r.usagePollInterval(claim)
+	if interval <= 0 {
+		return false
+	}
+	usage := claim.Status.Usage
+	if usage == nil || usage.LastUpdated == nil {
+		return true
+	}
+	return time.Since(usage.LastUpdated.Time) >= interval
+}
+
+// measureBucketUsage lists all objects in the bucket and sums their sizes
+func measureBucketUsage(ctx context.Context, s3c *s3.Client, bucket string) (*quv1.BucketUsage, error) {
+	usage := &quv1.BucketUsage{}
+	paginator := s3.NewListObjectsV2Paginator(s3c, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", err)
+		}
+		for _, obj := range page.Contents {
+			usage.Objects++
+			usage.Bytes += aws.ToInt64(obj.Size)
+		}
+	}
+	now := metav1.Now()
+	usage.LastUpdated = &now
+	return usage, nil
+}
+
+// snapshotUsage sums the snapshots taken of the claim. It returns nil if the
+// claim has no snapshots.
+func (r *QuObjectBucketClaimReconciler) snapshotUsage(
+	ctx context.Context,
+	claim *quv1.QuObjectBucketClaim,
+) (*quv1.SnapshotUsage, error) {
+	var list quv1.QuObjectBucketSnapshotList
+	if err := r.List(ctx, &list, client.InNamespace(claim.Namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	var usage *quv1.SnapshotUsage
+	for _, snap := range list.Items {
+		if snap.Spec.ClaimName != claim.Name {
+			continue
+		}
+		if usage == nil {
+			usage = &quv1.SnapshotUsage{}
+		}
+		usage.Count++
+		if snap.Status.ReadyToUse {
+			usage.Bytes += snap.Status.Bytes
+		}
+	}
+	return usage, nil
+}
+
+// snapshotClaim maps a snapshot to the claim it was taken of
+func snapshotClaim(_ context.Context, obj client.Object) []reconcile.Request {
+	snap, ok := obj.(*quv1.QuObjectBucketSnapshot)
+	if !ok || snap.Spec.ClaimName == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: snap.Spec.ClaimName, Namespace: snap.Namespace}}}
+}
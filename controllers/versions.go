@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+)
+
+// versionedConfigMap reports whether the claim's ConfigMap is named by its
+// content
+func versionedConfigMap(claim *quv1.QuObjectBucketClaim) bool {
+	return claim.Spec.ImmutableOutputs || claim.Spec.ConfigMapHistoryLimit != nil
+}
+
+// versionedNames returns the name and fallback name of a versioned generated
+// resource with the given data. Both carry a hash of the data, so every
+// change of the data creates a new version of the resource. An override
+// from the spec replaces the derived base name.
+func versionedNames(override, claimName, suffix string, data map[string]string) (string, string) {
+	if override != "" {
+		name := versionedName(override, data)
+		return name, name
+	}
+	return versionedName(derivedName(claimName, suffix, false), data),
+		versionedName(derivedName(claimName, suffix, true), data)
+}
+
+// versionedName appends a short hash of data to name
+func versionedName(name string, data map[string]string) string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, k := range keys {
+		h.Write([]byte(k))
+		h.Write([]byte{0})
+		h.Write([]byte(data[k]))
+		h.Write([]byte{0})
+	}
+	version := "-" + hex.EncodeToString(h.Sum(nil))[:8]
+	if keep := maxResourceNameLength - len(version); len(name) > keep {
+		name = strings.TrimRight(name[:keep], "-.")
+	}
+	return name + version
+}
+
+// equalData reports whether the data of a Secret equals the string data it
+// is generated from
+func equalData(data map[string][]byte, stringData map[string]string) bool {
+	if len(data) != len(stringData) {
+		return false
+	}
+	for k, v := range stringData {
+		if b, ok := data[k]; !ok || string(b) != v {
+			return false
+		}
+	}
+	return true
+}
+
+// defaultSecretHistoryLimit is the number of previous versions of an
+// immutable Secret kept if the claim does not set spec.secretHistoryLimit
+const defaultSecretHistoryLimit = 1
+
+// secretHistoryLimit returns the number of previous Secret versions the
+// claim keeps. Only immutable Secrets are versioned.
+func secretHistoryLimit(claim *quv1.QuObjectBucketClaim) int {
+	if !claim.Spec.ImmutableOutputs || claim.Status.SecretRef == "" {
+		return 0
+	}
+	if limit := claim.Spec.SecretHistoryLimit; limit != nil {
+		return int(*limit)
+	}
+	return defaultSecretHistoryLimit
+}
+
+// pruneStaleOutputs deletes the Secrets and ConfigMaps the claim
+// generated before once its status publishes the current ones, such as
+// previous versions or objects under a previous name or in a previous
+// output namespace. The newest previous versions of an immutable Secret and
+// of a versioned ConfigMap are kept up to the claim's history limits.
+func (r *QuObjectBucketClaimReconciler) pruneStaleOutputs(
+	ctx context.Context,
+	claim *quv1.QuObjectBucketClaim,
+) error {
+	current := recordedOutputNamespace(claim)
+	var secrets []*corev1.Secret
+	for _, opt := range outputListOptions(claim) {
+		var list corev1.SecretList
+		if err := r.List(ctx, &list, opt); err != nil {
+			return err
+		}
+		for i := range list.Items {
+			secret := &list.Items[i]
+			if (secret.Name != claim.Status.SecretRef || secret.Namespace != current) && ownsOutput(claim, secret) {
+				secrets = append(secrets, secret)
+			}
+		}
+	}
+	// Newest first
+	sort.Slice(secrets, func(i, j int) bool {
+		return secrets[j].CreationTimestamp.Before(&secrets[i].CreationTimestamp)
+	})
+	// Only versions next to the current Secret are of use to pods
+	kept := 0
+	for _, secret := range secrets {
+		if secret.Immutable != nil && *secret.Immutable && secret.Namespace == current &&
+			kept < secretHistoryLimit(claim) {
+			kept++
+			continue
+		}
+		if err := r.Delete(ctx, secret); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	var previous []*corev1.ConfigMap
+	for _, opt := range outputListOptions(claim) {
+		var list corev1.ConfigMapList
+		if err := r.List(ctx, &list, opt); err != nil {
+			return err
+		}
+		for i := range list.Items {
+			cm := &list.Items[i]
+			if (cm.Name != claim.Status.ConfigMapRef || cm.Namespace != current) && ownsOutput(claim, cm) {
+				previous = append(previous, cm)
+			}
+		}
+	}
+	// Newest first
+	sort.Slice(previous, func(i, j int) bool {
+		return previous[j].CreationTimestamp.Before(&previous[i].CreationTimestamp)
+	})
+	// Only versions next to the current ConfigMap are of use to pods
+	kept = 0
+	for _, cm := range previous {
+		if limit := claim.Spec.ConfigMapHistoryLimit; limit != nil && claim.Status.ConfigMapRef != "" &&
+			cm.Namespace == current && kept < int(*limit) {
+			kept++
+			continue
+		}
+		if err := r.Delete(ctx, cm); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// outputListOptions select the objects that may have been generated for the
+// claim: those in its namespace, and those labeled for it in others
+func outputListOptions(claim *quv1.QuObjectBucketClaim) []client.ListOption {
+	return []client.ListOption{
+		client.InNamespace(claim.Namespace),
+		client.MatchingLabels{labelClaimUID: string(claim.UID)},
+	}
+}
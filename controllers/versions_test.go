@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/testutil"
+)
+
+func TestPruneStaleSecrets(t *testing.T) {
+	srv := testutil.NewS3Server()
+	defer srv.Close()
+	claim := &quv1.QuObjectBucketClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", UID: "uid-app"},
+		Spec:       quv1.QuObjectBucketClaimSpec{ImmutableOutputs: true},
+		Status:     quv1.QuObjectBucketClaimStatus{SecretRef: "app-bucket-secret-d"},
+	}
+	r := newTestReconciler(t, srv, claim)
+	ctx := context.Background()
+
+	// Versions a to d, oldest first, and a mutable Secret from before
+	// spec.immutableOutputs was set
+	base := time.Now()
+	for i, name := range []string{"app-bucket-secret", "app-bucket-secret-a", "app-bucket-secret-b", "app-bucket-secret-c", "app-bucket-secret-d"} {
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(base.Add(time.Duration(i) * time.Minute)),
+		}}
+		if i > 0 {
+			secret.Immutable = ptr.To(true)
+		}
+		if err := controllerutil.SetControllerReference(claim, secret, r.Scheme); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Create(ctx, secret); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Each step prunes further, so the limits decrease
+	for _, tc := range []struct {
+		limit *int32
+		want  []string
+	}{
+		{ptr.To[int32](2), []string{"app-bucket-secret-b", "app-bucket-secret-c", "app-bucket-secret-d"}},
+		{nil, []string{"app-bucket-secret-c", "app-bucket-secret-d"}},
+		{ptr.To[int32](0), []string{"app-bucket-secret-d"}},
+	} {
+		claim.Spec.SecretHistoryLimit = tc.limit
+		if err := r.pruneStaleOutputs(ctx, claim); err != nil {
+			t.Fatal(err)
+		}
+		var list corev1.SecretList
+		if err := r.List(ctx, &list, client.InNamespace("default")); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, secret := range list.Items {
+			got = append(got, secret.Name)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("limit %v: Secrets %v, want %v", ptr.Deref(tc.limit, -1), got, tc.want)
+		}
+	}
+}
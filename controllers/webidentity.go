@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+)
+
+// serviceAccountSubject returns the subject of the projected tokens of a
+// ServiceAccount. The backend's OIDC provider maps the sub claim to the
+// canned policy of the same name.
+func serviceAccountSubject(namespace, name string) string {
+	return "system:serviceaccount:" + namespace + ":" + name
+}
+
+// syncServiceAccountAccess updates the canned policies of the ServiceAccounts
+// the claim grants or granted access to. A ServiceAccount's policy allows
+// all buckets of the claims in its namespace on the same backend that list
+// it, and is removed once no claim does. A claim being deleted or
+// hibernated grants nothing.
+func (r *QuObjectBucketClaimReconciler) syncServiceAccountAccess(
+	ctx context.Context,
+	claim *quv1.QuObjectBucketClaim,
+	backendName string,
+	cfg backend.Config,
+) error {
+	accounts := map[string]bool{}
+	for _, sa := range claim.Status.ServiceAccounts {
+		accounts[sa] = true
+	}
+	for _, sa := range claim.Spec.ServiceAccounts {
+		accounts[sa] = true
+	}
+	if len(accounts) == 0 {
+		return nil
+	}
+
+	var claims quv1.QuObjectBucketClaimList
+	if err := r.List(ctx, &claims, client.InNamespace(claim.Namespace)); err != nil {
+		return fmt.Errorf("failed to list claims: %w", err)
+	}
+	// The cache may not have observed the latest state of this claim yet
+	for i := range claims.Items {
+		if claims.Items[i].UID == claim.UID {
+			claims.Items[i] = *claim
+		}
+	}
+
+	for sa := range accounts {
+		subject := serviceAccountSubject(claim.Namespace, sa)
+		buckets := grantedBuckets(claims.Items, backendName, sa)
+		if len(buckets) == 0 {
+			if err := backend.DeleteCannedPolicy(ctx, cfg, r.S3RateLimiter, subject); err != nil {
+				return fmt.Errorf("failed to remove policy of ServiceAccount %s: %w", sa, err)
+			}
+			continue
+		}
+		policy, err := json.Marshal(serviceAccountPolicy(buckets))
+		if err != nil {
+			return err
+		}
+		if err := backend.PutCannedPolicy(ctx, cfg, r.S3RateLimiter, subject, policy); err != nil {
+			return fmt.Errorf("failed to update policy of ServiceAccount %s: %w", sa, err)
+		}
+	}
+
+	claim.Status.ServiceAccounts = nil
+	if grantsAccess(claim) {
+		claim.Status.ServiceAccounts = append([]string(nil), claim.Spec.ServiceAccounts...)
+	}
+	return nil
+}
+
+// grantsAccess reports whether the claim's ServiceAccounts may access its
+// bucket, which is not the case while it is deleted or hibernated
+func grantsAccess(claim *quv1.QuObjectBucketClaim) bool {
+	return claim.DeletionTimestamp.IsZero() && !claim.Spec.Hibernate
+}
+
+// grantedBuckets returns the sorted buckets on the backend that the claims
+// grant the ServiceAccount access to
+func grantedBuckets(claims []quv1.QuObjectBucketClaim, backendName, serviceAccount string) []string {
+	var buckets []string
+	for i := range claims {
+		c := &claims[i]
+		bucket := c.Annotations[annotationBucketName]
+		if !grantsAccess(c) || bucket == "" || c.Annotations[annotationBackend] != backendName {
+			continue
+		}
+		for _, sa := range c.Spec.ServiceAccounts {
+			if sa == serviceAccount {
+				buckets = append(buckets, bucket)
+				break
+			}
+		}
+	}
+	sort.Strings(buckets)
+	return buckets
+}
+
+// serviceAccountPolicy returns an IAM policy allowing all S3 actions on the
+// buckets and their objects
+func serviceAccountPolicy(buckets []string) *policyDocument {
+	resources := make([]string, 0, 2*len(buckets))
+	for _, b := range buckets {
+		resources = append(resources, bucketARN(b), bucketARN(b, "*"))
+	}
+	return &policyDocument{
+		Version: "2012-10-17",
+		Statement: []policyStatement{{
+			Sid:      managedSidPrefix + "ServiceAccountAccess",
+			Effect:   "Allow",
+			Action:   []string{"s3:*"},
+			Resource: resources,
+		}},
+	}
+}
@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/ratelimiter"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// NewQueueRateLimiter returns a workqueue rate limiter that backs off failing
+// items exponentially from baseDelay up to maxDelay and limits all requeues
+// to qps with the given burst, like the controller-runtime default
+func NewQueueRateLimiter(baseDelay, maxDelay time.Duration, qps float64, burst int) ratelimiter.RateLimiter {
+	return workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(baseDelay, maxDelay),
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(qps), burst)},
+	)
+}
+
+// instrumentedQueue is a rate limiting workqueue that additionally reports
+// the retry count of each failing item and the age of the oldest item
+// waiting to be processed, on top of the standard workqueue metrics
+type instrumentedQueue struct {
+	workqueue.RateLimitingInterface
+	name        string
+	rateLimiter ratelimiter.RateLimiter
+
+	mu sync.Mutex
+	// readyAt is when each waiting item became, or will become, ready
+	readyAt map[interface{}]time.Time
+}
+
+// newInstrumentedQueue is a controller NewQueue function
+func newInstrumentedQueue(name string, rl ratelimiter.RateLimiter) workqueue.RateLimitingInterface {
+	q := &instrumentedQueue{
+		RateLimitingInterface: workqueue.NewRateLimitingQueueWithConfig(rl, workqueue.RateLimitingQueueConfig{
+			Name: name,
+		}),
+		name:        name,
+		rateLimiter: rl,
+		readyAt:     map[interface{}]time.Time{},
+	}
+	// A queue recreated for a restarted controller replaces the old gauge
+	age := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "quobject_workqueue_oldest_item_age_seconds",
+		Help:        "Seconds the oldest item of the workqueue has been waiting to be processed",
+		ConstLabels: prometheus.Labels{"controller": name},
+	}, q.oldestAge)
+	metrics.Registry.Unregister(age)
+	metrics.Registry.MustRegister(age)
+	return q
+}
+
+// Add marks the item ready now unless it is already waiting
+func (q *instrumentedQueue) Add(item interface{}) {
+	q.markReady(item, time.Now())
+	q.RateLimitingInterface.Add(item)
+}
+
+// AddAfter marks the item ready once the delay has passed
+func (q *instrumentedQueue) AddAfter(item interface{}, d time.Duration) {
+	q.markReady(item, time.Now().Add(d))
+	q.RateLimitingInterface.AddAfter(item, d)
+}
+
+// AddRateLimited requeues a failed item after its backoff and records how
+// often it has been retried
+func (q *instrumentedQueue) AddRateLimited(item interface{}) {
+	q.AddAfter(item, q.rateLimiter.When(item))
+	if req, ok := item.(reconcile.Request); ok {
+		workqueueItemRetries.WithLabelValues(q.name, req.Namespace, req.Name).
+			Set(float64(q.rateLimiter.NumRequeues(item)))
+	}
+}
+
+// Forget stops tracking the retries of an item
+func (q *instrumentedQueue) Forget(item interface{}) {
+	q.RateLimitingInterface.Forget(item)
+	if req, ok := item.(reconcile.Request); ok {
+		workqueueItemRetries.DeleteLabelValues(q.name, req.Namespace, req.Name)
+	}
+}
+
+// Get hands out an item, which stops it from waiting
+func (q *instrumentedQueue) Get() (interface{}, bool) {
+	item, shutdown := q.RateLimitingInterface.Get()
+	q.mu.Lock()
+	delete(q.readyAt, item)
+	q.mu.Unlock()
+	return item, shutdown
+}
+
+// markReady keeps the earliest ready time of an item
+func (q *instrumentedQueue) markReady(item interface{}, at time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if t, ok := q.readyAt[item]; !ok || at.Before(t) {
+		q.readyAt[item] = at
+	}
+}
+
+// oldestAge returns how long the oldest ready item has been waiting
+func (q *instrumentedQueue) oldestAge() float64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	var oldest time.Duration
+	for _, t := range q.readyAt {
+		if age := now.Sub(t); age > oldest {
+			oldest = age
+		}
+	}
+	return oldest.Seconds()
+}
@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+)
+
+const readOnlySid = managedSidPrefix + "ReadOnly"
+
+const reasonWriteWindowElapsed = "WriteWindowElapsed"
+
+// writeActions are the object actions denied once the write window elapsed
+var writeActions = []string{
+	"s3:PutObject",
+	"s3:DeleteObject",
+	"s3:DeleteObjectVersion",
+	"s3:AbortMultipartUpload",
+	"s3:PutObjectTagging",
+	"s3:DeleteObjectTagging",
+}
+
+// isReadOnly reports whether the claim's write window elapsed
+func isReadOnly(claim *quv1.QuObjectBucketClaim) bool {
+	return claim.Status.Access != nil && claim.Status.Access.Mode == quv1.AccessModeReadOnly
+}
+
+// syncAccess starts the claim's write window when its bucket is first
+// provisioned and switches the bucket to read-only once the window elapsed.
+// It must run before the credentials are issued, so that temporary
+// credentials are issued read-only from then on.
+func (r *QuObjectBucketClaimReconciler) syncAccess(ctx context.Context, claim *quv1.QuObjectBucketClaim) {
+	window := claim.Spec.WriteWindow
+	if window == nil {
+		claim.Status.Access = nil
+		return
+	}
+	now := metav1.Now()
+	access := claim.Status.Access
+	if access == nil {
+		access = &quv1.BucketAccessStatus{Mode: quv1.AccessModeReadWrite, WindowStart: now}
+	}
+	until := metav1.NewTime(access.WindowStart.Add(window.Duration))
+	access.WritableUntil = &until
+	if now.Before(&until) {
+		access.Mode = quv1.AccessModeReadWrite
+		access.ReadOnlySince = nil
+	} else if access.Mode != quv1.AccessModeReadOnly {
+		access.Mode = quv1.AccessModeReadOnly
+		access.ReadOnlySince = &now
+		r.event(ctx, claim, corev1.EventTypeNormal, reasonWriteWindowElapsed,
+			"The write window of %s elapsed; the bucket is read-only", window.Duration)
+	}
+	claim.Status.Access = access
+}
+
+// writableFor returns how long the claim's bucket still accepts writes, or
+// zero without a pending write window
+func writableFor(claim *quv1.QuObjectBucketClaim) time.Duration {
+	access := claim.Status.Access
+	if access == nil || access.Mode != quv1.AccessModeReadWrite || access.WritableUntil == nil {
+		return 0
+	}
+	return time.Until(access.WritableUntil.Time)
+}
+
+// issuedBeforeReadOnly reports whether temporary credentials expiring at exp
+// were issued while the bucket was still writable, and so must be replaced
+func issuedBeforeReadOnly(claim *quv1.QuObjectBucketClaim, exp *metav1.Time) bool {
+	if !isReadOnly(claim) || claim.Status.Access.ReadOnlySince == nil || exp == nil {
+		return false
+	}
+	issued := exp.Add(-credentialsDuration(claim))
+	return issued.Before(claim.Status.Access.ReadOnlySince.Time)
+}
+
+// readOnlyStatements returns the bucket policy statements denying writes
+// once the write window elapsed
+func readOnlyStatements(claim *quv1.QuObjectBucketClaim, bucket string) []policyStatement {
+	// Like the quota, directory buckets are not covered by bucket policies
+	if !isReadOnly(claim) || isDirectoryBucket(claim) {
+		return nil
+	}
+	return []policyStatement{{
+		Sid:       readOnlySid,
+		Effect:    "Deny",
+		Principal: "*",
+		Action:    writeActions,
+		Resource:  []string{bucketARN(bucket, "*")},
+	}}
+}
@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/testutil"
+)
+
+// TestDeleteReadOnlyClaim deletes a claim with retainPolicy Delete whose
+// write window elapsed. The read-only statement denies deletes to everyone,
+// including the controller, so it must be lifted before the bucket is
+// drained.
+func TestDeleteReadOnlyClaim(t *testing.T) {
+	srv := testutil.NewS3Server()
+	defer srv.Close()
+	claim := &quv1.QuObjectBucketClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "archive", Namespace: "default"},
+		Spec: quv1.QuObjectBucketClaimSpec{
+			BucketName:   "archive",
+			RetainPolicy: quv1.RetainPolicyDelete,
+			WriteWindow:  &metav1.Duration{Duration: time.Nanosecond},
+		},
+	}
+	r := newTestReconciler(t, srv, claim)
+	key := client.ObjectKeyFromObject(claim)
+
+	readOnly := reconcileUntil(t, r, key, func(c *quv1.QuObjectBucketClaim) bool {
+		return c != nil && c.Status.Phase == quv1.ClaimPhaseBound && isReadOnly(c)
+	})
+	if policy := srv.Policy("archive"); !strings.Contains(policy, readOnlySid) {
+		t.Fatalf("bucket policy %s lacks the %s statement", policy, readOnlySid)
+	}
+	for i := 0; i < 10; i++ {
+		srv.PutObject("archive", fmt.Sprintf("record-%d", i), []byte("data"))
+	}
+
+	if err := r.Delete(context.Background(), readOnly); err != nil {
+		t.Fatal(err)
+	}
+	reconcileUntil(t, r, key, func(c *quv1.QuObjectBucketClaim) bool { return c == nil })
+	if srv.BucketExists("archive") {
+		t.Fatalf("bucket leaked with %d objects", len(srv.Objects("archive")))
+	}
+}
@@ -0,0 +1,356 @@
+package backend
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/pamvdam71/quobject-controller/internal/logging"
+)
+
+// Config holds the connection settings of an S3 backend as read from its
+// credentials secret
+type Config struct {
+	// Endpoint is the resolved primary endpoint for Region
+	Endpoint string
+	// Endpoints are all resolved equivalent endpoints, starting with Endpoint
+	Endpoints []string
+	// EndpointTemplates are the endpoints as configured, possibly containing
+	// a {region} placeholder
+	EndpointTemplates  []string
+	Region             string
+	AccessKey          string
+	SecretKey          string
+	UseSSL             bool
+	InsecureSkipVerify bool
+	// UsePathStyle selects path-style instead of virtual-hosted addressing
+	UsePathStyle bool
+	// CABundle is a PEM bundle of CAs trusted for the endpoint in addition
+	// to the system roots
+	CABundle []byte
+	// TLSMinVersion is the minimum TLS version of backend connections. Zero
+	// selects the Go default.
+	TLSMinVersion uint16
+	// TLSCipherSuites restricts the cipher suites of TLS 1.2 and earlier.
+	// Empty selects the Go defaults.
+	TLSCipherSuites []uint16
+	// ClientCertSecret names a kubernetes.io/tls secret in Namespace whose
+	// certificate authenticates the controller to the backend
+	ClientCertSecret string
+	// ClientCert is the certificate loaded from ClientCertSecret
+	ClientCert *tls.Certificate
+	// UseFIPSEndpoint and UseDualStackEndpoint make the SDK resolve the FIPS
+	// or dual-stack (IPv6) AWS endpoints instead of using Endpoint, which is
+	// then only published to clients
+	UseFIPSEndpoint      bool
+	UseDualStackEndpoint bool
+	// SignatureVersion selects how S3 requests are signed
+	SignatureVersion SignatureVersion
+	// DefaultRetainPolicy is the retain policy of claims that set none,
+	// either Retain or Delete. Empty selects Retain.
+	DefaultRetainPolicy string
+	// Headers are added to every S3 request, e.g. tenant or routing headers
+	// required by a gateway
+	Headers http.Header
+	// STSEndpoint and STSRoleARN configure AssumeRole for temporary
+	// credentials. The endpoint defaults to the S3 endpoint.
+	STSEndpoint string
+	STSRoleARN  string
+	// IAMEndpoint is the IAM API used to rotate the backend's access key. It
+	// defaults to the AWS endpoint on backends with apiProfile aws.
+	IAMEndpoint string
+	// Rotation configures the rotation of the backend's access key
+	Rotation CredentialsRotation
+	// OIDC is the OpenID Connect issuer trusted for web identity sessions
+	OIDC OIDCTrust
+	// Quobyte, if enabled, issues every claim its own user and access keys
+	Quobyte QuobyteAPI
+	// RGWTenant is the RGW tenant the backend's keys belong to. Generated
+	// bucket names are qualified with it as tenant:bucket, and claim users
+	// are created in it.
+	RGWTenant string
+	Profile   Profile
+}
+
+// ConfigFromSecret extracts the backend configuration from a credentials
+// secret. A missing or malformed required key is reported as an
+// *InvalidSecretError.
+func ConfigFromSecret(secret *corev1.Secret) (Config, error) {
+	if err := validateSecret(secret); err != nil {
+		return Config{}, err
+	}
+	cfg := Config{
+		Region:    string(secret.Data["region"]),
+		AccessKey: string(secret.Data["accessKey"]),
+		SecretKey: string(secret.Data["secretKey"]),
+	}
+	logging.SetSecrets(SecretsOwner(secret.Name), time.Time{}, cfg.AccessKey, cfg.SecretKey)
+
+	// A comma-separated list of equivalent gateways takes precedence over
+	// the single endpoint
+	for _, e := range strings.Split(string(secret.Data["endpoints"]), ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			cfg.EndpointTemplates = append(cfg.EndpointTemplates, e)
+		}
+	}
+	if len(cfg.EndpointTemplates) == 0 {
+		cfg.EndpointTemplates = []string{string(secret.Data["endpoint"])}
+	}
+	cfg = cfg.ForRegion("")
+
+	// Extract SSL configuration with defaults
+	cfg.UseSSL = true // default to HTTPS
+	if sslStr := string(secret.Data["useSSL"]); sslStr != "" {
+		cfg.UseSSL = parseBool(sslStr)
+	}
+
+	cfg.InsecureSkipVerify = false // default to verify certificates
+	if skipVerifyStr := string(secret.Data["insecureSkipVerify"]); skipVerifyStr != "" {
+		cfg.InsecureSkipVerify = parseBool(skipVerifyStr)
+	}
+
+	cfg.UsePathStyle = true // default to path-style addressing
+	if pathStyleStr := string(secret.Data["forcePathStyle"]); pathStyleStr != "" {
+		cfg.UsePathStyle = parseBool(pathStyleStr)
+	}
+
+	cfg.CABundle = secret.Data["caBundle"]
+	minVersion, suites, err := tlsFromSecret(secret)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.TLSMinVersion = minVersion
+	cfg.TLSCipherSuites = suites
+	cfg.ClientCertSecret = string(secret.Data["clientCertSecret"])
+	cfg.SignatureVersion, err = signatureFromSecret(secret, cfg.UsePathStyle)
+	if err != nil {
+		return Config{}, err
+	}
+	switch policy := string(secret.Data["defaultRetainPolicy"]); policy {
+	case "", "Retain", "Delete":
+		cfg.DefaultRetainPolicy = policy
+	default:
+		return Config{}, &InvalidSecretError{Secret: secret.Name, Key: "defaultRetainPolicy",
+			Problem: fmt.Sprintf("%q must be Retain or Delete", policy)}
+	}
+	cfg.Headers, err = headersFromSecret(secret)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.STSEndpoint = string(secret.Data["stsEndpoint"])
+	cfg.STSRoleARN = string(secret.Data["stsRoleArn"])
+
+	oidc, err := oidcFromSecret(secret)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.OIDC = oidc
+
+	profile, err := LookupProfile(string(secret.Data["apiProfile"]))
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.Profile = profile
+	cfg.Quobyte, err = quobyteFromSecret(secret)
+	if err != nil {
+		return Config{}, err
+	}
+	if cfg.Quobyte.Enabled() && !strings.EqualFold(string(secret.Data["apiProfile"]), "quobyte") {
+		return Config{}, &InvalidSecretError{Secret: secret.Name, Key: "quobyteApiUrl", Problem: "requires apiProfile quobyte"}
+	}
+	cfg.RGWTenant, err = rgwTenantFromSecret(secret, profile, cfg.UsePathStyle)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.UseFIPSEndpoint = parseBool(string(secret.Data["useFIPSEndpoint"]))
+	cfg.UseDualStackEndpoint = parseBool(string(secret.Data["useDualStackEndpoint"]))
+	// Only AWS has endpoints the SDK can resolve
+	if (cfg.UseFIPSEndpoint || cfg.UseDualStackEndpoint) && !strings.EqualFold(string(secret.Data["apiProfile"]), "aws") {
+		key := "useFIPSEndpoint"
+		if !cfg.UseFIPSEndpoint {
+			key = "useDualStackEndpoint"
+		}
+		return Config{}, &InvalidSecretError{Secret: secret.Name, Key: key, Problem: "requires apiProfile aws"}
+	}
+	cfg.IAMEndpoint = string(secret.Data["iamEndpoint"])
+	cfg.Rotation, err = rotationFromSecret(secret)
+	if err != nil {
+		return Config{}, err
+	}
+	if cfg.Rotation.Enabled() && !cfg.CanRotateCredentials() {
+		return Config{}, &InvalidSecretError{Secret: secret.Name, Key: "rotationInterval",
+			Problem: "requires apiProfile minio or aws, or an iamEndpoint"}
+	}
+	if cfg.Region == "" {
+		cfg.Region = profile.DefaultRegion
+		cfg = cfg.ForRegion("")
+	}
+
+	return cfg, nil
+}
+
+// ForRegion returns the configuration for the given region, resolving a
+// {region} placeholder in the endpoint. An empty region keeps the backend's
+// default region.
+func (c Config) ForRegion(region string) Config {
+	if region != "" {
+		c.Region = region
+	}
+	c.Endpoints = make([]string, len(c.EndpointTemplates))
+	for i, t := range c.EndpointTemplates {
+		c.Endpoints[i] = resolveEndpoint(t, c.Region)
+	}
+	if len(c.Endpoints) > 0 {
+		c.Endpoint = c.Endpoints[0]
+	}
+	return c
+}
+
+func resolveEndpoint(template, region string) string {
+	return strings.ReplaceAll(template, "{region}", region)
+}
+
+// NewS3Client creates a new S3 client with configurable SSL/TLS settings.
+// If limiter is non-nil, every request attempt waits on it before being sent.
+// Additional options are applied after the backend configuration.
+func NewS3Client(cfg Config, limiter *rate.Limiter, optFns ...func(*s3.Options)) (*s3.Client, error) {
+	// The SDK would only fail when signing the first request
+	if cfg.Region == "" {
+		return nil, errors.New("no region resolved for the backend: set region in the backend secret")
+	}
+	// Ensure endpoints have the correct protocol
+	endpoints := make([]string, len(cfg.Endpoints))
+	for i, e := range cfg.Endpoints {
+		endpoints[i] = withScheme(e, cfg.UseSSL)
+	}
+	var pool *endpointPool
+	if len(endpoints) > 1 {
+		p, err := poolFor(endpoints)
+		if err != nil {
+			return nil, err
+		}
+		pool = p
+	}
+
+	awsCfg, err := awsConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		o.BaseEndpoint = aws.String(withScheme(cfg.Endpoint, cfg.UseSSL))
+		o.UsePathStyle = cfg.UsePathStyle
+		if limiter != nil {
+			o.APIOptions = append(o.APIOptions, withRateLimit(limiter))
+		}
+		if cfg.UseFIPSEndpoint {
+			o.EndpointOptions.UseFIPSEndpoint = aws.FIPSEndpointStateEnabled
+		}
+		if cfg.UseDualStackEndpoint {
+			o.EndpointOptions.UseDualStackEndpoint = aws.DualStackEndpointStateEnabled
+		}
+		if cfg.UseFIPSEndpoint || cfg.UseDualStackEndpoint {
+			// The SDK rejects FIPS and dual-stack with a custom endpoint
+			o.BaseEndpoint = nil
+		}
+		if cfg.Profile.DisableChecksums || cfg.SignatureVersion == SignatureV2 {
+			o.APIOptions = append(o.APIOptions, withoutChecksums)
+		}
+		if len(cfg.Headers) > 0 {
+			o.APIOptions = append(o.APIOptions, withHeaders(cfg.Headers))
+		}
+		if cfg.SignatureVersion == SignatureV2 {
+			o.APIOptions = append(o.APIOptions, withSignatureV2(cfg.AccessKey, cfg.SecretKey))
+		}
+		for _, fn := range optFns {
+			fn(o)
+		}
+		// Options that resolve endpoints themselves opt out of the pool, and
+		// virtual-hosted addressing needs the bucket in the endpoint host
+		if pool != nil && o.BaseEndpoint != nil && o.UsePathStyle {
+			o.APIOptions = append(o.APIOptions, withEndpointPool(pool))
+		}
+	}), nil
+}
+
+// EndpointURL returns the primary endpoint including its scheme
+func (c Config) EndpointURL() string {
+	return withScheme(c.Endpoint, c.UseSSL)
+}
+
+// Scheme returns the URL scheme of the primary endpoint
+func (c Config) Scheme() string {
+	if u, err := url.Parse(c.EndpointURL()); err == nil && u.Scheme != "" {
+		return u.Scheme
+	}
+	if c.UseSSL {
+		return "https"
+	}
+	return "http"
+}
+
+// Port returns the port of the primary endpoint, defaulting to the port of
+// its scheme
+func (c Config) Port() string {
+	if u, err := url.Parse(c.EndpointURL()); err == nil && u.Port() != "" {
+		return u.Port()
+	}
+	if c.Scheme() == "http" {
+		return "80"
+	}
+	return "443"
+}
+
+// awsConfig returns the SDK configuration with the backend's credentials and
+// TLS settings
+func awsConfig(cfg Config) (aws.Config, error) {
+	tlsCfg, err := tlsConfig(cfg)
+	if err != nil {
+		return aws.Config{}, err
+	}
+	tr := &http.Transport{TLSClientConfig: tlsCfg}
+	hclient := &http.Client{Transport: tr}
+
+	var provider aws.CredentialsProvider = credentials.NewStaticCredentialsProvider(cfg.AccessKey, cfg.SecretKey, "")
+	if cfg.AccessKey == "" {
+		// The client certificate authenticates the controller
+		provider = aws.AnonymousCredentials{}
+	}
+	awsCfg, err := config.LoadDefaultConfig(
+		context.TODO(),
+		config.WithRegion(cfg.Region),
+		config.WithCredentialsProvider(provider),
+		config.WithHTTPClient(hclient),
+	)
+	if err != nil {
+		return aws.Config{}, err
+	}
+
+	return awsCfg, nil
+}
+
+func withScheme(endpoint string, useSSL bool) string {
+	if strings.HasPrefix(endpoint, "http://") || strings.HasPrefix(endpoint, "https://") {
+		return endpoint
+	}
+	if useSSL {
+		return "https://" + endpoint
+	}
+	return "http://" + endpoint
+}
+
+func parseBool(s string) bool {
+	return s == "true" || s == "1"
+}
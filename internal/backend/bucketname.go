@@ -0,0 +1,60 @@
+package backend
+
+import "strings"
+
+// OwnerMarkerKey is the object in every managed bucket that names the claim
+// owning it
+const OwnerMarkerKey = ".quobject/owner.json"
+
+// Prefixes and suffixes S3 reserves for its own bucket names
+var (
+	reservedBucketPrefixes = []string{"xn--", "sthree-", "amzn-s3-demo-"}
+	reservedBucketSuffixes = []string{"-s3alias", "--ol-s3", "--x-s3", "--table-s3"}
+)
+
+// SanitizeBucketName normalizes a name derived from a claim into a legal S3
+// bucket name:
+//
+//   - upper-case letters are lower-cased
+//   - characters other than a-z, 0-9, '.' and '-' become '-'
+//   - runs of dots collapse to one dot, and a dot next to a hyphen is dropped
+//   - leading and trailing dots and hyphens are trimmed
+//   - reserved prefixes get a "b-" prepended and reserved suffixes a "-b"
+//     appended
+//
+// An empty result becomes "bucket". The length is not limited.
+func SanitizeBucketName(name string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-':
+			sb.WriteRune(r)
+		case r == '.':
+			// The previous dot or hyphen already separates
+			if s := sb.String(); strings.HasSuffix(s, ".") || strings.HasSuffix(s, "-") {
+				continue
+			}
+			sb.WriteRune(r)
+		default:
+			sb.WriteRune('-')
+		}
+	}
+	s := strings.ReplaceAll(sb.String(), ".-", "-")
+	s = strings.Trim(s, ".-")
+	if s == "" {
+		return "bucket"
+	}
+	for _, p := range reservedBucketPrefixes {
+		if strings.HasPrefix(s, p) {
+			s = "b-" + s
+			break
+		}
+	}
+	for _, suffix := range reservedBucketSuffixes {
+		if strings.HasSuffix(s, suffix) {
+			s += "-b"
+			break
+		}
+	}
+	return s
+}
@@ -0,0 +1,85 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+)
+
+// classBackendPrefix tells the backends configured by a QuObjectBucketClass
+// from backend secrets, whose names cannot contain a slash
+const classBackendPrefix = "class/"
+
+// BackendNameForClass returns the backend name of a QuObjectBucketClass
+func BackendNameForClass(class string) string {
+	return classBackendPrefix + class
+}
+
+// ClassName returns the QuObjectBucketClass of a backend name, if the
+// backend is configured by one
+func ClassName(backendName string) (string, bool) {
+	return strings.CutPrefix(backendName, classBackendPrefix)
+}
+
+// resolveClass returns the configuration of the QuObjectBucketClass named
+// after the storage class. It reports false if there is none, including on
+// clusters without the QuObjectBucketClass CRD.
+func resolveClass(ctx context.Context, c client.Reader, storageClass string) (Config, bool, error) {
+	class := &quv1.QuObjectBucketClass{}
+	err := c.Get(ctx, types.NamespacedName{Name: storageClass}, class)
+	if apierrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+		return Config{}, false, nil
+	} else if err != nil {
+		return Config{}, false, fmt.Errorf("failed to get QuObjectBucketClass %s: %w", storageClass, err)
+	}
+	cfg, err := ConfigFromClass(ctx, c, class)
+	return cfg, true, err
+}
+
+// loadClass reads the named QuObjectBucketClass and returns its backend
+// configuration
+func loadClass(ctx context.Context, c client.Reader, name string) (Config, error) {
+	class := &quv1.QuObjectBucketClass{}
+	if err := c.Get(ctx, types.NamespacedName{Name: name}, class); err != nil {
+		return Config{}, fmt.Errorf("failed to get QuObjectBucketClass %s: %w", name, err)
+	}
+	return ConfigFromClass(ctx, c, class)
+}
+
+// ConfigFromClass returns the backend configuration of a QuObjectBucketClass.
+// The settings of the class override the keys of its credentials secret,
+// which is otherwise read like a backend secret.
+func ConfigFromClass(ctx context.Context, c client.Reader, class *quv1.QuObjectBucketClass) (Config, error) {
+	ref := class.Spec.CredentialsSecretRef.Name
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Name: ref, Namespace: Namespace}, secret); err != nil {
+		return Config{}, fmt.Errorf("failed to get credentials secret %s/%s of QuObjectBucketClass %s: %w",
+			Namespace, ref, class.Name, err)
+	}
+	merged := secret.DeepCopy()
+	if merged.Data == nil {
+		merged.Data = map[string][]byte{}
+	}
+	merged.Data["endpoint"] = []byte(class.Spec.Endpoint)
+	delete(merged.Data, "endpoints")
+	delete(merged.Data, "storageClasses")
+	if class.Spec.Region != "" {
+		merged.Data["region"] = []byte(class.Spec.Region)
+	}
+	if class.Spec.ForcePathStyle != nil {
+		merged.Data["forcePathStyle"] = []byte(strconv.FormatBool(*class.Spec.ForcePathStyle))
+	}
+	if class.Spec.DefaultRetainPolicy != "" {
+		merged.Data["defaultRetainPolicy"] = []byte(class.Spec.DefaultRetainPolicy)
+	}
+	return configFromSecret(ctx, c, merged)
+}
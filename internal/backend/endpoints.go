@@ -0,0 +1,120 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// endpointCooldown is how long an endpoint is skipped after a failure
+const endpointCooldown = 30 * time.Second
+
+// endpointPool spreads requests round-robin over equivalent endpoints of a
+// backend, skipping endpoints that recently failed
+type endpointPool struct {
+	endpoints []*url.URL
+
+	mu             sync.Mutex
+	next           int
+	unhealthyUntil []time.Time
+}
+
+// pools are shared by all clients of a backend so that selection and health
+// survive across reconciles
+var pools sync.Map
+
+// poolFor returns the shared pool for the given endpoint URLs
+func poolFor(endpoints []string) (*endpointPool, error) {
+	key := strings.Join(endpoints, ",")
+	if p, ok := pools.Load(key); ok {
+		return p.(*endpointPool), nil
+	}
+	p := &endpointPool{unhealthyUntil: make([]time.Time, len(endpoints))}
+	for _, e := range endpoints {
+		u, err := url.Parse(e)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid endpoint %q", e)
+		}
+		p.endpoints = append(p.endpoints, u)
+	}
+	actual, _ := pools.LoadOrStore(key, p)
+	return actual.(*endpointPool), nil
+}
+
+// pick returns the index of the next healthy endpoint. If all endpoints are
+// unhealthy, the one that becomes available first is used.
+func (p *endpointPool) pick() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	best := -1
+	for i := 0; i < len(p.endpoints); i++ {
+		idx := (p.next + i) % len(p.endpoints)
+		if !now.Before(p.unhealthyUntil[idx]) {
+			best = idx
+			break
+		}
+		if best == -1 || p.unhealthyUntil[idx].Before(p.unhealthyUntil[best]) {
+			best = idx
+		}
+	}
+	p.next = (best + 1) % len(p.endpoints)
+	return best
+}
+
+// report records the outcome of a request sent to the endpoint at idx
+func (p *endpointPool) report(idx int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if endpointFailed(err) {
+		p.unhealthyUntil[idx] = time.Now().Add(endpointCooldown)
+	} else {
+		p.unhealthyUntil[idx] = time.Time{}
+	}
+}
+
+// endpointFailed reports whether err indicates a problem with the endpoint
+// itself (connection failure or server error) rather than the request
+func endpointFailed(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var respErr *smithyhttp.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.HTTPStatusCode() >= 500
+	}
+	return true
+}
+
+// withEndpointPool inserts a middleware that points each request attempt at
+// an endpoint of the pool. It runs after the retry middleware so retries can
+// go to another endpoint, and before signing because the host is signed.
+func withEndpointPool(pool *endpointPool) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		return stack.Finalize.Insert(
+			middleware.FinalizeMiddlewareFunc("QuObjectEndpointPool", func(
+				ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler,
+			) (middleware.FinalizeOutput, middleware.Metadata, error) {
+				req, ok := in.Request.(*smithyhttp.Request)
+				if !ok {
+					return next.HandleFinalize(ctx, in)
+				}
+				idx := pool.pick()
+				req.URL.Scheme = pool.endpoints[idx].Scheme
+				req.URL.Host = pool.endpoints[idx].Host
+				out, md, err := next.HandleFinalize(ctx, in)
+				pool.report(idx, err)
+				return out, md, err
+			}),
+			"Retry",
+			middleware.After,
+		)
+	}
+}
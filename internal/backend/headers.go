@@ -0,0 +1,84 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// reservedHeaders are set by the SDK or the signer and cannot be overridden
+var reservedHeaders = map[string]bool{
+	"Authorization":        true,
+	"Host":                 true,
+	"Content-Length":       true,
+	"Content-Md5":          true,
+	"Date":                 true,
+	"X-Amz-Date":           true,
+	"X-Amz-Content-Sha256": true,
+	"X-Amz-Security-Token": true,
+}
+
+// headersFromSecret reads the requestHeaders key of a backend secret: one
+// "Name: value" header per line, sent with every S3 request
+func headersFromSecret(secret *corev1.Secret) (http.Header, error) {
+	invalid := func(problem string) error {
+		return &InvalidSecretError{Secret: secret.Name, Key: "requestHeaders", Problem: problem}
+	}
+
+	var headers http.Header
+	for _, line := range strings.Split(string(secret.Data["requestHeaders"]), "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || !validHeaderName(name) || strings.ContainsAny(value, "\r\n\x00") {
+			return nil, invalid(fmt.Sprintf("%q is not a \"Name: value\" header", line))
+		}
+		name = textproto.CanonicalMIMEHeaderKey(name)
+		if reservedHeaders[name] {
+			return nil, invalid(fmt.Sprintf("header %s is set by the controller", name))
+		}
+		if headers == nil {
+			headers = http.Header{}
+		}
+		headers.Add(name, value)
+	}
+	return headers, nil
+}
+
+// withHeaders adds static headers to every request. It runs in the build
+// step so that the headers are signed.
+func withHeaders(headers http.Header) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		return stack.Build.Add(middleware.BuildMiddlewareFunc("QuObjectHeaders", func(
+			ctx context.Context, in middleware.BuildInput, next middleware.BuildHandler,
+		) (middleware.BuildOutput, middleware.Metadata, error) {
+			if req, ok := in.Request.(*smithyhttp.Request); ok {
+				for name, values := range headers {
+					req.Header[name] = append([]string(nil), values...)
+				}
+			}
+			return next.HandleBuild(ctx, in)
+		}), middleware.After)
+	}
+}
+
+// validHeaderName reports whether name is an RFC 7230 token
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if r > 0x7e || r <= ' ' || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,134 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"golang.org/x/time/rate"
+)
+
+// minioAdminPrefix is the path of version 3 of the MinIO admin API
+const minioAdminPrefix = "/minio/admin/v3"
+
+// PutCannedPolicy creates or replaces a named IAM policy through the MinIO
+// admin API
+func PutCannedPolicy(ctx context.Context, cfg Config, limiter *rate.Limiter, name string, policy []byte) error {
+	_, err := minioAdmin(ctx, cfg, limiter, http.MethodPut, "/add-canned-policy", url.Values{"name": {name}}, policy, nil)
+	return err
+}
+
+// DeleteCannedPolicy removes a named IAM policy through the MinIO admin API.
+// Removing a policy that does not exist is not an error.
+func DeleteCannedPolicy(ctx context.Context, cfg Config, limiter *rate.Limiter, name string) error {
+	_, err := minioAdmin(ctx, cfg, limiter, http.MethodDelete, "/remove-canned-policy", url.Values{"name": {name}}, nil, nil)
+	if err != nil && isAdminNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// SetBucketQuota sets a hard quota of size bytes on the bucket through the
+// MinIO admin API. A size of zero removes the quota.
+func SetBucketQuota(ctx context.Context, cfg Config, limiter *rate.Limiter, bucket string, size int64) error {
+	// Older servers read the size from "quota", newer ones from "size"
+	body, err := json.Marshal(map[string]any{"quota": size, "size": size, "quotatype": "hard"})
+	if err != nil {
+		return err
+	}
+	_, err = minioAdmin(ctx, cfg, limiter, http.MethodPut, "/set-bucket-quota", url.Values{"bucket": {bucket}}, body, nil)
+	return err
+}
+
+// adminError is an error response of the MinIO admin API
+type adminError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *adminError) Error() string {
+	return fmt.Sprintf("admin API returned %d: %s", e.StatusCode, e.Body)
+}
+
+func isAdminNotFound(err error) bool {
+	e, ok := err.(*adminError)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+// minioAdmin sends a SigV4-signed request to the MinIO admin API of the
+// backend's primary endpoint and returns the response headers
+func minioAdmin(
+	ctx context.Context,
+	cfg Config,
+	limiter *rate.Limiter,
+	method, path string,
+	query url.Values,
+	body []byte,
+	header http.Header,
+) (http.Header, error) {
+	if !cfg.Profile.MinIOAdmin {
+		return nil, fmt.Errorf("the backend's apiProfile does not provide the MinIO admin API")
+	}
+	return adminRequest(ctx, cfg, limiter, method, minioAdminPrefix+path, query, body, header)
+}
+
+// adminRequest sends a SigV4-signed request to an admin API served on the
+// backend's primary endpoint and returns the response headers
+func adminRequest(
+	ctx context.Context,
+	cfg Config,
+	limiter *rate.Limiter,
+	method, path string,
+	query url.Values,
+	body []byte,
+	header http.Header,
+) (http.Header, error) {
+	awsCfg, err := awsConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	u := cfg.EndpointURL() + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	sum := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(sum[:])
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	creds := aws.Credentials{AccessKeyID: cfg.AccessKey, SecretAccessKey: cfg.SecretKey}
+	if err := v4.NewSigner().SignHTTP(ctx, creds, req, payloadHash, "s3", cfg.Region, time.Now()); err != nil {
+		return nil, fmt.Errorf("failed to sign admin request: %w", err)
+	}
+	if limiter != nil {
+		if err := limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := awsCfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("admin request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &adminError{StatusCode: resp.StatusCode, Body: string(msg)}
+	}
+	return resp.Header, nil
+}
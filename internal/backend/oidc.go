@@ -0,0 +1,118 @@
+package backend
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/minio/madmin-go/v3"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// OpenIDProviderName is the name of the OpenID provider configuration the
+// controller manages on a backend
+const OpenIDProviderName = "quobject"
+
+// OIDCTrust describes the OpenID Connect issuer whose tokens the backend
+// accepts for AssumeRoleWithWebIdentity
+type OIDCTrust struct {
+	// Issuer is the issuer URL, normally the cluster's ServiceAccount issuer
+	Issuer string
+	// Audience is the audience tokens must be issued for
+	Audience string
+	// ClaimName is the token claim that names the policies of a session
+	ClaimName string
+	// RolePolicy, if set, is applied to every session instead of the
+	// policies named by ClaimName
+	RolePolicy string
+}
+
+// Enabled reports whether the backend trusts an OIDC issuer
+func (t OIDCTrust) Enabled() bool {
+	return t.Issuer != ""
+}
+
+// oidcFromSecret reads the OIDC trust settings of a backend secret
+func oidcFromSecret(secret *corev1.Secret) (OIDCTrust, error) {
+	t := OIDCTrust{
+		Issuer:     strings.TrimSuffix(string(secret.Data["oidcIssuer"]), "/"),
+		Audience:   string(secret.Data["oidcAudience"]),
+		ClaimName:  string(secret.Data["oidcClaimName"]),
+		RolePolicy: string(secret.Data["oidcRolePolicy"]),
+	}
+	if !t.Enabled() {
+		return t, nil
+	}
+	if u, err := url.Parse(t.Issuer); err != nil || u.Scheme != "https" || u.Host == "" {
+		return OIDCTrust{}, fmt.Errorf("oidcIssuer %q must be an https URL", t.Issuer)
+	}
+	if t.Audience == "" {
+		return OIDCTrust{}, errors.New("oidcAudience is required with oidcIssuer")
+	}
+	if t.ClaimName == "" {
+		// Maps ServiceAccount subjects to the policies of the same name
+		t.ClaimName = "sub"
+	}
+	return t, nil
+}
+
+// Fingerprint identifies the provider configuration so that unchanged
+// settings are not applied again
+func (t OIDCTrust) Fingerprint() string {
+	sum := sha256.Sum256([]byte(t.identityConfig()))
+	return hex.EncodeToString(sum[:8])
+}
+
+// identityConfig renders the trust as MinIO identity_openid settings
+func (t OIDCTrust) identityConfig() string {
+	kvs := []string{
+		"config_url=" + t.Issuer + "/.well-known/openid-configuration",
+		"client_id=" + t.Audience,
+	}
+	if t.RolePolicy != "" {
+		kvs = append(kvs, "role_policy="+t.RolePolicy)
+	} else {
+		kvs = append(kvs, "claim_name="+t.ClaimName)
+	}
+	return strings.Join(kvs, " ")
+}
+
+// ConfigureOpenID creates or updates the backend's OpenID provider from its
+// OIDC trust settings through the MinIO admin API. It reports whether the
+// backend must be restarted to apply the change.
+func ConfigureOpenID(ctx context.Context, cfg Config, limiter *rate.Limiter) (restart bool, err error) {
+	payload, err := encryptAdminPayload(cfg.SecretKey, []byte(cfg.OIDC.identityConfig()))
+	if err != nil {
+		return false, err
+	}
+	header := http.Header{"Content-Type": {"application/octet-stream"}}
+	path := "/idp-config/openid/" + OpenIDProviderName
+
+	// Adding fails for an existing provider, which is updated instead
+	h, err := minioAdmin(ctx, cfg, limiter, http.MethodPut, path, nil, payload, header)
+	var adminErr *adminError
+	if errors.As(err, &adminErr) && (adminErr.StatusCode == http.StatusConflict ||
+		strings.Contains(adminErr.Body, "AlreadyExists")) {
+		h, err = minioAdmin(ctx, cfg, limiter, http.MethodPost, path, nil, payload, header)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to configure OpenID provider: %w", err)
+	}
+	return h.Get("X-Minio-Config-Applied") != "true", nil
+}
+
+// encryptAdminPayload encrypts a configuration payload for the MinIO admin
+// API with the backend's secret key
+func encryptAdminPayload(password string, data []byte) ([]byte, error) {
+	payload, err := madmin.EncryptData(password, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt admin payload: %w", err)
+	}
+	return payload, nil
+}
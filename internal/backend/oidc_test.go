@@ -0,0 +1,27 @@
+package backend
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/minio/madmin-go/v3"
+)
+
+func TestEncryptAdminPayloadRoundTrip(t *testing.T) {
+	trust := OIDCTrust{Issuer: "https://kubernetes.default.svc", Audience: "sts.min.io", ClaimName: "sub"}
+	data := []byte(trust.identityConfig())
+	payload, err := encryptAdminPayload("backend-secret-key", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := madmin.DecryptData("backend-secret-key", bytes.NewReader(payload))
+	if err != nil {
+		t.Fatalf("MinIO cannot decrypt the payload: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("decrypted %q, want %q", got, data)
+	}
+	if _, err := madmin.DecryptData("another-secret-key", bytes.NewReader(payload)); err == nil {
+		t.Fatal("payload decrypted with the wrong secret key")
+	}
+}
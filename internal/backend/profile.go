@@ -0,0 +1,142 @@
+package backend
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/smithy-go/middleware"
+)
+
+// Profile adjusts the controller to the quirks of an S3-compatible API
+type Profile struct {
+	// SkipLocationConstraint omits the location constraint from CreateBucket
+	// for APIs that reject it
+	SkipLocationConstraint bool
+	// DisableChecksums stops the SDK from sending flexible checksum headers
+	// and validating response checksums. Content-MD5 is still sent for
+	// operations that require it.
+	DisableChecksums bool
+	// BucketExistsErrors are lower-case substrings of CreateBucket errors that
+	// mean the bucket already exists and can be adopted
+	BucketExistsErrors []string
+	// MinIOAdmin enables features that manage identities through the MinIO
+	// admin API, such as ServiceAccount access to buckets
+	MinIOAdmin bool
+	// IAM provides the IAM API, through which the controller rotates the
+	// backend's own access key and manages the users of claims with
+	// dedicated credentials
+	IAM bool
+	// RGWAdmin provides the Ceph RGW admin ops API, through which the
+	// controller manages the users of claims with dedicated credentials
+	RGWAdmin bool
+	// DefaultRegion is used when the backend secret sets no region. Empty
+	// requires the secret to set one.
+	DefaultRegion string
+	// LocationHints sends a claim's location hint as the location
+	// constraint of CreateBucket instead of the region
+	LocationHints bool
+	// PlacementTargets appends a claim's placement target to the location
+	// constraint as "<location>:<target>" and sends its storage policy as
+	// the storage class of CreateBucket, as Ceph RGW expects
+	PlacementTargets bool
+}
+
+// defaultBucketExistsErrors only accepts buckets the credentials own.
+// BucketAlreadyExists means another account owns the name, so it must not
+// be adopted; profiles of backends that report it for buckets of the
+// credentials themselves add it explicitly. Those buckets are normally found
+// by HeadBucket before CreateBucket is tried.
+var defaultBucketExistsErrors = []string{"bucketalreadyownedbyyou"}
+
+// profiles are the supported values of the apiProfile backend setting
+var profiles = map[string]Profile{
+	"generic": {
+		BucketExistsErrors: defaultBucketExistsErrors,
+		DefaultRegion:      "us-east-1",
+	},
+	"minio": {
+		BucketExistsErrors: defaultBucketExistsErrors,
+		MinIOAdmin:         true,
+		DefaultRegion:      "us-east-1",
+	},
+	"aws": {
+		BucketExistsErrors: defaultBucketExistsErrors,
+		IAM:                true,
+	},
+	"r2": {
+		// R2 only knows the "auto" location and rejects AWS region names
+		SkipLocationConstraint: true,
+		DisableChecksums:       true,
+		BucketExistsErrors:     defaultBucketExistsErrors,
+		DefaultRegion:          "auto",
+	},
+	"backblaze": {
+		// The region is implied by the endpoint
+		SkipLocationConstraint: true,
+		DisableChecksums:       true,
+		BucketExistsErrors:     append([]string{"duplicate_bucket_name"}, defaultBucketExistsErrors...),
+	},
+	"rgw": {
+		// The location constraint names the zonegroup and placement target
+		BucketExistsErrors: defaultBucketExistsErrors,
+		LocationHints:      true,
+		PlacementTargets:   true,
+		RGWAdmin:           true,
+		DefaultRegion:      "us-east-1",
+	},
+	"quobyte": {
+		BucketExistsErrors: defaultBucketExistsErrors,
+		DefaultRegion:      "us-east-1",
+	},
+	"wasabi": {
+		DisableChecksums:   true,
+		BucketExistsErrors: defaultBucketExistsErrors,
+	},
+}
+
+// LookupProfile returns the named API profile. An empty name selects the
+// generic profile.
+func LookupProfile(name string) (Profile, error) {
+	if name == "" {
+		name = "generic"
+	}
+	p, ok := profiles[strings.ToLower(name)]
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for n := range profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return Profile{}, fmt.Errorf("unknown apiProfile %q (supported: %s)", name, strings.Join(names, ", "))
+	}
+	return p, nil
+}
+
+// IsBucketExists reports whether a CreateBucket error means the bucket
+// already exists
+func (p Profile) IsBucketExists(err error) bool {
+	if err == nil {
+		return false
+	}
+	l := strings.ToLower(err.Error())
+	for _, s := range p.BucketExistsErrors {
+		if strings.Contains(l, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutChecksums removes the flexible checksum setup middlewares so no
+// checksum algorithm is ever selected for a request or response
+func withoutChecksums(stack *middleware.Stack) error {
+	for _, id := range []string{"AWSChecksum:SetupInputContext", "AWSChecksum:SetupOutputContext"} {
+		if _, ok := stack.Initialize.Get(id); ok {
+			if _, err := stack.Initialize.Remove(id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/pamvdam71/quobject-controller/internal/logging"
+)
+
+// QuobyteAPI is the Quobyte management API used to create a dedicated S3
+// user with its own access keys per claim, so the backend's keys are never
+// handed to clients
+type QuobyteAPI struct {
+	// URL is the JSON-RPC endpoint of the API service, e.g.
+	// https://quobyte-api.quobyte:7860
+	URL      string
+	User     string
+	Password string
+	// Tenant is the tenant the claim users are created in
+	Tenant string
+}
+
+// Enabled reports whether claims get their own Quobyte users
+func (q QuobyteAPI) Enabled() bool {
+	return q.URL != ""
+}
+
+// quobyteFromSecret reads the Quobyte management API settings of a backend
+// secret
+func quobyteFromSecret(secret *corev1.Secret) (QuobyteAPI, error) {
+	q := QuobyteAPI{
+		URL:      strings.TrimSuffix(string(secret.Data["quobyteApiUrl"]), "/"),
+		User:     string(secret.Data["quobyteApiUser"]),
+		Password: string(secret.Data["quobyteApiPassword"]),
+		Tenant:   string(secret.Data["quobyteTenant"]),
+	}
+	if !q.Enabled() {
+		return q, nil
+	}
+	if u, err := url.Parse(q.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return QuobyteAPI{}, &InvalidSecretError{Secret: secret.Name, Key: "quobyteApiUrl",
+			Problem: fmt.Sprintf("%q must be an http or https URL", q.URL)}
+	}
+	for key, v := range map[string]string{"quobyteApiUser": q.User, "quobyteApiPassword": q.Password, "quobyteTenant": q.Tenant} {
+		if v == "" {
+			return QuobyteAPI{}, &InvalidSecretError{Secret: secret.Name, Key: key, Problem: "is required with quobyteApiUrl"}
+		}
+	}
+	logging.SetSecrets(SecretsOwner(secret.Name)+"/quobyte", time.Time{}, q.Password)
+	return q, nil
+}
+
+// QuobyteAccessKey is an S3 access key pair of a Quobyte user
+type QuobyteAccessKey struct {
+	AccessKeyID     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+}
+
+// quobyteError is an error response of the Quobyte management API
+type quobyteError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *quobyteError) Error() string {
+	return fmt.Sprintf("Quobyte API returned %d: %s", e.Code, e.Message)
+}
+
+func isQuobyteError(err error, substr string) bool {
+	var e *quobyteError
+	return errors.As(err, &e) && strings.Contains(strings.ToLower(e.Message), substr)
+}
+
+// CreateQuobyteUser creates a user in the backend's tenant without
+// permissions beyond S3 access to what it is granted. A user that already
+// exists is kept.
+func CreateQuobyteUser(ctx context.Context, cfg Config, limiter *rate.Limiter, name string) error {
+	// Users authenticate with access keys only; the password is never used
+	password := make([]byte, 24)
+	if _, err := rand.Read(password); err != nil {
+		return err
+	}
+	err := quobyteCall(ctx, cfg, limiter, "createUser", map[string]any{
+		"user_name":           name,
+		"member_of_tenant_id": []string{cfg.Quobyte.Tenant},
+		"password":            hex.EncodeToString(password),
+	}, nil)
+	if err != nil && isQuobyteError(err, "exist") {
+		return nil
+	}
+	return err
+}
+
+// DeleteQuobyteUser deletes a user together with its access keys. Deleting
+// a user that does not exist is not an error.
+func DeleteQuobyteUser(ctx context.Context, cfg Config, limiter *rate.Limiter, name string) error {
+	err := quobyteCall(ctx, cfg, limiter, "deleteUser", map[string]any{"user_name": name}, nil)
+	if err != nil && (isQuobyteError(err, "not found") || isQuobyteError(err, "does not exist")) {
+		return nil
+	}
+	return err
+}
+
+// CreateQuobyteAccessKey creates a new S3 access key pair for the user
+func CreateQuobyteAccessKey(ctx context.Context, cfg Config, limiter *rate.Limiter, user string) (QuobyteAccessKey, error) {
+	var resp struct {
+		Credentials QuobyteAccessKey `json:"access_key_credentials"`
+	}
+	err := quobyteCall(ctx, cfg, limiter, "createAccessKeyCredentials", map[string]any{
+		"user_name": user,
+		"tenant_id": cfg.Quobyte.Tenant,
+	}, &resp)
+	if err != nil {
+		return QuobyteAccessKey{}, err
+	}
+	if resp.Credentials.AccessKeyID == "" || resp.Credentials.SecretAccessKey == "" {
+		return QuobyteAccessKey{}, errors.New("Quobyte API returned no access key")
+	}
+	return resp.Credentials, nil
+}
+
+// quobyteCall sends a JSON-RPC 2.0 request to the Quobyte management API,
+// authenticated with the API user, and decodes its result into result
+func quobyteCall(
+	ctx context.Context,
+	cfg Config,
+	limiter *rate.Limiter,
+	method string,
+	params, result any,
+) error {
+	if !cfg.Quobyte.Enabled() {
+		return errors.New("the backend does not configure the Quobyte management API")
+	}
+	awsCfg, err := awsConfig(cfg)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": "1", "method": method, "params": params})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.Quobyte.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(cfg.Quobyte.User, cfg.Quobyte.Password)
+	if limiter != nil {
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+
+	resp, err := awsCfg.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Quobyte API request %s failed: %w", method, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read Quobyte API response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		return &quobyteError{Code: resp.StatusCode, Message: string(data)}
+	}
+	var rpc struct {
+		Result json.RawMessage `json:"result"`
+		Error  *quobyteError   `json:"error"`
+	}
+	if err := json.Unmarshal(data, &rpc); err != nil {
+		return fmt.Errorf("malformed Quobyte API response: %w", err)
+	}
+	if rpc.Error != nil {
+		return rpc.Error
+	}
+	if result == nil || len(rpc.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(rpc.Result, result)
+}
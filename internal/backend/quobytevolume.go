@@ -0,0 +1,228 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Keys of spec.additionalConfig applied to the Quobyte volume backing a
+// claim's bucket on backends with the Quobyte management API
+const (
+	// QuobyteKeyPrefix prefixes all Quobyte keys. Unknown keys with the
+	// prefix are rejected instead of ignored, so typos are noticed.
+	QuobyteKeyPrefix = "quobyte.io/"
+	// QuobyteKeyQuota limits the logical disk space of the volume, as a
+	// quantity like 100Gi
+	QuobyteKeyQuota = QuobyteKeyPrefix + "quota"
+	// QuobyteKeyFileQuota limits the number of files of the volume
+	QuobyteKeyFileQuota = QuobyteKeyPrefix + "file-quota"
+	// QuobyteKeyPolicyPreset applies the policies of a Quobyte policy preset,
+	// e.g. for replication or tiering, to the volume
+	QuobyteKeyPolicyPreset = QuobyteKeyPrefix + "policy-preset"
+)
+
+// QuobyteVolumeConfig is the configuration of a bucket's Quobyte volume
+// requested through spec.additionalConfig. Zero values leave the setting
+// at the tenant's default.
+type QuobyteVolumeConfig struct {
+	// Quota is the logical disk space limit in bytes
+	Quota int64
+	// FileQuota is the file count limit
+	FileQuota int64
+	// PolicyPreset names the policy preset applied to the volume
+	PolicyPreset string
+}
+
+// IsZero reports whether the configuration requests nothing
+func (c QuobyteVolumeConfig) IsZero() bool {
+	return c == QuobyteVolumeConfig{}
+}
+
+// ParseQuobyteConfig returns the Quobyte volume configuration of the
+// additionalConfig of a claim. Keys without QuobyteKeyPrefix are not
+// interpreted and are returned in ignored.
+func ParseQuobyteConfig(additional map[string]string) (cfg QuobyteVolumeConfig, ignored []string, err error) {
+	var errs []error
+	for key, value := range additional {
+		switch key {
+		case QuobyteKeyQuota:
+			q, perr := resource.ParseQuantity(value)
+			if perr != nil || q.Sign() <= 0 {
+				errs = append(errs, fmt.Errorf("%s %q must be a positive quantity, e.g. 100Gi", key, value))
+				continue
+			}
+			cfg.Quota = q.Value()
+		case QuobyteKeyFileQuota:
+			n, perr := strconv.ParseInt(value, 10, 64)
+			if perr != nil || n <= 0 {
+				errs = append(errs, fmt.Errorf("%s %q must be a positive integer", key, value))
+				continue
+			}
+			cfg.FileQuota = n
+		case QuobyteKeyPolicyPreset:
+			if strings.TrimSpace(value) == "" || strings.TrimSpace(value) != value {
+				errs = append(errs, fmt.Errorf("%s %q must be the name of a policy preset", key, value))
+				continue
+			}
+			cfg.PolicyPreset = value
+		default:
+			if strings.HasPrefix(key, QuobyteKeyPrefix) {
+				errs = append(errs, fmt.Errorf("%s is not a known Quobyte key; supported are %s, %s and %s",
+					key, QuobyteKeyQuota, QuobyteKeyFileQuota, QuobyteKeyPolicyPreset))
+				continue
+			}
+			ignored = append(ignored, key)
+		}
+	}
+	sort.Strings(ignored)
+	// Report the errors in a stable order
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return cfg, ignored, errors.Join(errs...)
+}
+
+// ResolveQuobyteVolume returns the UUID of the volume backing a bucket.
+// Quobyte stores each bucket in a volume of the same name in the tenant.
+func ResolveQuobyteVolume(ctx context.Context, cfg Config, limiter *rate.Limiter, bucket string) (string, error) {
+	var resp struct {
+		VolumeUUID string `json:"volume_uuid"`
+	}
+	err := quobyteCall(ctx, cfg, limiter, "resolveVolumeName", map[string]any{
+		"volume_name":   bucket,
+		"tenant_domain": cfg.Quobyte.Tenant,
+	}, &resp)
+	if err != nil {
+		return "", err
+	}
+	if resp.VolumeUUID == "" {
+		return "", fmt.Errorf("Quobyte API found no volume for bucket %s", bucket)
+	}
+	return resp.VolumeUUID, nil
+}
+
+// SetQuobyteVolumeQuota sets the disk space and file count limits of a
+// volume. A zero limit is not sent, so setting both to zero removes the
+// volume's quota.
+func SetQuobyteVolumeQuota(ctx context.Context, cfg Config, limiter *rate.Limiter, volume string, bytes, files int64) error {
+	limits := []map[string]any{}
+	if bytes > 0 {
+		limits = append(limits, map[string]any{"type": "LOGICAL_DISK_SPACE", "value": bytes})
+	}
+	if files > 0 {
+		limits = append(limits, map[string]any{"type": "FILE_COUNT", "value": files})
+	}
+	return quobyteCall(ctx, cfg, limiter, "setQuota", map[string]any{
+		"quotas": []map[string]any{{
+			"consumer": []map[string]any{{
+				"type":       "VOLUME",
+				"identifier": volume,
+				"tenant_id":  cfg.Quobyte.Tenant,
+			}},
+			"limits": limits,
+		}},
+	}, nil)
+}
+
+// quobytePolicyRule is a Quobyte policy rule, reduced to the fields the
+// controller manages
+type quobytePolicyRule struct {
+	UUID        string         `json:"uuid,omitempty"`
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Enabled     bool           `json:"enabled"`
+	Scope       map[string]any `json:"scope"`
+	Policies    map[string]any `json:"policies"`
+}
+
+// ApplyQuobytePolicyPreset creates or updates the policy rule named rule
+// that applies the policies of the preset to a volume, and returns the
+// rule's UUID
+func ApplyQuobytePolicyPreset(
+	ctx context.Context,
+	cfg Config,
+	limiter *rate.Limiter,
+	rule, volume, preset string,
+) (string, error) {
+	var presets struct {
+		Presets []struct {
+			Name     string         `json:"name"`
+			Policies map[string]any `json:"policies"`
+		} `json:"policy_preset"`
+	}
+	if err := quobyteCall(ctx, cfg, limiter, "getPolicyPresets", map[string]any{}, &presets); err != nil {
+		return "", err
+	}
+	var policies map[string]any
+	for _, p := range presets.Presets {
+		if p.Name == preset {
+			policies = p.Policies
+			break
+		}
+	}
+	if policies == nil {
+		return "", fmt.Errorf("Quobyte policy preset %q does not exist", preset)
+	}
+
+	desired := quobytePolicyRule{
+		Name:        rule,
+		Description: "Managed by quobject-controller",
+		Enabled:     true,
+		Scope:       map[string]any{"volume": map[string]any{"uuid": []string{volume}}},
+		Policies:    policies,
+	}
+	existing, err := findQuobytePolicyRule(ctx, cfg, limiter, rule)
+	if err != nil {
+		return "", err
+	}
+	if existing != "" {
+		desired.UUID = existing
+		if err := quobyteCall(ctx, cfg, limiter, "updatePolicyRule", map[string]any{"policy_rule": desired}, nil); err != nil {
+			return "", err
+		}
+		return existing, nil
+	}
+	var created struct {
+		UUID string `json:"policy_rule_uuid"`
+	}
+	if err := quobyteCall(ctx, cfg, limiter, "createPolicyRule", map[string]any{"policy_rule": desired}, &created); err != nil {
+		return "", err
+	}
+	return created.UUID, nil
+}
+
+// DeleteQuobytePolicyRule deletes the named policy rule. Deleting a rule
+// that does not exist is not an error.
+func DeleteQuobytePolicyRule(ctx context.Context, cfg Config, limiter *rate.Limiter, rule string) error {
+	uuid, err := findQuobytePolicyRule(ctx, cfg, limiter, rule)
+	if err != nil || uuid == "" {
+		return err
+	}
+	err = quobyteCall(ctx, cfg, limiter, "deletePolicyRule", map[string]any{"policy_rule_uuid": uuid}, nil)
+	if err != nil && (isQuobyteError(err, "not found") || isQuobyteError(err, "does not exist")) {
+		return nil
+	}
+	return err
+}
+
+// findQuobytePolicyRule returns the UUID of the named policy rule, or an
+// empty one if there is none
+func findQuobytePolicyRule(ctx context.Context, cfg Config, limiter *rate.Limiter, rule string) (string, error) {
+	var resp struct {
+		Rules []quobytePolicyRule `json:"policy_rule"`
+	}
+	if err := quobyteCall(ctx, cfg, limiter, "getPolicyRules", map[string]any{}, &resp); err != nil {
+		return "", err
+	}
+	for _, r := range resp.Rules {
+		if r.Name == rule {
+			return r.UUID, nil
+		}
+	}
+	return "", nil
+}
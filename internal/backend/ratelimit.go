@@ -0,0 +1,40 @@
+package backend
+
+import (
+	"context"
+
+	"github.com/aws/smithy-go/middleware"
+	"golang.org/x/time/rate"
+)
+
+// NewRateLimiter returns the limiter shared by all S3 clients of the
+// controller, or nil if qps is not positive (unlimited)
+func NewRateLimiter(qps float64, burst int) *rate.Limiter {
+	if qps <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return rate.NewLimiter(rate.Limit(qps), burst)
+}
+
+// withRateLimit inserts a middleware that waits on the limiter before each
+// request attempt. It runs after the retry middleware so that retries are
+// throttled too, and before signing so signatures are not delayed.
+func withRateLimit(limiter *rate.Limiter) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		return stack.Finalize.Insert(
+			middleware.FinalizeMiddlewareFunc("QuObjectRateLimit", func(
+				ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler,
+			) (middleware.FinalizeOutput, middleware.Metadata, error) {
+				if err := limiter.Wait(ctx); err != nil {
+					return middleware.FinalizeOutput{}, middleware.Metadata{}, err
+				}
+				return next.HandleFinalize(ctx, in)
+			}),
+			"Retry",
+			middleware.After,
+		)
+	}
+}
@@ -0,0 +1,225 @@
+package backend
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// minRotationInterval bounds how often the backend's keys may be rotated
+const minRotationInterval = time.Hour
+
+// defaultRotationGracePeriod is how long the previous key stays valid after
+// a rotation when the backend secret sets no rotationGracePeriod
+const defaultRotationGracePeriod = time.Hour
+
+// CredentialsRotation configures the rotation of the backend's own access
+// key by the controller
+type CredentialsRotation struct {
+	// Interval is the age at which the key is replaced. Zero disables
+	// rotation.
+	Interval time.Duration
+	// GracePeriod is how long the previous key stays valid, so that claim
+	// Secrets can be updated and their consumers pick up the new key
+	GracePeriod time.Duration
+}
+
+// Enabled reports whether the controller rotates the backend's key
+func (r CredentialsRotation) Enabled() bool {
+	return r.Interval > 0
+}
+
+// rotationFromSecret reads the rotation settings of a backend secret
+func rotationFromSecret(secret *corev1.Secret) (CredentialsRotation, error) {
+	var r CredentialsRotation
+	if v := string(secret.Data["rotationInterval"]); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < minRotationInterval {
+			return CredentialsRotation{}, &InvalidSecretError{Secret: secret.Name, Key: "rotationInterval",
+				Problem: fmt.Sprintf("%q must be a duration of at least %s", v, minRotationInterval)}
+		}
+		r.Interval = d
+	}
+	r.GracePeriod = defaultRotationGracePeriod
+	if v := string(secret.Data["rotationGracePeriod"]); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return CredentialsRotation{}, &InvalidSecretError{Secret: secret.Name, Key: "rotationGracePeriod",
+				Problem: fmt.Sprintf("%q must be a positive duration", v)}
+		}
+		r.GracePeriod = d
+	}
+	if r.Enabled() && r.GracePeriod >= r.Interval {
+		return CredentialsRotation{}, &InvalidSecretError{Secret: secret.Name, Key: "rotationGracePeriod",
+			Problem: "must be shorter than rotationInterval"}
+	}
+	return r, nil
+}
+
+// CanRotateCredentials reports whether the controller can issue new keys
+// for the identity of the backend's keys, through the MinIO admin API or
+// the IAM API
+func (c Config) CanRotateCredentials() bool {
+	return c.Profile.MinIOAdmin || c.Profile.IAM || c.IAMEndpoint != ""
+}
+
+// AccessKeyPair is an access key of the backend's own identity
+type AccessKeyPair struct {
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// CreateBackendAccessKey issues a new access key for the identity of the
+// backend's keys. On MinIO it is a service account of that identity, on
+// IAM an access key of its user.
+func CreateBackendAccessKey(ctx context.Context, cfg Config, limiter *rate.Limiter) (AccessKeyPair, error) {
+	if cfg.Profile.MinIOAdmin {
+		return createServiceAccount(ctx, cfg, limiter)
+	}
+	iamc, err := iamClient(cfg, limiter)
+	if err != nil {
+		return AccessKeyPair{}, err
+	}
+	out, err := iamc.CreateAccessKey(ctx, &iam.CreateAccessKeyInput{})
+	if err != nil {
+		return AccessKeyPair{}, fmt.Errorf("failed to create access key: %w", err)
+	}
+	if out.AccessKey == nil {
+		return AccessKeyPair{}, errors.New("failed to create access key: no key returned")
+	}
+	return AccessKeyPair{
+		AccessKeyID:     aws.ToString(out.AccessKey.AccessKeyId),
+		SecretAccessKey: aws.ToString(out.AccessKey.SecretAccessKey),
+	}, nil
+}
+
+// DeleteBackendAccessKey deletes a previous access key issued by
+// CreateBackendAccessKey, or on IAM any access key of the user. Deleting a
+// key that does not exist is not an error.
+func DeleteBackendAccessKey(ctx context.Context, cfg Config, limiter *rate.Limiter, accessKey string) error {
+	if cfg.Profile.MinIOAdmin {
+		_, err := minioAdmin(ctx, cfg, limiter, http.MethodDelete, "/delete-service-account",
+			url.Values{"accessKey": {accessKey}}, nil, nil)
+		if err != nil && isAdminNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	iamc, err := iamClient(cfg, limiter)
+	if err != nil {
+		return err
+	}
+	_, err = iamc.DeleteAccessKey(ctx, &iam.DeleteAccessKeyInput{AccessKeyId: aws.String(accessKey)})
+	var notFound *iamtypes.NoSuchEntityException
+	if errors.As(err, &notFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete access key: %w", err)
+	}
+	return nil
+}
+
+// DeleteStaleBackendAccessKeys deletes the access keys of the backend's IAM
+// user other than those to keep, such as a key created by a rotation that
+// failed to record it, and returns the deleted keys. IAM allows a user two
+// keys, so a stale one would make every later rotation fail. MinIO does not
+// limit service accounts, so nothing is deleted there.
+func DeleteStaleBackendAccessKeys(ctx context.Context, cfg Config, limiter *rate.Limiter, keep ...string) ([]string, error) {
+	if cfg.Profile.MinIOAdmin {
+		return nil, nil
+	}
+	iamc, err := iamClient(cfg, limiter)
+	if err != nil {
+		return nil, err
+	}
+	var stale []string
+	pages := iam.NewListAccessKeysPaginator(iamc, &iam.ListAccessKeysInput{})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list access keys: %w", err)
+		}
+		for _, key := range page.AccessKeyMetadata {
+			if id := aws.ToString(key.AccessKeyId); id != "" && !slices.Contains(keep, id) {
+				stale = append(stale, id)
+			}
+		}
+	}
+	var deleted []string
+	for _, id := range stale {
+		if err := DeleteBackendAccessKey(ctx, cfg, limiter, id); err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, id)
+	}
+	return deleted, nil
+}
+
+// createServiceAccount creates a MinIO service account with generated keys
+// for the requesting identity, or for its parent if the backend's keys are
+// a service account themselves
+func createServiceAccount(ctx context.Context, cfg Config, limiter *rate.Limiter) (AccessKeyPair, error) {
+	id := make([]byte, 12)
+	secret := make([]byte, 20)
+	if _, err := rand.Read(id); err != nil {
+		return AccessKeyPair{}, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return AccessKeyPair{}, err
+	}
+	key := AccessKeyPair{
+		AccessKeyID:     base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(id),
+		SecretAccessKey: hex.EncodeToString(secret),
+	}
+	body, err := json.Marshal(map[string]string{
+		"accessKey":   key.AccessKeyID,
+		"secretKey":   key.SecretAccessKey,
+		"description": "Backend credentials rotated by quobject-controller",
+	})
+	if err != nil {
+		return AccessKeyPair{}, err
+	}
+	payload, err := encryptAdminPayload(cfg.SecretKey, body)
+	if err != nil {
+		return AccessKeyPair{}, err
+	}
+	if _, err := minioAdmin(ctx, cfg, limiter, http.MethodPut, "/add-service-account", nil, payload, nil); err != nil {
+		return AccessKeyPair{}, fmt.Errorf("failed to create service account: %w", err)
+	}
+	return key, nil
+}
+
+// iamClient returns an IAM client for the backend. The endpoint defaults to
+// the one the SDK resolves for AWS.
+func iamClient(cfg Config, limiter *rate.Limiter) (*iam.Client, error) {
+	if !cfg.Profile.IAM && cfg.IAMEndpoint == "" {
+		return nil, errors.New("the backend provides neither the IAM API nor the MinIO admin API")
+	}
+	awsCfg, err := awsConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return iam.NewFromConfig(awsCfg, func(o *iam.Options) {
+		if cfg.IAMEndpoint != "" {
+			o.BaseEndpoint = aws.String(withScheme(cfg.IAMEndpoint, cfg.UseSSL))
+		}
+		if limiter != nil {
+			o.APIOptions = append(o.APIOptions, withRateLimit(limiter))
+		}
+	}), nil
+}
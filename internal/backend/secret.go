@@ -0,0 +1,195 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Namespace is the namespace holding backend credentials secrets
+const Namespace = "quobject-controller"
+
+// DefaultSecretName is the credentials secret of the default backend
+const DefaultSecretName = "s3-credentials"
+
+// ErrNoBackend is returned when a storage class resolves to no backend
+var ErrNoBackend = errors.New("no backend configured")
+
+// InvalidSecretError reports a backend secret key that is missing or
+// malformed
+type InvalidSecretError struct {
+	// Secret is the name of the backend secret
+	Secret string
+	// Key is the offending key
+	Key string
+	// Missing is true if the key is absent or empty
+	Missing bool
+	// Problem describes a malformed key
+	Problem string
+}
+
+func (e *InvalidSecretError) Error() string {
+	secret := "backend secret"
+	if e.Secret != "" {
+		secret = fmt.Sprintf("backend secret %s/%s", Namespace, e.Secret)
+	}
+	if e.Missing {
+		return fmt.Sprintf("%s is missing key %s", secret, e.Key)
+	}
+	return fmt.Sprintf("%s has an invalid key %s: %s", secret, e.Key, e.Problem)
+}
+
+// validateSecret checks that the keys every backend needs are present and
+// well-formed
+func validateSecret(secret *corev1.Secret) error {
+	invalid := func(key, problem string) error {
+		return &InvalidSecretError{Secret: secret.Name, Key: key, Missing: problem == "", Problem: problem}
+	}
+
+	endpointKey := "endpoint"
+	if len(secret.Data["endpoints"]) > 0 {
+		endpointKey = "endpoints"
+	}
+	keys := []string{endpointKey}
+	// The region may be left to the API profile, which is validated later
+	if profile, err := LookupProfile(string(secret.Data["apiProfile"])); err != nil ||
+		profile.DefaultRegion == "" || len(secret.Data["region"]) > 0 {
+		keys = append(keys, "region")
+	}
+	// Gateways authenticating clients by certificate need no access keys
+	if len(secret.Data["clientCertSecret"]) == 0 ||
+		len(secret.Data["accessKey"]) > 0 || len(secret.Data["secretKey"]) > 0 {
+		keys = append(keys, "accessKey", "secretKey")
+	}
+	for _, key := range keys {
+		value := string(secret.Data[key])
+		if value == "" {
+			return invalid(key, "")
+		}
+		// Typically a newline left by encoding the value with echo
+		if strings.TrimSpace(value) != value || (key != "endpoints" && strings.ContainsAny(value, " \t\r\n")) {
+			return invalid(key, "contains whitespace")
+		}
+	}
+	for _, e := range strings.Split(string(secret.Data[endpointKey]), ",") {
+		if e = strings.TrimSpace(e); e == "" {
+			continue
+		}
+		if strings.Contains(e, "://") && !strings.HasPrefix(e, "http://") && !strings.HasPrefix(e, "https://") {
+			return invalid(endpointKey, fmt.Sprintf("%q must use the http or https scheme", e))
+		}
+		u, err := url.Parse(withScheme(e, true))
+		if err != nil || u.Host == "" {
+			return invalid(endpointKey, fmt.Sprintf("%q is not a host or URL", e))
+		}
+	}
+	return nil
+}
+
+// SecretNameForStorageClass returns the name of the credentials secret
+// dedicated to a storage class
+func SecretNameForStorageClass(storageClass string) string {
+	return "quobject-" + storageClass + "-creds"
+}
+
+// IsSecretName reports whether a secret in Namespace configures a backend
+func IsSecretName(name string) bool {
+	return name == DefaultSecretName ||
+		(strings.HasPrefix(name, "quobject-") && strings.HasSuffix(name, "-creds"))
+}
+
+// SecretsOwner names the keys of a backend secret for log redaction
+func SecretsOwner(secretName string) string {
+	return "backend/" + secretName
+}
+
+// Resolve returns the name and configuration of the backend serving a
+// storage class. A storage class is served by the QuObjectBucketClass of the
+// same name, or by its dedicated secret if one exists, and otherwise by the
+// default backend, unless the default backend restricts the classes it
+// serves with a comma-separated storageClasses key. Claims without a storage
+// class always use the default backend.
+func Resolve(ctx context.Context, c client.Reader, storageClass string) (string, Config, error) {
+	if storageClass != "" {
+		if cfg, ok, err := resolveClass(ctx, c, storageClass); ok || err != nil {
+			return BackendNameForClass(storageClass), cfg, err
+		}
+		name := SecretNameForStorageClass(storageClass)
+		secret := &corev1.Secret{}
+		err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: Namespace}, secret)
+		if err == nil {
+			cfg, err := configFromSecret(ctx, c, secret)
+			return name, cfg, err
+		}
+		if !apierrors.IsNotFound(err) {
+			return "", Config{}, fmt.Errorf("failed to get backend secret %s/%s: %w", Namespace, name, err)
+		}
+	}
+
+	secret := &corev1.Secret{}
+	err := c.Get(ctx, types.NamespacedName{Name: DefaultSecretName, Namespace: Namespace}, secret)
+	if apierrors.IsNotFound(err) {
+		return "", Config{}, noBackendError(storageClass)
+	} else if err != nil {
+		return "", Config{}, fmt.Errorf("failed to get backend secret %s/%s: %w", Namespace, DefaultSecretName, err)
+	}
+	if storageClass != "" && !servesStorageClass(secret, storageClass) {
+		return "", Config{}, noBackendError(storageClass)
+	}
+	cfg, err := configFromSecret(ctx, c, secret)
+	return DefaultSecretName, cfg, err
+}
+
+func noBackendError(storageClass string) error {
+	if storageClass == "" {
+		return fmt.Errorf("%w: secret %s/%s not found", ErrNoBackend, Namespace, DefaultSecretName)
+	}
+	return fmt.Errorf("%w for storage class %q: create QuObjectBucketClass %s or secret %s/%s",
+		ErrNoBackend, storageClass, storageClass, Namespace, SecretNameForStorageClass(storageClass))
+}
+
+// servesStorageClass reports whether the default backend secret serves the
+// storage class
+func servesStorageClass(secret *corev1.Secret, storageClass string) bool {
+	classes, ok := secret.Data["storageClasses"]
+	if !ok {
+		return true
+	}
+	for _, c := range strings.Split(string(classes), ",") {
+		if strings.TrimSpace(c) == storageClass {
+			return true
+		}
+	}
+	return false
+}
+
+// Load reads the named credentials secret from Namespace, or the
+// QuObjectBucketClass of a class backend, and returns its backend
+// configuration
+func Load(ctx context.Context, c client.Reader, name string) (Config, error) {
+	if class, ok := ClassName(name); ok {
+		return loadClass(ctx, c, class)
+	}
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: Namespace}, secret); err != nil {
+		return Config{}, fmt.Errorf("failed to get backend secret %s/%s: %w", Namespace, name, err)
+	}
+	return configFromSecret(ctx, c, secret)
+}
+
+// configFromSecret extracts the backend configuration from a credentials
+// secret and loads the client certificate it references
+func configFromSecret(ctx context.Context, c client.Reader, secret *corev1.Secret) (Config, error) {
+	cfg, err := ConfigFromSecret(secret)
+	if err != nil {
+		return Config{}, err
+	}
+	return LoadClientCertificate(ctx, c, cfg)
+}
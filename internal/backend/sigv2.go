@@ -0,0 +1,141 @@
+package backend
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// SignatureVersion selects how S3 requests to a backend are signed
+type SignatureVersion string
+
+const (
+	// SignatureV4 is AWS Signature Version 4, the default
+	SignatureV4 SignatureVersion = "v4"
+	// SignatureV2 is the legacy AWS Signature Version 2 for appliances
+	// that do not support V4
+	SignatureV2 SignatureVersion = "v2"
+)
+
+// signatureFromSecret reads the signatureVersion key of a backend secret.
+// Signature V2 signs the bucket as part of the path, so it requires
+// path-style addressing.
+func signatureFromSecret(secret *corev1.Secret, usePathStyle bool) (SignatureVersion, error) {
+	switch v := SignatureVersion(strings.TrimSpace(string(secret.Data["signatureVersion"]))); v {
+	case "", SignatureV4:
+		return SignatureV4, nil
+	case SignatureV2:
+		if !usePathStyle {
+			return "", &InvalidSecretError{Secret: secret.Name, Key: "signatureVersion",
+				Problem: "v2 requires forcePathStyle to be true"}
+		}
+		return SignatureV2, nil
+	default:
+		return "", &InvalidSecretError{Secret: secret.Name, Key: "signatureVersion",
+			Problem: fmt.Sprintf("%q must be v2 or v4", v)}
+	}
+}
+
+// sigV2SubResources are the query parameters included in the signed
+// resource of a Signature V2 request
+var sigV2SubResources = map[string]bool{
+	"acl": true, "cors": true, "delete": true, "lifecycle": true, "location": true,
+	"logging": true, "notification": true, "partNumber": true, "policy": true,
+	"requestPayment": true, "restore": true, "tagging": true, "torrent": true,
+	"uploadId": true, "uploads": true, "versionId": true, "versioning": true,
+	"versions": true, "website": true,
+	"response-cache-control": true, "response-content-disposition": true,
+	"response-content-encoding": true, "response-content-language": true,
+	"response-content-type": true, "response-expires": true,
+}
+
+// withSignatureV2 replaces the Signature V4 signer of a client with a
+// Signature V2 signer using the backend's static keys
+func withSignatureV2(accessKey, secretKey string) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		_, err := stack.Finalize.Swap("Signing", middleware.FinalizeMiddlewareFunc("Signing", func(
+			ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler,
+		) (middleware.FinalizeOutput, middleware.Metadata, error) {
+			req, ok := in.Request.(*smithyhttp.Request)
+			if !ok {
+				return middleware.FinalizeOutput{}, middleware.Metadata{}, fmt.Errorf("unexpected request type %T", in.Request)
+			}
+			signV2(req.Request, accessKey, secretKey, time.Now())
+			return next.HandleFinalize(ctx, in)
+		}))
+		return err
+	}
+}
+
+// signV2 adds the Date and Authorization headers of Signature V2 to a
+// path-style request
+func signV2(req *http.Request, accessKey, secretKey string, now time.Time) {
+	// The Date header is signed instead
+	req.Header.Del("X-Amz-Date")
+	req.Header.Set("Date", now.UTC().Format(http.TimeFormat))
+	if accessKey == "" {
+		return
+	}
+
+	var amzHeaders []string
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") {
+			amzHeaders = append(amzHeaders, name+":"+strings.Join(values, ","))
+		}
+	}
+	sort.Strings(amzHeaders)
+
+	var sb strings.Builder
+	sb.WriteString(req.Method + "\n")
+	sb.WriteString(req.Header.Get("Content-MD5") + "\n")
+	sb.WriteString(req.Header.Get("Content-Type") + "\n")
+	sb.WriteString(req.Header.Get("Date") + "\n")
+	for _, h := range amzHeaders {
+		sb.WriteString(h + "\n")
+	}
+	sb.WriteString(sigV2Resource(req))
+
+	mac := hmac.New(sha1.New, []byte(secretKey))
+	mac.Write([]byte(sb.String()))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	req.Header.Set("Authorization", "AWS "+accessKey+":"+signature)
+}
+
+// sigV2Resource returns the canonicalized resource of a path-style request:
+// its escaped path followed by the signed sub-resources in sorted order
+func sigV2Resource(req *http.Request) string {
+	resource := req.URL.EscapedPath()
+	if resource == "" {
+		resource = "/"
+	}
+	query := req.URL.Query()
+	var keys []string
+	for k := range query {
+		if sigV2SubResources[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		sep := "&"
+		if i == 0 {
+			sep = "?"
+		}
+		resource += sep + k
+		if v := query.Get(k); v != "" {
+			resource += "=" + v
+		}
+	}
+	return resource
+}
@@ -0,0 +1,101 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"golang.org/x/time/rate"
+)
+
+// defaultRoleARN is sent when the backend names no role. MinIO ignores the
+// role of AssumeRole but the API requires one.
+const defaultRoleARN = "arn:xxx:xxx:xxx:xxxx"
+
+// TemporaryCredentials are short-lived credentials issued by STS
+type TemporaryCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      time.Time
+}
+
+// AssumeRoleForBucket obtains temporary credentials whose session policy
+// only allows access to the given bucket, and only reads if readOnly is set.
+// The STS endpoint defaults to the backend endpoint, which is where MinIO
+// serves STS.
+func AssumeRoleForBucket(
+	ctx context.Context,
+	cfg Config,
+	limiter *rate.Limiter,
+	bucket, sessionName string,
+	duration time.Duration,
+	readOnly bool,
+) (TemporaryCredentials, error) {
+	awsCfg, err := awsConfig(cfg)
+	if err != nil {
+		return TemporaryCredentials{}, err
+	}
+	endpoint := cfg.STSEndpoint
+	if endpoint == "" {
+		endpoint = cfg.EndpointURL()
+	}
+	stsc := sts.NewFromConfig(awsCfg, func(o *sts.Options) {
+		o.BaseEndpoint = aws.String(withScheme(endpoint, cfg.UseSSL))
+		if limiter != nil {
+			o.APIOptions = append(o.APIOptions, withRateLimit(limiter))
+		}
+	})
+
+	policy, err := bucketSessionPolicy(bucket, readOnly)
+	if err != nil {
+		return TemporaryCredentials{}, err
+	}
+	roleARN := cfg.STSRoleARN
+	if roleARN == "" {
+		roleARN = defaultRoleARN
+	}
+	out, err := stsc.AssumeRole(ctx, &sts.AssumeRoleInput{
+		RoleArn:         aws.String(roleARN),
+		RoleSessionName: aws.String(sessionName),
+		Policy:          aws.String(policy),
+		DurationSeconds: aws.Int32(int32(duration.Seconds())),
+	})
+	if err != nil {
+		return TemporaryCredentials{}, fmt.Errorf("failed to assume role: %w", err)
+	}
+	if out.Credentials == nil {
+		return TemporaryCredentials{}, fmt.Errorf("failed to assume role: no credentials returned")
+	}
+	return TemporaryCredentials{
+		AccessKeyID:     aws.ToString(out.Credentials.AccessKeyId),
+		SecretAccessKey: aws.ToString(out.Credentials.SecretAccessKey),
+		SessionToken:    aws.ToString(out.Credentials.SessionToken),
+		Expiration:      aws.ToTime(out.Credentials.Expiration),
+	}, nil
+}
+
+// bucketSessionPolicy returns a session policy allowing all S3 actions, or
+// only reads, on the bucket and its objects only
+func bucketSessionPolicy(bucket string, readOnly bool) (string, error) {
+	actions := []string{"s3:*"}
+	if readOnly {
+		actions = []string{"s3:Get*", "s3:List*"}
+	}
+	policy := map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []map[string]interface{}{{
+			"Effect": "Allow",
+			"Action": actions,
+			"Resource": []string{
+				BucketARN(bucket),
+				BucketARN(bucket) + "/*",
+			},
+		}},
+	}
+	data, err := json.Marshal(policy)
+	return string(data), err
+}
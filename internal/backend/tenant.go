@@ -0,0 +1,84 @@
+package backend
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// rgwTenantPattern matches the names RGW allows for tenants
+var rgwTenantPattern = regexp.MustCompile(`^[A-Za-z0-9_]{1,255}$`)
+
+// SplitTenantBucket splits a tenant-qualified RGW bucket name,
+// tenant:bucket, into its parts. Names without a tenant are returned as
+// they are with an empty tenant.
+func SplitTenantBucket(name string) (tenant, bucket string) {
+	if tenant, bucket, ok := strings.Cut(name, ":"); ok {
+		return tenant, bucket
+	}
+	return "", name
+}
+
+// QualifyBucketName returns the tenant-qualified name of a bucket in the
+// tenant. An empty tenant leaves the name unqualified.
+func QualifyBucketName(tenant, bucket string) string {
+	if tenant == "" {
+		return bucket
+	}
+	return tenant + ":" + bucket
+}
+
+// ValidTenant reports whether the tenant of a qualified bucket name is a
+// legal RGW tenant name
+func ValidTenant(tenant string) bool {
+	return rgwTenantPattern.MatchString(tenant)
+}
+
+// BucketARN returns the ARN of a bucket in policies. RGW expects the tenant
+// of a qualified bucket name as the account of the ARN,
+// arn:aws:s3::tenant:bucket, rather than as part of its resource.
+func BucketARN(bucket string) string {
+	tenant, name := SplitTenantBucket(bucket)
+	return "arn:aws:s3::" + tenant + ":" + name
+}
+
+// rgwTenantFromSecret reads the RGW tenant the backend's keys belong to, in
+// which generated bucket names and claim users are qualified
+func rgwTenantFromSecret(secret *corev1.Secret, profile Profile, usePathStyle bool) (string, error) {
+	tenant := string(secret.Data["rgwTenant"])
+	if tenant == "" {
+		return "", nil
+	}
+	if !profile.RGWAdmin {
+		return "", &InvalidSecretError{Secret: secret.Name, Key: "rgwTenant", Problem: "requires apiProfile rgw"}
+	}
+	if !ValidTenant(tenant) {
+		return "", &InvalidSecretError{Secret: secret.Name, Key: "rgwTenant",
+			Problem: fmt.Sprintf("%q must consist of letters, digits and underscores", tenant)}
+	}
+	if !usePathStyle {
+		return "", &InvalidSecretError{Secret: secret.Name, Key: "rgwTenant", Problem: "requires forcePathStyle"}
+	}
+	return tenant, nil
+}
+
+// CheckTenantBucket reports why a bucket name cannot be used with the
+// backend. Tenant-qualified names need the rgw apiProfile and path-style
+// addressing, as the colon is not allowed in host names.
+func (c Config) CheckTenantBucket(name string) error {
+	if !strings.Contains(name, ":") {
+		return nil
+	}
+	tenant, _ := SplitTenantBucket(name)
+	switch {
+	case !c.Profile.RGWAdmin:
+		return fmt.Errorf("tenant-qualified bucket name %q requires a backend with apiProfile rgw", name)
+	case !ValidTenant(tenant):
+		return fmt.Errorf("tenant %q of bucket name %q must consist of letters, digits and underscores", tenant, name)
+	case !c.UsePathStyle:
+		return fmt.Errorf("tenant-qualified bucket name %q requires path-style addressing (forcePathStyle)", name)
+	}
+	return nil
+}
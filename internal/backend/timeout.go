@@ -0,0 +1,27 @@
+package backend
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// WithOperationTimeout bounds each S3 operation, including its retries, to
+// the timeout. It runs first, so that time spent in the rate limiter counts
+// too.
+func WithOperationTimeout(timeout time.Duration) func(*s3.Options) {
+	return s3.WithAPIOptions(func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(
+			middleware.InitializeMiddlewareFunc("QuObjectOperationTimeout", func(
+				ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler,
+			) (middleware.InitializeOutput, middleware.Metadata, error) {
+				ctx, cancel := context.WithTimeout(ctx, timeout)
+				defer cancel()
+				return next.HandleInitialize(ctx, in)
+			}),
+			middleware.Before,
+		)
+	})
+}
@@ -0,0 +1,105 @@
+package backend
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// tlsVersions maps the tlsMinVersion values of a backend secret to versions
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsFromSecret reads the minimum TLS version and the allowed cipher suites
+// of a backend secret. Only cipher suites without known weaknesses can be
+// selected.
+func tlsFromSecret(secret *corev1.Secret) (uint16, []uint16, error) {
+	var minVersion uint16
+	if v := strings.TrimSpace(string(secret.Data["tlsMinVersion"])); v != "" {
+		version, ok := tlsVersions[v]
+		if !ok {
+			return 0, nil, &InvalidSecretError{Secret: secret.Name, Key: "tlsMinVersion",
+				Problem: fmt.Sprintf("%q must be one of 1.0, 1.1, 1.2 or 1.3", v)}
+		}
+		minVersion = version
+	}
+
+	var suites []uint16
+	for _, name := range strings.Split(string(secret.Data["tlsCipherSuites"]), ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		id, ok := cipherSuiteID(name)
+		if !ok {
+			return 0, nil, &InvalidSecretError{Secret: secret.Name, Key: "tlsCipherSuites",
+				Problem: fmt.Sprintf("%q is not a supported secure cipher suite", name)}
+		}
+		suites = append(suites, id)
+	}
+	return minVersion, suites, nil
+}
+
+func cipherSuiteID(name string) (uint16, bool) {
+	for _, s := range tls.CipherSuites() {
+		if s.Name == name {
+			return s.ID, true
+		}
+	}
+	return 0, false
+}
+
+// tlsConfig returns the TLS settings for connections to the backend
+func tlsConfig(cfg Config) (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		MinVersion:         cfg.TLSMinVersion,
+		CipherSuites:       cfg.TLSCipherSuites,
+	}
+	if cfg.ClientCertSecret != "" {
+		if cfg.ClientCert == nil {
+			return nil, fmt.Errorf("client certificate secret %s/%s is not loaded", Namespace, cfg.ClientCertSecret)
+		}
+		tlsCfg.Certificates = []tls.Certificate{*cfg.ClientCert}
+	}
+	if len(cfg.CABundle) > 0 {
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(cfg.CABundle) {
+			return nil, errors.New("caBundle contains no valid PEM certificates")
+		}
+		tlsCfg.RootCAs = roots
+	}
+	return tlsCfg, nil
+}
+
+// LoadClientCertificate reads the client certificate referenced by the
+// backend configuration, if any
+func LoadClientCertificate(ctx context.Context, c client.Reader, cfg Config) (Config, error) {
+	if cfg.ClientCertSecret == "" {
+		return cfg, nil
+	}
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{Name: cfg.ClientCertSecret, Namespace: Namespace}
+	if err := c.Get(ctx, key, secret); err != nil {
+		return Config{}, fmt.Errorf("failed to get client certificate secret %s/%s: %w", Namespace, key.Name, err)
+	}
+	cert, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid client certificate in secret %s/%s: %w", Namespace, key.Name, err)
+	}
+	cfg.ClientCert = &cert
+	return cfg, nil
+}
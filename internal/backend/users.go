@@ -0,0 +1,345 @@
+package backend
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"golang.org/x/time/rate"
+)
+
+// rgwAdminPrefix is the path of the Ceph RGW admin ops API
+const rgwAdminPrefix = "/admin"
+
+// claimUserPolicyName is the inline IAM policy of a claim's user
+const claimUserPolicyName = "quobject-bucket-access"
+
+// ErrUserProvisioningUnsupported is returned for dedicated credentials on a
+// backend without an API to manage users
+var ErrUserProvisioningUnsupported = errors.New(
+	"the backend provides neither the MinIO admin, the RGW admin ops nor the IAM API to create users")
+
+// CanProvisionUsers reports whether the controller can create a user with
+// its own access key for a claim, through the MinIO admin API, the RGW admin
+// ops API or the IAM API
+func (c Config) CanProvisionUsers() bool {
+	return c.Profile.MinIOAdmin || c.Profile.RGWAdmin || c.Profile.IAM || c.IAMEndpoint != ""
+}
+
+// UserPolicyGrantsAccess reports whether the policy attached to a user by
+// CreateClaimUser grants its bucket. Otherwise, as on RGW, the bucket
+// policy must allow the user.
+func (c Config) UserPolicyGrantsAccess() bool {
+	return c.Profile.MinIOAdmin || !c.Profile.RGWAdmin
+}
+
+// UserARN returns the principal of a user created by CreateClaimUser in
+// bucket policies. Users in an RGW tenant carry it as the account.
+func (c Config) UserARN(user string) string {
+	return "arn:aws:iam::" + c.RGWTenant + ":user/" + user
+}
+
+// rgwUID returns the RGW user ID of a claim user, qualified with the
+// backend's tenant as tenant$user
+func rgwUID(cfg Config, user string) string {
+	if cfg.RGWTenant == "" {
+		return user
+	}
+	return cfg.RGWTenant + "$" + user
+}
+
+// Tag keys identifying the claim of a user on IAM
+const (
+	userTagClaimNamespace = "quobject.io/claim-namespace"
+	userTagClaimName      = "quobject.io/claim-name"
+	userTagClaimUID       = "quobject.io/claim-uid"
+)
+
+// UserOwner identifies the claim a user is created for, so that backend
+// audit logs and access reviews can be traced back to it
+type UserOwner struct {
+	Namespace string
+	Name      string
+	UID       string
+}
+
+// iamTags returns the owner as IAM user tags
+func (o UserOwner) iamTags() []iamtypes.Tag {
+	return []iamtypes.Tag{
+		{Key: aws.String(userTagClaimNamespace), Value: aws.String(o.Namespace)},
+		{Key: aws.String(userTagClaimName), Value: aws.String(o.Name)},
+		{Key: aws.String(userTagClaimUID), Value: aws.String(o.UID)},
+	}
+}
+
+// CreateClaimUser creates the named user for a claim, or replaces the keys
+// of an existing one, and returns its only access key. On MinIO and IAM the
+// user is given a policy allowing the buckets only; on RGW, where user
+// policies are not supported, a bucket policy must allow it. The owner is
+// recorded as tags of IAM users and as the display name of RGW users;
+// MinIO users cannot carry it.
+func CreateClaimUser(
+	ctx context.Context,
+	cfg Config,
+	limiter *rate.Limiter,
+	user string,
+	owner UserOwner,
+	buckets ...string,
+) (AccessKeyPair, error) {
+	switch {
+	case cfg.Profile.MinIOAdmin:
+		return createMinIOUser(ctx, cfg, limiter, user, buckets)
+	case cfg.Profile.RGWAdmin:
+		return createRGWUser(ctx, cfg, limiter, user, owner)
+	case cfg.Profile.IAM || cfg.IAMEndpoint != "":
+		return createIAMUser(ctx, cfg, limiter, user, owner, buckets)
+	}
+	return AccessKeyPair{}, ErrUserProvisioningUnsupported
+}
+
+// PutClaimUserPolicy replaces the policy of a user created by
+// CreateClaimUser to allow the given buckets, e.g. when the claim's bucket
+// is renamed. It does nothing on RGW.
+func PutClaimUserPolicy(ctx context.Context, cfg Config, limiter *rate.Limiter, user string, buckets ...string) error {
+	policy, err := bucketAccessPolicy(buckets)
+	if err != nil {
+		return err
+	}
+	switch {
+	case cfg.Profile.MinIOAdmin:
+		if err := PutCannedPolicy(ctx, cfg, limiter, user, policy); err != nil {
+			return fmt.Errorf("failed to put the policy of user: %w", err)
+		}
+		if _, err := minioAdmin(ctx, cfg, limiter, http.MethodPut, "/set-user-or-group-policy",
+			url.Values{"policyName": {user}, "userOrGroup": {user}, "isGroup": {"false"}}, nil, nil); err != nil {
+			return fmt.Errorf("failed to attach the policy to user: %w", err)
+		}
+		return nil
+	case cfg.Profile.RGWAdmin:
+		return nil
+	case cfg.Profile.IAM || cfg.IAMEndpoint != "":
+		iamc, err := iamClient(cfg, limiter)
+		if err != nil {
+			return err
+		}
+		if _, err := iamc.PutUserPolicy(ctx, &iam.PutUserPolicyInput{
+			UserName:       aws.String(user),
+			PolicyName:     aws.String(claimUserPolicyName),
+			PolicyDocument: aws.String(string(policy)),
+		}); err != nil {
+			return fmt.Errorf("failed to put the policy of user: %w", err)
+		}
+		return nil
+	}
+	return ErrUserProvisioningUnsupported
+}
+
+// DeleteClaimUser deletes a user created by CreateClaimUser with its keys
+// and policy. Deleting a user that does not exist is not an error.
+func DeleteClaimUser(ctx context.Context, cfg Config, limiter *rate.Limiter, user string) error {
+	switch {
+	case cfg.Profile.MinIOAdmin:
+		_, err := minioAdmin(ctx, cfg, limiter, http.MethodDelete, "/remove-user",
+			url.Values{"accessKey": {user}}, nil, nil)
+		if err != nil && !isAdminNotFound(err) {
+			return err
+		}
+		return DeleteCannedPolicy(ctx, cfg, limiter, user)
+	case cfg.Profile.RGWAdmin:
+		_, err := adminRequest(ctx, cfg, limiter, http.MethodDelete, rgwAdminPrefix+"/user",
+			url.Values{"uid": {rgwUID(cfg, user)}}, nil, nil)
+		if err != nil && isAdminNotFound(err) {
+			return nil
+		}
+		return err
+	case cfg.Profile.IAM || cfg.IAMEndpoint != "":
+		return deleteIAMUser(ctx, cfg, limiter, user)
+	}
+	return ErrUserProvisioningUnsupported
+}
+
+// bucketAccessPolicy returns an IAM policy allowing all S3 actions on the
+// buckets and their objects
+func bucketAccessPolicy(buckets []string) ([]byte, error) {
+	resources := make([]string, 0, 2*len(buckets))
+	for _, b := range buckets {
+		resources = append(resources, BucketARN(b), BucketARN(b)+"/*")
+	}
+	return json.Marshal(map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []map[string]interface{}{{
+			"Effect":   "Allow",
+			"Action":   []string{"s3:*"},
+			"Resource": resources,
+		}},
+	})
+}
+
+// generateSecretKey returns a random secret access key
+func generateSecretKey() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// createMinIOUser creates a MinIO user whose access key is its name, and
+// attaches a canned policy of the same name to it
+func createMinIOUser(ctx context.Context, cfg Config, limiter *rate.Limiter, user string, buckets []string) (AccessKeyPair, error) {
+	secretKey, err := generateSecretKey()
+	if err != nil {
+		return AccessKeyPair{}, err
+	}
+	body, err := json.Marshal(map[string]string{"secretKey": secretKey, "status": "enabled"})
+	if err != nil {
+		return AccessKeyPair{}, err
+	}
+	payload, err := encryptAdminPayload(cfg.SecretKey, body)
+	if err != nil {
+		return AccessKeyPair{}, err
+	}
+	if _, err := minioAdmin(ctx, cfg, limiter, http.MethodPut, "/add-user",
+		url.Values{"accessKey": {user}}, payload, nil); err != nil {
+		return AccessKeyPair{}, fmt.Errorf("failed to create user: %w", err)
+	}
+	if err := PutClaimUserPolicy(ctx, cfg, limiter, user, buckets...); err != nil {
+		return AccessKeyPair{}, err
+	}
+	return AccessKeyPair{AccessKeyID: user, SecretAccessKey: secretKey}, nil
+}
+
+// createRGWUser creates an RGW user with generated keys, displayed as the
+// claim it belongs to. An existing user is deleted first, which drops the
+// keys it had.
+func createRGWUser(ctx context.Context, cfg Config, limiter *rate.Limiter, user string, owner UserOwner) (AccessKeyPair, error) {
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return AccessKeyPair{}, err
+	}
+	secretKey, err := generateSecretKey()
+	if err != nil {
+		return AccessKeyPair{}, err
+	}
+	key := AccessKeyPair{
+		AccessKeyID:     base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(id),
+		SecretAccessKey: secretKey,
+	}
+	query := url.Values{
+		"uid":          {rgwUID(cfg, user)},
+		"display-name": {owner.Namespace + "/" + owner.Name},
+		"key-type":     {"s3"},
+		"access-key":   {key.AccessKeyID},
+		"secret-key":   {key.SecretAccessKey},
+	}
+	_, err = adminRequest(ctx, cfg, limiter, http.MethodPut, rgwAdminPrefix+"/user", query, nil, nil)
+	var adminErr *adminError
+	if errors.As(err, &adminErr) && adminErr.StatusCode == http.StatusConflict {
+		if err := DeleteClaimUser(ctx, cfg, limiter, user); err != nil {
+			return AccessKeyPair{}, fmt.Errorf("failed to replace user: %w", err)
+		}
+		_, err = adminRequest(ctx, cfg, limiter, http.MethodPut, rgwAdminPrefix+"/user", query, nil, nil)
+	}
+	if err != nil {
+		return AccessKeyPair{}, fmt.Errorf("failed to create user: %w", err)
+	}
+	return key, nil
+}
+
+// createIAMUser creates an IAM user tagged with its owner and with an inline
+// policy for the buckets, and replaces any access keys it has by a new one
+func createIAMUser(
+	ctx context.Context,
+	cfg Config,
+	limiter *rate.Limiter,
+	user string,
+	owner UserOwner,
+	buckets []string,
+) (AccessKeyPair, error) {
+	iamc, err := iamClient(cfg, limiter)
+	if err != nil {
+		return AccessKeyPair{}, err
+	}
+	_, err = iamc.CreateUser(ctx, &iam.CreateUserInput{UserName: aws.String(user), Tags: owner.iamTags()})
+	var exists *iamtypes.EntityAlreadyExistsException
+	if errors.As(err, &exists) {
+		// A user left by an earlier attempt may predate its tags
+		_, err = iamc.TagUser(ctx, &iam.TagUserInput{UserName: aws.String(user), Tags: owner.iamTags()})
+		if err != nil {
+			return AccessKeyPair{}, fmt.Errorf("failed to tag user: %w", err)
+		}
+	} else if err != nil {
+		return AccessKeyPair{}, fmt.Errorf("failed to create user: %w", err)
+	}
+	if err := PutClaimUserPolicy(ctx, cfg, limiter, user, buckets...); err != nil {
+		return AccessKeyPair{}, err
+	}
+	// Keys of an earlier attempt were never published
+	if err := deleteIAMAccessKeys(ctx, iamc, user); err != nil {
+		return AccessKeyPair{}, err
+	}
+	out, err := iamc.CreateAccessKey(ctx, &iam.CreateAccessKeyInput{UserName: aws.String(user)})
+	if err != nil {
+		return AccessKeyPair{}, fmt.Errorf("failed to create access key: %w", err)
+	}
+	if out.AccessKey == nil {
+		return AccessKeyPair{}, errors.New("failed to create access key: no key returned")
+	}
+	return AccessKeyPair{
+		AccessKeyID:     aws.ToString(out.AccessKey.AccessKeyId),
+		SecretAccessKey: aws.ToString(out.AccessKey.SecretAccessKey),
+	}, nil
+}
+
+// deleteIAMUser deletes an IAM user after its access keys and inline
+// policy, which IAM requires
+func deleteIAMUser(ctx context.Context, cfg Config, limiter *rate.Limiter, user string) error {
+	iamc, err := iamClient(cfg, limiter)
+	if err != nil {
+		return err
+	}
+	var notFound *iamtypes.NoSuchEntityException
+	if err := deleteIAMAccessKeys(ctx, iamc, user); errors.As(err, &notFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	_, err = iamc.DeleteUserPolicy(ctx, &iam.DeleteUserPolicyInput{
+		UserName:   aws.String(user),
+		PolicyName: aws.String(claimUserPolicyName),
+	})
+	if err != nil && !errors.As(err, &notFound) {
+		return fmt.Errorf("failed to delete the policy of user: %w", err)
+	}
+	_, err = iamc.DeleteUser(ctx, &iam.DeleteUserInput{UserName: aws.String(user)})
+	if err != nil && !errors.As(err, &notFound) {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	return nil
+}
+
+// deleteIAMAccessKeys deletes all access keys of an IAM user
+func deleteIAMAccessKeys(ctx context.Context, iamc *iam.Client, user string) error {
+	keys, err := iamc.ListAccessKeys(ctx, &iam.ListAccessKeysInput{UserName: aws.String(user)})
+	if err != nil {
+		return fmt.Errorf("failed to list access keys: %w", err)
+	}
+	for _, k := range keys.AccessKeyMetadata {
+		if _, err := iamc.DeleteAccessKey(ctx, &iam.DeleteAccessKeyInput{
+			UserName:    aws.String(user),
+			AccessKeyId: k.AccessKeyId,
+		}); err != nil {
+			return fmt.Errorf("failed to delete access key: %w", err)
+		}
+	}
+	return nil
+}
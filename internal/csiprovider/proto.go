@@ -0,0 +1,174 @@
+package csiprovider
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// The messages of the provider API
+// (sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1/service.proto) are
+// encoded by hand, as the provider only needs a handful of scalar fields.
+
+// Protobuf wire types
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+var errMalformed = errors.New("malformed protobuf message")
+
+// File is a file the driver writes into the pod's volume
+type File struct {
+	Path     string
+	Mode     int32
+	Contents []byte
+}
+
+// ObjectVersion identifies the version of a mounted object, so the driver
+// can tell when a rotation changed it
+type ObjectVersion struct {
+	ID      string
+	Version string
+}
+
+// mountRequest is the MountRequest message
+type mountRequest struct {
+	// Attributes is JSON with the SecretProviderClass parameters and the
+	// pod information of the driver
+	Attributes string
+	// Secrets is JSON with the nodePublishSecretRef contents
+	Secrets    string
+	TargetPath string
+	// Permission is the JSON-encoded file mode
+	Permission     string
+	CurrentVersion []ObjectVersion
+}
+
+// appendTag appends the key of a field
+func appendTag(b []byte, field, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(field)<<3|uint64(wireType))
+}
+
+func appendBytes(b []byte, field int, v []byte) []byte {
+	b = appendTag(b, field, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendString(b []byte, field int, v string) []byte {
+	if v == "" {
+		return b
+	}
+	return appendBytes(b, field, []byte(v))
+}
+
+func appendVarint(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = appendTag(b, field, wireVarint)
+	return binary.AppendUvarint(b, v)
+}
+
+// parseFields calls fn with the number and value of every length-delimited
+// field of a message. Varint fields are skipped.
+func parseFields(b []byte, fn func(field int, v []byte) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errMalformed
+		}
+		b = b[n:]
+		field := int(key >> 3)
+		switch key & 7 {
+		case wireVarint:
+			if _, n = binary.Uvarint(b); n <= 0 {
+				return errMalformed
+			}
+			b = b[n:]
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return errMalformed
+			}
+			if err := fn(field, b[n:n+int(l)]); err != nil {
+				return err
+			}
+			b = b[n+int(l):]
+		default:
+			return errMalformed
+		}
+	}
+	return nil
+}
+
+func parseVersionRequest(b []byte) (string, error) {
+	var version string
+	err := parseFields(b, func(field int, v []byte) error {
+		if field == 1 {
+			version = string(v)
+		}
+		return nil
+	})
+	return version, err
+}
+
+func marshalVersionResponse(version, runtimeName, runtimeVersion string) []byte {
+	var b []byte
+	b = appendString(b, 1, version)
+	b = appendString(b, 2, runtimeName)
+	return appendString(b, 3, runtimeVersion)
+}
+
+func parseMountRequest(b []byte) (*mountRequest, error) {
+	req := &mountRequest{}
+	err := parseFields(b, func(field int, v []byte) error {
+		switch field {
+		case 1:
+			req.Attributes = string(v)
+		case 2:
+			req.Secrets = string(v)
+		case 3:
+			req.TargetPath = string(v)
+		case 4:
+			req.Permission = string(v)
+		case 5:
+			var ov ObjectVersion
+			err := parseFields(v, func(field int, v []byte) error {
+				switch field {
+				case 1:
+					ov.ID = string(v)
+				case 2:
+					ov.Version = string(v)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			req.CurrentVersion = append(req.CurrentVersion, ov)
+		}
+		return nil
+	})
+	return req, err
+}
+
+// marshalMountResponse encodes a successful MountResponse. Failures are
+// reported as gRPC status instead of in its Error field.
+func marshalMountResponse(versions []ObjectVersion, files []File) []byte {
+	var b []byte
+	for _, ov := range versions {
+		var m []byte
+		m = appendString(m, 1, ov.ID)
+		m = appendString(m, 2, ov.Version)
+		b = appendBytes(b, 1, m)
+	}
+	for _, f := range files {
+		var m []byte
+		m = appendString(m, 1, f.Path)
+		m = appendVarint(m, 2, uint64(f.Mode))
+		m = appendBytes(m, 3, f.Contents)
+		b = appendBytes(b, 3, m)
+	}
+	return b
+}
@@ -0,0 +1,196 @@
+// Package csiprovider serves the provider API of the Secrets Store CSI
+// driver on a unix socket, so pods can mount bucket credentials through a
+// CSI volume. It speaks the subset of gRPC the driver uses (unary calls
+// over HTTP/2 without TLS) without depending on a gRPC implementation.
+package csiprovider
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// apiVersion is the provider API version implemented
+const apiVersion = "v1alpha1"
+
+// Pod information the driver adds to the attributes of a mount
+const (
+	AttributePodName      = "csi.storage.k8s.io/pod.name"
+	AttributePodNamespace = "csi.storage.k8s.io/pod.namespace"
+)
+
+// maxMessageSize bounds the requests read from the driver
+const maxMessageSize = 4 << 20
+
+// gRPC status codes
+const (
+	codeOK            = 0
+	codeInvalidArg    = 3
+	codeUnimplemented = 12
+	codeInternal      = 13
+)
+
+// Provider mounts the objects requested by a SecretProviderClass
+type Provider interface {
+	// Mount returns the files to write for the given attributes, the
+	// SecretProviderClass parameters merged with the pod information, and
+	// their versions. current holds the versions mounted before.
+	Mount(ctx context.Context, attributes map[string]string, mode int32, current []ObjectVersion) ([]File, []ObjectVersion, error)
+}
+
+// Server answers the driver's calls
+type Server struct {
+	Provider Provider
+	// Name and Version identify the provider to the driver
+	Name    string
+	Version string
+}
+
+// Serve listens on the unix socket at path until ctx is done. A stale socket
+// of an earlier run is removed first.
+func (s *Server) Serve(ctx context.Context, path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{
+		Handler:     s,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	// The driver dials gRPC with HTTP/2 prior knowledge
+	srv.Protocols = new(http.Protocols)
+	srv.Protocols.SetUnencryptedHTTP2(true)
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	if err := srv.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// ServeHTTP handles one unary gRPC call
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "gRPC requests only", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+
+	msg, err := readMessage(r.Body)
+	if err != nil {
+		writeStatus(w, codeInvalidArg, err.Error())
+		return
+	}
+	var resp []byte
+	switch r.URL.Path {
+	case "/v1alpha1.CSIDriverProvider/Version":
+		if _, err := parseVersionRequest(msg); err != nil {
+			writeStatus(w, codeInvalidArg, err.Error())
+			return
+		}
+		resp = marshalVersionResponse(apiVersion, s.Name, s.Version)
+	case "/v1alpha1.CSIDriverProvider/Mount":
+		var code int
+		resp, code, err = s.mount(r.Context(), msg)
+		if err != nil {
+			writeStatus(w, code, err.Error())
+			return
+		}
+	default:
+		writeStatus(w, codeUnimplemented, "unknown method "+r.URL.Path)
+		return
+	}
+
+	frame := make([]byte, 5, 5+len(resp))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(resp)))
+	if _, err := w.Write(append(frame, resp...)); err != nil {
+		return
+	}
+	writeStatus(w, codeOK, "")
+}
+
+// mount decodes a MountRequest and encodes the provider's answer. On error
+// it returns the gRPC status code to report, whose message the driver
+// records in the pod's events.
+func (s *Server) mount(ctx context.Context, msg []byte) ([]byte, int, error) {
+	req, err := parseMountRequest(msg)
+	if err != nil {
+		return nil, codeInvalidArg, err
+	}
+	attributes := map[string]string{}
+	if err := json.Unmarshal([]byte(req.Attributes), &attributes); err != nil {
+		return nil, codeInvalidArg, fmt.Errorf("malformed attributes: %w", err)
+	}
+	var mode int32 = 0o644
+	if req.Permission != "" {
+		if err := json.Unmarshal([]byte(req.Permission), &mode); err != nil {
+			return nil, codeInvalidArg, fmt.Errorf("malformed permission: %w", err)
+		}
+	}
+
+	files, versions, err := s.Provider.Mount(ctx, attributes, mode, req.CurrentVersion)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Mount failed",
+			"namespace", attributes[AttributePodNamespace], "pod", attributes[AttributePodName])
+		return nil, codeInternal, err
+	}
+	return marshalMountResponse(versions, files), codeOK, nil
+}
+
+// readMessage reads the single length-prefixed message of a unary call
+func readMessage(r io.Reader) ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, fmt.Errorf("failed to read message: %w", err)
+	}
+	if header[0] != 0 {
+		return nil, errors.New("compressed messages are not supported")
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxMessageSize {
+		return nil, fmt.Errorf("message of %d bytes exceeds the limit of %d", size, maxMessageSize)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, fmt.Errorf("failed to read message: %w", err)
+	}
+	return msg, nil
+}
+
+// writeStatus sends the gRPC status as trailers
+func writeStatus(w http.ResponseWriter, code int, message string) {
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", percentEncode(message))
+	}
+}
+
+// percentEncode encodes a grpc-message value: bytes outside printable ASCII
+// and '%' are percent-encoded
+func percentEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
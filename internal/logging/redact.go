@@ -0,0 +1,191 @@
+package logging
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// redacted replaces registered secrets in log output
+const redacted = "[REDACTED]"
+
+// minSecretLength guards against registering values so short that redacting
+// them would mangle unrelated log output
+const minSecretLength = 8
+
+// secrets are the secrets of each owner, replaced as they are refreshed
+var secrets = struct {
+	sync.RWMutex
+	owned map[string][]ownedSecrets
+}{owned: map[string][]ownedSecrets{}}
+
+// ownedSecrets are secrets issued together, such as an access key, its
+// secret key and session token
+type ownedSecrets struct {
+	values []string
+	// expires is when the secrets stop being valid; zero never
+	expires time.Time
+}
+
+// now is replaced in tests
+var now = time.Now
+
+func (o ownedSecrets) expired(t time.Time) bool {
+	return !o.expires.IsZero() && !o.expires.After(t)
+}
+
+// SetSecrets replaces the secrets of owner, such as the credentials of a
+// claim or backend, with values that must not appear in log output until
+// they expire. A zero expires never expires. Replaced secrets that have not
+// expired yet stay redacted until they do, so refreshing credentials does
+// not grow the set. Empty and very short values are ignored.
+func SetSecrets(owner string, expires time.Time, values ...string) {
+	set := ownedSecrets{expires: expires}
+	for _, v := range values {
+		if len(v) >= minSecretLength {
+			set.values = append(set.values, v)
+		}
+	}
+	secrets.Lock()
+	defer secrets.Unlock()
+	t := now()
+	var kept []ownedSecrets
+	for _, o := range secrets.owned[owner] {
+		if !o.expires.IsZero() && !o.expired(t) && !slices.Equal(o.values, set.values) {
+			kept = append(kept, o)
+		}
+	}
+	if len(set.values) > 0 && !set.expired(t) {
+		kept = append(kept, set)
+	}
+	secrets.owned[owner] = kept
+	// Drop the expired secrets of owners that are no longer refreshed
+	for name, sets := range secrets.owned {
+		sets = slices.DeleteFunc(sets, func(o ownedSecrets) bool { return o.expired(t) })
+		if len(sets) == 0 {
+			delete(secrets.owned, name)
+		} else {
+			secrets.owned[name] = sets
+		}
+	}
+}
+
+// ForgetSecrets drops the secrets of owners that are gone, such as deleted
+// claims
+func ForgetSecrets(owners ...string) {
+	secrets.Lock()
+	defer secrets.Unlock()
+	for _, owner := range owners {
+		delete(secrets.owned, owner)
+	}
+}
+
+// Redact replaces all registered secrets in s
+func Redact(s string) string {
+	secrets.RLock()
+	defer secrets.RUnlock()
+	t := now()
+	for _, sets := range secrets.owned {
+		for _, o := range sets {
+			if o.expired(t) {
+				continue
+			}
+			for _, v := range o.values {
+				if strings.Contains(s, v) {
+					s = strings.ReplaceAll(s, v, redacted)
+				}
+			}
+		}
+	}
+	return s
+}
+
+// redactedError wraps an error so its message is redacted while errors.Is
+// and errors.As keep working on the original
+type redactedError struct {
+	err error
+}
+
+func (e redactedError) Error() string { return Redact(e.err.Error()) }
+func (e redactedError) Unwrap() error { return e.err }
+
+// NewRedactingLogger wraps logger so that registered secrets are scrubbed
+// from messages, errors and key/value pairs before they reach the sink.
+func NewRedactingLogger(logger logr.Logger) logr.Logger {
+	sink := logger.GetSink()
+	if sink == nil {
+		return logger
+	}
+	// Account for the extra frame of the wrapper in caller information
+	if cd, ok := sink.(logr.CallDepthLogSink); ok {
+		sink = cd.WithCallDepth(1)
+	}
+	return logr.New(&redactingSink{sink: sink})
+}
+
+type redactingSink struct {
+	sink logr.LogSink
+}
+
+var _ logr.CallDepthLogSink = &redactingSink{}
+
+// Init is a no-op: the wrapped sink was initialized by its own logger
+func (r *redactingSink) Init(logr.RuntimeInfo) {}
+
+func (r *redactingSink) Enabled(level int) bool {
+	return r.sink.Enabled(level)
+}
+
+func (r *redactingSink) Info(level int, msg string, keysAndValues ...interface{}) {
+	r.sink.Info(level, Redact(msg), redactValues(keysAndValues)...)
+}
+
+func (r *redactingSink) Error(err error, msg string, keysAndValues ...interface{}) {
+	if err != nil {
+		err = redactedError{err: err}
+	}
+	r.sink.Error(err, Redact(msg), redactValues(keysAndValues)...)
+}
+
+func (r *redactingSink) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	return &redactingSink{sink: r.sink.WithValues(redactValues(keysAndValues)...)}
+}
+
+func (r *redactingSink) WithName(name string) logr.LogSink {
+	return &redactingSink{sink: r.sink.WithName(name)}
+}
+
+func (r *redactingSink) WithCallDepth(depth int) logr.LogSink {
+	if cd, ok := r.sink.(logr.CallDepthLogSink); ok {
+		return &redactingSink{sink: cd.WithCallDepth(depth)}
+	}
+	return r
+}
+
+// redactValues returns a copy of keysAndValues with secrets scrubbed from
+// strings, errors and Stringers
+func redactValues(keysAndValues []interface{}) []interface{} {
+	out := make([]interface{}, len(keysAndValues))
+	for i, v := range keysAndValues {
+		switch val := v.(type) {
+		case string:
+			out[i] = Redact(val)
+		case []byte:
+			out[i] = Redact(string(val))
+		case error:
+			out[i] = redactedError{err: val}
+		case logr.Marshaler:
+			// Structured values such as object references keep their encoding
+			out[i] = v
+		case fmt.Stringer:
+			out[i] = Redact(val.String())
+		default:
+			out[i] = v
+		}
+	}
+	return out
+}
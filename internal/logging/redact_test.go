@@ -0,0 +1,67 @@
+package logging
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// secretCount returns the number of values Redact scans for
+func secretCount() int {
+	secrets.RLock()
+	defer secrets.RUnlock()
+	n := 0
+	for _, sets := range secrets.owned {
+		for _, o := range sets {
+			n += len(o.values)
+		}
+	}
+	return n
+}
+
+func TestSetSecretsStaysBoundedAcrossRefreshes(t *testing.T) {
+	clock := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+	defer func() { now = time.Now }()
+	defer ForgetSecrets("claim/a", "claim/b", "backend/s3-credentials")
+
+	// Temporary credentials valid for an hour are refreshed after 40 minutes
+	var last string
+	for i := 0; i < 1000; i++ {
+		last = fmt.Sprintf("session-token-%04d", i)
+		SetSecrets("claim/a", clock.Add(time.Hour), fmt.Sprintf("access-key-%04d", i), last)
+		// Static keys read on every reconcile
+		SetSecrets("backend/s3-credentials", time.Time{}, "backend-access-key", "backend-secret-key")
+		clock = clock.Add(40 * time.Minute)
+	}
+	// The current and the still valid previous credentials of claim/a, and
+	// the backend keys
+	if n := secretCount(); n > 6 {
+		t.Fatalf("%d secrets registered after 1000 refreshes, want at most 6", n)
+	}
+	if got := Redact("token " + last); strings.Contains(got, last) {
+		t.Errorf("current credentials not redacted: %s", got)
+	}
+	if got := Redact("key backend-secret-key"); strings.Contains(got, "backend-secret-key") {
+		t.Errorf("backend key not redacted: %s", got)
+	}
+
+	// Owners that are no longer refreshed are dropped once expired
+	SetSecrets("claim/b", clock.Add(time.Minute), "short-lived-key")
+	clock = clock.Add(2 * time.Hour)
+	SetSecrets("backend/s3-credentials", time.Time{}, "backend-access-key", "backend-secret-key")
+	if n := secretCount(); n != 2 {
+		t.Errorf("%d secrets registered after all temporary credentials expired, want 2", n)
+	}
+
+	// Keys without expiry are replaced, and forgotten with their owner
+	SetSecrets("backend/s3-credentials", time.Time{}, "rotated-access-key", "rotated-secret-key")
+	if got := Redact("backend-secret-key"); got != "backend-secret-key" {
+		t.Errorf("replaced key still redacted: %s", got)
+	}
+	ForgetSecrets("backend/s3-credentials")
+	if n := secretCount(); n != 0 {
+		t.Errorf("%d secrets registered after all owners were forgotten, want 0", n)
+	}
+}
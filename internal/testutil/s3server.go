@@ -0,0 +1,920 @@
+// Package testutil provides test infrastructure for exercising the full
+// reconcile path without external services.
+package testutil
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	s3Namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+	timeFormat  = "2006-01-02T15:04:05.000Z"
+)
+
+// S3Server is a minimal in-memory S3-compatible server. It supports bucket
+// create/head/list/delete, bucket policies, tagging, lifecycle, encryption
+// and versioning configurations, and basic object operations with user
+// metadata, including server-side copies and multipart uploads, with
+// path-style addressing. Configurations are stored and returned verbatim but
+// not applied; versioned buckets keep only the current version of each
+// object. Other subresources are answered with NotImplemented. Request
+// signatures are not verified, and of bucket policies only statements
+// denying object deletes to everyone are enforced, as AWS and RGW apply them
+// to the bucket owner too.
+type S3Server struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	buckets map[string]*memBucket
+	// foreign are the bucket names owned by another account
+	foreign map[string]bool
+	// uploads are the multipart uploads in progress by upload ID
+	uploads map[string]*memUpload
+	// nextUpload numbers the upload IDs
+	nextUpload int
+	// copyLimit is the largest object CopyObject copies; zero is unlimited
+	copyLimit int
+}
+
+// memUpload is a multipart upload in progress
+type memUpload struct {
+	bucket string
+	key    string
+	parts  map[int][]byte
+}
+
+type memBucket struct {
+	created time.Time
+	objects map[string]*memObject
+	policy  []byte
+	// configs holds the XML configuration documents by subresource
+	configs map[string][]byte
+}
+
+// bucketConfigs are the bucket subresources stored as XML documents, with
+// the error code for reading one that is not set. Unset versioning reads as
+// an empty configuration.
+var bucketConfigs = map[string]string{
+	"tagging":    "NoSuchTagSet",
+	"lifecycle":  "NoSuchLifecycleConfiguration",
+	"encryption": "ServerSideEncryptionConfigurationNotFoundError",
+	"versioning": "",
+}
+
+// queryParams are the query parameters of supported operations; any other
+// parameter names a subresource
+var queryParams = map[string]bool{
+	"x-id":               true,
+	"list-type":          true,
+	"prefix":             true,
+	"delimiter":          true,
+	"max-keys":           true,
+	"continuation-token": true,
+	"start-after":        true,
+	"fetch-owner":        true,
+	"encoding-type":      true,
+	"key-marker":         true,
+	"version-id-marker":  true,
+	"versionId":          true,
+	"uploadId":           true,
+	"partNumber":         true,
+}
+
+// subresource returns the subresource a request addresses, or the empty
+// string for the bucket or object itself
+func subresource(q url.Values) string {
+	for name := range q {
+		if !queryParams[name] {
+			return name
+		}
+	}
+	return ""
+}
+
+type memObject struct {
+	data     []byte
+	etag     string
+	modified time.Time
+	// metadata holds the x-amz-meta- headers by lower-case name
+	metadata map[string]string
+}
+
+// NewS3Server starts an in-memory S3 server. Callers must Close it.
+func NewS3Server() *S3Server {
+	s := &S3Server{buckets: map[string]*memBucket{}, foreign: map[string]bool{}, uploads: map[string]*memUpload{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// BackendData returns credentials secret data pointing the controller at
+// the server
+func (s *S3Server) BackendData() map[string]string {
+	return map[string]string{
+		"endpoint":  s.URL,
+		"region":    "us-east-1",
+		"accessKey": "testutil-access-key",
+		"secretKey": "testutil-secret-key",
+		"useSSL":    "false",
+	}
+}
+
+// BucketExists reports whether the bucket exists
+func (s *S3Server) BucketExists(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.buckets[name]
+	return ok
+}
+
+// Buckets returns the names of all buckets, sorted
+func (s *S3Server) Buckets() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedBucketNames(s.buckets)
+}
+
+// Objects returns the keys of all objects in the bucket, sorted
+func (s *S3Server) Objects(bucket string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[bucket]
+	if !ok {
+		return nil
+	}
+	return sortedKeys(b.objects, "", "")
+}
+
+// SetForeignBucket makes the name taken by another account: HeadBucket is
+// forbidden and CreateBucket fails with BucketAlreadyExists
+func (s *S3Server) SetForeignBucket(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.foreign[name] = true
+}
+
+// PutObject stores an object, creating the bucket if needed. It is meant
+// for seeding test data.
+func (s *S3Server) PutObject(bucket, key string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[bucket]
+	if !ok {
+		b = newMemBucket()
+		s.buckets[bucket] = b
+	}
+	b.objects[key] = newMemObject(data)
+}
+
+// Config returns the XML configuration document of a bucket subresource,
+// e.g. "tagging" or "lifecycle", or the empty string if none is set
+func (s *S3Server) Config(bucket, subresource string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if b, ok := s.buckets[bucket]; ok {
+		return string(b.configs[subresource])
+	}
+	return ""
+}
+
+// Policy returns the bucket policy, or the empty string if none is set
+func (s *S3Server) Policy(bucket string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if b, ok := s.buckets[bucket]; ok {
+		return string(b.policy)
+	}
+	return ""
+}
+
+// SetCopyLimit makes CopyObject fail for objects larger than size bytes,
+// like the 5 GiB limit of S3, which larger objects must be copied in parts
+// to avoid
+func (s *S3Server) SetCopyLimit(size int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.copyLimit = size
+}
+
+// Uploads returns the number of multipart uploads neither completed nor
+// aborted
+func (s *S3Server) Uploads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.uploads)
+}
+
+func newMemBucket() *memBucket {
+	return &memBucket{created: time.Now().UTC(), objects: map[string]*memObject{}, configs: map[string][]byte{}}
+}
+
+func newMemObject(data []byte) *memObject {
+	sum := md5.Sum(data)
+	return &memObject{data: data, etag: `"` + hex.EncodeToString(sum[:]) + `"`, modified: time.Now().UTC()}
+}
+
+func (s *S3Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	bucket, key, _ := strings.Cut(path, "/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case bucket == "":
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "method not allowed")
+			return
+		}
+		s.listBuckets(w)
+	case s.foreign[bucket]:
+		if r.Method == http.MethodPut && key == "" && subresource(r.URL.Query()) == "" {
+			writeError(w, http.StatusConflict, "BucketAlreadyExists", "the requested bucket name is not available")
+			return
+		}
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		writeError(w, http.StatusForbidden, "AccessDenied", "access denied")
+	case key == "":
+		s.serveBucket(w, r, bucket)
+	default:
+		s.serveObject(w, r, bucket, key)
+	}
+}
+
+func (s *S3Server) serveBucket(w http.ResponseWriter, r *http.Request, name string) {
+	sub := subresource(r.URL.Query())
+	b, exists := s.buckets[name]
+	if r.Method == http.MethodPut && sub == "" {
+		if exists {
+			writeError(w, http.StatusConflict, "BucketAlreadyOwnedByYou", "bucket already exists")
+			return
+		}
+		s.buckets[name] = newMemBucket()
+		w.Header().Set("Location", "/"+name)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if !exists {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeError(w, http.StatusNotFound, "NoSuchBucket", "the specified bucket does not exist")
+		return
+	}
+
+	if _, ok := bucketConfigs[sub]; ok {
+		s.serveBucketConfig(w, r, b, sub)
+		return
+	}
+	switch {
+	case sub == "policy":
+		s.serveBucketPolicy(w, r, b)
+	case sub == "delete" && r.Method == http.MethodPost:
+		s.deleteObjects(w, r, name, b)
+	case sub == "location" && r.Method == http.MethodGet:
+		writeXML(w, locationConstraint{Xmlns: s3Namespace})
+	case sub == "versions" && r.Method == http.MethodGet:
+		s.listObjectVersions(w, r, name, b)
+	case sub != "":
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "the "+sub+" subresource is not implemented")
+	case r.Method == http.MethodHead:
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodGet:
+		s.listObjects(w, r, name, b)
+	case r.Method == http.MethodDelete:
+		if len(b.objects) > 0 {
+			writeError(w, http.StatusConflict, "BucketNotEmpty", "the bucket you tried to delete is not empty")
+			return
+		}
+		delete(s.buckets, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "method not allowed")
+	}
+}
+
+// serveBucketConfig stores and returns the XML configuration document of a
+// bucket subresource
+func (s *S3Server) serveBucketConfig(w http.ResponseWriter, r *http.Request, b *memBucket, sub string) {
+	switch r.Method {
+	case http.MethodGet:
+		doc, ok := b.configs[sub]
+		if !ok {
+			if notFound := bucketConfigs[sub]; notFound != "" {
+				writeError(w, http.StatusNotFound, notFound, "the "+sub+" configuration does not exist")
+				return
+			}
+			doc = []byte(`<VersioningConfiguration xmlns="` + s3Namespace + `"></VersioningConfiguration>`)
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write(doc)
+	case http.MethodPut:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		b.configs[sub] = body
+		w.WriteHeader(http.StatusOK)
+	case http.MethodDelete:
+		if sub == "versioning" {
+			writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "versioning cannot be deleted")
+			return
+		}
+		delete(b.configs, sub)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "method not allowed")
+	}
+}
+
+func (s *S3Server) serveBucketPolicy(w http.ResponseWriter, r *http.Request, b *memBucket) {
+	switch r.Method {
+	case http.MethodGet:
+		if b.policy == nil {
+			writeError(w, http.StatusNotFound, "NoSuchBucketPolicy", "the bucket policy does not exist")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b.policy)
+	case http.MethodPut:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		b.policy = body
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		b.policy = nil
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "method not allowed")
+	}
+}
+
+func (s *S3Server) serveObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	b, ok := s.buckets[bucket]
+	if !ok {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeError(w, http.StatusNotFound, "NoSuchBucket", "the specified bucket does not exist")
+		return
+	}
+	q := r.URL.Query()
+	if sub := subresource(q); sub == "uploads" && r.Method == http.MethodPost {
+		s.createUpload(w, bucket, key)
+		return
+	} else if sub != "" {
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "the "+sub+" subresource is not implemented")
+		return
+	}
+	if q.Has("uploadId") {
+		s.serveUpload(w, r, b, q.Get("uploadId"))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		if src := r.Header.Get("X-Amz-Copy-Source"); src != "" {
+			s.copyObject(w, r, b, key, src)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		obj := newMemObject(body)
+		obj.metadata = userMetadata(r.Header)
+		b.objects[key] = obj
+		w.Header().Set("ETag", obj.etag)
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet, http.MethodHead:
+		obj, ok := b.objects[key]
+		if !ok {
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			writeError(w, http.StatusNotFound, "NoSuchKey", "the specified key does not exist")
+			return
+		}
+		w.Header().Set("ETag", obj.etag)
+		w.Header().Set("Last-Modified", obj.modified.Format(http.TimeFormat))
+		w.Header().Set("Content-Length", strconv.Itoa(len(obj.data)))
+		for name, value := range obj.metadata {
+			w.Header().Set(metadataPrefix+name, value)
+		}
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(obj.data)
+		}
+	case http.MethodDelete:
+		if b.deleteDenied(bucket) {
+			writeError(w, http.StatusForbidden, "AccessDenied", "access denied by the bucket policy")
+			return
+		}
+		delete(b.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "method not allowed")
+	}
+}
+
+type copyObjectResult struct {
+	XMLName      xml.Name `xml:"CopyObjectResult"`
+	Xmlns        string   `xml:"xmlns,attr"`
+	ETag         string   `xml:"ETag"`
+	LastModified string   `xml:"LastModified"`
+}
+
+// copyObject serves a server-side copy from the URL-encoded bucket/key
+// source. The metadata is copied unless the request replaces it.
+func (s *S3Server) copyObject(w http.ResponseWriter, r *http.Request, b *memBucket, key, source string) {
+	src, ok := s.copySource(w, source)
+	if !ok {
+		return
+	}
+	if s.copyLimit > 0 && len(src.data) > s.copyLimit {
+		writeError(w, http.StatusBadRequest, "InvalidRequest",
+			"The specified copy source is larger than the maximum allowable size for a copy source")
+		return
+	}
+	obj := newMemObject(append([]byte(nil), src.data...))
+	obj.metadata = src.metadata
+	if r.Header.Get("X-Amz-Metadata-Directive") == "REPLACE" {
+		obj.metadata = userMetadata(r.Header)
+	}
+	b.objects[key] = obj
+	writeXML(w, copyObjectResult{Xmlns: s3Namespace, ETag: obj.etag, LastModified: obj.modified.Format(timeFormat)})
+}
+
+// metadataPrefix starts the headers carrying user metadata
+const metadataPrefix = "X-Amz-Meta-"
+
+// userMetadata returns the user metadata headers of a request by lower-case
+// name, or nil if there are none
+func userMetadata(h http.Header) map[string]string {
+	var metadata map[string]string
+	for name := range h {
+		if key, ok := strings.CutPrefix(name, metadataPrefix); ok {
+			if metadata == nil {
+				metadata = map[string]string{}
+			}
+			metadata[strings.ToLower(key)] = h.Get(name)
+		}
+	}
+	return metadata
+}
+
+// copySource returns the object named by the URL-encoded bucket/key source
+// of a copy, or writes the error
+func (s *S3Server) copySource(w http.ResponseWriter, source string) (*memObject, bool) {
+	source, err := url.PathUnescape(strings.TrimPrefix(source, "/"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return nil, false
+	}
+	srcBucket, srcKey, _ := strings.Cut(source, "/")
+	sb, ok := s.buckets[srcBucket]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchBucket", "the specified bucket does not exist")
+		return nil, false
+	}
+	src, ok := sb.objects[srcKey]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchKey", "the specified key does not exist")
+		return nil, false
+	}
+	return src, true
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+type copyPartResult struct {
+	XMLName      xml.Name `xml:"CopyPartResult"`
+	Xmlns        string   `xml:"xmlns,attr"`
+	ETag         string   `xml:"ETag"`
+	LastModified string   `xml:"LastModified"`
+}
+
+type completeMultipartUpload struct {
+	Parts []struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	} `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Bucket  string   `xml:"Bucket"`
+	Key     string   `xml:"Key"`
+	ETag    string   `xml:"ETag"`
+}
+
+func (s *S3Server) createUpload(w http.ResponseWriter, bucket, key string) {
+	s.nextUpload++
+	id := strconv.Itoa(s.nextUpload)
+	s.uploads[id] = &memUpload{bucket: bucket, key: key, parts: map[int][]byte{}}
+	writeXML(w, initiateMultipartUploadResult{Xmlns: s3Namespace, Bucket: bucket, Key: key, UploadID: id})
+}
+
+// serveUpload uploads, copies and lists the parts of a multipart upload,
+// and completes or aborts it
+func (s *S3Server) serveUpload(w http.ResponseWriter, r *http.Request, b *memBucket, id string) {
+	upload, ok := s.uploads[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchUpload", "the specified upload does not exist")
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		part, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+		if err != nil || part < 1 || part > 10000 {
+			writeError(w, http.StatusBadRequest, "InvalidArgument", "invalid part number")
+			return
+		}
+		if source := r.Header.Get("X-Amz-Copy-Source"); source != "" {
+			src, ok := s.copySource(w, source)
+			if !ok {
+				return
+			}
+			data, ok := copyRange(w, src.data, r.Header.Get("X-Amz-Copy-Source-Range"))
+			if !ok {
+				return
+			}
+			upload.parts[part] = data
+			etag := newMemObject(data).etag
+			writeXML(w, copyPartResult{Xmlns: s3Namespace, ETag: etag, LastModified: time.Now().UTC().Format(timeFormat)})
+			return
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		upload.parts[part] = data
+		w.Header().Set("ETag", newMemObject(data).etag)
+		w.WriteHeader(http.StatusOK)
+	case http.MethodPost:
+		var req completeMultipartUpload
+		if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "MalformedXML", err.Error())
+			return
+		}
+		var data []byte
+		for i, p := range req.Parts {
+			part, ok := upload.parts[p.PartNumber]
+			if !ok || (i > 0 && p.PartNumber <= req.Parts[i-1].PartNumber) {
+				writeError(w, http.StatusBadRequest, "InvalidPart", "a part is missing or out of order")
+				return
+			}
+			data = append(data, part...)
+		}
+		obj := newMemObject(data)
+		// Multipart ETags carry the number of parts
+		obj.etag = strings.TrimSuffix(obj.etag, `"`) + "-" + strconv.Itoa(len(req.Parts)) + `"`
+		b.objects[upload.key] = obj
+		delete(s.uploads, id)
+		writeXML(w, completeMultipartUploadResult{Xmlns: s3Namespace, Bucket: upload.bucket, Key: upload.key, ETag: obj.etag})
+	case http.MethodDelete:
+		delete(s.uploads, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "method not allowed")
+	}
+}
+
+// copyRange returns the bytes=first-last range of data, or all of it
+// without a range
+func copyRange(w http.ResponseWriter, data []byte, byteRange string) ([]byte, bool) {
+	if byteRange == "" {
+		return append([]byte(nil), data...), true
+	}
+	first, last, ok := strings.Cut(strings.TrimPrefix(byteRange, "bytes="), "-")
+	from, err1 := strconv.Atoi(first)
+	to, err2 := strconv.Atoi(last)
+	if !ok || err1 != nil || err2 != nil || from > to || to >= len(data) {
+		writeError(w, http.StatusBadRequest, "InvalidArgument", "invalid copy source range "+byteRange)
+		return nil, false
+	}
+	return append([]byte(nil), data[from:to+1]...), true
+}
+
+type listBucketsResult struct {
+	XMLName xml.Name `xml:"ListAllMyBucketsResult"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Owner   struct {
+		ID string `xml:"ID"`
+	} `xml:"Owner"`
+	Buckets []bucketEntry `xml:"Buckets>Bucket"`
+}
+
+type bucketEntry struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+func (s *S3Server) listBuckets(w http.ResponseWriter) {
+	res := listBucketsResult{Xmlns: s3Namespace}
+	res.Owner.ID = "testutil"
+	for _, name := range sortedBucketNames(s.buckets) {
+		res.Buckets = append(res.Buckets, bucketEntry{
+			Name:         name,
+			CreationDate: s.buckets[name].created.Format(timeFormat),
+		})
+	}
+	writeXML(w, res)
+}
+
+type listObjectsResult struct {
+	XMLName               xml.Name      `xml:"ListBucketResult"`
+	Xmlns                 string        `xml:"xmlns,attr"`
+	Name                  string        `xml:"Name"`
+	Prefix                string        `xml:"Prefix"`
+	KeyCount              int           `xml:"KeyCount"`
+	MaxKeys               int           `xml:"MaxKeys"`
+	IsTruncated           bool          `xml:"IsTruncated"`
+	ContinuationToken     string        `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string        `xml:"NextContinuationToken,omitempty"`
+	Contents              []objectEntry `xml:"Contents"`
+}
+
+type objectEntry struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int    `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+// listObjects implements ListObjectsV2. Continuation tokens are the last
+// key of the previous page.
+func (s *S3Server) listObjects(w http.ResponseWriter, r *http.Request, name string, b *memBucket) {
+	q := r.URL.Query()
+	maxKeys := 1000
+	if v := q.Get("max-keys"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 && n < maxKeys {
+			maxKeys = n
+		}
+	}
+	after := q.Get("start-after")
+	if token := q.Get("continuation-token"); token != "" {
+		after = token
+	}
+
+	keys := sortedKeys(b.objects, q.Get("prefix"), after)
+	res := listObjectsResult{
+		Xmlns:             s3Namespace,
+		Name:              name,
+		Prefix:            q.Get("prefix"),
+		MaxKeys:           maxKeys,
+		ContinuationToken: q.Get("continuation-token"),
+	}
+	if len(keys) > maxKeys {
+		keys = keys[:maxKeys]
+		res.IsTruncated = true
+		res.NextContinuationToken = keys[len(keys)-1]
+	}
+	for _, key := range keys {
+		obj := b.objects[key]
+		res.Contents = append(res.Contents, objectEntry{
+			Key:          key,
+			LastModified: obj.modified.Format(timeFormat),
+			ETag:         obj.etag,
+			Size:         len(obj.data),
+			StorageClass: "STANDARD",
+		})
+	}
+	res.KeyCount = len(res.Contents)
+	writeXML(w, res)
+}
+
+type locationConstraint struct {
+	XMLName xml.Name `xml:"LocationConstraint"`
+	Xmlns   string   `xml:"xmlns,attr"`
+}
+
+type listVersionsResult struct {
+	XMLName             xml.Name       `xml:"ListVersionsResult"`
+	Xmlns               string         `xml:"xmlns,attr"`
+	Name                string         `xml:"Name"`
+	Prefix              string         `xml:"Prefix"`
+	KeyMarker           string         `xml:"KeyMarker"`
+	MaxKeys             int            `xml:"MaxKeys"`
+	IsTruncated         bool           `xml:"IsTruncated"`
+	NextKeyMarker       string         `xml:"NextKeyMarker,omitempty"`
+	NextVersionIDMarker string         `xml:"NextVersionIdMarker,omitempty"`
+	Versions            []versionEntry `xml:"Version"`
+}
+
+type versionEntry struct {
+	Key          string `xml:"Key"`
+	VersionID    string `xml:"VersionId"`
+	IsLatest     bool   `xml:"IsLatest"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int    `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+// listObjectVersions implements ListObjectVersions. Only current versions
+// are kept, all with the version ID "null".
+func (s *S3Server) listObjectVersions(w http.ResponseWriter, r *http.Request, name string, b *memBucket) {
+	q := r.URL.Query()
+	maxKeys := 1000
+	if v := q.Get("max-keys"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 && n < maxKeys {
+			maxKeys = n
+		}
+	}
+	keys := sortedKeys(b.objects, q.Get("prefix"), q.Get("key-marker"))
+	res := listVersionsResult{
+		Xmlns:     s3Namespace,
+		Name:      name,
+		Prefix:    q.Get("prefix"),
+		KeyMarker: q.Get("key-marker"),
+		MaxKeys:   maxKeys,
+	}
+	if len(keys) > maxKeys {
+		keys = keys[:maxKeys]
+		res.IsTruncated = true
+		res.NextKeyMarker = keys[len(keys)-1]
+		res.NextVersionIDMarker = "null"
+	}
+	for _, key := range keys {
+		obj := b.objects[key]
+		res.Versions = append(res.Versions, versionEntry{
+			Key:          key,
+			VersionID:    "null",
+			IsLatest:     true,
+			LastModified: obj.modified.Format(timeFormat),
+			ETag:         obj.etag,
+			Size:         len(obj.data),
+			StorageClass: "STANDARD",
+		})
+	}
+	writeXML(w, res)
+}
+
+type deleteRequest struct {
+	Objects []struct {
+		Key string `xml:"Key"`
+	} `xml:"Object"`
+	Quiet bool `xml:"Quiet"`
+}
+
+type deleteResult struct {
+	XMLName xml.Name `xml:"DeleteResult"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Deleted []struct {
+		Key string `xml:"Key"`
+	} `xml:"Deleted"`
+	Errors []deleteError `xml:"Error"`
+}
+
+type deleteError struct {
+	Key     string `xml:"Key"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (s *S3Server) deleteObjects(w http.ResponseWriter, r *http.Request, name string, b *memBucket) {
+	var req deleteRequest
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "MalformedXML", err.Error())
+		return
+	}
+	res := deleteResult{Xmlns: s3Namespace}
+	denied := b.deleteDenied(name)
+	for _, obj := range req.Objects {
+		if denied {
+			res.Errors = append(res.Errors, deleteError{
+				Key: obj.Key, Code: "AccessDenied", Message: "access denied by the bucket policy",
+			})
+			continue
+		}
+		delete(b.objects, obj.Key)
+		if !req.Quiet {
+			res.Deleted = append(res.Deleted, struct {
+				Key string `xml:"Key"`
+			}{Key: obj.Key})
+		}
+	}
+	writeXML(w, res)
+}
+
+// deleteDenied reports whether the bucket policy denies everyone deleting
+// the objects of the bucket
+func (b *memBucket) deleteDenied(name string) bool {
+	var policy struct {
+		Statement []struct {
+			Effect    string
+			Principal interface{}
+			Action    interface{}
+			Resource  interface{}
+		}
+	}
+	if b.policy == nil || json.Unmarshal(b.policy, &policy) != nil {
+		return false
+	}
+	for _, st := range policy.Statement {
+		if st.Effect != "Deny" || !matchesAny(st.Principal, "*") {
+			continue
+		}
+		if (matchesAny(st.Action, "s3:DeleteObject") || matchesAny(st.Action, "s3:*")) &&
+			matchesAny(st.Resource, "arn:aws:s3:::"+name+"/*") {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAny reports whether a policy element, a string, a list of strings
+// or a principal map, contains value
+func matchesAny(element interface{}, value string) bool {
+	switch e := element.(type) {
+	case string:
+		return e == value
+	case []interface{}:
+		for _, v := range e {
+			if matchesAny(v, value) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		for _, v := range e {
+			if matchesAny(v, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type errorResponse struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprint(w, xml.Header)
+	xml.NewEncoder(w).Encode(errorResponse{Code: code, Message: message})
+}
+
+func writeXML(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, xml.Header)
+	xml.NewEncoder(w).Encode(v)
+}
+
+func sortedBucketNames(buckets map[string]*memBucket) []string {
+	names := make([]string, 0, len(buckets))
+	for name := range buckets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sortedKeys returns the keys with the given prefix that sort after after
+func sortedKeys(objects map[string]*memObject, prefix, after string) []string {
+	keys := make([]string, 0, len(objects))
+	for key := range objects {
+		if strings.HasPrefix(key, prefix) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,251 @@
+package testutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+func newClient(srv *S3Server) *s3.Client {
+	data := srv.BackendData()
+	return s3.New(s3.Options{
+		Region:       data["region"],
+		BaseEndpoint: aws.String(srv.URL),
+		UsePathStyle: true,
+		Credentials:  credentials.NewStaticCredentialsProvider(data["accessKey"], data["secretKey"], ""),
+	})
+}
+
+func errorCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return ""
+}
+
+func TestS3ServerBucketSubresources(t *testing.T) {
+	srv := NewS3Server()
+	defer srv.Close()
+	s3c := newClient(srv)
+	ctx := context.Background()
+	bucket := aws.String("subresources")
+
+	if _, err := s3c.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: bucket}); err != nil {
+		t.Fatalf("CreateBucket: %v", err)
+	}
+	if _, err := s3c.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: bucket}); errorCode(err) != "BucketAlreadyOwnedByYou" {
+		t.Fatalf("second CreateBucket: got %v, want BucketAlreadyOwnedByYou", err)
+	}
+
+	// Unset configurations read as their not-found errors
+	if _, err := s3c.GetBucketTagging(ctx, &s3.GetBucketTaggingInput{Bucket: bucket}); errorCode(err) != "NoSuchTagSet" {
+		t.Errorf("GetBucketTagging: got %v, want NoSuchTagSet", err)
+	}
+	_, err := s3c.GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{Bucket: bucket})
+	if errorCode(err) != "NoSuchLifecycleConfiguration" {
+		t.Errorf("GetBucketLifecycleConfiguration: got %v, want NoSuchLifecycleConfiguration", err)
+	}
+	_, err = s3c.GetBucketEncryption(ctx, &s3.GetBucketEncryptionInput{Bucket: bucket})
+	if errorCode(err) != "ServerSideEncryptionConfigurationNotFoundError" {
+		t.Errorf("GetBucketEncryption: got %v, want ServerSideEncryptionConfigurationNotFoundError", err)
+	}
+	versioning, err := s3c.GetBucketVersioning(ctx, &s3.GetBucketVersioningInput{Bucket: bucket})
+	if err != nil || versioning.Status != "" {
+		t.Errorf("GetBucketVersioning: got %v, %v, want no status", versioning, err)
+	}
+
+	// Setting a configuration must not be mistaken for creating the bucket
+	_, err = s3c.PutBucketTagging(ctx, &s3.PutBucketTaggingInput{
+		Bucket:  bucket,
+		Tagging: &s3types.Tagging{TagSet: []s3types.Tag{{Key: aws.String("team"), Value: aws.String("a")}}},
+	})
+	if err != nil {
+		t.Fatalf("PutBucketTagging: %v", err)
+	}
+	tags, err := s3c.GetBucketTagging(ctx, &s3.GetBucketTaggingInput{Bucket: bucket})
+	if err != nil || len(tags.TagSet) != 1 || aws.ToString(tags.TagSet[0].Value) != "a" {
+		t.Errorf("GetBucketTagging: got %v, %v, want team=a", tags, err)
+	}
+
+	_, err = s3c.PutBucketLifecycleConfiguration(ctx, &s3.PutBucketLifecycleConfigurationInput{
+		Bucket: bucket,
+		LifecycleConfiguration: &s3types.BucketLifecycleConfiguration{Rules: []s3types.LifecycleRule{{
+			ID:         aws.String("expire"),
+			Status:     s3types.ExpirationStatusEnabled,
+			Filter:     &s3types.LifecycleRuleFilterMemberPrefix{Value: "tmp/"},
+			Expiration: &s3types.LifecycleExpiration{Days: aws.Int32(7)},
+		}}},
+	})
+	if err != nil {
+		t.Fatalf("PutBucketLifecycleConfiguration: %v", err)
+	}
+	lifecycle, err := s3c.GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{Bucket: bucket})
+	if err != nil || len(lifecycle.Rules) != 1 || aws.ToInt32(lifecycle.Rules[0].Expiration.Days) != 7 {
+		t.Errorf("GetBucketLifecycleConfiguration: got %v, %v, want one rule expiring after 7 days", lifecycle, err)
+	}
+
+	_, err = s3c.PutBucketVersioning(ctx, &s3.PutBucketVersioningInput{
+		Bucket:                  bucket,
+		VersioningConfiguration: &s3types.VersioningConfiguration{Status: s3types.BucketVersioningStatusEnabled},
+	})
+	if err != nil {
+		t.Fatalf("PutBucketVersioning: %v", err)
+	}
+	versioning, err = s3c.GetBucketVersioning(ctx, &s3.GetBucketVersioningInput{Bucket: bucket})
+	if err != nil || versioning.Status != s3types.BucketVersioningStatusEnabled {
+		t.Errorf("GetBucketVersioning: got %v, %v, want Enabled", versioning, err)
+	}
+
+	// Subresources the server does not know are refused, not misrouted
+	_, err = s3c.GetBucketCors(ctx, &s3.GetBucketCorsInput{Bucket: bucket})
+	if errorCode(err) != "NotImplemented" {
+		t.Errorf("GetBucketCors: got %v, want NotImplemented", err)
+	}
+	_, err = s3c.PutBucketCors(ctx, &s3.PutBucketCorsInput{
+		Bucket: bucket,
+		CORSConfiguration: &s3types.CORSConfiguration{CORSRules: []s3types.CORSRule{{
+			AllowedMethods: []string{"GET"},
+			AllowedOrigins: []string{"*"},
+		}}},
+	})
+	if errorCode(err) != "NotImplemented" {
+		t.Errorf("PutBucketCors: got %v, want NotImplemented", err)
+	}
+}
+
+func TestS3ServerListAndDeleteObjects(t *testing.T) {
+	srv := NewS3Server()
+	defer srv.Close()
+	s3c := newClient(srv)
+	ctx := context.Background()
+	const bucket = "objects"
+
+	const count = 2500
+	for i := 0; i < count; i++ {
+		srv.PutObject(bucket, fmt.Sprintf("key-%04d", i), []byte("data"))
+	}
+
+	var keys []s3types.ObjectIdentifier
+	paginator := s3.NewListObjectsV2Paginator(s3c, &s3.ListObjectsV2Input{Bucket: aws.String(bucket)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			t.Fatalf("ListObjectsV2: %v", err)
+		}
+		for _, obj := range page.Contents {
+			keys = append(keys, s3types.ObjectIdentifier{Key: obj.Key})
+		}
+	}
+	if len(keys) != count {
+		t.Fatalf("listed %d objects, want %d", len(keys), count)
+	}
+
+	var versions int
+	versionPaginator := s3.NewListObjectVersionsPaginator(s3c, &s3.ListObjectVersionsInput{Bucket: aws.String(bucket)})
+	for versionPaginator.HasMorePages() {
+		page, err := versionPaginator.NextPage(ctx)
+		if err != nil {
+			t.Fatalf("ListObjectVersions: %v", err)
+		}
+		versions += len(page.Versions)
+	}
+	if versions != count {
+		t.Errorf("listed %d versions, want %d", versions, count)
+	}
+
+	for len(keys) > 0 {
+		n := min(len(keys), 1000)
+		_, err := s3c.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &s3types.Delete{Objects: keys[:n], Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			t.Fatalf("DeleteObjects: %v", err)
+		}
+		keys = keys[n:]
+	}
+	if left := srv.Objects(bucket); len(left) != 0 {
+		t.Fatalf("%d objects left after DeleteObjects, e.g. %s", len(left), strings.Join(left[:1], ""))
+	}
+	if _, err := s3c.DeleteBucket(ctx, &s3.DeleteBucketInput{Bucket: aws.String(bucket)}); err != nil {
+		t.Fatalf("DeleteBucket: %v", err)
+	}
+	if srv.BucketExists(bucket) {
+		t.Error("bucket still exists after DeleteBucket")
+	}
+}
+
+func TestS3ServerMultipartCopy(t *testing.T) {
+	srv := NewS3Server()
+	defer srv.Close()
+	srv.SetCopyLimit(10)
+	s3c := newClient(srv)
+	ctx := context.Background()
+	srv.PutObject("src", "obj", []byte("0123456789abcdefghij"))
+	srv.PutObject("dst", "placeholder", nil)
+
+	_, err := s3c.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket: aws.String("dst"), Key: aws.String("obj"), CopySource: aws.String("src/obj"),
+	})
+	if errorCode(err) != "InvalidRequest" {
+		t.Fatalf("CopyObject above the copy limit: got %v, want InvalidRequest", err)
+	}
+
+	upload, err := s3c.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{Bucket: aws.String("dst"), Key: aws.String("obj")})
+	if err != nil {
+		t.Fatalf("CreateMultipartUpload: %v", err)
+	}
+	var parts []s3types.CompletedPart
+	for i, r := range []string{"bytes=0-9", "bytes=10-19"} {
+		part, err := s3c.UploadPartCopy(ctx, &s3.UploadPartCopyInput{
+			Bucket: aws.String("dst"), Key: aws.String("obj"), UploadId: upload.UploadId,
+			PartNumber: aws.Int32(int32(i + 1)), CopySource: aws.String("src/obj"), CopySourceRange: aws.String(r),
+		})
+		if err != nil {
+			t.Fatalf("UploadPartCopy %s: %v", r, err)
+		}
+		parts = append(parts, s3types.CompletedPart{ETag: part.CopyPartResult.ETag, PartNumber: aws.Int32(int32(i + 1))})
+	}
+	if srv.Uploads() != 1 {
+		t.Errorf("%d uploads in progress, want 1", srv.Uploads())
+	}
+	_, err = s3c.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket: aws.String("dst"), Key: aws.String("obj"), UploadId: upload.UploadId,
+		MultipartUpload: &s3types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		t.Fatalf("CompleteMultipartUpload: %v", err)
+	}
+	obj, err := s3c.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String("dst"), Key: aws.String("obj")})
+	if err != nil {
+		t.Fatalf("GetObject: %v", err)
+	}
+	defer obj.Body.Close()
+	data, _ := io.ReadAll(obj.Body)
+	if string(data) != "0123456789abcdefghij" || !strings.HasSuffix(aws.ToString(obj.ETag), `-2"`) {
+		t.Errorf("assembled object %q with ETag %s, want the source with a 2-part ETag", data, aws.ToString(obj.ETag))
+	}
+
+	aborted, err := s3c.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{Bucket: aws.String("dst"), Key: aws.String("other")})
+	if err != nil {
+		t.Fatalf("CreateMultipartUpload: %v", err)
+	}
+	if _, err := s3c.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket: aws.String("dst"), Key: aws.String("other"), UploadId: aborted.UploadId,
+	}); err != nil {
+		t.Fatalf("AbortMultipartUpload: %v", err)
+	}
+	if srv.Uploads() != 0 {
+		t.Errorf("%d uploads in progress after completing and aborting, want 0", srv.Uploads())
+	}
+}
@@ -1,20 +1,28 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"os"
+	"time"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
 	"github.com/pamvdam71/quobject-controller/controllers"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+	"github.com/pamvdam71/quobject-controller/internal/logging"
+	"github.com/pamvdam71/quobject-controller/webhooks"
 )
 
 var (
@@ -31,6 +39,42 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var deleteWorkers int
+	var s3QPS float64
+	var s3Burst int
+	var usagePollInterval time.Duration
+	var verifyInterval time.Duration
+	var provisioningTimeout time.Duration
+	var s3OperationTimeout time.Duration
+	var logFormat string
+	var userAgentReconcileID bool
+	var enableWebhooks bool
+	var existingBucketCheck string
+	var bucketNamePolicy string
+	var bucketNameTruncation string
+	var recoverClaims bool
+	var detachOnly bool
+	var labelTags string
+	var usageReportInterval time.Duration
+	var usageReportLabel string
+	var metricsPushURL string
+	var metricsPushInterval time.Duration
+	var inventoryAddr string
+	var inventoryTokenFile string
+	var inventoryCertDir string
+	var backendCredentialsCheck bool
+	var webhookCertDir string
+	var webhookSelfSignedCert bool
+	var queueBaseDelay time.Duration
+	var queueMaxDelay time.Duration
+	var queueQPS float64
+	var queueBurst int
+	var throttleBaseDelay time.Duration
+	var throttleMaxDelay time.Duration
+	var shards int
+	var shardIndex int
+	var bucketLeases bool
+	var bucketLeaseDuration time.Duration
 
 	flag.StringVar(
 		&metricsAddr,
@@ -50,6 +94,224 @@ func main() {
 		false,
 		"Enable leader election for controller manager.",
 	)
+	flag.IntVar(
+		&deleteWorkers,
+		"delete-workers",
+		4,
+		"Number of parallel workers used to empty a bucket before deleting it.",
+	)
+	flag.Float64Var(
+		&s3QPS,
+		"s3-qps",
+		0,
+		"Maximum number of S3 requests per second across all backends (0 disables the limit).",
+	)
+	flag.IntVar(
+		&s3Burst,
+		"s3-burst",
+		10,
+		"Maximum burst of S3 requests allowed above s3-qps.",
+	)
+	flag.DurationVar(
+		&usagePollInterval,
+		"usage-poll-interval",
+		5*time.Minute,
+		"How often the object count and size of each bucket are measured (0 disables usage polling).",
+	)
+	flag.DurationVar(
+		&usageReportInterval,
+		"usage-report-interval",
+		0,
+		"How often the usage of all claims is aggregated into the quobject-usage-report ConfigMap (0 disables the report).",
+	)
+	flag.StringVar(
+		&usageReportLabel,
+		"usage-report-label",
+		"",
+		"Claim label, e.g. team, to aggregate the usage report by in addition to namespaces.",
+	)
+	flag.StringVar(
+		&metricsPushURL,
+		"metrics-push-url",
+		"",
+		"Prometheus Pushgateway URL to push the controller's metrics to, for clusters that don't scrape /metrics.",
+	)
+	flag.DurationVar(
+		&metricsPushInterval,
+		"metrics-push-interval",
+		time.Minute,
+		"How often metrics are pushed to --metrics-push-url.",
+	)
+	flag.StringVar(
+		&inventoryAddr,
+		"inventory-api-bind-address",
+		"",
+		"Address the read-only inventory API binds to, e.g. :8443. Empty disables it.",
+	)
+	flag.StringVar(
+		&inventoryTokenFile,
+		"inventory-api-token-file",
+		"",
+		"File with the bearer tokens accepted by the inventory API, one per line.",
+	)
+	flag.StringVar(
+		&inventoryCertDir,
+		"inventory-api-cert-dir",
+		"",
+		"Directory with tls.crt and tls.key for the inventory API. Empty serves plain HTTP.",
+	)
+	flag.DurationVar(
+		&verifyInterval,
+		"verify-interval",
+		10*time.Hour,
+		"How often each bucket and its generated resources are verified (0 relies on watch events only).",
+	)
+	flag.DurationVar(
+		&provisioningTimeout,
+		"provisioning-timeout",
+		0,
+		"How long a claim may take to bind before it is marked Failed and no longer retried (0 retries forever).",
+	)
+	flag.DurationVar(
+		&s3OperationTimeout,
+		"s3-operation-timeout",
+		0,
+		"Deadline of each S3 operation made for a claim, including retries; claims override it with spec.operationTimeout (0 disables).",
+	)
+	flag.StringVar(
+		&bucketNameTruncation,
+		"bucket-name-truncation",
+		"hash",
+		"How generated bucket names longer than 63 characters are handled: hash truncates them and appends a hash of the full name, reject fails the claim.",
+	)
+	flag.DurationVar(
+		&queueBaseDelay,
+		"queue-base-delay",
+		5*time.Millisecond,
+		"Initial requeue delay of a failing claim, doubled on every further failure.",
+	)
+	flag.DurationVar(
+		&queueMaxDelay,
+		"queue-max-delay",
+		1000*time.Second,
+		"Maximum requeue delay of a failing claim.",
+	)
+	flag.Float64Var(
+		&queueQPS,
+		"queue-qps",
+		10,
+		"Maximum rate of claim requeues per second across all claims.",
+	)
+	flag.IntVar(
+		&queueBurst,
+		"queue-burst",
+		100,
+		"Maximum burst of claim requeues allowed above queue-qps.",
+	)
+	flag.DurationVar(
+		&throttleBaseDelay,
+		"throttle-base-delay",
+		5*time.Second,
+		"Initial retry delay of a claim whose backend throttled it with SlowDown or 503 responses, doubled on every further throttled attempt. Other claims on the backend hold off as long.",
+	)
+	flag.DurationVar(
+		&throttleMaxDelay,
+		"throttle-max-delay",
+		5*time.Minute,
+		"Maximum retry delay of a throttled claim.",
+	)
+
+	flag.BoolVar(
+		&userAgentReconcileID,
+		"s3-user-agent-reconcile-id",
+		false,
+		"Append the reconcile ID to the user agent of S3 requests for tracing in backend audit logs.",
+	)
+	flag.BoolVar(
+		&enableWebhooks,
+		"enable-webhooks",
+		false,
+		"Serve the admission webhooks for QuObjectBucketClaims and backend secrets.",
+	)
+	flag.StringVar(
+		&existingBucketCheck,
+		"existing-bucket-check",
+		"off",
+		"How the webhook treats an explicit bucketName that already exists and is not tagged for adoption: "+
+			"off (no check), warn or deny.",
+	)
+	flag.StringVar(
+		&bucketNamePolicy,
+		"bucket-name-policy",
+		"allow",
+		"Whether the webhook admits an explicit bucketName: allow or deny. Namespaces override it with the quobject.io/bucket-name-policy annotation.",
+	)
+	flag.BoolVar(
+		&backendCredentialsCheck,
+		"backend-credentials-check",
+		false,
+		"Have the webhook check the credentials of backend secrets against the backend when they are applied.",
+	)
+	flag.StringVar(
+		&webhookCertDir,
+		"webhook-cert-dir",
+		"/tmp/k8s-webhook-server/serving-certs",
+		"Directory the webhook server reads tls.crt and tls.key from.",
+	)
+	flag.BoolVar(
+		&webhookSelfSignedCert,
+		"webhook-self-signed-cert",
+		false,
+		"Issue the webhook serving certificate from a self-signed CA and inject the CA bundle into the webhook configuration, instead of relying on cert-manager.",
+	)
+	flag.IntVar(
+		&shards,
+		"shards",
+		1,
+		"Number of controller replicas that split the claims between them, each with its own leader election.",
+	)
+	flag.IntVar(
+		&shardIndex,
+		"shard-index",
+		0,
+		"Shard served by this replica, from 0 to shards-1.",
+	)
+	flag.BoolVar(
+		&bucketLeases,
+		"bucket-leases",
+		false,
+		"Hold a Lease per bucket name while creating it, so replicas of different shards never create the same bucket concurrently.",
+	)
+	flag.DurationVar(
+		&bucketLeaseDuration,
+		"bucket-lease-duration",
+		30*time.Second,
+		"How long the bucket Lease of a crashed replica blocks other replicas.",
+	)
+	flag.StringVar(
+		&labelTags,
+		"label-tags",
+		"",
+		"Comma-separated claim labels copied to bucket tags, each optionally renamed with =<tag key>, e.g. team,cost-center=CostCenter.",
+	)
+	flag.BoolVar(
+		&recoverClaims,
+		"recover-claims",
+		false,
+		"On startup, recreate missing claims from the ownership markers of the backends' buckets, e.g. after a cluster loss.",
+	)
+	flag.BoolVar(
+		&detachOnly,
+		"detach-only",
+		false,
+		"Only remove the controller's finalizers from all claims and snapshots, never deleting or provisioning anything, so the controller can be uninstalled without deleting buckets.",
+	)
+	flag.StringVar(
+		&logFormat,
+		"log-format",
+		"text",
+		"Log output format, either text or json.",
+	)
 
 	opts := zap.Options{
 		Development: true,
@@ -57,7 +319,39 @@ func main() {
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 
-	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	switch logFormat {
+	case "text":
+	case "json":
+		opts.Development = false
+		zap.JSONEncoder()(&opts)
+	default:
+		// The logger is not set up yet
+		fmt.Fprintf(os.Stderr, "invalid --log-format %q: must be text or json\n", logFormat)
+		os.Exit(1)
+	}
+	// Credentials registered by the backends are scrubbed from every log line
+	ctrl.SetLogger(logging.NewRedactingLogger(zap.New(zap.UseFlagOptions(&opts))))
+
+	shard := controllers.Sharding{Count: shards, Index: shardIndex}
+	if err := shard.Validate(); err != nil {
+		setupLog.Error(err, "invalid flags")
+		os.Exit(1)
+	}
+	truncation, err := controllers.ParseBucketNameTruncation(bucketNameTruncation)
+	if err != nil {
+		setupLog.Error(err, "invalid flags")
+		os.Exit(1)
+	}
+	tags, err := controllers.ParseLabelTags(labelTags)
+	if err != nil {
+		setupLog.Error(err, "invalid flags")
+		os.Exit(1)
+	}
+	leaderElectionID := "quobject-controller.quobject.io"
+	if shard.Enabled() {
+		// Each shard elects its own leader
+		leaderElectionID = fmt.Sprintf("quobject-controller-shard-%d.quobject.io", shard.Index)
+	}
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme: scheme,
@@ -65,26 +359,250 @@ func main() {
 			BindAddress: metricsAddr,
 		},
 		WebhookServer: webhook.NewServer(webhook.Options{
-			Port: 9443,
+			Port:    9443,
+			CertDir: webhookCertDir,
 		}),
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "quobject-controller.quobject.io",
+		LeaderElectionID:       leaderElectionID,
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
+	metrics.Registry.MustRegister(controllers.NewClaimCollector(mgr.GetClient(), shard))
+
+	s3RateLimiter := backend.NewRateLimiter(s3QPS, s3Burst)
+	bucketLocks := &controllers.BucketLocks{}
+	if bucketLeases {
+		// Leases are read uncached so a takeover sees the latest holder
+		leaseClient, err := client.New(mgr.GetConfig(), client.Options{Scheme: mgr.GetScheme()})
+		if err != nil {
+			setupLog.Error(err, "unable to create lease client")
+			os.Exit(1)
+		}
+		identity, err := os.Hostname()
+		if err != nil {
+			setupLog.Error(err, "unable to determine lease identity")
+			os.Exit(1)
+		}
+		bucketLocks.Leases = leaseClient
+		bucketLocks.Namespace = backend.Namespace
+		bucketLocks.Identity = identity
+		bucketLocks.LeaseDuration = bucketLeaseDuration
+	}
 	reconciler := &controllers.QuObjectBucketClaimReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:               mgr.GetClient(),
+		Scheme:               mgr.GetScheme(),
+		DeleteWorkers:        deleteWorkers,
+		S3RateLimiter:        s3RateLimiter,
+		UsagePollInterval:    usagePollInterval,
+		VerifyInterval:       verifyInterval,
+		ProvisioningTimeout:  provisioningTimeout,
+		S3OperationTimeout:   s3OperationTimeout,
+		Recorder:             mgr.GetEventRecorderFor("quobject-controller"),
+		UserAgentReconcileID: userAgentReconcileID,
+		Shard:                shard,
+		QueueRateLimiter:     controllers.NewQueueRateLimiter(queueBaseDelay, queueMaxDelay, queueQPS, queueBurst),
+		BucketLocks:          bucketLocks,
+		BucketNameTruncation: truncation,
+		LabelTags:            tags,
+		Throttle:             &controllers.ThrottleBackoff{BaseDelay: throttleBaseDelay, MaxDelay: throttleMaxDelay},
+		DetachOnly:           detachOnly,
 	}
 	if err := reconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "QuObjectBucketClaim")
 		os.Exit(1)
 	}
 
+	snapshotReconciler := &controllers.QuObjectBucketSnapshotReconciler{
+		Client:        mgr.GetClient(),
+		DeleteWorkers: deleteWorkers,
+		S3RateLimiter: s3RateLimiter,
+		Recorder:      mgr.GetEventRecorderFor("quobject-controller"),
+		Shard:         shard,
+		DetachOnly:    detachOnly,
+	}
+	if err := snapshotReconciler.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "QuObjectBucketSnapshot")
+		os.Exit(1)
+	}
+
+	// Migrations, scheduled snapshots, quota accounting and backend rotation
+	// only run while the controller manages its claims
+	if !detachOnly {
+		migrationReconciler := &controllers.QuObjectBucketMigrationReconciler{
+			Client:        mgr.GetClient(),
+			DeleteWorkers: deleteWorkers,
+			S3RateLimiter: s3RateLimiter,
+			Recorder:      mgr.GetEventRecorderFor("quobject-controller"),
+			Shard:         shard,
+			BucketLocks:   bucketLocks,
+		}
+		if err := migrationReconciler.SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "QuObjectBucketMigration")
+			os.Exit(1)
+		}
+
+		scheduleReconciler := &controllers.QuObjectBucketSnapshotScheduleReconciler{
+			Client:   mgr.GetClient(),
+			Recorder: mgr.GetEventRecorderFor("quobject-controller"),
+			Shard:    shard,
+		}
+		if err := scheduleReconciler.SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "QuObjectBucketSnapshotSchedule")
+			os.Exit(1)
+		}
+
+		quotaReconciler := &controllers.QuObjectQuotaReconciler{
+			Client: mgr.GetClient(),
+			Shard:  shard,
+		}
+		if err := quotaReconciler.SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "QuObjectQuota")
+			os.Exit(1)
+		}
+	}
+
+	// Backends are shared by all shards and configured by the first one
+	if shard.Index == 0 && !detachOnly {
+		backendReconciler := &controllers.BackendReconciler{
+			Client:        mgr.GetClient(),
+			S3RateLimiter: s3RateLimiter,
+			Recorder:      mgr.GetEventRecorderFor("quobject-controller"),
+		}
+		if err := backendReconciler.SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "Backend")
+			os.Exit(1)
+		}
+	}
+
+	if enableWebhooks {
+		check, err := webhooks.ParseExistingBucketCheck(existingBucketCheck)
+		if err != nil {
+			setupLog.Error(err, "invalid flags")
+			os.Exit(1)
+		}
+		namePolicy, err := webhooks.ParseBucketNamePolicy(bucketNamePolicy)
+		if err != nil {
+			setupLog.Error(err, "invalid flags")
+			os.Exit(1)
+		}
+		validator := &webhooks.ClaimValidator{
+			Client:           mgr.GetClient(),
+			S3RateLimiter:    s3RateLimiter,
+			ExistingBucket:   check,
+			BucketNamePolicy: namePolicy,
+			Recorder:         mgr.GetEventRecorderFor("quobject-controller"),
+		}
+		if err := validator.SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "QuObjectBucketClaim")
+			os.Exit(1)
+		}
+		defaulter := &webhooks.ClaimDefaulter{Client: mgr.GetClient()}
+		if err := defaulter.SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "QuObjectBucketClaimDefaulter")
+			os.Exit(1)
+		}
+		backendValidator := &webhooks.BackendValidator{
+			Client:           mgr.GetClient(),
+			S3RateLimiter:    s3RateLimiter,
+			CheckCredentials: backendCredentialsCheck,
+		}
+		if err := backendValidator.SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Backend")
+			os.Exit(1)
+		}
+		if webhookSelfSignedCert {
+			// The webhook server needs the certificate before the manager's
+			// caches start
+			certClient, err := client.New(mgr.GetConfig(), client.Options{Scheme: mgr.GetScheme()})
+			if err != nil {
+				setupLog.Error(err, "unable to create webhook certificate client")
+				os.Exit(1)
+			}
+			certs := &webhooks.SelfSignedCert{
+				Client:                        certClient,
+				CertDir:                       webhookCertDir,
+				Namespace:                     backend.Namespace,
+				ServiceName:                   "quobject-controller-webhook",
+				SecretName:                    "quobject-controller-webhook-cert",
+				WebhookConfigurations:         []string{"quobject-controller-validating-webhook"},
+				MutatingWebhookConfigurations: []string{"quobject-controller-mutating-webhook"},
+			}
+			if err := certs.Ensure(ctrl.LoggerInto(context.Background(), setupLog)); err != nil {
+				setupLog.Error(err, "unable to provision webhook certificate")
+				os.Exit(1)
+			}
+			if err := mgr.Add(certs); err != nil {
+				setupLog.Error(err, "unable to add webhook certificate renewal")
+				os.Exit(1)
+			}
+		}
+	}
+
+	if usageReportInterval > 0 {
+		reporter := &controllers.UsageReporter{
+			Client:   mgr.GetClient(),
+			Interval: usageReportInterval,
+			Label:    usageReportLabel,
+			Shard:    shard,
+		}
+		if err := mgr.Add(reporter); err != nil {
+			setupLog.Error(err, "unable to set up usage report")
+			os.Exit(1)
+		}
+	}
+
+	if metricsPushURL != "" {
+		instance, err := os.Hostname()
+		if err != nil {
+			setupLog.Error(err, "unable to determine metrics push instance")
+			os.Exit(1)
+		}
+		pusher := &controllers.MetricsPusher{
+			URL:      metricsPushURL,
+			Job:      "quobject-controller",
+			Instance: instance,
+			Interval: metricsPushInterval,
+			Gatherer: metrics.Registry,
+		}
+		if err := mgr.Add(pusher); err != nil {
+			setupLog.Error(err, "unable to set up metrics push")
+			os.Exit(1)
+		}
+	}
+
+	if inventoryAddr != "" {
+		if inventoryTokenFile == "" {
+			setupLog.Error(fmt.Errorf("--inventory-api-token-file is required with --inventory-api-bind-address"), "invalid flags")
+			os.Exit(1)
+		}
+		inventory := &controllers.InventoryServer{
+			Client:    mgr.GetClient(),
+			Addr:      inventoryAddr,
+			TokenFile: inventoryTokenFile,
+			CertDir:   inventoryCertDir,
+		}
+		if err := mgr.Add(inventory); err != nil {
+			setupLog.Error(err, "unable to set up inventory API")
+			os.Exit(1)
+		}
+	}
+
+	if recoverClaims && !detachOnly {
+		recovery := &controllers.ClaimRecovery{
+			Client:        mgr.GetClient(),
+			S3RateLimiter: s3RateLimiter,
+			Shard:         shard,
+		}
+		if err := mgr.Add(recovery); err != nil {
+			setupLog.Error(err, "unable to set up claim recovery")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
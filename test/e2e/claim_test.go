@@ -0,0 +1,85 @@
+//go:build integration
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/testutil"
+)
+
+// TestClaimBindAndDelete drives a claim with retainPolicy Delete to Bound
+// against the in-memory S3 server and deletes it again, which must drain and
+// delete its bucket
+func TestClaimBindAndDelete(t *testing.T) {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		t.Skip("KUBEBUILDER_ASSETS is not set; install the envtest binaries with setup-envtest")
+	}
+	// A CA bundle from the environment cannot be added to the controller's
+	// own HTTP client
+	t.Setenv("AWS_CA_BUNDLE", "")
+	srv := testutil.NewS3Server()
+	defer srv.Close()
+
+	h, err := Start(Options{Backend: srv.BackendData()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := h.Stop(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	ctx := context.Background()
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "e2e"}}
+	if err := h.Client.Create(ctx, ns); err != nil {
+		t.Fatal(err)
+	}
+	claim := &quv1.QuObjectBucketClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: ns.Name},
+		Spec: quv1.QuObjectBucketClaimSpec{
+			BucketName:   "e2e-app",
+			RetainPolicy: quv1.RetainPolicyDelete,
+		},
+	}
+	if err := h.Client.Create(ctx, claim); err != nil {
+		t.Fatal(err)
+	}
+	key := types.NamespacedName{Namespace: claim.Namespace, Name: claim.Name}
+
+	claim, err = h.WaitForPhase(ctx, key, quv1.ClaimPhaseBound, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claim.Status.BucketName != "e2e-app" || !srv.BucketExists("e2e-app") {
+		t.Fatalf("claim bound to bucket %q, buckets on the server: %v", claim.Status.BucketName, srv.Buckets())
+	}
+	secret := &corev1.Secret{}
+	if err := h.Client.Get(ctx, types.NamespacedName{Namespace: ns.Name, Name: claim.Status.SecretRef}, secret); err != nil {
+		t.Fatalf("failed to get the claim's Secret %q: %v", claim.Status.SecretRef, err)
+	}
+
+	// More than one DeleteObjects batch
+	for i := 0; i < 1500; i++ {
+		srv.PutObject("e2e-app", fmt.Sprintf("data/%04d", i), []byte("payload"))
+	}
+	if err := h.Client.Delete(ctx, claim); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.WaitForDeletion(ctx, key, time.Minute); err != nil {
+		t.Fatalf("claim was not deleted: %v", err)
+	}
+	if srv.BucketExists("e2e-app") {
+		t.Errorf("bucket still exists with %d objects after the claim was deleted", len(srv.Objects("e2e-app")))
+	}
+}
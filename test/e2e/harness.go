@@ -0,0 +1,231 @@
+// Package e2e provides a reusable envtest-based harness that runs the
+// QuObjectBucketClaim controller against a real API server, so downstream
+// forks and platform teams can test their own policies against the
+// controller's behavior.
+//
+// The harness needs the envtest control plane binaries; point
+// KUBEBUILDER_ASSETS at them (e.g. with setup-envtest) before calling Start.
+//
+//	h, err := e2e.Start(e2e.Options{
+//		Backend: map[string]string{"endpoint": srv.URL, "region": "us-east-1", ...},
+//	})
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer h.Stop()
+//	claim, err := h.WaitForPhase(ctx, types.NamespacedName{...}, quv1.ClaimPhaseBound, time.Minute)
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/controllers"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+)
+
+// ControllerNamespace is the namespace the controller reads backend
+// credentials from
+const ControllerNamespace = backend.Namespace
+
+// CredentialsSecret is the name of the default backend credentials secret
+const CredentialsSecret = backend.DefaultSecretName
+
+// Options configure the harness
+type Options struct {
+	// CRDDirectoryPaths are installed into the API server. Defaults to the
+	// CRDs shipped with the controller.
+	CRDDirectoryPaths []string
+
+	// Backend is the data of the default credentials secret, e.g. endpoint,
+	// region, accessKey and secretKey pointing at a fake S3 provider. The
+	// secret is not created if Backend is nil.
+	Backend map[string]string
+
+	// ConfigureReconciler may adjust the reconciler before it is started,
+	// e.g. to set flags or wrap the client
+	ConfigureReconciler func(*controllers.QuObjectBucketClaimReconciler)
+}
+
+// Harness is a running API server with the controller manager attached
+type Harness struct {
+	Env    *envtest.Environment
+	Config *rest.Config
+	Scheme *kruntime.Scheme
+	// Client talks directly to the API server, bypassing the manager cache
+	Client  client.Client
+	Manager ctrl.Manager
+
+	cancel context.CancelFunc
+	done   chan error
+}
+
+// CRDDirectory returns the directory holding the controller's CRDs
+func CRDDirectory() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "..", "config", "crd", "bases")
+}
+
+// Start boots an API server, installs the CRDs, creates the controller
+// namespace and backend secret and starts the manager
+func Start(opts Options) (*Harness, error) {
+	if len(opts.CRDDirectoryPaths) == 0 {
+		opts.CRDDirectoryPaths = []string{CRDDirectory()}
+	}
+
+	scheme := kruntime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	if err := quv1.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+
+	env := &envtest.Environment{
+		CRDDirectoryPaths:     opts.CRDDirectoryPaths,
+		ErrorIfCRDPathMissing: true,
+	}
+	cfg, err := env.Start()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start envtest: %w", err)
+	}
+
+	h := &Harness{Env: env, Config: cfg, Scheme: scheme}
+	if err := h.setup(opts); err != nil {
+		env.Stop()
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *Harness) setup(opts Options) error {
+	var err error
+	h.Client, err = client.New(h.Config, client.Options{Scheme: h.Scheme})
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ControllerNamespace}}
+	if err := h.Client.Create(ctx, ns); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create controller namespace: %w", err)
+	}
+	if opts.Backend != nil {
+		if err := h.SetBackend(ctx, CredentialsSecret, opts.Backend); err != nil {
+			return err
+		}
+	}
+
+	h.Manager, err = ctrl.NewManager(h.Config, ctrl.Options{
+		Scheme:  h.Scheme,
+		Metrics: metricsserver.Options{BindAddress: "0"},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create manager: %w", err)
+	}
+
+	reconciler := &controllers.QuObjectBucketClaimReconciler{
+		Client:        h.Manager.GetClient(),
+		Scheme:        h.Manager.GetScheme(),
+		DeleteWorkers: 4,
+		Recorder:      h.Manager.GetEventRecorderFor("quobject-controller"),
+	}
+	if opts.ConfigureReconciler != nil {
+		opts.ConfigureReconciler(reconciler)
+	}
+	if err := reconciler.SetupWithManager(h.Manager); err != nil {
+		return fmt.Errorf("failed to set up controller: %w", err)
+	}
+
+	mgrCtx, cancel := context.WithCancel(context.Background())
+	h.cancel = cancel
+	h.done = make(chan error, 1)
+	go func() {
+		h.done <- h.Manager.Start(mgrCtx)
+	}()
+	return nil
+}
+
+// SetBackend creates or replaces a backend credentials secret in the
+// controller namespace
+func (h *Harness) SetBackend(ctx context.Context, name string, data map[string]string) error {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ControllerNamespace},
+		StringData: data,
+	}
+	err := h.Client.Create(ctx, secret)
+	if apierrors.IsAlreadyExists(err) {
+		err = h.Client.Update(ctx, secret)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write backend secret %s: %w", name, err)
+	}
+	return nil
+}
+
+// WaitForPhase polls the claim until it reaches the given phase or the
+// timeout expires
+func (h *Harness) WaitForPhase(
+	ctx context.Context,
+	key types.NamespacedName,
+	phase quv1.ClaimPhase,
+	timeout time.Duration,
+) (*quv1.QuObjectBucketClaim, error) {
+	claim := &quv1.QuObjectBucketClaim{}
+	err := wait.PollUntilContextTimeout(ctx, 250*time.Millisecond, timeout, true,
+		func(ctx context.Context) (bool, error) {
+			if err := h.Client.Get(ctx, key, claim); err != nil {
+				if apierrors.IsNotFound(err) {
+					return false, nil
+				}
+				return false, err
+			}
+			return claim.Status.Phase == phase, nil
+		})
+	if err != nil {
+		return claim, fmt.Errorf("claim %s did not reach phase %s (last phase %q): %w",
+			key, phase, claim.Status.Phase, err)
+	}
+	return claim, nil
+}
+
+// WaitForDeletion polls until the claim is gone, i.e. its finalizer has run
+func (h *Harness) WaitForDeletion(ctx context.Context, key types.NamespacedName, timeout time.Duration) error {
+	return wait.PollUntilContextTimeout(ctx, 250*time.Millisecond, timeout, true,
+		func(ctx context.Context) (bool, error) {
+			err := h.Client.Get(ctx, key, &quv1.QuObjectBucketClaim{})
+			if apierrors.IsNotFound(err) {
+				return true, nil
+			}
+			return false, err
+		})
+}
+
+// Stop shuts down the manager and the API server
+func (h *Harness) Stop() error {
+	if h.cancel != nil {
+		h.cancel()
+		if err := <-h.done; err != nil {
+			h.Env.Stop()
+			return fmt.Errorf("manager exited with error: %w", err)
+		}
+	}
+	return h.Env.Stop()
+}
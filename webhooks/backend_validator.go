@@ -0,0 +1,158 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+)
+
+// credentialsCheckTimeout bounds the connectivity check so admission stays
+// responsive when a backend is unreachable
+const credentialsCheckTimeout = 10 * time.Second
+
+// scalarSecretKeys are the single-value keys of backend secrets. Leading or
+// trailing whitespace in them, typically a newline from encoding the value
+// with echo, is silently misread or breaks request signatures.
+var scalarSecretKeys = []string{
+	"endpoint", "endpoints", "region", "accessKey", "secretKey",
+	"useSSL", "insecureSkipVerify", "forcePathStyle", "storageClasses",
+	"tlsMinVersion", "tlsCipherSuites", "clientCertSecret", "signatureVersion",
+	"useFIPSEndpoint", "useDualStackEndpoint",
+	"defaultRetainPolicy", "apiProfile", "stsEndpoint", "stsRoleArn",
+	"oidcIssuer", "oidcAudience", "oidcClaimName", "oidcRolePolicy",
+	"quobyteApiUrl", "quobyteApiUser", "quobyteApiPassword", "quobyteTenant",
+	"iamEndpoint", "rotationInterval", "rotationGracePeriod",
+}
+
+// BackendValidator validates backend credentials secrets at admission, so a
+// misconfigured backend is reported when it is applied rather than on the
+// first claim
+type BackendValidator struct {
+	Client        client.Reader
+	S3RateLimiter *rate.Limiter
+	// CheckCredentials lists the buckets of the backend with the secret's
+	// credentials. Rejected credentials deny the secret; an unreachable
+	// backend only produces a warning.
+	CheckCredentials bool
+}
+
+var _ admission.CustomValidator = &BackendValidator{}
+
+// SetupWithManager registers the validating webhook with the manager
+func (v *BackendValidator) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&corev1.Secret{}).
+		WithValidator(v).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate--v1-secret,mutating=false,failurePolicy=ignore,sideEffects=None,groups="",resources=secrets,verbs=create;update,versions=v1,name=vbackend.quobject.io,admissionReviewVersions=v1
+
+// ValidateCreate validates a new backend secret
+func (v *BackendValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		return nil, fmt.Errorf("expected a Secret but got %T", obj)
+	}
+	return v.validate(ctx, nil, secret)
+}
+
+// ValidateUpdate validates a changed backend secret
+func (v *BackendValidator) ValidateUpdate(
+	ctx context.Context,
+	oldObj, newObj runtime.Object,
+) (admission.Warnings, error) {
+	oldSecret, ok := oldObj.(*corev1.Secret)
+	if !ok {
+		return nil, fmt.Errorf("expected a Secret but got %T", oldObj)
+	}
+	secret, ok := newObj.(*corev1.Secret)
+	if !ok {
+		return nil, fmt.Errorf("expected a Secret but got %T", newObj)
+	}
+	return v.validate(ctx, oldSecret, secret)
+}
+
+// ValidateDelete allows all deletions
+func (v *BackendValidator) ValidateDelete(context.Context, runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *BackendValidator) validate(
+	ctx context.Context,
+	oldSecret, secret *corev1.Secret,
+) (admission.Warnings, error) {
+	// Only backend secrets are validated; the webhook configuration already
+	// restricts it to the controller's namespace
+	if secret.Namespace != backend.Namespace || !backend.IsSecretName(secret.Name) ||
+		!secret.DeletionTimestamp.IsZero() {
+		return nil, nil
+	}
+
+	for _, key := range scalarSecretKeys {
+		if value, ok := secret.Data[key]; ok && strings.TrimSpace(string(value)) != string(value) {
+			return nil, fmt.Errorf("key %s of backend secret %s has leading or trailing whitespace, "+
+				"e.g. a newline from echo; encode it with echo -n", key, secret.Name)
+		}
+	}
+
+	cfg, err := backend.ConfigFromSecret(secret)
+	var invalid *backend.InvalidSecretError
+	if errors.As(err, &invalid) && invalid.Missing && oldSecret != nil && len(oldSecret.Data[invalid.Key]) > 0 {
+		return nil, fmt.Errorf("the update removes key %s, which backend secret %s requires", invalid.Key, secret.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var warnings admission.Warnings
+	// The certificate secret may be applied after the backend secret
+	if cfg, err = backend.LoadClientCertificate(ctx, v.Client, cfg); err != nil {
+		return admission.Warnings{err.Error()}, nil
+	}
+	for _, e := range cfg.EndpointTemplates {
+		if cfg.UseSSL && strings.HasPrefix(e, "http://") {
+			warnings = append(warnings, fmt.Sprintf("endpoint %s is plain HTTP although useSSL is true", e))
+		}
+	}
+	if cfg.InsecureSkipVerify {
+		warnings = append(warnings, "insecureSkipVerify disables certificate verification of the backend")
+	}
+	if cfg.SignatureVersion == backend.SignatureV2 {
+		warnings = append(warnings, "signatureVersion v2 is deprecated; prefer v4 if the backend supports it")
+	}
+	if !v.CheckCredentials {
+		return warnings, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, credentialsCheckTimeout)
+	defer cancel()
+	s3c, err := backend.NewS3Client(cfg, v.S3RateLimiter)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s3c.ListBuckets(ctx, &s3.ListBucketsInput{})
+	var respErr *smithyhttp.ResponseError
+	if errors.As(err, &respErr) && respErr.HTTPStatusCode() == 403 {
+		return nil, fmt.Errorf("backend %s rejected the credentials: %w", cfg.Endpoint, err)
+	}
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to check backend credentials", "backend", secret.Name)
+		warnings = append(warnings, fmt.Sprintf("could not reach backend %s to check the credentials: %v", cfg.Endpoint, err))
+	}
+	return warnings, nil
+}
@@ -0,0 +1,339 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// annotationSelfSignedCert marks the webhook certificate secret as managed
+// by the controller, so that a secret issued by cert-manager is never
+// overwritten
+const annotationSelfSignedCert = "quobject.io/self-signed-webhook-cert"
+
+// Lifetimes of the self-signed certificates. The serving certificate is
+// renewed when less than certRenewBefore of it remains; the CA is kept, so
+// the CA bundle of the webhook configurations stays valid.
+const (
+	caValidity      = 10 * 365 * 24 * time.Hour
+	certValidity    = 365 * 24 * time.Hour
+	certRenewBefore = 30 * 24 * time.Hour
+	certCheckPeriod = 10 * time.Minute
+)
+
+//+kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=validatingwebhookconfigurations,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=mutatingwebhookconfigurations,verbs=get;list;watch;update;patch
+
+// SelfSignedCert issues the serving certificate of the webhooks from a CA of
+// its own and injects the CA into the webhook configurations, for clusters
+// without cert-manager. CA and certificate are kept in a secret shared by
+// all replicas.
+type SelfSignedCert struct {
+	// Client must not be cached, as the certificate is needed before the
+	// manager's caches start
+	Client client.Client
+	// CertDir is the directory the webhook server reads tls.crt and tls.key
+	// from
+	CertDir string
+	// Namespace and ServiceName address the webhook service the certificate
+	// is issued for
+	Namespace   string
+	ServiceName string
+	// SecretName is the secret holding the CA and the serving certificate
+	SecretName string
+	// WebhookConfigurations are the ValidatingWebhookConfigurations whose
+	// CA bundle is set
+	WebhookConfigurations []string
+	// MutatingWebhookConfigurations are the MutatingWebhookConfigurations
+	// whose CA bundle is set
+	MutatingWebhookConfigurations []string
+}
+
+// NeedLeaderElection makes every replica keep its certificate files current
+func (c *SelfSignedCert) NeedLeaderElection() bool {
+	return false
+}
+
+// Start renews the certificate and re-injects the CA bundle periodically
+// until ctx is done
+func (c *SelfSignedCert) Start(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("webhook-cert")
+	ticker := time.NewTicker(certCheckPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := c.Ensure(ctx); err != nil {
+				log.Error(err, "Failed to ensure webhook certificate")
+			}
+		}
+	}
+}
+
+// Ensure creates or renews the certificate secret, writes the serving
+// certificate to CertDir and sets the CA bundle of the webhook
+// configurations. It must succeed before the webhook server starts.
+func (c *SelfSignedCert) Ensure(ctx context.Context) error {
+	secret, err := c.ensureSecret(ctx)
+	if err != nil {
+		return err
+	}
+	if err := c.writeFiles(secret); err != nil {
+		return fmt.Errorf("failed to write webhook certificate: %w", err)
+	}
+	return c.injectCABundle(ctx, secret.Data["ca.crt"])
+}
+
+// ensureSecret returns the certificate secret, creating it or renewing its
+// serving certificate first if needed. Replicas racing to do so retry with
+// the winner's secret.
+func (c *SelfSignedCert) ensureSecret(ctx context.Context) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{Namespace: c.Namespace, Name: c.SecretName}
+	err := retry.OnError(retry.DefaultRetry, func(err error) bool {
+		return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)
+	}, func() error {
+		err := c.Client.Get(ctx, key, secret)
+		if apierrors.IsNotFound(err) {
+			secret = &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   c.Namespace,
+					Name:        c.SecretName,
+					Annotations: map[string]string{annotationSelfSignedCert: "true"},
+				},
+				Type: corev1.SecretTypeTLS,
+			}
+			if secret.Data, err = c.issue(nil, nil); err != nil {
+				return err
+			}
+			return c.Client.Create(ctx, secret)
+		} else if err != nil {
+			return err
+		}
+		if secret.Annotations[annotationSelfSignedCert] != "true" {
+			return fmt.Errorf("secret %s is not managed by the controller; delete it or disable self-signed webhook certificates", key)
+		}
+		if !needsRenewal(secret.Data["tls.crt"]) {
+			return nil
+		}
+		data, err := c.issue(secret.Data["ca.crt"], secret.Data["ca.key"])
+		if err != nil {
+			return err
+		}
+		secret.Data = data
+		log.FromContext(ctx).Info("Renewing webhook serving certificate", "secret", key)
+		return c.Client.Update(ctx, secret)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to ensure webhook certificate secret: %w", err)
+	}
+	return secret, nil
+}
+
+// needsRenewal reports whether a serving certificate is unreadable or
+// expires within certRenewBefore
+func needsRenewal(certPEM []byte) bool {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return true
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	return err != nil || time.Until(cert.NotAfter) < certRenewBefore
+}
+
+// issue returns the secret data with a serving certificate for the webhook
+// service, signed by the given CA. A missing or expiring CA is replaced.
+func (c *SelfSignedCert) issue(caCertPEM, caKeyPEM []byte) (map[string][]byte, error) {
+	caCert, caKey, err := parseCA(caCertPEM, caKeyPEM)
+	if err != nil || time.Until(caCert.NotAfter) < certValidity {
+		caKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		tmpl := &x509.Certificate{
+			SerialNumber:          serialNumber(),
+			Subject:               pkix.Name{CommonName: "quobject-controller-webhook-ca"},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(caValidity),
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &caKey.PublicKey, caKey)
+		if err != nil {
+			return nil, err
+		}
+		if caCert, err = x509.ParseCertificate(der); err != nil {
+			return nil, err
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	host := fmt.Sprintf("%s.%s.svc", c.ServiceName, c.Namespace)
+	tmpl := &x509.Certificate{
+		SerialNumber: serialNumber(),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host, host + ".cluster.local"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(certValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	caKeyDER, err := x509.MarshalECPrivateKey(caKey)
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]byte{
+		"ca.crt":  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caCert.Raw}),
+		"ca.key":  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: caKeyDER}),
+		"tls.crt": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		"tls.key": pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}, nil
+}
+
+func parseCA(certPEM, keyPEM []byte) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, nil, errors.New("CA key is not an ECDSA key")
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+func serialNumber() *big.Int {
+	n, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	return n
+}
+
+// writeFiles writes the serving certificate to CertDir if it changed. The
+// webhook server picks up replaced files without a restart.
+func (c *SelfSignedCert) writeFiles(secret *corev1.Secret) error {
+	if err := os.MkdirAll(c.CertDir, 0o700); err != nil {
+		return err
+	}
+	for _, name := range []string{"tls.key", "tls.crt"} {
+		path := filepath.Join(c.CertDir, name)
+		if current, err := os.ReadFile(path); err == nil && bytes.Equal(current, secret.Data[name]) {
+			continue
+		}
+		// Renaming replaces the file atomically for the reader
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, secret.Data[name], 0o600); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// injectCABundle sets the CA bundle of every webhook of the configurations.
+// Configurations that are not deployed yet are skipped and handled on a
+// later check.
+func (c *SelfSignedCert) injectCABundle(ctx context.Context, caBundle []byte) error {
+	for _, name := range c.WebhookConfigurations {
+		cfg := &admissionregistrationv1.ValidatingWebhookConfiguration{}
+		err := c.injectInto(ctx, name, cfg, caBundle, func() []*admissionregistrationv1.WebhookClientConfig {
+			clientConfigs := make([]*admissionregistrationv1.WebhookClientConfig, len(cfg.Webhooks))
+			for i := range cfg.Webhooks {
+				clientConfigs[i] = &cfg.Webhooks[i].ClientConfig
+			}
+			return clientConfigs
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, name := range c.MutatingWebhookConfigurations {
+		cfg := &admissionregistrationv1.MutatingWebhookConfiguration{}
+		err := c.injectInto(ctx, name, cfg, caBundle, func() []*admissionregistrationv1.WebhookClientConfig {
+			clientConfigs := make([]*admissionregistrationv1.WebhookClientConfig, len(cfg.Webhooks))
+			for i := range cfg.Webhooks {
+				clientConfigs[i] = &cfg.Webhooks[i].ClientConfig
+			}
+			return clientConfigs
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// injectInto sets the CA bundle of the client configs of the named webhook
+// configuration, which is read into cfg
+func (c *SelfSignedCert) injectInto(
+	ctx context.Context,
+	name string,
+	cfg client.Object,
+	caBundle []byte,
+	clientConfigs func() []*admissionregistrationv1.WebhookClientConfig,
+) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if err := c.Client.Get(ctx, types.NamespacedName{Name: name}, cfg); err != nil {
+			return err
+		}
+		changed := false
+		for _, cc := range clientConfigs() {
+			if !bytes.Equal(cc.CABundle, caBundle) {
+				cc.CABundle = caBundle
+				changed = true
+			}
+		}
+		if !changed {
+			return nil
+		}
+		return c.Client.Update(ctx, cfg)
+	})
+	if apierrors.IsNotFound(err) {
+		log.FromContext(ctx).Info("Webhook configuration not found; the CA bundle is injected once it exists",
+			"configuration", name)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to inject the CA bundle into %s: %w", name, err)
+	}
+	return nil
+}
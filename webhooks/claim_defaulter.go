@@ -0,0 +1,92 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+)
+
+// AnnotationBucketNamePrefix on a Namespace requires the bucket names of the
+// claims in it to start with its value, e.g. team-a-
+const AnnotationBucketNamePrefix = quv1.AnnotationBucketNamePrefix
+
+// ClaimDefaulter injects the bucket name prefix of the claim's namespace
+// into new claims at admission
+type ClaimDefaulter struct {
+	Client client.Reader
+}
+
+var _ admission.CustomDefaulter = &ClaimDefaulter{}
+
+// SetupWithManager registers the mutating webhook with the manager
+func (d *ClaimDefaulter) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&quv1.QuObjectBucketClaim{}).
+		WithDefaulter(d).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-quobject-io-v1alpha1-quobjectbucketclaim,mutating=true,failurePolicy=ignore,sideEffects=None,groups=quobject.io,resources=quobjectbucketclaims,verbs=create,versions=v1alpha1,name=mquobjectbucketclaim.quobject.io,admissionReviewVersions=v1
+
+// Default prefixes the generated bucket names of a new claim with the
+// namespace's bucket name prefix. Explicit bucket names are used verbatim,
+// so they are left to the validating webhook.
+func (d *ClaimDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	claim, ok := obj.(*quv1.QuObjectBucketClaim)
+	if !ok {
+		return fmt.Errorf("expected a QuObjectBucketClaim but got %T", obj)
+	}
+	if req, err := admission.RequestFromContext(ctx); err == nil && req.Operation != admissionv1.Create {
+		return nil
+	}
+	if claim.Spec.BucketName != "" {
+		return nil
+	}
+	ns := &corev1.Namespace{}
+	if err := d.Client.Get(ctx, client.ObjectKey{Name: claim.Namespace}, ns); err != nil {
+		return fmt.Errorf("failed to get the namespace of the claim: %w", err)
+	}
+	prefix, _ := bucketNamePrefix(ns)
+	if prefix == "" || strings.HasPrefix(generatedBucketName(claim), prefix) {
+		return nil
+	}
+	base := claim.Spec.GenerateBucketName
+	if base == "" {
+		base = claim.Name
+	}
+	claim.Spec.GenerateBucketName = prefix + base
+	return nil
+}
+
+// bucketNamePrefix returns the bucket name prefix required in the namespace,
+// if any. A malformed prefix is ignored with a warning.
+func bucketNamePrefix(ns *corev1.Namespace) (string, admission.Warnings) {
+	prefix, ok := quv1.BucketNamePrefix(ns.Annotations)
+	if !ok {
+		return "", admission.Warnings{fmt.Sprintf(
+			"ignoring the %s annotation of namespace %s: %q must be at most 40 lowercase letters, digits, dots and hyphens",
+			AnnotationBucketNamePrefix, ns.Name, ns.Annotations[AnnotationBucketNamePrefix])}
+	}
+	return prefix, nil
+}
+
+// generatedBucketName returns how the names the controller generates for
+// the claim start. They are the sanitized prefix followed by a hyphen and an
+// alphanumeric suffix, for which x stands in.
+func generatedBucketName(claim *quv1.QuObjectBucketClaim) string {
+	prefix := claim.Spec.GenerateBucketName
+	if prefix == "" {
+		prefix = claim.Namespace + "-" + claim.Name
+	}
+	return backend.SanitizeBucketName(prefix + "-x")
+}
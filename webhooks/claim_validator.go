@@ -0,0 +1,610 @@
+// Package webhooks contains the optional admission webhooks of the
+// controller. They are only registered when --enable-webhooks is set.
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+	"github.com/pamvdam71/quobject-controller/internal/backend"
+)
+
+// AdoptTag is the bucket tag that marks a pre-existing bucket as adoptable by
+// a claim with an explicit bucketName
+const AdoptTag = "quobject.io/adopt"
+
+// ExistingBucketCheck selects how admission treats an explicit bucketName
+// that already exists on the backend
+type ExistingBucketCheck string
+
+const (
+	// ExistingBucketOff skips the check
+	ExistingBucketOff ExistingBucketCheck = "off"
+	// ExistingBucketWarn admits the claim with a warning
+	ExistingBucketWarn ExistingBucketCheck = "warn"
+	// ExistingBucketDeny rejects the claim
+	ExistingBucketDeny ExistingBucketCheck = "deny"
+)
+
+// ParseExistingBucketCheck validates a --existing-bucket-check flag value
+func ParseExistingBucketCheck(s string) (ExistingBucketCheck, error) {
+	switch c := ExistingBucketCheck(s); c {
+	case ExistingBucketOff, ExistingBucketWarn, ExistingBucketDeny:
+		return c, nil
+	}
+	return "", fmt.Errorf("invalid existing bucket check %q: must be off, warn or deny", s)
+}
+
+// BucketNamePolicy selects whether claims may set an explicit bucketName
+type BucketNamePolicy string
+
+const (
+	// BucketNameAllow admits explicit bucket names
+	BucketNameAllow BucketNamePolicy = "allow"
+	// BucketNameDeny rejects explicit bucket names, so claims must use
+	// generated names
+	BucketNameDeny BucketNamePolicy = "deny"
+)
+
+// AnnotationBucketNamePolicy on a Namespace overrides the controller's
+// bucket name policy for the claims in it, e.g. to allow explicit names in
+// platform namespaces
+const AnnotationBucketNamePolicy = "quobject.io/bucket-name-policy"
+
+// ParseBucketNamePolicy validates a --bucket-name-policy flag value
+func ParseBucketNamePolicy(s string) (BucketNamePolicy, error) {
+	switch p := BucketNamePolicy(s); p {
+	case BucketNameAllow, BucketNameDeny:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid bucket name policy %q: must be allow or deny", s)
+}
+
+// ClaimValidator validates QuObjectBucketClaims at admission
+type ClaimValidator struct {
+	Client        client.Reader
+	S3RateLimiter *rate.Limiter
+	// ExistingBucket selects how claims for existing, non-adoptable buckets
+	// are treated. Empty skips the check.
+	ExistingBucket ExistingBucketCheck
+	// BucketNamePolicy is the policy for explicit bucket names in namespaces
+	// without the AnnotationBucketNamePolicy annotation
+	BucketNamePolicy BucketNamePolicy
+	// Recorder emits Events on claims whose update was denied. Nil only
+	// counts denials.
+	Recorder record.EventRecorder
+}
+
+var _ admission.CustomValidator = &ClaimValidator{}
+
+// SetupWithManager registers the validating webhook with the manager
+func (v *ClaimValidator) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&quv1.QuObjectBucketClaim{}).
+		WithValidator(v).
+		Complete()
+}
+
+//+kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+//+kubebuilder:rbac:groups=quobject.io,resources=quobjectquotas,verbs=get;list;watch
+
+// +kubebuilder:webhook:path=/validate-quobject-io-v1alpha1-quobjectbucketclaim,mutating=false,failurePolicy=fail,sideEffects=None,groups=quobject.io,resources=quobjectbucketclaims,verbs=create;update,versions=v1alpha1,name=vquobjectbucketclaim.quobject.io,admissionReviewVersions=v1
+
+// ValidateCreate validates a new claim
+func (v *ClaimValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	claim, ok := obj.(*quv1.QuObjectBucketClaim)
+	if !ok {
+		return nil, fmt.Errorf("expected a QuObjectBucketClaim but got %T", obj)
+	}
+	warnings, err := v.validate(ctx, nil, claim)
+	v.recordDenial("create", nil, claim, err)
+	return warnings, err
+}
+
+// ValidateUpdate validates a changed claim
+func (v *ClaimValidator) ValidateUpdate(
+	ctx context.Context,
+	oldObj, newObj runtime.Object,
+) (admission.Warnings, error) {
+	oldClaim, ok := oldObj.(*quv1.QuObjectBucketClaim)
+	if !ok {
+		return nil, fmt.Errorf("expected a QuObjectBucketClaim but got %T", oldObj)
+	}
+	claim, ok := newObj.(*quv1.QuObjectBucketClaim)
+	if !ok {
+		return nil, fmt.Errorf("expected a QuObjectBucketClaim but got %T", newObj)
+	}
+	warnings, err := v.validate(ctx, oldClaim, claim)
+	v.recordDenial("update", oldClaim, claim, err)
+	return warnings, err
+}
+
+// ValidateDelete allows all deletions
+func (v *ClaimValidator) ValidateDelete(context.Context, runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *ClaimValidator) validate(
+	ctx context.Context,
+	oldClaim, claim *quv1.QuObjectBucketClaim,
+) (admission.Warnings, error) {
+	// Updates by the controller while a claim is deleted must never be blocked
+	if !claim.DeletionTimestamp.IsZero() {
+		return nil, nil
+	}
+	claim, err := v.withClaimClass(ctx, oldClaim, claim)
+	if err != nil {
+		return nil, denied(denialClaimClass, err)
+	}
+	if err := validateResources(claim); err != nil {
+		return nil, err
+	}
+	if w := claim.Spec.WriteWindow; w != nil && w.Duration <= 0 {
+		return nil, errors.New("spec.writeWindow must be a positive duration")
+	}
+	if t := claim.Spec.OperationTimeout; t != nil && t.Duration < 0 {
+		return nil, errors.New("spec.operationTimeout must not be negative")
+	}
+	if err := validateLifecycleRules(claim); err != nil {
+		return nil, err
+	}
+	if e := claim.Spec.Encryption; e != nil && e.KMSKeyID != "" && e.Mode != quv1.EncryptionModeSSEKMS {
+		return nil, fmt.Errorf("spec.encryption.kmsKeyId requires spec.encryption.mode %s", quv1.EncryptionModeSSEKMS)
+	}
+	if claim.Spec.StoragePolicy != "" && claim.Spec.PlacementTarget == "" {
+		return nil, errors.New("spec.storagePolicy requires spec.placementTarget")
+	}
+	quobyteCfg, _, err := backend.ParseQuobyteConfig(claim.Spec.AdditionalConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid spec.additionalConfig: %w", err)
+	}
+	for field, name := range map[string]string{"spec.secretName": claim.Spec.SecretName, "spec.configMapName": claim.Spec.ConfigMapName} {
+		if name == "" {
+			continue
+		}
+		if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+			return nil, fmt.Errorf("%s %q is not a valid object name: %s", field, name, strings.Join(errs, ", "))
+		}
+	}
+	if value, ok := claim.Annotations[quv1.AnnotationShare]; ok {
+		if _, _, err := quv1.ParseShare(value); err != nil {
+			return nil, fmt.Errorf("invalid %s annotation: %w", quv1.AnnotationShare, err)
+		}
+	}
+	policyWarnings, err := v.checkBucketNamePolicy(ctx, oldClaim, claim)
+	if err != nil {
+		return nil, denied(denialBucketNamePolicy, err)
+	}
+	prefixWarnings, err := v.checkBucketNamePrefix(ctx, oldClaim, claim)
+	if err != nil {
+		return nil, denied(denialBucketNamePrefix, err)
+	}
+	policyWarnings = append(policyWarnings, prefixWarnings...)
+	if err := v.checkOutputNamespace(ctx, oldClaim, claim); err != nil {
+		return nil, denied(denialOutputNamespace, err)
+	}
+	if err := v.checkNamespaceQuotas(ctx, oldClaim, claim); err != nil {
+		return nil, denied(denialQuotaExceeded, err)
+	}
+
+	// Claims for a storage class without a backend would never provision.
+	// Existing claims keep their storage class admissible so they can still
+	// be updated after their backend was removed.
+	backendName, cfg, err := backend.Resolve(ctx, v.Client, claim.Spec.StorageClassName)
+	if errors.Is(err, backend.ErrNoBackend) {
+		if oldClaim != nil && oldClaim.Spec.StorageClassName == claim.Spec.StorageClassName {
+			return append(policyWarnings, err.Error()), nil
+		}
+		return nil, denied(denialNoBackend, err)
+	} else if err != nil {
+		return append(policyWarnings, fmt.Sprintf("could not resolve the backend of the claim: %v", err)), nil
+	}
+	if err := cfg.CheckTenantBucket(claim.Spec.BucketName); err != nil {
+		return nil, denied(denialBackendUnsupported, fmt.Errorf("invalid spec.bucketName: %w", err))
+	}
+	if len(claim.Spec.ServiceAccounts) > 0 && !cfg.Profile.MinIOAdmin {
+		return nil, denied(denialBackendUnsupported,
+			fmt.Errorf("spec.serviceAccounts requires a backend with the minio apiProfile, but %s has another profile", backendName))
+	}
+	if c := claim.Spec.Credentials; c != nil && c.Mode == quv1.CredentialsModeDedicated {
+		if claim.Spec.OutputMode == quv1.OutputModeCSI {
+			return nil, fmt.Errorf("spec.credentials.mode %s cannot be combined with spec.outputMode %s",
+				quv1.CredentialsModeDedicated, quv1.OutputModeCSI)
+		}
+		if !cfg.CanProvisionUsers() && !cfg.Quobyte.Enabled() {
+			return nil, denied(denialBackendUnsupported, fmt.Errorf(
+				"spec.credentials.mode %s requires a backend with the minio, rgw or aws apiProfile, "+
+					"an iamEndpoint or the Quobyte management API, but %s has none", quv1.CredentialsModeDedicated, backendName))
+		}
+	}
+	if claim.Spec.OutputMode == quv1.OutputModeCSI && cfg.Quobyte.Enabled() &&
+		(claim.Spec.Credentials == nil || claim.Spec.Credentials.Mode != quv1.CredentialsModeTemporary) {
+		return nil, denied(denialBackendUnsupported, fmt.Errorf(
+			"spec.outputMode %s requires spec.credentials.mode %s on backend %s: it issues each claim a Quobyte user "+
+				"whose keys are only kept in the claim's Secret", quv1.OutputModeCSI, quv1.CredentialsModeTemporary, backendName))
+	}
+	warnings := append(policyWarnings, bucketNameWarnings(claim)...)
+	if tenant, _ := backend.SplitTenantBucket(claim.Spec.BucketName); tenant != "" && tenant != cfg.RGWTenant {
+		warnings = append(warnings, fmt.Sprintf(
+			"spec.bucketName is in RGW tenant %s, but the keys of backend %s are not; the bucket must exist and allow them access",
+			tenant, backendName))
+	}
+	if !quobyteCfg.IsZero() && !cfg.Quobyte.Enabled() {
+		warnings = append(warnings, fmt.Sprintf(
+			"the quobyte.io keys of spec.additionalConfig are ignored: backend %s does not configure the Quobyte management API", backendName))
+	}
+	if claim.Spec.LocationHint != "" && !cfg.Profile.LocationHints {
+		warnings = append(warnings, fmt.Sprintf(
+			"spec.locationHint is ignored: backend %s has no apiProfile that supports placement", backendName))
+	}
+	if claim.Spec.PlacementTarget != "" && !cfg.Profile.PlacementTargets {
+		warnings = append(warnings, fmt.Sprintf(
+			"spec.placementTarget and spec.storagePolicy are ignored: backend %s does not have apiProfile rgw", backendName))
+	}
+	warnings = append(warnings, deprecationWarnings(claim)...)
+	existing, err := v.checkExistingBucket(ctx, oldClaim, claim, backendName, cfg)
+	return append(warnings, existing...), denied(denialBucketExists, err)
+}
+
+// checkBucketNamePolicy rejects a new or changed explicit bucketName in
+// namespaces whose policy is deny, which prevents claiming well-known names
+// on shared backends. Claims that already have their bucketName are left
+// alone so a stricter policy never blocks their updates.
+func (v *ClaimValidator) checkBucketNamePolicy(
+	ctx context.Context,
+	oldClaim, claim *quv1.QuObjectBucketClaim,
+) (admission.Warnings, error) {
+	bucket := claim.Spec.BucketName
+	if bucket == "" || (oldClaim != nil && oldClaim.Spec.BucketName == bucket) {
+		return nil, nil
+	}
+	policy := v.BucketNamePolicy
+	var warnings admission.Warnings
+	ns := &corev1.Namespace{}
+	if err := v.Client.Get(ctx, client.ObjectKey{Name: claim.Namespace}, ns); err != nil {
+		return nil, fmt.Errorf("failed to get the namespace of the claim: %w", err)
+	}
+	if value, ok := ns.Annotations[AnnotationBucketNamePolicy]; ok {
+		p, err := ParseBucketNamePolicy(value)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("ignoring the %s annotation of namespace %s: %v",
+				AnnotationBucketNamePolicy, claim.Namespace, err))
+		} else {
+			policy = p
+		}
+	}
+	if policy == BucketNameDeny {
+		return nil, fmt.Errorf("explicit bucket names are not allowed in namespace %s; remove spec.bucketName "+
+			"and use spec.generateBucketName instead", claim.Namespace)
+	}
+	return warnings, nil
+}
+
+// checkBucketNamePrefix rejects bucket names outside the prefix required in
+// the claim's namespace: a new or changed explicit bucketName, and the
+// generated names of a new claim, which the mutating webhook prefixes. Like
+// the bucket name policy, it never blocks claims that keep their names.
+func (v *ClaimValidator) checkBucketNamePrefix(
+	ctx context.Context,
+	oldClaim, claim *quv1.QuObjectBucketClaim,
+) (admission.Warnings, error) {
+	bucket := claim.Spec.BucketName
+	if bucket != "" && oldClaim != nil && oldClaim.Spec.BucketName == bucket {
+		return nil, nil
+	}
+	if bucket == "" && oldClaim != nil {
+		return nil, nil
+	}
+	ns := &corev1.Namespace{}
+	if err := v.Client.Get(ctx, client.ObjectKey{Name: claim.Namespace}, ns); err != nil {
+		return nil, fmt.Errorf("failed to get the namespace of the claim: %w", err)
+	}
+	prefix, warnings := bucketNamePrefix(ns)
+	if prefix == "" {
+		return warnings, nil
+	}
+	if bucket != "" {
+		// The prefix applies to the name within an RGW tenant
+		if _, name := backend.SplitTenantBucket(bucket); !strings.HasPrefix(name, prefix) {
+			return nil, fmt.Errorf("bucket names in namespace %s must start with %q, but spec.bucketName is %q",
+				claim.Namespace, prefix, bucket)
+		}
+		return warnings, nil
+	}
+	if !strings.HasPrefix(generatedBucketName(claim), prefix) {
+		base := claim.Spec.GenerateBucketName
+		if base == "" {
+			base = claim.Name
+		}
+		return nil, fmt.Errorf("bucket names in namespace %s must start with %q; set spec.generateBucketName to %s%s",
+			claim.Namespace, prefix, prefix, base)
+	}
+	return warnings, nil
+}
+
+// checkNamespaceQuotas rejects new claims and larger storage requests that
+// would exceed a QuObjectQuota of the claim's namespace
+func (v *ClaimValidator) checkNamespaceQuotas(ctx context.Context, oldClaim, claim *quv1.QuObjectBucketClaim) error {
+	var quotas quv1.QuObjectQuotaList
+	// Clusters without the QuObjectQuota CRD have no quotas
+	if err := v.Client.List(ctx, &quotas, client.InNamespace(claim.Namespace)); meta.IsNoMatchError(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to list the quotas of namespace %s: %w", claim.Namespace, err)
+	}
+	if len(quotas.Items) == 0 {
+		return nil
+	}
+	var claims quv1.QuObjectBucketClaimList
+	if err := v.Client.List(ctx, &claims, client.InNamespace(claim.Namespace)); err != nil {
+		return fmt.Errorf("failed to list the claims of namespace %s: %w", claim.Namespace, err)
+	}
+	others := slices.DeleteFunc(claims.Items, func(c quv1.QuObjectBucketClaim) bool {
+		return c.Name == claim.Name
+	})
+	for i := range quotas.Items {
+		if err := quv1.CheckQuota(&quotas.Items[i], others, oldClaim, claim); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withClaimClass rejects a new or changed spec.claimClassName naming a class
+// that does not exist, and returns the claim with the settings of its class
+// as the controller will apply them, so that they are validated too
+func (v *ClaimValidator) withClaimClass(
+	ctx context.Context,
+	oldClaim, claim *quv1.QuObjectBucketClaim,
+) (*quv1.QuObjectBucketClaim, error) {
+	name := claim.Spec.ClaimClassName
+	if name == "" || claim.Annotations[quv1.AnnotationClaimClassApplied] == name {
+		return claim, nil
+	}
+	class := &quv1.QuObjectBucketClaimClass{}
+	if err := v.Client.Get(ctx, client.ObjectKey{Name: name}, class); apierrors.IsNotFound(err) {
+		if oldClaim != nil && oldClaim.Spec.ClaimClassName == name {
+			return claim, nil
+		}
+		return nil, fmt.Errorf("spec.claimClassName %s does not exist", name)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get the claim class: %w", err)
+	}
+	claim = claim.DeepCopy()
+	quv1.ApplyClaimClass(claim, class)
+	return claim, nil
+}
+
+// checkOutputNamespace rejects a new or changed spec.outputNamespace unless
+// the target namespace accepts outputs from the claim's namespace, so claims
+// cannot plant Secrets in namespaces that did not opt in
+func (v *ClaimValidator) checkOutputNamespace(ctx context.Context, oldClaim, claim *quv1.QuObjectBucketClaim) error {
+	target := claim.Spec.OutputNamespace
+	if target == "" || target == claim.Namespace || (oldClaim != nil && oldClaim.Spec.OutputNamespace == target) {
+		return nil
+	}
+	if errs := validation.IsDNS1123Label(target); len(errs) > 0 {
+		return fmt.Errorf("spec.outputNamespace %q is not a valid namespace name: %s", target, strings.Join(errs, ", "))
+	}
+	ns := &corev1.Namespace{}
+	if err := v.Client.Get(ctx, client.ObjectKey{Name: target}, ns); apierrors.IsNotFound(err) {
+		return fmt.Errorf("spec.outputNamespace %s does not exist", target)
+	} else if err != nil {
+		return fmt.Errorf("failed to get the output namespace: %w", err)
+	}
+	if !quv1.AcceptsOutputsFrom(ns.Annotations, claim.Namespace) {
+		return fmt.Errorf("namespace %s does not accept outputs from namespace %s; a cluster administrator must add "+
+			"%s to its %s annotation", target, claim.Namespace, claim.Namespace, quv1.AnnotationAcceptOutputsFrom)
+	}
+	return nil
+}
+
+// bucketNameWarnings reports bucket names that are not legal as given. An
+// explicit name is used verbatim and rejected by the backend, while the
+// prefix of generated names is sanitized, so claims with different prefixes
+// may end up with the same one.
+func bucketNameWarnings(claim *quv1.QuObjectBucketClaim) admission.Warnings {
+	if name := claim.Spec.BucketName; name != "" {
+		if claim.Spec.BucketType == quv1.BucketTypeDirectory {
+			return nil
+		}
+		// The tenant of a qualified RGW name is checked with the backend
+		_, bucket := backend.SplitTenantBucket(name)
+		if backend.SanitizeBucketName(bucket) != bucket || len(bucket) < 3 || len(bucket) > 63 {
+			return admission.Warnings{fmt.Sprintf(
+				"spec.bucketName %q is not a legal S3 bucket name and will likely be rejected by the backend", name)}
+		}
+		return nil
+	}
+	field, prefix := "spec.generateBucketName", claim.Spec.GenerateBucketName
+	if prefix == "" {
+		field, prefix = "the namespace and name", claim.Namespace+"-"+claim.Name
+	}
+	if sanitized := backend.SanitizeBucketName(prefix); sanitized != prefix {
+		return admission.Warnings{fmt.Sprintf(
+			"%s %q is not a legal bucket name prefix; generated bucket names start with %q instead", field, prefix, sanitized)}
+	}
+	return nil
+}
+
+// deprecationWarnings guides users of legacy fields to their replacements.
+// Legacy fields keep working, so they are never denied.
+func deprecationWarnings(claim *quv1.QuObjectBucketClaim) admission.Warnings {
+	var warnings admission.Warnings
+	// The Quobyte keys are interpreted and validated by validate
+	if _, keys, _ := backend.ParseQuobyteConfig(claim.Spec.AdditionalConfig); len(keys) > 0 {
+		warnings = append(warnings, fmt.Sprintf(
+			"spec.additionalConfig is deprecated and its keys (%s) are ignored by the controller; use the structured spec fields instead",
+			strings.Join(keys, ", ")))
+	}
+	if quota := claim.Spec.Quota; quota != nil && quota.MaxSize != nil {
+		warnings = append(warnings, "spec.quota.maxSize is deprecated; use spec.resources.requests.storage instead")
+	}
+	return warnings
+}
+
+// validateResources rejects requests for resources other than storage, and
+// a storage request that contradicts the legacy spec.quota.maxSize
+func validateResources(claim *quv1.QuObjectBucketClaim) error {
+	if claim.Spec.Resources == nil {
+		return nil
+	}
+	for name := range claim.Spec.Resources.Requests {
+		if name != corev1.ResourceStorage {
+			return fmt.Errorf("spec.resources.requests.%s is not supported; only storage can be requested", name)
+		}
+	}
+	storage, ok := claim.Spec.Resources.Requests[corev1.ResourceStorage]
+	if quota := claim.Spec.Quota; ok && quota != nil && quota.MaxSize != nil && storage.Cmp(*quota.MaxSize) != 0 {
+		return fmt.Errorf("spec.resources.requests.storage (%s) and the deprecated spec.quota.maxSize (%s) disagree; remove spec.quota",
+			storage.String(), quota.MaxSize.String())
+	}
+	return nil
+}
+
+// validateLifecycleRules rejects lifecycle rules without an action, rules
+// that share an ID, and noncurrent version expiration on directory buckets,
+// which are not versioned
+func validateLifecycleRules(claim *quv1.QuObjectBucketClaim) error {
+	ids := map[string]bool{}
+	for i, rule := range claim.Spec.LifecycleRules {
+		id := rule.ID
+		if id == "" {
+			id = strconv.Itoa(i)
+		}
+		if ids[id] {
+			return fmt.Errorf("spec.lifecycleRules[%d]: duplicate id %q", i, id)
+		}
+		ids[id] = true
+		if rule.ExpirationDays == nil && rule.NoncurrentVersionExpirationDays == nil && rule.AbortIncompleteMultipartUploadDays == nil {
+			return fmt.Errorf("spec.lifecycleRules[%d]: one of expirationDays, noncurrentVersionExpirationDays "+
+				"and abortIncompleteMultipartUploadDays is required", i)
+		}
+		if rule.NoncurrentVersionExpirationDays != nil && claim.Spec.BucketType == quv1.BucketTypeDirectory {
+			return fmt.Errorf("spec.lifecycleRules[%d]: directory buckets have no noncurrent versions to expire", i)
+		}
+	}
+	return nil
+}
+
+// checkExistingBucket guards against taking over someone else's bucket with
+// an explicit bucketName. Backend errors only produce warnings so that an
+// unreachable backend never blocks admission.
+func (v *ClaimValidator) checkExistingBucket(
+	ctx context.Context,
+	oldClaim, claim *quv1.QuObjectBucketClaim,
+	backendName string,
+	cfg backend.Config,
+) (admission.Warnings, error) {
+	bucket := claim.Spec.BucketName
+	if v.ExistingBucket == ExistingBucketOff || v.ExistingBucket == "" || bucket == "" ||
+		claim.Spec.BucketType == quv1.BucketTypeDirectory {
+		return nil, nil
+	}
+	// The claim already owns the bucket it keeps referring to
+	if oldClaim != nil && (oldClaim.Spec.BucketName == bucket || oldClaim.Status.BucketName == bucket) {
+		return nil, nil
+	}
+
+	s3c, err := backend.NewS3Client(cfg.ForRegion(claim.Spec.Region), v.S3RateLimiter)
+	if err != nil {
+		return admission.Warnings{fmt.Sprintf("could not check whether bucket %s exists: %v", bucket, err)}, nil
+	}
+
+	exists, adoptable, err := bucketAdoptable(ctx, s3c, bucket, claim)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to check for existing bucket", "bucket", bucket, "backend", backendName)
+		return admission.Warnings{fmt.Sprintf("could not check whether bucket %s exists: %v", bucket, err)}, nil
+	}
+	if !exists || adoptable {
+		return nil, nil
+	}
+
+	msg := fmt.Sprintf("bucket %s already exists and is not tagged %s=true for adoption", bucket, AdoptTag)
+	if v.ExistingBucket == ExistingBucketDeny {
+		return nil, errors.New(msg)
+	}
+	return admission.Warnings{msg}, nil
+}
+
+// bucketAdoptable reports whether the bucket exists and, if so, whether it
+// carries the adoption tag or an ownership marker naming the claim, as
+// after a disaster recovery. A bucket that exists but is not accessible with
+// the backend credentials belongs to someone else and is never adoptable.
+func bucketAdoptable(
+	ctx context.Context,
+	s3c *s3.Client,
+	bucket string,
+	claim *quv1.QuObjectBucketClaim,
+) (exists, adoptable bool, err error) {
+	_, err = s3c.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucket)})
+	var respErr *smithyhttp.ResponseError
+	if errors.As(err, &respErr) {
+		switch respErr.HTTPStatusCode() {
+		case 404:
+			return false, false, nil
+		case 403:
+			return true, false, nil
+		}
+	}
+	if err != nil {
+		return false, false, err
+	}
+
+	if ownedByClaim(ctx, s3c, bucket, claim) {
+		return true, true, nil
+	}
+	tagging, err := s3c.GetBucketTagging(ctx, &s3.GetBucketTaggingInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		// Buckets without tags report NoSuchTagSet
+		return true, false, nil
+	}
+	for _, tag := range tagging.TagSet {
+		if aws.ToString(tag.Key) == AdoptTag && aws.ToString(tag.Value) == "true" {
+			return true, true, nil
+		}
+	}
+	return true, false, nil
+}
+
+// ownedByClaim reports whether the ownership marker of the bucket names a
+// claim with the namespace and name of claim
+func ownedByClaim(ctx context.Context, s3c *s3.Client, bucket string, claim *quv1.QuObjectBucketClaim) bool {
+	obj, err := s3c.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(backend.OwnerMarkerKey),
+	})
+	if err != nil {
+		return false
+	}
+	defer obj.Body.Close()
+	var owner struct {
+		Namespace string `json:"namespace"`
+		Name      string `json:"name"`
+	}
+	if err := json.NewDecoder(obj.Body).Decode(&owner); err != nil {
+		return false
+	}
+	return owner.Namespace == claim.Namespace && owner.Name == claim.Name
+}
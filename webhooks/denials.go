@@ -0,0 +1,87 @@
+package webhooks
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	quv1 "github.com/pamvdam71/quobject-controller/api/v1alpha1"
+)
+
+// Reasons for denying a claim at admission, the reason label of
+// quobject_webhook_claim_denials_total
+const (
+	denialInvalidSpec        = "InvalidSpec"
+	denialClaimClass         = "ClaimClass"
+	denialBucketNamePolicy   = "BucketNamePolicy"
+	denialBucketNamePrefix   = "BucketNamePrefix"
+	denialOutputNamespace    = "OutputNamespace"
+	denialQuotaExceeded      = "QuotaExceeded"
+	denialNoBackend          = "NoBackend"
+	denialBackendUnsupported = "BackendUnsupported"
+	denialBucketExists       = "BucketExists"
+)
+
+// reasonAdmissionDenied is the Event reason of a denied update of a claim
+const reasonAdmissionDenied = "AdmissionDenied"
+
+var claimDenials = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "quobject_webhook_claim_denials_total",
+		Help: "Number of QuObjectBucketClaim creates and updates denied by the admission webhook, by reason",
+	},
+	[]string{"reason", "operation", "namespace"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(claimDenials)
+}
+
+// denialError is an admission denial with the reason it is counted under
+type denialError struct {
+	reason string
+	err    error
+}
+
+func (e *denialError) Error() string {
+	return e.err.Error()
+}
+
+func (e *denialError) Unwrap() error {
+	return e.err
+}
+
+// denied attributes a denial to a reason. A nil err stays nil.
+func denied(reason string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &denialError{reason: reason, err: err}
+}
+
+// denialReason returns the reason of a denial. Denials without one are
+// invalid specs.
+func denialReason(err error) string {
+	var d *denialError
+	if errors.As(err, &d) {
+		return d.reason
+	}
+	return denialInvalidSpec
+}
+
+// recordDenial counts a denied create or update of a claim and, for
+// updates, records a Warning Event on the stored claim, whose owner may not
+// be the one who sent the update. New claims do not exist to carry an Event.
+func (v *ClaimValidator) recordDenial(operation string, oldClaim, claim *quv1.QuObjectBucketClaim, err error) {
+	if err == nil {
+		return
+	}
+	reason := denialReason(err)
+	claimDenials.WithLabelValues(reason, operation, claim.Namespace).Inc()
+	if oldClaim != nil && v.Recorder != nil {
+		v.Recorder.Eventf(oldClaim, corev1.EventTypeWarning, reasonAdmissionDenied,
+			"Update denied (%s): %v", reason, err)
+	}
+}